@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"os/signal"
@@ -9,12 +10,17 @@ import (
 	"github.com/mikey/llm-spam-filter/internal/core"
 	"github.com/mikey/llm-spam-filter/internal/di"
 	"github.com/mikey/llm-spam-filter/internal/ports"
+	"github.com/mikey/llm-spam-filter/internal/prompt"
 	"go.uber.org/zap"
 )
 
 func main() {
+	// Parse command line flags
+	configPath := flag.String("config", "", "Path to config file (overrides SPAM_FILTER_CONFIG)")
+	flag.Parse()
+
 	// Build the dependency injection container
-	container, err := di.BuildContainer()
+	container, err := di.BuildContainer(*configPath)
 	if err != nil {
 		fmt.Printf("Failed to build dependency container: %v\n", err)
 		os.Exit(1)
@@ -31,8 +37,14 @@ func main() {
 func run(
 	logger *zap.Logger,
 	emailFilter ports.EmailFilter,
+	service *core.SpamFilterService,
 	llmClient core.LLMClient,
 	cacheRepo core.CacheRepository,
+	scoreRecorder core.ScoreRecorder,
+	reputationStore core.ReputationStore,
+	digestStore core.DigestStore,
+	errorSamples *prompt.ErrorSamples,
+	latencyRecorder core.LatencyRecorder,
 ) error {
 	defer logger.Sync()
 
@@ -42,11 +54,20 @@ func run(
 		return err
 	}
 
-	// Handle graceful shutdown
+	// Handle graceful shutdown, toggling the kill switch on SIGUSR1 and
+	// logging unparseable responses on SIGUSR2
 	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR1, syscall.SIGUSR2)
 
-	<-sigCh
+	for sig := range sigCh {
+		if sig == syscall.SIGUSR1 {
+			service.SetLLMDisabled(!service.LLMDisabled())
+		} else if sig == syscall.SIGUSR2 {
+			logErrorSamples(logger, errorSamples)
+		} else {
+			break
+		}
+	}
 	logger.Info("Shutting down...")
 
 	// Stop the filter
@@ -66,6 +87,46 @@ func run(
 		stopper.Stop()
 	}
 
+	// Stop the score histogram if needed
+	if stopper, ok := scoreRecorder.(interface{ Stop() }); ok {
+		stopper.Stop()
+	}
+
+	// Stop the latency tracker if needed
+	if stopper, ok := latencyRecorder.(interface{ Stop() }); ok {
+		stopper.Stop()
+	}
+
+	// Stop the reputation store if needed
+	if stopper, ok := reputationStore.(interface{ Stop() }); ok {
+		stopper.Stop()
+	}
+
+	// Close the digest store if needed
+	if closer, ok := digestStore.(interface{ Close() error }); ok {
+		if err := closer.Close(); err != nil {
+			logger.Error("Failed to close digest store", zap.Error(err))
+		}
+	}
+
 	logger.Info("Shutdown complete")
 	return nil
 }
+
+// logErrorSamples logs the recent model responses that could not be parsed,
+// oldest first
+func logErrorSamples(logger *zap.Logger, errorSamples *prompt.ErrorSamples) {
+	if errorSamples == nil {
+		logger.Info("Not recording unparseable responses, set llm.error_samples")
+		return
+	}
+
+	samples := errorSamples.Samples()
+	logger.Info("Logging unparseable responses", zap.Int("samples", len(samples)))
+	for _, sample := range samples {
+		logger.Info("Unparseable response",
+			zap.Time("time", sample.Time),
+			zap.String("error", sample.Error),
+			zap.String("response", sample.Response))
+	}
+}
@@ -3,15 +3,22 @@ package main
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/mail"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/mikey/llm-spam-filter/internal/config"
 	"github.com/mikey/llm-spam-filter/internal/core"
 	"github.com/mikey/llm-spam-filter/internal/di"
+	"github.com/mikey/llm-spam-filter/internal/factory"
+	"github.com/mikey/llm-spam-filter/internal/loadtest"
 	"github.com/mikey/llm-spam-filter/internal/ports"
+	"github.com/mikey/llm-spam-filter/internal/utils"
 	"go.uber.org/zap"
 )
 
@@ -26,6 +33,42 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Record feedback instead of analyzing if requested
+	if flags.Feedback != "" {
+		if err := container.Invoke(runFeedback); err != nil {
+			fmt.Printf("Application error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Print the digest of rejected spam instead of analyzing if requested
+	if flags.Digest {
+		if err := container.Invoke(runDigest); err != nil {
+			fmt.Printf("Application error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Train the Bayesian classifier instead of analyzing if requested
+	if flags.TrainSpam != "" || flags.TrainHam != "" {
+		if err := container.Invoke(runTrain); err != nil {
+			fmt.Printf("Application error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Replay a fixture directory instead of analyzing a single email if requested
+	if flags.LoadTest != "" {
+		if err := container.Invoke(runLoadTest); err != nil {
+			fmt.Printf("Application error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Run the application
 	if err := container.Invoke(run); err != nil {
 		fmt.Printf("Application error: %v\n", err)
@@ -38,6 +81,7 @@ func run(
 	logger *zap.Logger,
 	emailFilter ports.EmailFilter,
 	llmClient core.LLMClient,
+	cfg *config.Config,
 	flags *di.CLIFlags,
 ) error {
 	defer logger.Sync()
@@ -45,10 +89,25 @@ func run(
 	// Read email from file or stdin
 	email := readEmail(logger, flags.InputFile)
 
-	// Process the email
+	// Apply the overall deadline, independent of any provider-level timeouts
+	timeout, err := cfg.GetDuration("cli.timeout")
+	if err != nil {
+		return fmt.Errorf("invalid cli timeout: %w", err)
+	}
 	ctx := context.Background()
-	_, err := emailFilter.ProcessEmail(ctx, email)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// Process the email
+	_, err = emailFilter.ProcessEmail(ctx, email)
 	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			logger.Error("Analysis timed out", zap.Duration("timeout", timeout))
+			return fmt.Errorf("analysis timed out after %v", timeout)
+		}
 		logger.Error("Failed to process email", zap.Error(err))
 		return err
 	}
@@ -63,6 +122,201 @@ func run(
 	return nil
 }
 
+// runLoadTest replays a fixture directory of emails through the spam filter
+// service and reports throughput, latency percentiles and the error rate
+func runLoadTest(
+	logger *zap.Logger,
+	service *core.SpamFilterService,
+	llmClient core.LLMClient,
+	cfg *config.Config,
+	flags *di.CLIFlags,
+) error {
+	defer logger.Sync()
+
+	emails, err := loadEmails(flags.LoadTest)
+	if err != nil {
+		return err
+	}
+
+	timeout, err := cfg.GetDuration("cli.timeout")
+	if err != nil {
+		return fmt.Errorf("invalid cli timeout: %w", err)
+	}
+
+	logger.Info("Starting load test",
+		zap.String("directory", flags.LoadTest),
+		zap.Int("emails", len(emails)),
+		zap.Int("concurrency", flags.Concurrency),
+		zap.Float64("rate", flags.Rate),
+		zap.Duration("duration", flags.Duration))
+
+	runner := loadtest.NewRunner(service, loadtest.Options{
+		Concurrency: flags.Concurrency,
+		Rate:        flags.Rate,
+		Duration:    flags.Duration,
+		Timeout:     timeout,
+	}, logger)
+	report, err := runner.Run(context.Background(), emails)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("=== Load Test Results ===")
+	fmt.Print(report.String())
+
+	// Close any resources that need closing
+	if closer, ok := llmClient.(interface{ Close() error }); ok {
+		if err := closer.Close(); err != nil {
+			logger.Error("Failed to close LLM client", zap.Error(err))
+		}
+	}
+
+	return nil
+}
+
+// loadEmails parses every regular file in a directory as an email
+func loadEmails(dir string) ([]*core.Email, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture directory: %w", err)
+	}
+
+	var emails []*core.Email
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", path, err)
+		}
+		email, err := parseEmail(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		emails = append(emails, email)
+	}
+
+	if len(emails) == 0 {
+		return nil, fmt.Errorf("no emails found in %s", dir)
+	}
+	return emails, nil
+}
+
+// runFeedback records a verdict correction for a message or sender
+func runFeedback(
+	logger *zap.Logger,
+	feedbackService *core.FeedbackService,
+	flags *di.CLIFlags,
+) error {
+	defer logger.Sync()
+
+	var isSpam bool
+	switch strings.ToLower(flags.Feedback) {
+	case "spam":
+		isSpam = true
+	case "ham":
+		isSpam = false
+	default:
+		return fmt.Errorf("invalid feedback label %q, expected spam or ham", flags.Feedback)
+	}
+
+	var recipients []string
+	for _, recipient := range strings.Split(flags.FeedbackRecipients, ",") {
+		if recipient = strings.TrimSpace(recipient); recipient != "" {
+			recipients = append(recipients, recipient)
+		}
+	}
+
+	if err := feedbackService.Submit(context.Background(), flags.FeedbackID, recipients, isSpam); err != nil {
+		logger.Error("Failed to submit feedback", zap.Error(err))
+		return err
+	}
+
+	fmt.Printf("Recorded feedback for %s: %s\n", flags.FeedbackID, strings.ToLower(flags.Feedback))
+	return nil
+}
+
+// runDigest prints a summary of the spam rejected within the digest window
+// and prunes entries older than the retention period
+func runDigest(
+	logger *zap.Logger,
+	digestStore core.DigestStore,
+	digestFactory *factory.DigestFactory,
+	flags *di.CLIFlags,
+) error {
+	defer logger.Sync()
+
+	if digestStore == nil {
+		return fmt.Errorf("digest is disabled, set digest.enabled to record rejected spam")
+	}
+	if closer, ok := digestStore.(interface{ Close() error }); ok {
+		defer closer.Close()
+	}
+
+	ctx := context.Background()
+	since := time.Now().Add(-flags.DigestSince)
+	entries, err := digestStore.List(ctx, since)
+	if err != nil {
+		return err
+	}
+	fmt.Print(core.FormatDigest(entries, since))
+
+	retention, err := digestFactory.GetRetention()
+	if err != nil {
+		return err
+	}
+	if retention > 0 {
+		if err := digestStore.Prune(ctx, time.Now().Add(-retention)); err != nil {
+			logger.Error("Failed to prune digest", zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// runTrain trains the Bayesian classifier on directories of spam and ham
+func runTrain(
+	logger *zap.Logger,
+	classifier core.BayesClassifier,
+	flags *di.CLIFlags,
+) error {
+	defer logger.Sync()
+
+	if classifier == nil {
+		return fmt.Errorf("bayesian classifier is disabled, set bayes.enabled to train it")
+	}
+	if closer, ok := classifier.(interface{ Close() error }); ok {
+		defer closer.Close()
+	}
+
+	ctx := context.Background()
+	for _, corpus := range []struct {
+		dir    string
+		isSpam bool
+		label  string
+	}{
+		{flags.TrainSpam, true, "spam"},
+		{flags.TrainHam, false, "ham"},
+	} {
+		if corpus.dir == "" {
+			continue
+		}
+		emails, err := loadEmails(corpus.dir)
+		if err != nil {
+			return err
+		}
+		for _, email := range emails {
+			if err := classifier.Train(ctx, email, corpus.isSpam); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("Trained on %d %s messages from %s\n", len(emails), corpus.label, corpus.dir)
+	}
+	return nil
+}
+
 // readEmail reads an email from a file or stdin
 func readEmail(logger *zap.Logger, inputFile string) *core.Email {
 	// Read email from file or stdin
@@ -80,12 +334,22 @@ func readEmail(logger *zap.Logger, inputFile string) *core.Email {
 		logger.Info("Reading email from stdin")
 	}
 
-	// Parse email
-	msg, err := mail.ReadMessage(bufio.NewReader(emailReader))
+	email, err := parseEmail(emailReader)
 	if err != nil {
 		logger.Fatal("Failed to parse email", zap.Error(err))
 	}
 
+	return email
+}
+
+// parseEmail parses an email message into an email object
+func parseEmail(r io.Reader) (*core.Email, error) {
+	// Parse email
+	msg, err := mail.ReadMessage(bufio.NewReader(r))
+	if err != nil {
+		return nil, err
+	}
+
 	// Extract email content
 	from := msg.Header.Get("From")
 	to := msg.Header.Get("To")
@@ -94,14 +358,14 @@ func readEmail(logger *zap.Logger, inputFile string) *core.Email {
 	// Read body
 	bodyBytes, err := io.ReadAll(msg.Body)
 	if err != nil {
-		logger.Fatal("Failed to read email body", zap.Error(err))
+		return nil, fmt.Errorf("failed to read email body: %w", err)
 	}
 	body := string(bodyBytes)
 
 	// Create email object
 	email := &core.Email{
 		From:    from,
-		To:      strings.Split(to, ","),
+		To:      utils.ParseAddressList(to),
 		Subject: subject,
 		Body:    body,
 		Headers: make(map[string][]string),
@@ -112,5 +376,5 @@ func readEmail(logger *zap.Logger, inputFile string) *core.Email {
 		email.Headers[k] = v
 	}
 
-	return email
+	return email, nil
 }
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mikey/llm-spam-filter/internal/adapters/filter"
+	"github.com/mikey/llm-spam-filter/internal/config"
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"github.com/mikey/llm-spam-filter/internal/di"
+	"go.uber.org/zap"
+)
+
+// slowLLM is an LLMClient that never answers before its context is done
+type slowLLM struct{}
+
+func (slowLLM) AnalyzeEmail(ctx context.Context, email *core.Email) (*core.SpamAnalysisResult, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestRunRespectsDeadline(t *testing.T) {
+	input := filepath.Join(t.TempDir(), "email.eml")
+	message := "From: sender@example.com\r\nTo: user@example.org\r\nSubject: Hello\r\n\r\nJust checking in.\r\n"
+	if err := os.WriteFile(input, []byte(message), 0644); err != nil {
+		t.Fatalf("failed to write email: %v", err)
+	}
+
+	logger := zap.NewNop()
+	service := core.NewSpamFilterService(slowLLM{}, nil, logger, false, time.Hour, 0.7, nil, nil, nil, core.ServiceOptions{})
+	cliFilter, err := filter.NewCliFilter(service, logger, false)
+	if err != nil {
+		t.Fatalf("NewCliFilter() error = %v", err)
+	}
+
+	v := config.NewEmptyViper()
+	v.Set("cli.timeout", "50ms")
+
+	done := make(chan error, 1)
+	go func() {
+		done <- run(logger, cliFilter, slowLLM{}, config.NewFromViper(v), &di.CLIFlags{InputFile: input})
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "timed out after 50ms") {
+			t.Errorf("run() error = %v, want a timeout", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("run() did not return after its deadline")
+	}
+}
@@ -0,0 +1,191 @@
+package batch
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"go.uber.org/zap"
+)
+
+// request is an analysis waiting to be sent in a batch
+type request struct {
+	ctx   context.Context
+	email *core.Email
+	done  chan outcome
+}
+
+// outcome is the result of a batched analysis for one caller
+type outcome struct {
+	result *core.SpamAnalysisResult
+	err    error
+}
+
+// Client is an implementation of the LLMClient interface that buffers
+// analyses for a short window and sends them to the provider together, to
+// cut the number of billed requests
+type Client struct {
+	client   core.LLMClient
+	batcher  core.BatchLLMClient
+	provider string
+	window   time.Duration
+	maxSize  int
+	logger   *zap.Logger
+
+	mu      sync.Mutex
+	pending []*request
+	timer   *time.Timer
+}
+
+// NewClient creates a client sending up to maxSize analyses at a time
+// through client, waiting at most window after the first for more to arrive
+func NewClient(client core.LLMClient, provider string, window time.Duration, maxSize int, logger *zap.Logger) (*Client, error) {
+	batcher, ok := client.(core.BatchLLMClient)
+	if !ok {
+		return nil, fmt.Errorf("provider %s does not support batching", provider)
+	}
+	if maxSize < 2 {
+		return nil, fmt.Errorf("invalid batch size %d for %s, expected at least 2", maxSize, provider)
+	}
+	if window <= 0 {
+		return nil, fmt.Errorf("invalid batch window %s for %s, expected more than 0", window, provider)
+	}
+
+	return &Client{
+		client:   client,
+		batcher:  batcher,
+		provider: provider,
+		window:   window,
+		maxSize:  maxSize,
+		logger:   logger,
+	}, nil
+}
+
+// AnalyzeEmail adds an email to the next batch and waits for its result
+func (c *Client) AnalyzeEmail(ctx context.Context, email *core.Email) (*core.SpamAnalysisResult, error) {
+	req := &request{ctx: ctx, email: email, done: make(chan outcome, 1)}
+
+	c.mu.Lock()
+	c.pending = append(c.pending, req)
+	if len(c.pending) >= c.maxSize {
+		// The batch is full, so send it now
+		batch := c.take()
+		c.mu.Unlock()
+		go c.send(batch)
+	} else {
+		if len(c.pending) == 1 {
+			c.timer = time.AfterFunc(c.window, c.flush)
+		}
+		c.mu.Unlock()
+	}
+
+	select {
+	case out := <-req.done:
+		return out.result, out.err
+	case <-ctx.Done():
+		return nil, fmt.Errorf("waiting for %s batch: %w", c.provider, ctx.Err())
+	}
+}
+
+// flush sends the pending analyses once the window has passed
+func (c *Client) flush() {
+	c.mu.Lock()
+	batch := c.take()
+	c.mu.Unlock()
+	if len(batch) > 0 {
+		c.send(batch)
+	}
+}
+
+// take removes and returns the pending analyses. The caller must hold mu.
+func (c *Client) take() []*request {
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	batch := c.pending
+	c.pending = nil
+	return batch
+}
+
+// send analyzes a batch and hands each caller its result. Callers that
+// have gone away are left out, and emails the provider gave no verdict for
+// are analyzed on their own.
+func (c *Client) send(batch []*request) {
+	live := make([]*request, 0, len(batch))
+	for _, req := range batch {
+		if req.ctx.Err() == nil {
+			live = append(live, req)
+		}
+	}
+	if len(live) == 0 {
+		return
+	}
+	if len(live) == 1 {
+		c.analyzeAlone(live[0])
+		return
+	}
+
+	ctx, cancel := batchContext(live)
+	defer cancel()
+
+	emails := make([]*core.Email, len(live))
+	for i, req := range live {
+		emails[i] = req.email
+	}
+	c.logger.Debug("Sending batched analyses",
+		zap.String("provider", c.provider),
+		zap.Int("emails", len(emails)))
+
+	results, err := c.batcher.AnalyzeEmails(ctx, emails)
+	if err != nil {
+		for _, req := range live {
+			req.done <- outcome{err: fmt.Errorf("batched analysis failed: %w", err)}
+		}
+		return
+	}
+
+	for i, req := range live {
+		if i < len(results) && results[i] != nil {
+			req.done <- outcome{result: results[i]}
+			continue
+		}
+		core.ContextLogger(req.ctx, c.logger).Warn("No verdict in batch response, analyzing email alone",
+			zap.String("provider", c.provider),
+			zap.String("from", req.email.From))
+		c.analyzeAlone(req)
+	}
+}
+
+// analyzeAlone analyzes a single email outside a batch
+func (c *Client) analyzeAlone(req *request) {
+	result, err := c.client.AnalyzeEmail(req.ctx, req.email)
+	req.done <- outcome{result: result, err: err}
+}
+
+// batchContext returns the context for a batch call, which lasts until the
+// latest caller deadline so one impatient caller doesn't fail the others.
+// If any caller has no deadline, neither does the batch.
+func batchContext(batch []*request) (context.Context, context.CancelFunc) {
+	var latest time.Time
+	for _, req := range batch {
+		deadline, ok := req.ctx.Deadline()
+		if !ok {
+			return context.WithCancel(context.Background())
+		}
+		if deadline.After(latest) {
+			latest = deadline
+		}
+	}
+	return context.WithDeadline(context.Background(), latest)
+}
+
+// Close closes the wrapped client if it holds resources
+func (c *Client) Close() error {
+	if closer, ok := c.client.(interface{ Close() error }); ok {
+		return closer.Close()
+	}
+	return nil
+}
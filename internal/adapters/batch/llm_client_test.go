@@ -0,0 +1,139 @@
+package batch
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"go.uber.org/zap"
+)
+
+// fakeBatchLLM judges emails as spam when their subject mentions a prize,
+// counting batched and single calls. Subjects listed in skip get no verdict
+// in a batch.
+type fakeBatchLLM struct {
+	mu      sync.Mutex
+	batches [][]string
+	singles int
+	skip    map[string]bool
+}
+
+func verdict(email *core.Email) *core.SpamAnalysisResult {
+	if strings.Contains(email.Subject, "prize") {
+		return &core.SpamAnalysisResult{IsSpam: true, Score: 0.9, Explanation: email.Subject}
+	}
+	return &core.SpamAnalysisResult{IsSpam: false, Score: 0.1, Explanation: email.Subject}
+}
+
+func (l *fakeBatchLLM) AnalyzeEmail(ctx context.Context, email *core.Email) (*core.SpamAnalysisResult, error) {
+	l.mu.Lock()
+	l.singles++
+	l.mu.Unlock()
+	return verdict(email), nil
+}
+
+func (l *fakeBatchLLM) AnalyzeEmails(ctx context.Context, emails []*core.Email) ([]*core.SpamAnalysisResult, error) {
+	subjects := make([]string, len(emails))
+	results := make([]*core.SpamAnalysisResult, len(emails))
+	for i, email := range emails {
+		subjects[i] = email.Subject
+		if !l.skip[email.Subject] {
+			results[i] = verdict(email)
+		}
+	}
+	l.mu.Lock()
+	l.batches = append(l.batches, subjects)
+	l.mu.Unlock()
+	return results, nil
+}
+
+// analyzeConcurrently submits an email per subject at once, returning the
+// results by subject
+func analyzeConcurrently(t *testing.T, client *Client, subjects ...string) map[string]*core.SpamAnalysisResult {
+	t.Helper()
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		results = make(map[string]*core.SpamAnalysisResult)
+	)
+	for _, subject := range subjects {
+		wg.Add(1)
+		go func(subject string) {
+			defer wg.Done()
+			email := &core.Email{From: "sender@example.com", Subject: subject, Body: "Hello"}
+			result, err := client.AnalyzeEmail(context.Background(), email)
+			if err != nil {
+				t.Errorf("AnalyzeEmail(%q) error = %v", subject, err)
+				return
+			}
+			mu.Lock()
+			results[subject] = result
+			mu.Unlock()
+		}(subject)
+	}
+	wg.Wait()
+	return results
+}
+
+func checkVerdicts(t *testing.T, results map[string]*core.SpamAnalysisResult, subjects ...string) {
+	t.Helper()
+	for _, subject := range subjects {
+		result := results[subject]
+		if result == nil || result.Explanation != subject || result.IsSpam != strings.Contains(subject, "prize") {
+			t.Errorf("result for %q = %+v, want its own verdict", subject, result)
+		}
+	}
+}
+
+func TestConcurrentEmailsShareOneCall(t *testing.T) {
+	subjects := []string{"You won a prize", "Team lunch", "Claim your prize"}
+	tests := []struct {
+		name    string
+		window  time.Duration
+		maxSize int
+	}{
+		{"batch full", time.Minute, 3},
+		{"window passed", 50 * time.Millisecond, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			llm := &fakeBatchLLM{}
+			client, err := NewClient(llm, "fake", tt.window, tt.maxSize, zap.NewNop())
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+
+			results := analyzeConcurrently(t, client, subjects...)
+			if len(llm.batches) != 1 || len(llm.batches[0]) != 3 || llm.singles != 0 {
+				t.Fatalf("batches = %v, singles = %d, want all 3 emails in one call", llm.batches, llm.singles)
+			}
+			checkVerdicts(t, results, subjects...)
+		})
+	}
+}
+
+func TestMissingVerdictIsAnalyzedAlone(t *testing.T) {
+	llm := &fakeBatchLLM{skip: map[string]bool{"Team lunch": true}}
+	client, _ := NewClient(llm, "fake", time.Minute, 2, zap.NewNop())
+
+	results := analyzeConcurrently(t, client, "You won a prize", "Team lunch")
+	if len(llm.batches) != 1 || llm.singles != 1 {
+		t.Errorf("batches = %v, singles = %d, want the missing verdict retried alone", llm.batches, llm.singles)
+	}
+	checkVerdicts(t, results, "You won a prize", "Team lunch")
+}
+
+func TestNewClientRequiresBatchSupport(t *testing.T) {
+	single := struct{ core.LLMClient }{&fakeBatchLLM{}}
+	if _, err := NewClient(single, "fake", time.Second, 3, zap.NewNop()); err == nil {
+		t.Error("NewClient() error = nil, want an error for a provider without batching")
+	}
+	for _, size := range []int{0, 1} {
+		if _, err := NewClient(&fakeBatchLLM{}, "fake", time.Second, size, zap.NewNop()); err == nil {
+			t.Errorf("NewClient(maxSize %d) error = nil, want an error", size)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package bayes
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"go.uber.org/zap"
+)
+
+const (
+	// minTokenLength and maxTokenLength bound the words that are counted,
+	// skipping short words and encoded blobs
+	minTokenLength = 3
+	maxTokenLength = 24
+
+	// interestingTokens is how many of an email's tokens, those furthest
+	// from neutral, decide its score
+	interestingTokens = 15
+
+	// priorStrength is how many occurrences a token needs before its own
+	// ratio outweighs the neutral prior
+	priorStrength = 1.0
+
+	// queryChunk bounds the tokens looked up in one query
+	queryChunk = 200
+)
+
+// Classifier is a BayesClassifier keeping token counts in SQLite tables,
+// which may share a database with the SQLite cache
+type Classifier struct {
+	db          *sql.DB
+	minMessages int
+	logger      *zap.Logger
+}
+
+// NewClassifier creates a classifier that scores emails once at least
+// minMessages spam and minMessages ham messages have been trained
+func NewClassifier(dbPath string, minMessages int, logger *zap.Logger) (*Classifier, error) {
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite database: %w", err)
+	}
+
+	// Create tables if they don't exist
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS bayes_tokens (
+			token TEXT PRIMARY KEY,
+			spam INTEGER NOT NULL DEFAULT 0,
+			ham INTEGER NOT NULL DEFAULT 0
+		)
+	`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create bayes token table: %w", err)
+	}
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS bayes_messages (
+			label TEXT PRIMARY KEY,
+			count INTEGER NOT NULL DEFAULT 0
+		)
+	`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create bayes message table: %w", err)
+	}
+
+	return &Classifier{
+		db:          db,
+		minMessages: minMessages,
+		logger:      logger,
+	}, nil
+}
+
+// Train adds the tokens of an email to the spam or ham counts
+func (c *Classifier) Train(ctx context.Context, email *core.Email, isSpam bool) error {
+	label, spam, ham := "ham", 0, 1
+	if isSpam {
+		label, spam, ham = "spam", 1, 0
+	}
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin training: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO bayes_tokens (token, spam, ham) VALUES (?, ?, ?)
+		ON CONFLICT(token) DO UPDATE SET spam = spam + excluded.spam, ham = ham + excluded.ham
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare token update: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, token := range tokenize(email) {
+		if _, err := stmt.ExecContext(ctx, token, spam, ham); err != nil {
+			return fmt.Errorf("failed to update token counts: %w", err)
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO bayes_messages (label, count) VALUES (?, 1)
+		ON CONFLICT(label) DO UPDATE SET count = count + 1
+	`, label)
+	if err != nil {
+		return fmt.Errorf("failed to update message count: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit training: %w", err)
+	}
+	return nil
+}
+
+// Score returns the probability that an email is spam, combining the spam
+// probabilities of its most telling tokens. It returns false until enough
+// of both spam and ham have been trained.
+func (c *Classifier) Score(ctx context.Context, email *core.Email) (float64, bool, error) {
+	spamMessages, hamMessages, err := c.messageCounts(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+	if spamMessages < c.minMessages || hamMessages < c.minMessages || spamMessages == 0 || hamMessages == 0 {
+		return 0, false, nil
+	}
+
+	counts, err := c.tokenCounts(ctx, tokenize(email))
+	if err != nil {
+		return 0, false, err
+	}
+
+	probabilities := make([]float64, 0, len(counts))
+	for _, count := range counts {
+		spamFreq := float64(count.spam) / float64(spamMessages)
+		hamFreq := float64(count.ham) / float64(hamMessages)
+		seen := float64(count.spam + count.ham)
+		p := spamFreq / (spamFreq + hamFreq)
+		probabilities = append(probabilities, (priorStrength*0.5+seen*p)/(priorStrength+seen))
+	}
+	return combine(probabilities), true, nil
+}
+
+// combine merges the token probabilities furthest from neutral into one
+// spam probability, treating them as independent
+func combine(probabilities []float64) float64 {
+	sort.Slice(probabilities, func(i, j int) bool {
+		return math.Abs(probabilities[i]-0.5) > math.Abs(probabilities[j]-0.5)
+	})
+	if len(probabilities) > interestingTokens {
+		probabilities = probabilities[:interestingTokens]
+	}
+
+	// Sum log odds rather than multiplying, so that many tokens don't
+	// underflow, and keep single tokens from being conclusive
+	var logOdds float64
+	for _, p := range probabilities {
+		p = math.Min(math.Max(p, 0.01), 0.99)
+		logOdds += math.Log(p / (1 - p))
+	}
+	return 1 / (1 + math.Exp(-logOdds))
+}
+
+// messageCounts returns how many spam and ham messages have been trained
+func (c *Classifier) messageCounts(ctx context.Context) (int, int, error) {
+	rows, err := c.db.QueryContext(ctx, `SELECT label, count FROM bayes_messages`)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to query message counts: %w", err)
+	}
+	defer rows.Close()
+
+	var spam, ham int
+	for rows.Next() {
+		var label string
+		var count int
+		if err := rows.Scan(&label, &count); err != nil {
+			return 0, 0, fmt.Errorf("failed to read message count: %w", err)
+		}
+		switch label {
+		case "spam":
+			spam = count
+		case "ham":
+			ham = count
+		}
+	}
+	return spam, ham, rows.Err()
+}
+
+// tokenCount is the number of spam and ham messages a token was seen in
+type tokenCount struct {
+	spam int
+	ham  int
+}
+
+// tokenCounts looks up the counts of the tokens that have been trained
+func (c *Classifier) tokenCounts(ctx context.Context, tokens []string) ([]tokenCount, error) {
+	var counts []tokenCount
+	for start := 0; start < len(tokens); start += queryChunk {
+		chunk := tokens[start:min(start+queryChunk, len(tokens))]
+		args := make([]any, len(chunk))
+		for i, token := range chunk {
+			args[i] = token
+		}
+
+		rows, err := c.db.QueryContext(ctx, `SELECT spam, ham FROM bayes_tokens WHERE token IN (?`+
+			strings.Repeat(", ?", len(chunk)-1)+`)`, args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query token counts: %w", err)
+		}
+		for rows.Next() {
+			var count tokenCount
+			if err := rows.Scan(&count.spam, &count.ham); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to read token count: %w", err)
+			}
+			counts = append(counts, count)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read token counts: %w", err)
+		}
+	}
+	return counts, nil
+}
+
+// tokenize returns the distinct lowercase words of an email's subject and
+// body. Subject words are kept apart from body words, since spam often
+// gives itself away in the subject.
+func tokenize(email *core.Email) []string {
+	seen := make(map[string]bool)
+	var tokens []string
+	add := func(prefix, text string) {
+		words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '$' && r != '\''
+		})
+		for _, word := range words {
+			word = strings.Trim(word, "'")
+			if len(word) < minTokenLength || len(word) > maxTokenLength {
+				continue
+			}
+			token := prefix + word
+			if !seen[token] {
+				seen[token] = true
+				tokens = append(tokens, token)
+			}
+		}
+	}
+	add("subject:", email.Subject)
+	add("", email.Body)
+	return tokens
+}
+
+// Close closes the database
+func (c *Classifier) Close() error {
+	return c.db.Close()
+}
@@ -0,0 +1,93 @@
+package bayes
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"go.uber.org/zap"
+)
+
+var spamCorpus = []*core.Email{
+	{Subject: "You have won a cash prize", Body: "Claim your $1000 cash prize now. Click the link to claim your winnings today."},
+	{Subject: "Cheap pills online", Body: "Buy cheap pills online with no prescription. Limited offer, click now."},
+	{Subject: "Urgent: claim your reward", Body: "You are a winner! Claim your free reward now before the offer expires."},
+}
+
+var hamCorpus = []*core.Email{
+	{Subject: "Meeting notes", Body: "Here are the notes from this morning's meeting about the quarterly report."},
+	{Subject: "Lunch on Friday", Body: "Are you free for lunch on Friday? The usual place near the office works for me."},
+	{Subject: "Project schedule", Body: "I updated the project schedule with the new deadlines for the report review."},
+}
+
+// newTrainedClassifier returns a classifier in a temporary database,
+// trained on the small corpora
+func newTrainedClassifier(t *testing.T, minMessages int) *Classifier {
+	t.Helper()
+	classifier, err := NewClassifier(filepath.Join(t.TempDir(), "bayes.db"), minMessages, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewClassifier() error = %v", err)
+	}
+	t.Cleanup(func() { classifier.Close() })
+
+	for _, email := range spamCorpus {
+		if err := classifier.Train(context.Background(), email, true); err != nil {
+			t.Fatalf("Train() error = %v", err)
+		}
+	}
+	for _, email := range hamCorpus {
+		if err := classifier.Train(context.Background(), email, false); err != nil {
+			t.Fatalf("Train() error = %v", err)
+		}
+	}
+	return classifier
+}
+
+func TestTrainedClassifierScoresObviousSpamHigh(t *testing.T) {
+	classifier := newTrainedClassifier(t, 3)
+	tests := []struct {
+		name   string
+		email  *core.Email
+		isSpam bool
+	}{
+		{"spam", &core.Email{Subject: "Claim your cash prize", Body: "Click now to claim your free cash prize, winner!"}, true},
+		{"ham", &core.Email{Subject: "Report review", Body: "Can we move the meeting about the quarterly report to Friday?"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score, ok, err := classifier.Score(context.Background(), tt.email)
+			if err != nil || !ok {
+				t.Fatalf("Score() = %v, %t, %v, want a score", score, ok, err)
+			}
+			if tt.isSpam && score < 0.9 {
+				t.Errorf("Score() = %v, want obvious spam above 0.9", score)
+			}
+			if !tt.isSpam && score > 0.1 {
+				t.Errorf("Score() = %v, want obvious ham below 0.1", score)
+			}
+		})
+	}
+}
+
+func TestClassifierWaitsForEnoughTraining(t *testing.T) {
+	classifier := newTrainedClassifier(t, 4)
+	if _, ok, err := classifier.Score(context.Background(), spamCorpus[0]); ok || err != nil {
+		t.Errorf("Score() ok = %t, %v, want no score before 4 messages of each", ok, err)
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	email := &core.Email{Subject: "Win CASH", Body: "Win cash, win it's $100 on a-b."}
+	got := tokenize(email)
+	want := []string{"subject:win", "subject:cash", "win", "cash", "it's", "$100"}
+	if len(got) != len(want) {
+		t.Fatalf("tokenize() = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("tokenize() = %q, want %q", got, want)
+			break
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
 	"github.com/mikey/llm-spam-filter/internal/config"
+	"github.com/mikey/llm-spam-filter/internal/prompt"
 	"github.com/mikey/llm-spam-filter/internal/utils"
 	"go.uber.org/zap"
 )
@@ -16,21 +17,32 @@ type Factory struct {
 	cfg          *config.Config
 	logger       *zap.Logger
 	textProcessor *utils.TextProcessor
+	errorSamples  *prompt.ErrorSamples
 }
 
 // NewFactory creates a new Bedrock factory
-func NewFactory(cfg *config.Config, logger *zap.Logger, textProcessor *utils.TextProcessor) *Factory {
+func NewFactory(cfg *config.Config, logger *zap.Logger, textProcessor *utils.TextProcessor, errorSamples *prompt.ErrorSamples) *Factory {
 	return &Factory{
 		cfg:          cfg,
 		logger:       logger,
 		textProcessor: textProcessor,
+		errorSamples:  errorSamples,
 	}
 }
 
-// CreateClient creates a new Bedrock client
+// CreateClient creates a new Bedrock client for the configured model
 func (f *Factory) CreateClient() (*BedrockClient, error) {
+	return f.CreateClientForModel(f.cfg.GetBedrock().ModelID)
+}
+
+// CreateClientForModel creates a new Bedrock client for the given model
+func (f *Factory) CreateClientForModel(modelID string) (*BedrockClient, error) {
 	// Get Bedrock config
 	bedrockCfg := f.cfg.GetBedrock()
+	maxTokens, err := config.ResolveMaxTokens(bedrockCfg.MaxTokens, "bedrock", modelID)
+	if err != nil {
+		return nil, err
+	}
 	
 	// Load AWS configuration
 	awsCfg, err := awsconfig.LoadDefaultConfig(context.Background(), 
@@ -42,14 +54,16 @@ func (f *Factory) CreateClient() (*BedrockClient, error) {
 	// Create Bedrock client
 	client := bedrockruntime.NewFromConfig(awsCfg)
 	
+	promptOpts := prompt.OptionsFromConfig(f.cfg, bedrockCfg.MaxBodySize)
+	promptOpts.ErrorSamples = f.errorSamples
+	
 	return NewBedrockClient(
 		client,
-		bedrockCfg.ModelID,
-		bedrockCfg.MaxTokens,
+		modelID,
+		maxTokens,
 		bedrockCfg.Temperature,
 		bedrockCfg.TopP,
-		bedrockCfg.MaxBodySize,
 		f.logger,
-		f.textProcessor,
+		prompt.NewBuilder(promptOpts, f.textProcessor, f.logger),
 	), nil
 }
@@ -3,6 +3,7 @@ package bedrock
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -10,7 +11,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
 	"github.com/mikey/llm-spam-filter/internal/core"
-	"github.com/mikey/llm-spam-filter/internal/utils"
+	"github.com/mikey/llm-spam-filter/internal/prompt"
 	"go.uber.org/zap"
 )
 
@@ -21,18 +22,8 @@ type BedrockClient struct {
 	maxTokens    int
 	temperature  float32
 	topP         float32
-	maxBodySize  int
 	logger       *zap.Logger
-	promptFormat string
-	textProcessor *utils.TextProcessor
-}
-
-// SpamAnalysisResponse represents the structured response from the LLM
-type SpamAnalysisResponse struct {
-	IsSpam      bool    `json:"is_spam"`
-	Score       float64 `json:"score"`
-	Confidence  float64 `json:"confidence"`
-	Explanation string  `json:"explanation"`
+	promptBuilder *prompt.Builder
 }
 
 // NewBedrockClient creates a new Bedrock client
@@ -42,9 +33,8 @@ func NewBedrockClient(
 	maxTokens int,
 	temperature float32,
 	topP float32,
-	maxBodySize int,
 	logger *zap.Logger,
-	textProcessor *utils.TextProcessor,
+	promptBuilder *prompt.Builder,
 ) *BedrockClient {
 	return &BedrockClient{
 		client:       client,
@@ -52,24 +42,8 @@ func NewBedrockClient(
 		maxTokens:    maxTokens,
 		temperature:  temperature,
 		topP:         topP,
-		maxBodySize:  maxBodySize,
 		logger:       logger,
-		textProcessor: textProcessor,
-		promptFormat: `You are a spam detection system. Analyze the following email and determine if it's spam.
-Respond with a JSON object containing:
-- is_spam: boolean (true if spam, false if not)
-- score: number between 0 and 1 (higher means more likely to be spam)
-- confidence: number between 0 and 1 (how confident you are in your assessment)
-- explanation: string (brief explanation of why you think it's spam or not)
-
-Email:
-From: %s
-To: %s
-Subject: %s
-Body:
-%s
-
-Respond only with the JSON object and nothing else.`,
+		promptBuilder: promptBuilder,
 	}
 }
 
@@ -77,19 +51,8 @@ Respond only with the JSON object and nothing else.`,
 
 // AnalyzeEmail analyzes an email to determine if it's spam
 func (c *BedrockClient) AnalyzeEmail(ctx context.Context, email *core.Email) (*core.SpamAnalysisResult, error) {
-	// Format the prompt with email details
-	to := ""
-	if len(email.To) > 0 {
-		to = email.To[0]
-		if len(email.To) > 1 {
-			to += fmt.Sprintf(" and %d others", len(email.To)-1)
-		}
-	}
-	
-	// Process the body (truncate and sanitize)
-	processedBody := c.textProcessor.ProcessText(email.Body, c.maxBodySize)
-	
-	prompt := fmt.Sprintf(c.promptFormat, email.From, to, email.Subject, processedBody)
+	// Render the prompt with email details
+	promptText := c.promptBuilder.Build(email)
 	
 	// Create the request based on the model
 	var payload []byte
@@ -98,7 +61,7 @@ func (c *BedrockClient) AnalyzeEmail(ctx context.Context, email *core.Email) (*c
 	if c.isAnthropicModel() {
 		// Anthropic Claude models
 		payload, err = json.Marshal(map[string]interface{}{
-			"prompt":      prompt,
+			"prompt":      promptText,
 			"max_tokens_to_sample": c.maxTokens,
 			"temperature": c.temperature,
 			"top_p":       c.topP,
@@ -106,7 +69,7 @@ func (c *BedrockClient) AnalyzeEmail(ctx context.Context, email *core.Email) (*c
 	} else if c.isAmazonTitanModel() {
 		// Amazon Titan models
 		payload, err = json.Marshal(map[string]interface{}{
-			"inputText":  prompt,
+			"inputText":  promptText,
 			"textGenerationConfig": map[string]interface{}{
 				"maxTokenCount": c.maxTokens,
 				"temperature":   c.temperature,
@@ -116,7 +79,7 @@ func (c *BedrockClient) AnalyzeEmail(ctx context.Context, email *core.Email) (*c
 	} else {
 		// Default to a generic format
 		payload, err = json.Marshal(map[string]interface{}{
-			"prompt":      prompt,
+			"prompt":      promptText,
 			"max_tokens":  c.maxTokens,
 			"temperature": c.temperature,
 			"top_p":       c.topP,
@@ -190,36 +153,9 @@ func (c *BedrockClient) AnalyzeEmail(ctx context.Context, email *core.Email) (*c
 	}
 
 	// Parse the LLM's JSON response
-	var analysisResponse SpamAnalysisResponse
-	if err := json.Unmarshal([]byte(responseText), &analysisResponse); err != nil {
-		// Try to extract JSON from the text response
-		jsonStart := 0
-		jsonEnd := len(responseText)
-		
-		// Find JSON start
-		for i := 0; i < len(responseText); i++ {
-			if responseText[i] == '{' {
-				jsonStart = i
-				break
-			}
-		}
-		
-		// Find JSON end
-		for i := len(responseText) - 1; i >= 0; i-- {
-			if responseText[i] == '}' {
-				jsonEnd = i + 1
-				break
-			}
-		}
-		
-		if jsonStart < jsonEnd {
-			jsonStr := responseText[jsonStart:jsonEnd]
-			if err := json.Unmarshal([]byte(jsonStr), &analysisResponse); err != nil {
-				return nil, fmt.Errorf("failed to parse LLM response as JSON: %w", err)
-			}
-		} else {
-			return nil, fmt.Errorf("failed to extract JSON from LLM response: %w", err)
-		}
+	analysisResponse, err := c.promptBuilder.ParseResponse(responseText)
+	if err != nil {
+		return nil, err
 	}
 	
 	// Create the result
@@ -230,11 +166,22 @@ func (c *BedrockClient) AnalyzeEmail(ctx context.Context, email *core.Email) (*c
 		Explanation: analysisResponse.Explanation,
 		AnalyzedAt:  time.Now(),
 		ModelUsed:   c.modelID,
+		Provider:    "bedrock",
 	}
 	
 	return result, nil
 }
 
+// Validate checks that Bedrock accepts the credentials with a tiny
+// analysis, as the runtime API has no lighter call. An answer that doesn't
+// parse still shows the model is reachable.
+func (c *BedrockClient) Validate(ctx context.Context) error {
+	if _, err := c.AnalyzeEmail(ctx, core.ProbeEmail()); err != nil && !errors.Is(err, prompt.ErrInvalidResponse) {
+		return fmt.Errorf("failed to invoke Bedrock model %s: %w", c.modelID, err)
+	}
+	return nil
+}
+
 // isAnthropicModel checks if the model is an Anthropic Claude model
 func (c *BedrockClient) isAnthropicModel() bool {
 	return strings.HasPrefix(c.modelID, "anthropic.claude")
@@ -0,0 +1,88 @@
+package bedrock
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"github.com/mikey/llm-spam-filter/internal/prompt"
+	"github.com/mikey/llm-spam-filter/internal/utils"
+	"go.uber.org/zap"
+)
+
+// newTestClient creates a client for modelID talking to a fake Bedrock API
+// answering every request with response, and returns the bodies of the
+// requests it receives
+func newTestClient(t *testing.T, modelID, response string) (*BedrockClient, *[][]byte) {
+	t.Helper()
+	var mu sync.Mutex
+	var requests [][]byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, body)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(response))
+	}))
+	t.Cleanup(server.Close)
+
+	runtime := bedrockruntime.New(bedrockruntime.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL),
+		Credentials:  aws.AnonymousCredentials{},
+	})
+	logger := zap.NewNop()
+	builder := prompt.NewBuilder(prompt.Options{}, utils.NewTextProcessor(logger), logger)
+	return NewBedrockClient(runtime, modelID, 256, 0.1, 0.9, logger, builder), &requests
+}
+
+func TestRequestUsesConfiguredMaxTokens(t *testing.T) {
+	const verdict = `{\"is_spam\": true, \"score\": 0.9, \"confidence\": 0.8, \"explanation\": \"Phishing\"}`
+	tests := []struct {
+		modelID  string
+		response string
+		field    func(map[string]interface{}) interface{}
+	}{
+		{"anthropic.claude-v2", `{"completion": "` + verdict + `"}`, func(req map[string]interface{}) interface{} {
+			return req["max_tokens_to_sample"]
+		}},
+		{"amazon.titan-text-express-v1", `{"results": [{"outputText": "` + verdict + `"}]}`, func(req map[string]interface{}) interface{} {
+			config, _ := req["textGenerationConfig"].(map[string]interface{})
+			return config["maxTokenCount"]
+		}},
+		{"meta.llama3-8b-instruct-v1:0", `{"output": "` + verdict + `"}`, func(req map[string]interface{}) interface{} {
+			return req["max_tokens"]
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.modelID, func(t *testing.T) {
+			client, requests := newTestClient(t, tt.modelID, tt.response)
+			result, err := client.AnalyzeEmail(context.Background(), &core.Email{From: "sender@example.com", Subject: "Hello", Body: "Hi"})
+			if err != nil {
+				t.Fatalf("AnalyzeEmail() error = %v", err)
+			}
+			if !result.IsSpam || result.Provider != "bedrock" {
+				t.Errorf("result = %+v, want the parsed spam verdict", result)
+			}
+
+			if len(*requests) != 1 {
+				t.Fatalf("got %d requests, want 1", len(*requests))
+			}
+			var req map[string]interface{}
+			if err := json.Unmarshal((*requests)[0], &req); err != nil {
+				t.Fatalf("failed to decode request: %v", err)
+			}
+			if got := tt.field(req); got != float64(256) {
+				t.Errorf("max tokens = %v, want 256", got)
+			}
+		})
+	}
+}
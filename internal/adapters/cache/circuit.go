@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// CircuitBreaker bypasses a failing cache backend so that a slow or
+// unavailable database doesn't hold up every message. After threshold
+// consecutive errors the circuit opens and operations are skipped, as if
+// caching were disabled. Once the cooldown passes, a single operation is let
+// through as a probe: success closes the circuit and failure reopens it for
+// another cooldown.
+//
+// A nil CircuitBreaker lets every operation through.
+type CircuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	logger    *zap.Logger
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// NewCircuitBreaker creates a circuit breaker that opens after threshold
+// consecutive errors, or returns nil if threshold is not positive
+func NewCircuitBreaker(threshold int, cooldown time.Duration, logger *zap.Logger) *CircuitBreaker {
+	if threshold <= 0 {
+		return nil
+	}
+	return &CircuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		logger:    logger,
+	}
+}
+
+// Allow returns whether an operation may use the backend. While the
+// circuit is open this is false, except for one probe after the cooldown.
+func (b *CircuitBreaker) Allow() bool {
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.openUntil.IsZero() {
+		return true
+	}
+	if b.probing || time.Now().Before(b.openUntil) {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// Record records the outcome of an operation allowed by Allow
+func (b *CircuitBreaker) Record(err error) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil {
+		if !b.openUntil.IsZero() {
+			b.logger.Info("Cache backend recovered, closing circuit")
+		}
+		b.failures = 0
+		b.openUntil = time.Time{}
+		b.probing = false
+		return
+	}
+
+	b.failures++
+	if b.probing || (b.openUntil.IsZero() && b.failures >= b.threshold) {
+		b.openUntil = time.Now().Add(b.cooldown)
+		b.probing = false
+		b.logger.Warn("Cache backend is failing, bypassing it",
+			zap.Int("consecutive_errors", b.failures),
+			zap.Duration("cooldown", b.cooldown),
+			zap.Error(err))
+	}
+}
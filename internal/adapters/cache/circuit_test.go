@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+var errBackend = errors.New("database is locked")
+
+func TestCircuitBreakerTripsAndRecovers(t *testing.T) {
+	breaker := NewCircuitBreaker(3, 50*time.Millisecond, zap.NewNop())
+
+	// Errors below the threshold keep the circuit closed
+	for i := 0; i < 2; i++ {
+		if !breaker.Allow() {
+			t.Fatalf("Allow() = false after %d errors, want true below the threshold", i)
+		}
+		breaker.Record(errBackend)
+	}
+	if !breaker.Allow() {
+		t.Fatal("Allow() = false after 2 errors, want true below the threshold")
+	}
+	breaker.Record(errBackend)
+	if breaker.Allow() {
+		t.Fatal("Allow() = true after 3 errors, want the cache bypassed")
+	}
+
+	// After the cooldown a single probe is let through, and a failure
+	// reopens the circuit
+	time.Sleep(60 * time.Millisecond)
+	if !breaker.Allow() {
+		t.Fatal("Allow() = false after the cooldown, want a probe")
+	}
+	if breaker.Allow() {
+		t.Fatal("Allow() = true during the probe, want one probe at a time")
+	}
+	breaker.Record(errBackend)
+	if breaker.Allow() {
+		t.Fatal("Allow() = true after a failed probe, want another cooldown")
+	}
+
+	// A successful probe closes the circuit
+	time.Sleep(60 * time.Millisecond)
+	if !breaker.Allow() {
+		t.Fatal("Allow() = false after the cooldown, want a probe")
+	}
+	breaker.Record(nil)
+	for i := 0; i < 3; i++ {
+		if !breaker.Allow() {
+			t.Fatal("Allow() = false after a successful probe, want the circuit closed")
+		}
+	}
+}
+
+func TestSuccessResetsConsecutiveErrors(t *testing.T) {
+	breaker := NewCircuitBreaker(2, time.Hour, zap.NewNop())
+	breaker.Record(errBackend)
+	breaker.Record(nil)
+	breaker.Record(errBackend)
+	if !breaker.Allow() {
+		t.Error("Allow() = false, want errors separated by a success not to trip the circuit")
+	}
+}
+
+func TestNilCircuitBreakerAllowsEverything(t *testing.T) {
+	breaker := NewCircuitBreaker(0, time.Minute, zap.NewNop())
+	if breaker != nil {
+		t.Fatal("NewCircuitBreaker(0) = a breaker, want nil")
+	}
+	breaker.Record(errBackend)
+	if !breaker.Allow() {
+		t.Error("Allow() = false, want a nil breaker to allow every operation")
+	}
+}
+
+func TestSQLiteCacheBypassedWhileFailing(t *testing.T) {
+	observed, logs := observer.New(zapcore.ErrorLevel)
+	breaker := NewCircuitBreaker(2, 50*time.Millisecond, zap.NewNop())
+	cache, err := NewSQLiteCache(filepath.Join(t.TempDir(), "cache.db"), zap.New(observed), time.Hour, 0, breaker, nil, true)
+	if err != nil {
+		t.Fatalf("NewSQLiteCache() error = %v", err)
+	}
+	defer cache.Stop()
+	ctx := context.Background()
+
+	// Break the backend so that every query fails
+	if _, err := cache.db.Exec("ALTER TABLE spam_cache RENAME TO spam_cache_broken"); err != nil {
+		t.Fatalf("failed to break the cache table: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		cache.Get(ctx, "sender@example.com")
+	}
+	if failures := logs.FilterMessage("Failed to query cache").Len(); failures != 2 {
+		t.Errorf("queried the failing backend %d times, want 2 before it was bypassed", failures)
+	}
+
+	// Once the backend recovers, the probe after the cooldown closes the
+	// circuit
+	if _, err := cache.db.Exec("ALTER TABLE spam_cache_broken RENAME TO spam_cache"); err != nil {
+		t.Fatalf("failed to restore the cache table: %v", err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	cache.Get(ctx, "sender@example.com")
+	cache.Set(ctx, "sender@example.com", &core.SpamAnalysisResult{IsSpam: true, Score: 0.9, AnalyzedAt: time.Now()}, time.Hour)
+	if _, found := cache.Get(ctx, "sender@example.com"); !found {
+		t.Error("Get() found no entry, want the cache used again after recovering")
+	}
+}
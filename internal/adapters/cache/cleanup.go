@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// cleanupTask periodically runs a cache's cleanup function. Each interval is
+// extended by a random jitter so that caches started together don't clean up
+// in lockstep, and a tick is skipped while the previous cleanup is running.
+type cleanupTask struct {
+	cleanup func(ctx context.Context) error
+	logger  *zap.Logger
+	freq    time.Duration
+	jitter  time.Duration
+	running atomic.Bool
+	stopCh  chan struct{}
+	wg      sync.WaitGroup
+}
+
+// newCleanupTask creates a new cleanup task
+func newCleanupTask(cleanup func(ctx context.Context) error, logger *zap.Logger, freq, jitter time.Duration) *cleanupTask {
+	return &cleanupTask{
+		cleanup: cleanup,
+		logger:  logger,
+		freq:    freq,
+		jitter:  jitter,
+		stopCh:  make(chan struct{}),
+	}
+}
+
+// start starts the cleanup task in the background
+func (t *cleanupTask) start() {
+	t.wg.Add(1)
+	go t.run()
+}
+
+// run waits for each jittered interval and runs the cleanup until stopped
+func (t *cleanupTask) run() {
+	defer t.wg.Done()
+	timer := time.NewTimer(t.nextInterval())
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			t.tick()
+			timer.Reset(t.nextInterval())
+		case <-t.stopCh:
+			return
+		}
+	}
+}
+
+// tick runs the cleanup in the background unless one is already running
+func (t *cleanupTask) tick() {
+	if !t.running.CompareAndSwap(false, true) {
+		t.logger.Warn("Skipping cache cleanup, previous cleanup still running")
+		return
+	}
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		defer t.running.Store(false)
+		if err := t.cleanup(context.Background()); err != nil {
+			t.logger.Error("Failed to clean up cache", zap.Error(err))
+		}
+	}()
+}
+
+// nextInterval returns the cleanup frequency plus a random jitter
+func (t *cleanupTask) nextInterval() time.Duration {
+	if t.jitter <= 0 {
+		return t.freq
+	}
+	return t.freq + time.Duration(rand.Int63n(int64(t.jitter)))
+}
+
+// stop stops the cleanup task, waiting for a running cleanup to finish so
+// that the cache can be closed after it returns
+func (t *cleanupTask) stop() {
+	close(t.stopCh)
+	t.wg.Wait()
+}
@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestCleanupTicksDontOverlap(t *testing.T) {
+	var running, maxRunning, runs atomic.Int32
+	release := make(chan struct{})
+	task := newCleanupTask(func(ctx context.Context) error {
+		current := running.Add(1)
+		defer running.Add(-1)
+		if current > maxRunning.Load() {
+			maxRunning.Store(current)
+		}
+		runs.Add(1)
+		<-release
+		return nil
+	}, zap.NewNop(), time.Hour, 0)
+
+	// Ticks while the first cleanup is still running are skipped
+	for i := 0; i < 5; i++ {
+		task.tick()
+	}
+	close(release)
+	waitFor(t, func() bool { return !task.running.Load() })
+
+	if runs.Load() != 1 || maxRunning.Load() != 1 {
+		t.Errorf("got %d cleanups with up to %d at once, want one", runs.Load(), maxRunning.Load())
+	}
+
+	// Once it has finished, the next tick runs again
+	task.tick()
+	waitFor(t, func() bool { return runs.Load() == 2 && !task.running.Load() })
+}
+
+func TestCleanupStopWaitsForRunningCleanup(t *testing.T) {
+	var finished atomic.Bool
+	started := make(chan struct{})
+	task := newCleanupTask(func(ctx context.Context) error {
+		close(started)
+		time.Sleep(50 * time.Millisecond)
+		finished.Store(true)
+		return nil
+	}, zap.NewNop(), time.Millisecond, 0)
+	task.start()
+
+	<-started
+	task.stop()
+	if !finished.Load() {
+		t.Error("stop() returned while a cleanup was still running")
+	}
+}
+
+func TestCleanupIntervalJitter(t *testing.T) {
+	task := newCleanupTask(nil, zap.NewNop(), time.Minute, 10*time.Second)
+	for i := 0; i < 100; i++ {
+		if interval := task.nextInterval(); interval < time.Minute || interval >= time.Minute+10*time.Second {
+			t.Fatalf("nextInterval() = %v, want between 1m and 1m10s", interval)
+		}
+	}
+}
+
+// waitFor waits up to a second for condition to hold
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
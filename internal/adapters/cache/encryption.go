@@ -0,0 +1,96 @@
+package cache
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// KeyEncryptor encrypts cache keys, which hold sender addresses, before
+// they are stored in a SQL backend. Encryption is deterministic so that the
+// same key always encrypts to the same value and lookups still work: the
+// AES-GCM nonce is derived from an HMAC of the key (as in SIV mode), which
+// reveals only whether two stored keys are equal.
+//
+// A nil KeyEncryptor stores keys as they are.
+type KeyEncryptor struct {
+	aead   cipher.AEAD
+	macKey []byte
+}
+
+// NewKeyEncryptor creates a key encryptor with encryption and MAC keys
+// derived from secret, or returns nil if secret is empty
+func NewKeyEncryptor(secret string) (*KeyEncryptor, error) {
+	if secret == "" {
+		return nil, nil
+	}
+
+	kdf := hkdf.New(sha256.New, []byte(secret), nil, []byte("llm-spam-filter cache key encryption"))
+	encKey := make([]byte, 32)
+	macKey := make([]byte, 32)
+	if _, err := io.ReadFull(kdf, encKey); err != nil {
+		return nil, fmt.Errorf("failed to derive cache encryption key: %w", err)
+	}
+	if _, err := io.ReadFull(kdf, macKey); err != nil {
+		return nil, fmt.Errorf("failed to derive cache MAC key: %w", err)
+	}
+
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cache cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cache cipher: %w", err)
+	}
+
+	return &KeyEncryptor{aead: aead, macKey: macKey}, nil
+}
+
+// Encrypt returns the stored form of a cache key
+func (e *KeyEncryptor) Encrypt(key string) string {
+	if e == nil {
+		return key
+	}
+	nonce := e.nonce([]byte(key))
+	sealed := e.aead.Seal(nonce, nonce, []byte(key), nil)
+	return base64.RawURLEncoding.EncodeToString(sealed)
+}
+
+// Decrypt returns the cache key a stored value was encrypted from
+func (e *KeyEncryptor) Decrypt(stored string) (string, error) {
+	if e == nil {
+		return stored, nil
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(stored)
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted cache key: %w", err)
+	}
+	size := e.aead.NonceSize()
+	if len(sealed) < size {
+		return "", errors.New("invalid encrypted cache key: too short")
+	}
+	nonce, ciphertext := sealed[:size], sealed[size:]
+	key, err := e.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt cache key: %w", err)
+	}
+	if !hmac.Equal(nonce, e.nonce(key)) {
+		return "", errors.New("failed to decrypt cache key: nonce mismatch")
+	}
+	return string(key), nil
+}
+
+// nonce derives the nonce for a key from its HMAC
+func (e *KeyEncryptor) nonce(key []byte) []byte {
+	mac := hmac.New(sha256.New, e.macKey)
+	mac.Write(key)
+	return mac.Sum(nil)[:e.aead.NonceSize()]
+}
@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"go.uber.org/zap"
+)
+
+func TestKeyEncryptorIsDeterministic(t *testing.T) {
+	encryptor, err := NewKeyEncryptor("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("NewKeyEncryptor() error = %v", err)
+	}
+
+	stored := encryptor.Encrypt("sender@example.com")
+	if stored == "sender@example.com" || strings.Contains(stored, "example") {
+		t.Errorf("Encrypt() = %q, want ciphertext", stored)
+	}
+	if again := encryptor.Encrypt("sender@example.com"); again != stored {
+		t.Errorf("Encrypt() = %q then %q, want the same ciphertext for lookups", stored, again)
+	}
+	if other := encryptor.Encrypt("other@example.com"); other == stored {
+		t.Error("Encrypt() gave the same ciphertext for different keys")
+	}
+	if key, err := encryptor.Decrypt(stored); err != nil || key != "sender@example.com" {
+		t.Errorf("Decrypt() = %q, %v, want the original key", key, err)
+	}
+
+	otherSecret, _ := NewKeyEncryptor("another secret")
+	if _, err := otherSecret.Decrypt(stored); err == nil {
+		t.Error("Decrypt() with another secret succeeded, want an error")
+	}
+}
+
+func TestNilKeyEncryptorStoresKeysAsTheyAre(t *testing.T) {
+	encryptor, err := NewKeyEncryptor("")
+	if err != nil || encryptor != nil {
+		t.Fatalf("NewKeyEncryptor(\"\") = %v, %v, want nil", encryptor, err)
+	}
+	if stored := encryptor.Encrypt("sender@example.com"); stored != "sender@example.com" {
+		t.Errorf("Encrypt() = %q, want the key unchanged", stored)
+	}
+}
+
+func TestSQLiteCacheStoresEncryptedKeys(t *testing.T) {
+	encryptor, err := NewKeyEncryptor("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("NewKeyEncryptor() error = %v", err)
+	}
+	cache, err := NewSQLiteCache(filepath.Join(t.TempDir(), "cache.db"), zap.NewNop(), time.Hour, 0, nil, encryptor, true)
+	if err != nil {
+		t.Fatalf("NewSQLiteCache() error = %v", err)
+	}
+	defer cache.Stop()
+	ctx := context.Background()
+
+	cache.Set(ctx, "sender@example.com", &core.SpamAnalysisResult{IsSpam: true, Score: 0.9, AnalyzedAt: time.Now()}, time.Hour)
+
+	var stored string
+	if err := cache.db.QueryRow("SELECT sender_email FROM spam_cache").Scan(&stored); err != nil {
+		t.Fatalf("failed to read the stored row: %v", err)
+	}
+	if strings.Contains(stored, "sender") || strings.Contains(stored, "example.com") {
+		t.Errorf("stored sender_email = %q, want ciphertext", stored)
+	}
+
+	if result, found := cache.Get(ctx, "sender@example.com"); !found || !result.IsSpam {
+		t.Errorf("Get() = %+v, %t, want the cached verdict", result, found)
+	}
+	if err := cache.Delete(ctx, "sender@example.com"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, found := cache.Get(ctx, "sender@example.com"); found {
+		t.Error("Get() found the entry after Delete()")
+	}
+}
@@ -22,27 +22,36 @@ type MemoryCache struct {
 	entries     map[string]*core.CacheEntry
 	mu          sync.RWMutex
 	logger      *zap.Logger
-	cleanupFreq time.Duration
-	stopCh      chan struct{}
+	cleanup     *cleanupTask
 }
 
 // NewMemoryCache creates a new in-memory cache
-func NewMemoryCache(logger *zap.Logger, cleanupFreq time.Duration) *MemoryCache {
+func NewMemoryCache(logger *zap.Logger, cleanupFreq, cleanupJitter time.Duration) *MemoryCache {
 	cache := &MemoryCache{
 		entries:     make(map[string]*core.CacheEntry),
 		logger:      logger,
-		cleanupFreq: cleanupFreq,
-		stopCh:      make(chan struct{}),
 	}
 	
 	// Start background cleanup
-	go cache.startCleanupTask()
+	cache.cleanup = newCleanupTask(cache.Cleanup, logger, cleanupFreq, cleanupJitter)
+	cache.cleanup.start()
 	
 	return cache
 }
 
 // Get retrieves a cached entry for a sender
-func (c *MemoryCache) Get(senderEmail string) (*core.SpamAnalysisResult, bool) {
+func (c *MemoryCache) Get(ctx context.Context, senderEmail string) (*core.SpamAnalysisResult, bool) {
+	return c.get(senderEmail, false)
+}
+
+// GetAllowExpired retrieves a cached entry for a sender even if it has
+// expired, as long as it hasn't been cleaned up yet
+func (c *MemoryCache) GetAllowExpired(ctx context.Context, senderEmail string) (*core.SpamAnalysisResult, bool) {
+	return c.get(senderEmail, true)
+}
+
+// get retrieves a cached entry, ignoring its expiry if allowExpired is set
+func (c *MemoryCache) get(senderEmail string, allowExpired bool) (*core.SpamAnalysisResult, bool) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 	
@@ -52,7 +61,7 @@ func (c *MemoryCache) Get(senderEmail string) (*core.SpamAnalysisResult, bool) {
 	}
 	
 	// Check if entry has expired
-	if time.Now().After(entry.ExpiresAt) {
+	if !allowExpired && time.Now().After(entry.ExpiresAt) {
 		return nil, false
 	}
 	
@@ -60,6 +69,7 @@ func (c *MemoryCache) Get(senderEmail string) (*core.SpamAnalysisResult, bool) {
 	result := &core.SpamAnalysisResult{
 		IsSpam:     entry.IsSpam,
 		Score:      float64(entry.Score),
+		Confidence: float64(entry.Confidence),
 		AnalyzedAt: entry.LastSeen,
 	}
 	
@@ -67,7 +77,7 @@ func (c *MemoryCache) Get(senderEmail string) (*core.SpamAnalysisResult, bool) {
 }
 
 // Set stores a cache entry
-func (c *MemoryCache) Set(key string, result *core.SpamAnalysisResult, ttl time.Duration) {
+func (c *MemoryCache) Set(ctx context.Context, key string, result *core.SpamAnalysisResult, ttl time.Duration) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	
@@ -76,6 +86,7 @@ func (c *MemoryCache) Set(key string, result *core.SpamAnalysisResult, ttl time.
 		SenderEmail: key,
 		IsSpam:      result.IsSpam,
 		Score:       float32(result.Score),
+		Confidence:  float32(result.Confidence),
 		LastSeen:    result.AnalyzedAt,
 		ExpiresAt:   time.Now().Add(ttl),
 	}
@@ -111,24 +122,7 @@ func (c *MemoryCache) Cleanup(ctx context.Context) error {
 	return nil
 }
 
-// startCleanupTask starts a background task to clean up expired entries
-func (c *MemoryCache) startCleanupTask() {
-	ticker := time.NewTicker(c.cleanupFreq)
-	defer ticker.Stop()
-	
-	for {
-		select {
-		case <-ticker.C:
-			if err := c.Cleanup(context.Background()); err != nil {
-				c.logger.Error("Failed to clean up cache", zap.Error(err))
-			}
-		case <-c.stopCh:
-			return
-		}
-	}
-}
-
 // Stop stops the background cleanup task
 func (c *MemoryCache) Stop() {
-	close(c.stopCh)
+	c.cleanup.stop()
 }
@@ -0,0 +1,191 @@
+package cache
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// migrationTimeout bounds the whole migration, including the wait for
+// another instance to finish migrating
+const migrationTimeout = 60 * time.Second
+
+// mysqlMigrationLock is the name of the MySQL advisory lock held while
+// migrating
+const mysqlMigrationLock = "llm_spam_filter_cache_migrations"
+
+// migration is a versioned change to the cache schema. Versions are never
+// reused, and each migration runs once per database.
+type migration struct {
+	version     int
+	description string
+	statements  []string
+}
+
+// dialect holds the migrations of a database and how to stop other
+// instances migrating at the same time
+type dialect struct {
+	name       string
+	migrations []migration
+
+	// lock stops other instances migrating until unlock is called, which
+	// commits the migration unless it failed
+	lock   func(ctx context.Context, conn *sql.Conn) error
+	unlock func(ctx context.Context, conn *sql.Conn, failed bool) error
+}
+
+// sqliteDialect migrates SQLite caches inside a write transaction, which
+// SQLite holds exclusively and which also covers the schema changes
+var sqliteDialect = dialect{
+	name: "SQLite",
+	migrations: []migration{
+		{
+			version:     1,
+			description: "create spam_cache",
+			statements: []string{
+				`CREATE TABLE IF NOT EXISTS spam_cache (
+					sender_email TEXT PRIMARY KEY,
+					is_spam BOOLEAN,
+					score REAL,
+					last_seen TIMESTAMP,
+					expires_at TIMESTAMP
+				)`,
+				`CREATE INDEX IF NOT EXISTS idx_expires_at ON spam_cache(expires_at)`,
+			},
+		},
+		{
+			version:     2,
+			description: "add spam_cache.confidence",
+			statements: []string{
+				`ALTER TABLE spam_cache ADD COLUMN confidence REAL NOT NULL DEFAULT 0`,
+			},
+		},
+	},
+	lock: func(ctx context.Context, conn *sql.Conn) error {
+		// Wait for another instance's migration rather than failing as busy
+		if _, err := conn.ExecContext(ctx, `PRAGMA busy_timeout = 30000`); err != nil {
+			return err
+		}
+		_, err := conn.ExecContext(ctx, `BEGIN IMMEDIATE`)
+		return err
+	},
+	unlock: func(ctx context.Context, conn *sql.Conn, failed bool) error {
+		if failed {
+			_, err := conn.ExecContext(ctx, `ROLLBACK`)
+			return err
+		}
+		_, err := conn.ExecContext(ctx, `COMMIT`)
+		return err
+	},
+}
+
+// mysqlDialect migrates MySQL caches under an advisory lock, since MySQL
+// commits schema changes immediately
+var mysqlDialect = dialect{
+	name: "MySQL",
+	migrations: []migration{
+		{
+			version:     1,
+			description: "create spam_cache",
+			statements: []string{
+				`CREATE TABLE IF NOT EXISTS spam_cache (
+					sender_email VARCHAR(255) PRIMARY KEY,
+					is_spam BOOLEAN,
+					score FLOAT,
+					last_seen TIMESTAMP,
+					expires_at TIMESTAMP,
+					INDEX idx_expires_at (expires_at)
+				)`,
+			},
+		},
+		{
+			version:     2,
+			description: "add spam_cache.confidence",
+			statements: []string{
+				`ALTER TABLE spam_cache ADD COLUMN confidence FLOAT NOT NULL DEFAULT 0`,
+			},
+		},
+	},
+	lock: func(ctx context.Context, conn *sql.Conn) error {
+		var locked sql.NullInt64
+		err := conn.QueryRowContext(ctx, `SELECT GET_LOCK(?, ?)`,
+			mysqlMigrationLock, int(migrationTimeout.Seconds())).Scan(&locked)
+		if err != nil {
+			return err
+		}
+		if !locked.Valid || locked.Int64 != 1 {
+			return fmt.Errorf("timed out waiting for another instance's migration")
+		}
+		return nil
+	},
+	unlock: func(ctx context.Context, conn *sql.Conn, _ bool) error {
+		_, err := conn.ExecContext(ctx, `SELECT RELEASE_LOCK(?)`, mysqlMigrationLock)
+		return err
+	},
+}
+
+// migrate brings the cache schema up to date, applying each migration newer
+// than the version recorded in spam_cache_migrations and recording it. Only
+// one instance migrates at a time, so instances starting together don't
+// race, and running it again once up to date changes nothing.
+func migrate(db *sql.DB, d dialect, logger *zap.Logger) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), migrationTimeout)
+	defer cancel()
+
+	// The lock belongs to a connection, so everything runs on one
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect for migration: %w", err)
+	}
+	defer conn.Close()
+
+	if err := d.lock(ctx, conn); err != nil {
+		return fmt.Errorf("failed to lock %s cache for migration: %w", d.name, err)
+	}
+	defer func() {
+		if unlockErr := d.unlock(ctx, conn, err != nil); unlockErr != nil && err == nil {
+			err = fmt.Errorf("failed to finish %s cache migration: %w", d.name, unlockErr)
+		}
+	}()
+
+	_, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS spam_cache_migrations (
+			version INTEGER PRIMARY KEY,
+			description VARCHAR(255),
+			applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	var current int
+	err = conn.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM spam_cache_migrations`).Scan(&current)
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	for _, m := range d.migrations {
+		if m.version <= current {
+			continue
+		}
+		for _, statement := range m.statements {
+			if _, err = conn.ExecContext(ctx, statement); err != nil {
+				return fmt.Errorf("failed to apply migration %d (%s): %w", m.version, m.description, err)
+			}
+		}
+		_, err = conn.ExecContext(ctx, `INSERT INTO spam_cache_migrations (version, description) VALUES (?, ?)`,
+			m.version, m.description)
+		if err != nil {
+			return fmt.Errorf("failed to record migration %d: %w", m.version, err)
+		}
+		logger.Info("Applied cache migration",
+			zap.String("database", d.name),
+			zap.Int("version", m.version),
+			zap.String("description", m.description))
+	}
+	return nil
+}
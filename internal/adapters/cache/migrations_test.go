@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// appliedVersions returns the migration versions recorded in db
+func appliedVersions(t *testing.T, db *sql.DB) []int {
+	t.Helper()
+	rows, err := db.Query(`SELECT version FROM spam_cache_migrations ORDER BY version`)
+	if err != nil {
+		t.Fatalf("failed to read migrations: %v", err)
+	}
+	defer rows.Close()
+	var versions []int
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			t.Fatalf("failed to read migration: %v", err)
+		}
+		versions = append(versions, version)
+	}
+	return versions
+}
+
+func TestMigrateTwiceIsNoop(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	observed, logs := observer.New(zap.InfoLevel)
+	logger := zap.New(observed)
+
+	if err := migrate(db, sqliteDialect, logger); err != nil {
+		t.Fatalf("first migrate() error = %v", err)
+	}
+	want := len(sqliteDialect.migrations)
+	if versions := appliedVersions(t, db); len(versions) != want || versions[want-1] != sqliteDialect.migrations[want-1].version {
+		t.Fatalf("recorded versions = %v, want all %d migrations", versions, want)
+	}
+	if applied := logs.FilterMessage("Applied cache migration").Len(); applied != want {
+		t.Errorf("applied %d migrations, want %d", applied, want)
+	}
+
+	// The second run would fail re-adding columns if it applied anything
+	if err := migrate(db, sqliteDialect, logger); err != nil {
+		t.Fatalf("second migrate() error = %v", err)
+	}
+	if versions := appliedVersions(t, db); len(versions) != want {
+		t.Errorf("recorded versions = %v after migrating again, want them unchanged", versions)
+	}
+	if applied := logs.FilterMessage("Applied cache migration").Len(); applied != want {
+		t.Errorf("applied %d migrations in total, want none the second time", applied-want)
+	}
+
+	if _, err := db.Exec(`INSERT INTO spam_cache (sender_email, is_spam, score, confidence) VALUES ('a@example.com', 1, 0.9, 0.8)`); err != nil {
+		t.Errorf("migrated schema rejected a row: %v", err)
+	}
+}
+
+func TestMigrateAppliesOnlyNewerVersions(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	older := sqliteDialect
+	older.migrations = sqliteDialect.migrations[:1]
+	if err := migrate(db, older, zap.NewNop()); err != nil {
+		t.Fatalf("migrate() to version 1 error = %v", err)
+	}
+	if err := migrate(db, sqliteDialect, zap.NewNop()); err != nil {
+		t.Fatalf("migrate() to the latest version error = %v", err)
+	}
+	if versions := appliedVersions(t, db); len(versions) != len(sqliteDialect.migrations) {
+		t.Errorf("recorded versions = %v, want each migration once", versions)
+	}
+}
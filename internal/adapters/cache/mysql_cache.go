@@ -15,12 +15,16 @@ import (
 type MySQLCache struct {
 	db          *sql.DB
 	logger      *zap.Logger
-	cleanupFreq time.Duration
-	stopCh      chan struct{}
+	cleanup     *cleanupTask
+	breaker     *CircuitBreaker
+	encryptor   *KeyEncryptor
 }
 
-// NewMySQLCache creates a new MySQL cache
-func NewMySQLCache(dsn string, logger *zap.Logger, cleanupFreq time.Duration) (*MySQLCache, error) {
+// NewMySQLCache creates a new MySQL cache, migrating its schema if
+// runMigrations is set. Get and Set are skipped while breaker is open (nil
+// to never skip), and keys are stored encrypted by encryptor (nil to store
+// them as they are).
+func NewMySQLCache(dsn string, logger *zap.Logger, cleanupFreq, cleanupJitter time.Duration, breaker *CircuitBreaker, encryptor *KeyEncryptor, runMigrations bool) (*MySQLCache, error) {
 	db, err := sql.Open("mysql", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open MySQL database: %w", err)
@@ -32,46 +36,59 @@ func NewMySQLCache(dsn string, logger *zap.Logger, cleanupFreq time.Duration) (*
 		return nil, fmt.Errorf("failed to connect to MySQL database: %w", err)
 	}
 
-	// Create table if it doesn't exist
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS spam_cache (
-			sender_email VARCHAR(255) PRIMARY KEY,
-			is_spam BOOLEAN,
-			score FLOAT,
-			last_seen TIMESTAMP,
-			expires_at TIMESTAMP,
-			INDEX idx_expires_at (expires_at)
-		)
-	`)
-	if err != nil {
-		db.Close()
-		return nil, fmt.Errorf("failed to create table: %w", err)
+	// Bring the schema up to date, unless another instance does it
+	if runMigrations {
+		if err := migrate(db, mysqlDialect, logger); err != nil {
+			db.Close()
+			return nil, err
+		}
 	}
 
 	cache := &MySQLCache{
 		db:          db,
 		logger:      logger,
-		cleanupFreq: cleanupFreq,
-		stopCh:      make(chan struct{}),
+		breaker:     breaker,
+		encryptor:   encryptor,
 	}
 
 	// Start background cleanup
-	go cache.startCleanupTask()
+	cache.cleanup = newCleanupTask(cache.Cleanup, logger, cleanupFreq, cleanupJitter)
+	cache.cleanup.start()
 
 	return cache, nil
 }
 
 // Get retrieves a cached entry for a sender
-func (c *MySQLCache) Get(senderEmail string) (*core.SpamAnalysisResult, bool) {
+func (c *MySQLCache) Get(ctx context.Context, senderEmail string) (*core.SpamAnalysisResult, bool) {
+	return c.get(ctx, senderEmail, false)
+}
+
+// GetAllowExpired retrieves a cached entry for a sender even if it has
+// expired, as long as it hasn't been cleaned up yet
+func (c *MySQLCache) GetAllowExpired(ctx context.Context, senderEmail string) (*core.SpamAnalysisResult, bool) {
+	return c.get(ctx, senderEmail, true)
+}
+
+// get retrieves a cached entry, ignoring its expiry if allowExpired is set
+func (c *MySQLCache) get(ctx context.Context, senderEmail string, allowExpired bool) (*core.SpamAnalysisResult, bool) {
 	var isSpam bool
-	var score float32
+	var score, confidence float32
 	var lastSeen, expiresAt string
 
-	err := c.db.QueryRow(`
-		SELECT is_spam, score, last_seen, expires_at
+	if !c.breaker.Allow() {
+		return nil, false
+	}
+
+	err := c.db.QueryRowContext(ctx, `
+		SELECT is_spam, score, confidence, last_seen, expires_at
 		FROM spam_cache
-		WHERE sender_email = ? AND expires_at > NOW()
-	`, senderEmail).Scan(&isSpam, &score, &lastSeen, &expiresAt)
+		WHERE sender_email = ? AND (? OR expires_at > NOW())
+	`, c.encryptor.Encrypt(senderEmail), allowExpired).Scan(&isSpam, &score, &confidence, &lastSeen, &expiresAt)
+	if err == sql.ErrNoRows {
+		c.breaker.Record(nil)
+	} else {
+		c.breaker.Record(err)
+	}
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -92,6 +109,7 @@ func (c *MySQLCache) Get(senderEmail string) (*core.SpamAnalysisResult, bool) {
 	result := &core.SpamAnalysisResult{
 		IsSpam:     isSpam,
 		Score:      float64(score),
+		Confidence: float64(confidence),
 		AnalyzedAt: analyzedAt,
 	}
 
@@ -99,19 +117,25 @@ func (c *MySQLCache) Get(senderEmail string) (*core.SpamAnalysisResult, bool) {
 }
 
 // Set stores a cache entry
-func (c *MySQLCache) Set(key string, result *core.SpamAnalysisResult, ttl time.Duration) {
+func (c *MySQLCache) Set(ctx context.Context, key string, result *core.SpamAnalysisResult, ttl time.Duration) {
+	if !c.breaker.Allow() {
+		return
+	}
+
 	expiresAt := time.Now().Add(ttl)
 	
-	_, err := c.db.Exec(`
-		INSERT INTO spam_cache (sender_email, is_spam, score, last_seen, expires_at)
-		VALUES (?, ?, ?, ?, ?)
+	_, err := c.db.ExecContext(ctx, `
+		INSERT INTO spam_cache (sender_email, is_spam, score, confidence, last_seen, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)
 		ON DUPLICATE KEY UPDATE
 			is_spam = VALUES(is_spam),
 			score = VALUES(score),
+			confidence = VALUES(confidence),
 			last_seen = VALUES(last_seen),
 			expires_at = VALUES(expires_at)
-	`, key, result.IsSpam, float32(result.Score), result.AnalyzedAt.Format("2006-01-02 15:04:05"), expiresAt.Format("2006-01-02 15:04:05"))
+	`, c.encryptor.Encrypt(key), result.IsSpam, float32(result.Score), float32(result.Confidence), result.AnalyzedAt.Format("2006-01-02 15:04:05"), expiresAt.Format("2006-01-02 15:04:05"))
 
+	c.breaker.Record(err)
 	if err != nil {
 		c.logger.Error("Failed to insert cache entry", zap.Error(err), zap.String("sender", key))
 	}
@@ -122,7 +146,7 @@ func (c *MySQLCache) Delete(ctx context.Context, senderEmail string) error {
 	_, err := c.db.ExecContext(ctx, `
 		DELETE FROM spam_cache
 		WHERE sender_email = ?
-	`, senderEmail)
+	`, c.encryptor.Encrypt(senderEmail))
 
 	if err != nil {
 		return fmt.Errorf("failed to delete cache entry: %w", err)
@@ -152,26 +176,9 @@ func (c *MySQLCache) Cleanup(ctx context.Context) error {
 	return nil
 }
 
-// startCleanupTask starts a background task to clean up expired entries
-func (c *MySQLCache) startCleanupTask() {
-	ticker := time.NewTicker(c.cleanupFreq)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ticker.C:
-			if err := c.Cleanup(context.Background()); err != nil {
-				c.logger.Error("Failed to clean up cache", zap.Error(err))
-			}
-		case <-c.stopCh:
-			return
-		}
-	}
-}
-
 // Stop stops the background cleanup task and closes the database connection
 func (c *MySQLCache) Stop() {
-	close(c.stopCh)
+	c.cleanup.stop()
 	if err := c.db.Close(); err != nil {
 		c.logger.Error("Failed to close MySQL database", zap.Error(err))
 	}
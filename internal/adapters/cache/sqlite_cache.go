@@ -15,65 +15,74 @@ import (
 type SQLiteCache struct {
 	db          *sql.DB
 	logger      *zap.Logger
-	cleanupFreq time.Duration
-	stopCh      chan struct{}
+	cleanup     *cleanupTask
+	breaker     *CircuitBreaker
+	encryptor   *KeyEncryptor
 }
 
-// NewSQLiteCache creates a new SQLite cache
-func NewSQLiteCache(dbPath string, logger *zap.Logger, cleanupFreq time.Duration) (*SQLiteCache, error) {
+// NewSQLiteCache creates a new SQLite cache, migrating its schema if
+// runMigrations is set. Get and Set are skipped while breaker is open (nil
+// to never skip), and keys are stored encrypted by encryptor (nil to store
+// them as they are).
+func NewSQLiteCache(dbPath string, logger *zap.Logger, cleanupFreq, cleanupJitter time.Duration, breaker *CircuitBreaker, encryptor *KeyEncryptor, runMigrations bool) (*SQLiteCache, error) {
 	db, err := sql.Open("sqlite3", dbPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open SQLite database: %w", err)
 	}
 	
-	// Create table if it doesn't exist
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS spam_cache (
-			sender_email TEXT PRIMARY KEY,
-			is_spam BOOLEAN,
-			score REAL,
-			last_seen TIMESTAMP,
-			expires_at TIMESTAMP
-		)
-	`)
-	if err != nil {
-		db.Close()
-		return nil, fmt.Errorf("failed to create table: %w", err)
-	}
-	
-	// Create index on expires_at for faster cleanup
-	_, err = db.Exec(`
-		CREATE INDEX IF NOT EXISTS idx_expires_at ON spam_cache(expires_at)
-	`)
-	if err != nil {
-		db.Close()
-		return nil, fmt.Errorf("failed to create index: %w", err)
+	// Bring the schema up to date, unless another instance does it
+	if runMigrations {
+		if err := migrate(db, sqliteDialect, logger); err != nil {
+			db.Close()
+			return nil, err
+		}
 	}
 	
 	cache := &SQLiteCache{
 		db:          db,
 		logger:      logger,
-		cleanupFreq: cleanupFreq,
-		stopCh:      make(chan struct{}),
+		breaker:     breaker,
+		encryptor:   encryptor,
 	}
 	
 	// Start background cleanup
-	go cache.startCleanupTask()
+	cache.cleanup = newCleanupTask(cache.Cleanup, logger, cleanupFreq, cleanupJitter)
+	cache.cleanup.start()
 	
 	return cache, nil
 }
 
 // Get retrieves a cached entry for a sender
-func (c *SQLiteCache) Get(senderEmail string) (*core.SpamAnalysisResult, bool) {
+func (c *SQLiteCache) Get(ctx context.Context, senderEmail string) (*core.SpamAnalysisResult, bool) {
+	return c.get(ctx, senderEmail, false)
+}
+
+// GetAllowExpired retrieves a cached entry for a sender even if it has
+// expired, as long as it hasn't been cleaned up yet
+func (c *SQLiteCache) GetAllowExpired(ctx context.Context, senderEmail string) (*core.SpamAnalysisResult, bool) {
+	return c.get(ctx, senderEmail, true)
+}
+
+// get retrieves a cached entry, ignoring its expiry if allowExpired is set
+func (c *SQLiteCache) get(ctx context.Context, senderEmail string, allowExpired bool) (*core.SpamAnalysisResult, bool) {
 	var isSpam bool
-	var score float32
+	var score, confidence float32
 	var lastSeen, expiresAt string
+
+	if !c.breaker.Allow() {
+		return nil, false
+	}
 	
-	err := c.db.QueryRow(`
-		SELECT is_spam, score, last_seen, expires_at
+	err := c.db.QueryRowContext(ctx, `
+		SELECT is_spam, score, confidence, last_seen, expires_at
 		FROM spam_cache
-		WHERE sender_email = ? AND expires_at > datetime('now')
-	`, senderEmail).Scan(&isSpam, &score, &lastSeen, &expiresAt)
+		WHERE sender_email = ? AND (? OR expires_at > datetime('now'))
+	`, c.encryptor.Encrypt(senderEmail), allowExpired).Scan(&isSpam, &score, &confidence, &lastSeen, &expiresAt)
+	if err == sql.ErrNoRows {
+		c.breaker.Record(nil)
+	} else {
+		c.breaker.Record(err)
+	}
 	
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -94,6 +103,7 @@ func (c *SQLiteCache) Get(senderEmail string) (*core.SpamAnalysisResult, bool) {
 	result := &core.SpamAnalysisResult{
 		IsSpam:     isSpam,
 		Score:      float64(score),
+		Confidence: float64(confidence),
 		AnalyzedAt: analyzedAt,
 	}
 	
@@ -101,14 +111,19 @@ func (c *SQLiteCache) Get(senderEmail string) (*core.SpamAnalysisResult, bool) {
 }
 
 // Set stores a cache entry
-func (c *SQLiteCache) Set(key string, result *core.SpamAnalysisResult, ttl time.Duration) {
+func (c *SQLiteCache) Set(ctx context.Context, key string, result *core.SpamAnalysisResult, ttl time.Duration) {
+	if !c.breaker.Allow() {
+		return
+	}
+
 	expiresAt := time.Now().Add(ttl)
 	
-	_, err := c.db.Exec(`
-		INSERT OR REPLACE INTO spam_cache (sender_email, is_spam, score, last_seen, expires_at)
-		VALUES (?, ?, ?, ?, ?)
-	`, key, result.IsSpam, float32(result.Score), result.AnalyzedAt.Format(time.RFC3339), expiresAt.Format(time.RFC3339))
+	_, err := c.db.ExecContext(ctx, `
+		INSERT OR REPLACE INTO spam_cache (sender_email, is_spam, score, confidence, last_seen, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, c.encryptor.Encrypt(key), result.IsSpam, float32(result.Score), float32(result.Confidence), result.AnalyzedAt.Format(time.RFC3339), expiresAt.Format(time.RFC3339))
 	
+	c.breaker.Record(err)
 	if err != nil {
 		c.logger.Error("Failed to insert cache entry", zap.Error(err), zap.String("sender", key))
 	}
@@ -119,7 +134,7 @@ func (c *SQLiteCache) Delete(ctx context.Context, senderEmail string) error {
 	_, err := c.db.ExecContext(ctx, `
 		DELETE FROM spam_cache
 		WHERE sender_email = ?
-	`, senderEmail)
+	`, c.encryptor.Encrypt(senderEmail))
 	
 	if err != nil {
 		return fmt.Errorf("failed to delete cache entry: %w", err)
@@ -149,26 +164,9 @@ func (c *SQLiteCache) Cleanup(ctx context.Context) error {
 	return nil
 }
 
-// startCleanupTask starts a background task to clean up expired entries
-func (c *SQLiteCache) startCleanupTask() {
-	ticker := time.NewTicker(c.cleanupFreq)
-	defer ticker.Stop()
-	
-	for {
-		select {
-		case <-ticker.C:
-			if err := c.Cleanup(context.Background()); err != nil {
-				c.logger.Error("Failed to clean up cache", zap.Error(err))
-			}
-		case <-c.stopCh:
-			return
-		}
-	}
-}
-
 // Stop stops the background cleanup task and closes the database connection
 func (c *SQLiteCache) Stop() {
-	close(c.stopCh)
+	c.cleanup.stop()
 	if err := c.db.Close(); err != nil {
 		c.logger.Error("Failed to close SQLite database", zap.Error(err))
 	}
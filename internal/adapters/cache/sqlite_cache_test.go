@@ -0,0 +1,38 @@
+package cache
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"go.uber.org/zap"
+)
+
+func TestSQLiteCacheKeepsConfidenceOfExpiredEntries(t *testing.T) {
+	cache, err := NewSQLiteCache(filepath.Join(t.TempDir(), "cache.db"), zap.NewNop(), time.Hour, 0, nil, nil, true)
+	if err != nil {
+		t.Fatalf("NewSQLiteCache() error = %v", err)
+	}
+	defer cache.Stop()
+
+	ctx := context.Background()
+	cache.Set(ctx, "sender@example.com", &core.SpamAnalysisResult{
+		IsSpam:     true,
+		Score:      0.9,
+		Confidence: 0.8,
+		AnalyzedAt: time.Now(),
+	}, -48*time.Hour)
+
+	if _, found := cache.Get(ctx, "sender@example.com"); found {
+		t.Fatal("Get() found an expired entry")
+	}
+	result, found := cache.GetAllowExpired(ctx, "sender@example.com")
+	if !found {
+		t.Fatal("GetAllowExpired() found no entry")
+	}
+	if !result.IsSpam || float32(result.Score) != 0.9 || float32(result.Confidence) != 0.8 {
+		t.Errorf("got is_spam=%t score=%.2f confidence=%.2f, want true 0.90 0.80", result.IsSpam, result.Score, result.Confidence)
+	}
+}
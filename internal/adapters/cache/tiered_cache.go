@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"go.uber.org/zap"
+)
+
+// Backend is a cache repository that can also delete and clean up entries
+type Backend interface {
+	core.CacheRepository
+	core.StaleCacheReader
+	Delete(ctx context.Context, senderEmail string) error
+	Cleanup(ctx context.Context) error
+	Stop()
+}
+
+// TieredCache is a two-tier implementation of the CacheRepository interface,
+// with a fast in-memory L1 in front of a shared L2 backend such as SQLite or
+// MySQL
+type TieredCache struct {
+	l1     *MemoryCache
+	l2     Backend
+	l1TTL  time.Duration
+	logger *zap.Logger
+}
+
+// NewTieredCache creates a new tiered cache. Entries are kept in L1 for at
+// most l1TTL, which bounds how long L1 can serve an entry changed in L2 by
+// another instance.
+func NewTieredCache(l1 *MemoryCache, l2 Backend, l1TTL time.Duration, logger *zap.Logger) *TieredCache {
+	return &TieredCache{
+		l1:     l1,
+		l2:     l2,
+		l1TTL:  l1TTL,
+		logger: logger,
+	}
+}
+
+// Get retrieves a cached entry for a sender from L1, falling back to L2 and
+// populating L1 on an L2 hit
+func (c *TieredCache) Get(ctx context.Context, senderEmail string) (*core.SpamAnalysisResult, bool) {
+	if result, found := c.l1.Get(ctx, senderEmail); found {
+		return result, true
+	}
+
+	result, found := c.l2.Get(ctx, senderEmail)
+	if !found {
+		return nil, false
+	}
+
+	c.l1.Set(context.Background(), senderEmail, result, c.l1TTL)
+	c.logger.Debug("Populated L1 cache from L2", zap.String("sender", senderEmail))
+
+	return result, true
+}
+
+// GetAllowExpired retrieves a cached entry for a sender from either tier
+// even if it has expired, without populating L1
+func (c *TieredCache) GetAllowExpired(ctx context.Context, senderEmail string) (*core.SpamAnalysisResult, bool) {
+	if result, found := c.l1.Get(ctx, senderEmail); found {
+		return result, true
+	}
+	return c.l2.GetAllowExpired(ctx, senderEmail)
+}
+
+// Set stores a cache entry in both tiers
+func (c *TieredCache) Set(ctx context.Context, key string, result *core.SpamAnalysisResult, ttl time.Duration) {
+	c.l1.Set(ctx, key, result, min(ttl, c.l1TTL))
+	c.l2.Set(ctx, key, result, ttl)
+}
+
+// Delete removes a cache entry from both tiers
+func (c *TieredCache) Delete(ctx context.Context, senderEmail string) error {
+	return errors.Join(c.l1.Delete(ctx, senderEmail), c.l2.Delete(ctx, senderEmail))
+}
+
+// Cleanup removes expired entries from both tiers
+func (c *TieredCache) Cleanup(ctx context.Context) error {
+	return errors.Join(c.l1.Cleanup(ctx), c.l2.Cleanup(ctx))
+}
+
+// Stop stops the background cleanup of both tiers
+func (c *TieredCache) Stop() {
+	c.l1.Stop()
+	c.l2.Stop()
+}
@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"go.uber.org/zap"
+)
+
+// countingBackend is a memory-backed L2 that counts the calls made to it
+type countingBackend struct {
+	*MemoryCache
+	gets, deletes, cleanups int
+}
+
+func newCountingBackend() *countingBackend {
+	return &countingBackend{MemoryCache: NewMemoryCache(zap.NewNop(), time.Hour, 0)}
+}
+
+func (b *countingBackend) Get(ctx context.Context, senderEmail string) (*core.SpamAnalysisResult, bool) {
+	b.gets++
+	return b.MemoryCache.Get(ctx, senderEmail)
+}
+
+func (b *countingBackend) Delete(ctx context.Context, senderEmail string) error {
+	b.deletes++
+	return b.MemoryCache.Delete(ctx, senderEmail)
+}
+
+func (b *countingBackend) Cleanup(ctx context.Context) error {
+	b.cleanups++
+	return b.MemoryCache.Cleanup(ctx)
+}
+
+func newTestTieredCache() (*TieredCache, *MemoryCache, *countingBackend) {
+	l1 := NewMemoryCache(zap.NewNop(), time.Hour, 0)
+	l2 := newCountingBackend()
+	return NewTieredCache(l1, l2, time.Minute, zap.NewNop()), l1, l2
+}
+
+func TestTieredCacheL2HitPopulatesL1(t *testing.T) {
+	cache, l1, l2 := newTestTieredCache()
+	defer cache.Stop()
+
+	ctx := context.Background()
+	l2.MemoryCache.Set(ctx, "sender@example.com", &core.SpamAnalysisResult{IsSpam: true, Score: 0.9}, time.Hour)
+
+	for i := 0; i < 3; i++ {
+		result, found := cache.Get(ctx, "sender@example.com")
+		if !found || !result.IsSpam {
+			t.Fatalf("Get() = %+v, %t, want the L2 entry", result, found)
+		}
+	}
+	if l2.gets != 1 {
+		t.Errorf("L2 gets = %d, want 1 with later gets served from L1", l2.gets)
+	}
+	if _, found := l1.Get(ctx, "sender@example.com"); !found {
+		t.Error("L1 was not populated from L2")
+	}
+}
+
+func TestTieredCacheWritesThroughAndPropagates(t *testing.T) {
+	cache, l1, l2 := newTestTieredCache()
+	defer cache.Stop()
+
+	ctx := context.Background()
+	cache.Set(ctx, "sender@example.com", &core.SpamAnalysisResult{IsSpam: true}, time.Hour)
+	if _, found := l1.Get(ctx, "sender@example.com"); !found {
+		t.Error("Set() did not write to L1")
+	}
+	if _, found := l2.MemoryCache.Get(ctx, "sender@example.com"); !found {
+		t.Error("Set() did not write through to L2")
+	}
+
+	if err := cache.Delete(ctx, "sender@example.com"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, found := cache.Get(ctx, "sender@example.com"); found {
+		t.Error("Get() found a deleted entry")
+	}
+	if err := cache.Cleanup(ctx); err != nil {
+		t.Fatalf("Cleanup() error = %v", err)
+	}
+	if l2.deletes != 1 || l2.cleanups != 1 {
+		t.Errorf("L2 deletes=%d cleanups=%d, want 1 each", l2.deletes, l2.cleanups)
+	}
+}
@@ -0,0 +1,88 @@
+package classifier
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// ClassifyMethod is the full gRPC method name of Classifier.Classify
+const ClassifyMethod = "/spamfilter.classifier.v1.Classifier/Classify"
+
+// Descriptors holds the message descriptors of classifier.proto
+type Descriptors struct {
+	Request  protoreflect.MessageDescriptor
+	Response protoreflect.MessageDescriptor
+}
+
+// field builds a field descriptor
+func field(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, repeated bool) *descriptorpb.FieldDescriptorProto {
+	label := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+	if repeated {
+		label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+	}
+	return &descriptorpb.FieldDescriptorProto{
+		Name:     proto.String(name),
+		JsonName: proto.String(name),
+		Number:   proto.Int32(number),
+		Label:    label.Enum(),
+		Type:     typ.Enum(),
+	}
+}
+
+// NewDescriptors builds the descriptors of classifier.proto, which is not
+// compiled with protoc
+func NewDescriptors() (*Descriptors, error) {
+	file := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("classifier.proto"),
+		Package: proto.String("spamfilter.classifier.v1"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("ClassifyRequest"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("from", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, false),
+					field("to", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, true),
+					field("subject", 3, descriptorpb.FieldDescriptorProto_TYPE_STRING, false),
+					field("body", 4, descriptorpb.FieldDescriptorProto_TYPE_STRING, false),
+				},
+			},
+			{
+				Name: proto.String("ClassifyResponse"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("score", 1, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, false),
+					field("confidence", 2, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, false),
+					field("explanation", 3, descriptorpb.FieldDescriptorProto_TYPE_STRING, false),
+				},
+			},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{
+			{
+				Name: proto.String("Classifier"),
+				Method: []*descriptorpb.MethodDescriptorProto{
+					{
+						Name:       proto.String("Classify"),
+						InputType:  proto.String(".spamfilter.classifier.v1.ClassifyRequest"),
+						OutputType: proto.String(".spamfilter.classifier.v1.ClassifyResponse"),
+					},
+				},
+			},
+		},
+	}
+
+	// Resolve against an empty registry so the descriptors never clash
+	// with registered files
+	fd, err := protodesc.NewFile(file, new(protoregistry.Files))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build classifier descriptors: %w", err)
+	}
+
+	return &Descriptors{
+		Request:  fd.Messages().ByName("ClassifyRequest"),
+		Response: fd.Messages().ByName("ClassifyResponse"),
+	}, nil
+}
@@ -0,0 +1,56 @@
+package classifier
+
+import (
+	"crypto/tls"
+	"fmt"
+
+	"github.com/mikey/llm-spam-filter/internal/config"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Factory creates external classifier clients
+type Factory struct {
+	cfg    *config.Config
+	logger *zap.Logger
+}
+
+// NewFactory creates a new external classifier factory
+func NewFactory(cfg *config.Config, logger *zap.Logger) *Factory {
+	return &Factory{
+		cfg:    cfg,
+		logger: logger,
+	}
+}
+
+// CreateClient creates a new client for the configured classifier
+func (f *Factory) CreateClient() (*Client, error) {
+	grpcCfg := f.cfg.GetGRPC()
+	if grpcCfg.Address == "" {
+		return nil, fmt.Errorf("grpc.address is required for the grpc provider")
+	}
+
+	creds := insecure.NewCredentials()
+	if grpcCfg.TLS {
+		creds = credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+	}
+
+	conn, err := grpc.NewClient(grpcCfg.Address, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create classifier client: %w", err)
+	}
+
+	descriptors, err := NewDescriptors()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	f.logger.Info("Using external classifier",
+		zap.String("address", grpcCfg.Address),
+		zap.Bool("tls", grpcCfg.TLS))
+
+	return NewClient(conn, grpcCfg.Address, descriptors, f.logger), nil
+}
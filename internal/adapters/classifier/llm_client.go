@@ -0,0 +1,89 @@
+package classifier
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Client is an implementation of the LLMClient interface that asks an
+// external classifier served over gRPC for a score
+type Client struct {
+	conn        *grpc.ClientConn
+	address     string
+	descriptors *Descriptors
+	logger      *zap.Logger
+}
+
+// NewClient creates a new external classifier client
+func NewClient(conn *grpc.ClientConn, address string, descriptors *Descriptors, logger *zap.Logger) *Client {
+	return &Client{
+		conn:        conn,
+		address:     address,
+		descriptors: descriptors,
+		logger:      logger,
+	}
+}
+
+// AnalyzeEmail sends an email to the classifier and returns its score. The
+// verdict is decided by the spam filter service's threshold.
+func (c *Client) AnalyzeEmail(ctx context.Context, email *core.Email) (*core.SpamAnalysisResult, error) {
+	req := dynamicpb.NewMessage(c.descriptors.Request)
+	fields := c.descriptors.Request.Fields()
+	req.Set(fields.ByName("from"), protoreflect.ValueOfString(email.From))
+	to := req.Mutable(fields.ByName("to")).List()
+	for _, recipient := range email.To {
+		to.Append(protoreflect.ValueOfString(recipient))
+	}
+	req.Set(fields.ByName("subject"), protoreflect.ValueOfString(email.Subject))
+	// The body is left out of subject-only classifications
+	if !email.SubjectOnly {
+		req.Set(fields.ByName("body"), protoreflect.ValueOfString(email.Body))
+	}
+
+	resp := dynamicpb.NewMessage(c.descriptors.Response)
+	if err := c.conn.Invoke(ctx, ClassifyMethod, req, resp); err != nil {
+		return nil, fmt.Errorf("failed to call classifier: %w", err)
+	}
+
+	respFields := c.descriptors.Response.Fields()
+	score := resp.Get(respFields.ByName("score")).Float()
+	if score < 0 || score > 1 {
+		return nil, fmt.Errorf("classifier returned score %g outside 0-1", score)
+	}
+	explanation := resp.Get(respFields.ByName("explanation")).String()
+	if explanation == "" {
+		explanation = "Scored by external classifier"
+	}
+
+	core.ContextLogger(ctx, c.logger).Debug("Classifier response",
+		zap.String("address", c.address),
+		zap.Float64("score", score))
+
+	return &core.SpamAnalysisResult{
+		Score:       score,
+		Confidence:  resp.Get(respFields.ByName("confidence")).Float(),
+		Explanation: explanation,
+		AnalyzedAt:  time.Now(),
+		ModelUsed:   "grpc:" + c.address,
+		Provider:    "grpc",
+	}, nil
+}
+
+// Validate checks that the classifier is reachable with a tiny
+// classification
+func (c *Client) Validate(ctx context.Context) error {
+	_, err := c.AnalyzeEmail(ctx, core.ProbeEmail())
+	return err
+}
+
+// Close closes the connection to the classifier
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
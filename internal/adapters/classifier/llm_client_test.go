@@ -0,0 +1,149 @@
+package classifier
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// fakeClassifier is an in-process Classifier service returning a fixed
+// score and recording the requests it receives
+type fakeClassifier struct {
+	descriptors *Descriptors
+	score       float64
+	confidence  float64
+	explanation string
+
+	mu       sync.Mutex
+	requests []*dynamicpb.Message
+}
+
+func (f *fakeClassifier) classify(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	req := dynamicpb.NewMessage(f.descriptors.Request)
+	if err := dec(req); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	f.requests = append(f.requests, req)
+	f.mu.Unlock()
+
+	resp := dynamicpb.NewMessage(f.descriptors.Response)
+	fields := f.descriptors.Response.Fields()
+	resp.Set(fields.ByName("score"), protoreflect.ValueOfFloat64(f.score))
+	resp.Set(fields.ByName("confidence"), protoreflect.ValueOfFloat64(f.confidence))
+	resp.Set(fields.ByName("explanation"), protoreflect.ValueOfString(f.explanation))
+	return resp, nil
+}
+
+func (f *fakeClassifier) lastRequest() *dynamicpb.Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests[len(f.requests)-1]
+}
+
+// newTestClient serves classifier on an in-memory listener and returns a
+// client connected to it
+func newTestClient(t *testing.T, classifier *fakeClassifier) *Client {
+	t.Helper()
+	descriptors, err := NewDescriptors()
+	if err != nil {
+		t.Fatalf("NewDescriptors() error = %v", err)
+	}
+	classifier.descriptors = descriptors
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	server.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "spamfilter.classifier.v1.Classifier",
+		HandlerType: (*interface{})(nil),
+		Methods:     []grpc.MethodDesc{{MethodName: "Classify", Handler: classifier.classify}},
+	}, classifier)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///classifier",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	client := NewClient(conn, "classifier", descriptors, zap.NewNop())
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func testEmail() *core.Email {
+	return &core.Email{
+		From:    "sender@example.com",
+		To:      []string{"one@example.org", "two@example.org"},
+		Subject: "You have won",
+		Body:    "Claim your prize now.",
+	}
+}
+
+func TestAnalyzeEmailReturnsClassifierScore(t *testing.T) {
+	classifier := &fakeClassifier{score: 0.85, confidence: 0.6, explanation: "prize scam"}
+	client := newTestClient(t, classifier)
+
+	result, err := client.AnalyzeEmail(context.Background(), testEmail())
+	if err != nil {
+		t.Fatalf("AnalyzeEmail() error = %v", err)
+	}
+	if result.Score != 0.85 || result.Confidence != 0.6 || result.Explanation != "prize scam" {
+		t.Errorf("got score=%v confidence=%v explanation=%q, want 0.85 0.6 %q", result.Score, result.Confidence, result.Explanation, "prize scam")
+	}
+	if result.Provider != "grpc" || result.ModelUsed != "grpc:classifier" {
+		t.Errorf("got provider=%q model=%q, want grpc grpc:classifier", result.Provider, result.ModelUsed)
+	}
+
+	req := classifier.lastRequest()
+	fields := classifier.descriptors.Request.Fields()
+	if from := req.Get(fields.ByName("from")).String(); from != "sender@example.com" {
+		t.Errorf("request from = %q, want sender@example.com", from)
+	}
+	if to := req.Get(fields.ByName("to")).List(); to.Len() != 2 || to.Get(1).String() != "two@example.org" {
+		t.Errorf("request to has %d recipients, want both", to.Len())
+	}
+	if body := req.Get(fields.ByName("body")).String(); body != "Claim your prize now." {
+		t.Errorf("request body = %q, want the email body", body)
+	}
+}
+
+func TestAnalyzeEmailLeavesOutBodyWhenSubjectOnly(t *testing.T) {
+	classifier := &fakeClassifier{score: 0.1}
+	client := newTestClient(t, classifier)
+
+	email := testEmail()
+	email.SubjectOnly = true
+	result, err := client.AnalyzeEmail(context.Background(), email)
+	if err != nil {
+		t.Fatalf("AnalyzeEmail() error = %v", err)
+	}
+	if result.Explanation != "Scored by external classifier" {
+		t.Errorf("Explanation = %q, want the default explanation", result.Explanation)
+	}
+	if body := classifier.lastRequest().Get(classifier.descriptors.Request.Fields().ByName("body")).String(); body != "" {
+		t.Errorf("request body = %q, want none", body)
+	}
+}
+
+func TestAnalyzeEmailRejectsOutOfRangeScore(t *testing.T) {
+	client := newTestClient(t, &fakeClassifier{score: 7.5})
+
+	_, err := client.AnalyzeEmail(context.Background(), testEmail())
+	if err == nil || !strings.Contains(err.Error(), "outside 0-1") {
+		t.Errorf("AnalyzeEmail() error = %v, want an out of range score error", err)
+	}
+}
@@ -0,0 +1,97 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"go.uber.org/zap"
+)
+
+// Modes for requests over the concurrency cap
+const (
+	// ModeWait waits for a slot until the request's context is done
+	ModeWait = "wait"
+	// ModeFail fails the request immediately
+	ModeFail = "fail"
+)
+
+// ErrAtCapacity is returned in ModeFail when the cap is reached
+var ErrAtCapacity = errors.New("provider is at its concurrency cap")
+
+// Client is an implementation of the LLMClient interface that caps the
+// number of analyses in flight to a provider, to stay within its rate limits
+type Client struct {
+	client   core.LLMClient
+	provider string
+	mode     string
+	slots    chan struct{}
+	logger   *zap.Logger
+}
+
+// NewClient creates a client allowing at most maxConcurrent analyses in
+// flight through client at once
+func NewClient(client core.LLMClient, provider string, maxConcurrent int, mode string, logger *zap.Logger) (*Client, error) {
+	if maxConcurrent <= 0 {
+		return nil, fmt.Errorf("invalid concurrency cap %d for %s, expected at least 1", maxConcurrent, provider)
+	}
+
+	switch mode {
+	case ModeWait, ModeFail:
+	default:
+		return nil, fmt.Errorf("unsupported concurrency mode: %s", mode)
+	}
+
+	return &Client{
+		client:   client,
+		provider: provider,
+		mode:     mode,
+		slots:    make(chan struct{}, maxConcurrent),
+		logger:   logger,
+	}, nil
+}
+
+// AnalyzeEmail analyzes an email once a slot is free
+func (c *Client) AnalyzeEmail(ctx context.Context, email *core.Email) (*core.SpamAnalysisResult, error) {
+	if err := c.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer func() { <-c.slots }()
+
+	return c.client.AnalyzeEmail(ctx, email)
+}
+
+// acquire takes a slot, waiting for one in ModeWait
+func (c *Client) acquire(ctx context.Context) error {
+	select {
+	case c.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	if c.mode == ModeFail {
+		core.ContextLogger(ctx, c.logger).Warn("Rejecting analysis over the concurrency cap",
+			zap.String("provider", c.provider),
+			zap.Int("max_concurrent", cap(c.slots)))
+		return fmt.Errorf("%w (%s, %d in flight)", ErrAtCapacity, c.provider, cap(c.slots))
+	}
+
+	core.ContextLogger(ctx, c.logger).Debug("Waiting for a free slot",
+		zap.String("provider", c.provider),
+		zap.Int("max_concurrent", cap(c.slots)))
+	select {
+	case c.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for %s concurrency slot: %w", c.provider, ctx.Err())
+	}
+}
+
+// Close closes the wrapped client if it holds resources
+func (c *Client) Close() error {
+	if closer, ok := c.client.(interface{ Close() error }); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"go.uber.org/zap"
+)
+
+// trackingLLM is an LLMClient recording the most analyses it had in flight
+// at once, each taking delay
+type trackingLLM struct {
+	delay time.Duration
+
+	mu       sync.Mutex
+	inFlight int
+	peak     int
+	calls    int
+}
+
+func (c *trackingLLM) AnalyzeEmail(ctx context.Context, email *core.Email) (*core.SpamAnalysisResult, error) {
+	c.mu.Lock()
+	c.inFlight++
+	c.calls++
+	c.peak = max(c.peak, c.inFlight)
+	c.mu.Unlock()
+
+	time.Sleep(c.delay)
+
+	c.mu.Lock()
+	c.inFlight--
+	c.mu.Unlock()
+	return &core.SpamAnalysisResult{Score: 0.1}, nil
+}
+
+func TestClientNeverExceedsCap(t *testing.T) {
+	llm := &trackingLLM{delay: 10 * time.Millisecond}
+	client, err := NewClient(llm, "openai", 3, ModeWait, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.AnalyzeEmail(context.Background(), &core.Email{}); err != nil {
+				t.Errorf("AnalyzeEmail() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if llm.calls != 20 {
+		t.Errorf("calls = %d, want 20", llm.calls)
+	}
+	if llm.peak > 3 {
+		t.Errorf("peak in flight = %d, want at most 3", llm.peak)
+	}
+}
+
+func TestFailModeRejectsOverCap(t *testing.T) {
+	llm := &trackingLLM{delay: 100 * time.Millisecond}
+	client, err := NewClient(llm, "openai", 1, ModeFail, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		client.AnalyzeEmail(context.Background(), &core.Email{})
+	}()
+	// Wait for the first analysis to take the only slot
+	for deadline := time.Now().Add(time.Second); len(client.slots) == 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := client.AnalyzeEmail(context.Background(), &core.Email{}); !errors.Is(err, ErrAtCapacity) {
+		t.Errorf("AnalyzeEmail() over the cap error = %v, want ErrAtCapacity", err)
+	}
+	<-done
+}
+
+func TestWaitModeGivesUpWithContext(t *testing.T) {
+	client, err := NewClient(&trackingLLM{}, "openai", 1, ModeWait, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	client.slots <- struct{}{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := client.AnalyzeEmail(ctx, &core.Email{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("AnalyzeEmail() error = %v, want the context's deadline", err)
+	}
+}
+
+func TestNewClientValidates(t *testing.T) {
+	if _, err := NewClient(&trackingLLM{}, "openai", 0, ModeWait, zap.NewNop()); err == nil {
+		t.Error("NewClient() with a cap of 0 succeeded, want an error")
+	}
+	if _, err := NewClient(&trackingLLM{}, "openai", 1, "queue", zap.NewNop()); err == nil {
+		t.Error("NewClient() with an unknown mode succeeded, want an error")
+	}
+}
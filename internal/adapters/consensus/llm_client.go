@@ -0,0 +1,158 @@
+package consensus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"go.uber.org/zap"
+)
+
+// Member is a provider taking part in the consensus, whose score counts in
+// proportion to Weight
+type Member struct {
+	Name   string
+	Client core.LLMClient
+	Weight float64
+}
+
+// Client is an implementation of the LLMClient interface that asks several
+// providers at once and combines their scores by weight, so that no single
+// model decides alone
+type Client struct {
+	members []Member
+	logger  *zap.Logger
+}
+
+// NewClient creates a new consensus client. Weights must not be negative,
+// and at least one must be positive.
+func NewClient(members []Member, logger *zap.Logger) (*Client, error) {
+	if len(members) == 0 {
+		return nil, errors.New("consensus requires at least one provider")
+	}
+	total := 0.0
+	for i, member := range members {
+		if member.Client == nil {
+			return nil, fmt.Errorf("consensus provider %d has no client", i+1)
+		}
+		if member.Weight < 0 {
+			return nil, fmt.Errorf("consensus provider %s has negative weight %g", member.Name, member.Weight)
+		}
+		total += member.Weight
+	}
+	if total <= 0 {
+		return nil, errors.New("consensus requires a provider with a positive weight")
+	}
+
+	return &Client{
+		members: members,
+		logger:  logger,
+	}, nil
+}
+
+// AnalyzeEmail analyzes an email with every provider in parallel and
+// combines their scores into a weighted mean. Providers that fail are left
+// out, and the weights of the rest re-normalized, so the analysis only
+// fails if every provider does.
+func (c *Client) AnalyzeEmail(ctx context.Context, email *core.Email) (*core.SpamAnalysisResult, error) {
+	results := make([]*core.SpamAnalysisResult, len(c.members))
+	errs := make([]error, len(c.members))
+	var wg sync.WaitGroup
+	for i, member := range c.members {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = member.Client.AnalyzeEmail(ctx, email)
+		}()
+	}
+	wg.Wait()
+
+	logger := core.ContextLogger(ctx, c.logger)
+	verdicts := make([]core.ProviderVerdict, len(c.members))
+	var score, confidence, spamWeight, totalWeight float64
+	var explanations []string
+	for i, member := range c.members {
+		verdicts[i] = core.ProviderVerdict{Provider: member.Name, Weight: member.Weight}
+		if errs[i] == nil && results[i] == nil {
+			errs[i] = errors.New("no result")
+		}
+		if errs[i] != nil {
+			verdicts[i].Error = errs[i].Error()
+			logger.Warn("Consensus provider failed, leaving it out",
+				zap.String("provider", member.Name),
+				zap.Error(errs[i]))
+			continue
+		}
+
+		result := results[i]
+		verdicts[i].IsSpam = result.IsSpam
+		verdicts[i].Score = result.Score
+		verdicts[i].Responded = true
+		if member.Weight == 0 {
+			continue
+		}
+		totalWeight += member.Weight
+		score += member.Weight * result.Score
+		confidence += member.Weight * result.Confidence
+		if result.IsSpam {
+			spamWeight += member.Weight
+		}
+		if result.Explanation != "" {
+			explanations = append(explanations, fmt.Sprintf("%s: %s", member.Name, result.Explanation))
+		}
+	}
+
+	if totalWeight == 0 {
+		return nil, fmt.Errorf("no consensus provider responded: %w", errors.Join(errs...))
+	}
+
+	result := &core.SpamAnalysisResult{
+		IsSpam:           spamWeight/totalWeight >= 0.5,
+		Score:            score / totalWeight,
+		Confidence:       confidence / totalWeight,
+		Explanation:      strings.Join(explanations, " "),
+		ModelUsed:        "consensus",
+		Provider:         "consensus",
+		ProviderVerdicts: verdicts,
+	}
+
+	fields := []zap.Field{zap.Float64("score", result.Score)}
+	for _, verdict := range verdicts {
+		if verdict.Responded {
+			fields = append(fields, zap.Float64(verdict.Provider+"_score", verdict.Score))
+		}
+	}
+	logger.Info("Combined provider scores", fields...)
+
+	return result, nil
+}
+
+// Validate validates each provider's client
+func (c *Client) Validate(ctx context.Context) error {
+	for _, member := range c.members {
+		validator, ok := member.Client.(core.Validator)
+		if !ok {
+			continue
+		}
+		if err := validator.Validate(ctx); err != nil {
+			return fmt.Errorf("provider %s: %w", member.Name, err)
+		}
+	}
+	return nil
+}
+
+// Close closes the providers' clients that hold resources
+func (c *Client) Close() error {
+	var errs []error
+	for _, member := range c.members {
+		if closer, ok := member.Client.(interface{ Close() error }); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
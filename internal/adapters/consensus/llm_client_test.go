@@ -0,0 +1,115 @@
+package consensus
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"go.uber.org/zap"
+)
+
+// fixedLLM is an LLMClient returning a fixed score, or error
+type fixedLLM struct {
+	score float64
+	err   error
+}
+
+func (c *fixedLLM) AnalyzeEmail(ctx context.Context, email *core.Email) (*core.SpamAnalysisResult, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &core.SpamAnalysisResult{IsSpam: c.score >= 0.5, Score: c.score, Confidence: 0.8, Explanation: "checked"}, nil
+}
+
+func testEmail() *core.Email {
+	return &core.Email{From: "sender@example.com", To: []string{"user@example.org"}, Subject: "Hello", Body: "Just checking in."}
+}
+
+func TestWeightedScoresCombine(t *testing.T) {
+	tests := []struct {
+		name    string
+		members []Member
+		score   float64
+		isSpam  bool
+	}{
+		{
+			name: "both respond",
+			members: []Member{
+				{Name: "openai", Client: &fixedLLM{score: 0.9}, Weight: 2},
+				{Name: "gemini", Client: &fixedLLM{score: 0.3}, Weight: 1},
+			},
+			score:  0.7,
+			isSpam: true,
+		},
+		{
+			name: "heavier provider fails",
+			members: []Member{
+				{Name: "openai", Client: &fixedLLM{err: errors.New("timeout")}, Weight: 2},
+				{Name: "gemini", Client: &fixedLLM{score: 0.3}, Weight: 1},
+			},
+			score:  0.3,
+			isSpam: false,
+		},
+		{
+			name: "zero weight only recorded",
+			members: []Member{
+				{Name: "openai", Client: &fixedLLM{score: 0.9}, Weight: 1},
+				{Name: "shadow", Client: &fixedLLM{score: 0.1}, Weight: 0},
+			},
+			score:  0.9,
+			isSpam: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClient(tt.members, zap.NewNop())
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+			result, err := client.AnalyzeEmail(context.Background(), testEmail())
+			if err != nil {
+				t.Fatalf("AnalyzeEmail() error = %v", err)
+			}
+			if math.Abs(result.Score-tt.score) > 1e-9 || result.IsSpam != tt.isSpam {
+				t.Errorf("got score=%v is_spam=%t, want %v %t", result.Score, result.IsSpam, tt.score, tt.isSpam)
+			}
+
+			if len(result.ProviderVerdicts) != len(tt.members) {
+				t.Fatalf("verdicts = %+v, want one per provider", result.ProviderVerdicts)
+			}
+			for i, verdict := range result.ProviderVerdicts {
+				member := tt.members[i]
+				failed := member.Client.(*fixedLLM).err != nil
+				if verdict.Provider != member.Name || verdict.Weight != member.Weight || verdict.Responded == failed || (verdict.Error != "") != failed {
+					t.Errorf("verdict %d = %+v, want %s's own verdict", i, verdict, member.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestConsensusFailsWhenNoProviderResponds(t *testing.T) {
+	client, _ := NewClient([]Member{
+		{Name: "openai", Client: &fixedLLM{err: errors.New("timeout")}, Weight: 1},
+		{Name: "gemini", Client: &fixedLLM{err: errors.New("quota")}, Weight: 1},
+	}, zap.NewNop())
+	if _, err := client.AnalyzeEmail(context.Background(), testEmail()); err == nil {
+		t.Error("AnalyzeEmail() error = nil, want an error when every provider fails")
+	}
+}
+
+func TestNewClientValidatesWeights(t *testing.T) {
+	tests := map[string][]Member{
+		"no providers":    nil,
+		"negative weight": {{Name: "openai", Client: &fixedLLM{}, Weight: -1}},
+		"all zero":        {{Name: "openai", Client: &fixedLLM{}, Weight: 0}},
+		"missing client":  {{Name: "openai", Weight: 1}},
+	}
+	for name, members := range tests {
+		if _, err := NewClient(members, zap.NewNop()); err == nil {
+			t.Errorf("NewClient() with %s error = nil, want an error", name)
+		}
+	}
+}
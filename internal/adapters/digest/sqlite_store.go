@@ -0,0 +1,156 @@
+package digest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"go.uber.org/zap"
+)
+
+// SQLiteStore is a DigestStore that keeps rejected messages in a SQLite
+// table, which may share a database with the SQLite cache
+type SQLiteStore struct {
+	db     *sql.DB
+	logger *zap.Logger
+}
+
+// NewSQLiteStore creates a new SQLite digest store
+func NewSQLiteStore(dbPath string, logger *zap.Logger) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite database: %w", err)
+	}
+
+	// Create table if it doesn't exist
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS spam_digest (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			sender TEXT,
+			subject TEXT,
+			score REAL,
+			reason TEXT,
+			rejected_at TIMESTAMP,
+			count INTEGER NOT NULL DEFAULT 1
+		)
+	`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create digest table: %w", err)
+	}
+
+	// Digests created before identical messages were collapsed lack the
+	// count column
+	if err := addCountColumn(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	// Create index on rejected_at for listing and pruning
+	_, err = db.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_rejected_at ON spam_digest(rejected_at)
+	`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create digest index: %w", err)
+	}
+
+	return &SQLiteStore{
+		db:     db,
+		logger: logger,
+	}, nil
+}
+
+// addCountColumn adds the count column to a digest table without one
+func addCountColumn(db *sql.DB) error {
+	rows, err := db.Query(`PRAGMA table_info(spam_digest)`)
+	if err != nil {
+		return fmt.Errorf("failed to read digest table: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, columnType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &pk); err != nil {
+			return fmt.Errorf("failed to read digest table: %w", err)
+		}
+		if name == "count" {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read digest table: %w", err)
+	}
+
+	if _, err := db.Exec(`ALTER TABLE spam_digest ADD COLUMN count INTEGER NOT NULL DEFAULT 1`); err != nil {
+		return fmt.Errorf("failed to add digest count column: %w", err)
+	}
+	return nil
+}
+
+// Record adds a rejected message to the digest. Times are stored in UTC so
+// that they sort as text.
+func (s *SQLiteStore) Record(ctx context.Context, entry core.DigestEntry) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO spam_digest (sender, subject, score, reason, rejected_at, count)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, entry.Sender, entry.Subject, entry.Score, entry.Reason, entry.RejectedAt.UTC().Format(time.RFC3339), max(entry.Count, 1))
+	if err != nil {
+		return fmt.Errorf("failed to insert digest entry: %w", err)
+	}
+	return nil
+}
+
+// List returns the messages rejected since the given time, oldest first
+func (s *SQLiteStore) List(ctx context.Context, since time.Time) ([]core.DigestEntry, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT sender, subject, score, reason, rejected_at, count
+		FROM spam_digest
+		WHERE rejected_at >= ?
+		ORDER BY rejected_at, id
+	`, since.UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query digest: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []core.DigestEntry
+	for rows.Next() {
+		var entry core.DigestEntry
+		var rejectedAt string
+		if err := rows.Scan(&entry.Sender, &entry.Subject, &entry.Score, &entry.Reason, &rejectedAt, &entry.Count); err != nil {
+			return nil, fmt.Errorf("failed to read digest entry: %w", err)
+		}
+		if entry.RejectedAt, err = time.Parse(time.RFC3339, rejectedAt); err != nil {
+			return nil, fmt.Errorf("failed to parse rejected_at timestamp: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// Prune removes messages rejected before the given time
+func (s *SQLiteStore) Prune(ctx context.Context, before time.Time) error {
+	result, err := s.db.ExecContext(ctx, `
+		DELETE FROM spam_digest
+		WHERE rejected_at < ?
+	`, before.UTC().Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to prune digest: %w", err)
+	}
+
+	if rowsAffected, err := result.RowsAffected(); err == nil && rowsAffected > 0 {
+		s.logger.Info("Pruned digest entries", zap.Int64("count", rowsAffected))
+	}
+	return nil
+}
+
+// Close closes the database
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,77 @@
+package digest
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"go.uber.org/zap"
+)
+
+func newTestStore(t *testing.T) *SQLiteStore {
+	t.Helper()
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "digest.db"), zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() error = %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestRecordedRejectionAppearsInDigest(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	entries := []core.DigestEntry{
+		{Sender: "old@example.com", Subject: "Old news", Score: 0.8, RejectedAt: now.Add(-48 * time.Hour)},
+		{Sender: "spammer@example.com", Subject: "You have won", Score: 0.95, Reason: "Prize scam", RejectedAt: now.Add(-time.Hour)},
+	}
+	for _, entry := range entries {
+		if err := store.Record(ctx, entry); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+
+	since := now.Add(-24 * time.Hour)
+	listed, err := store.List(ctx, since)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(listed) != 1 || listed[0].Sender != "spammer@example.com" || listed[0].Count != 1 {
+		t.Fatalf("List() = %+v, want only the recent rejection", listed)
+	}
+
+	digest := core.FormatDigest(listed, since)
+	for _, want := range []string{"1 messages", "From:    spammer@example.com", "Subject: You have won", "Reason:  Prize scam"} {
+		if !strings.Contains(digest, want) {
+			t.Errorf("digest = %q, want %q", digest, want)
+		}
+	}
+}
+
+func TestPruneRemovesOldRejections(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	for _, age := range []time.Duration{72 * time.Hour, time.Hour} {
+		if err := store.Record(ctx, core.DigestEntry{Sender: "spammer@example.com", RejectedAt: now.Add(-age)}); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+	if err := store.Prune(ctx, now.Add(-24*time.Hour)); err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+
+	listed, err := store.List(ctx, time.Time{})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(listed) != 1 {
+		t.Errorf("List() after Prune() = %+v, want only the recent rejection", listed)
+	}
+}
@@ -0,0 +1,124 @@
+package digest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"go.uber.org/zap"
+)
+
+// flushTimeout bounds recording a collapsed entry once its window closes
+const flushTimeout = 5 * time.Second
+
+// Throttle is a DigestStore that collapses identical rejected messages,
+// such as a spam campaign, arriving within a window into one entry with a
+// count, so a campaign doesn't flood the digest
+type Throttle struct {
+	store  core.DigestStore
+	window time.Duration
+	logger *zap.Logger
+
+	mu      sync.Mutex
+	pending map[string]*pendingEntry
+}
+
+// pendingEntry is the first of a group of identical messages, waiting for
+// its window to close
+type pendingEntry struct {
+	entry core.DigestEntry
+	timer *time.Timer
+}
+
+// NewThrottle creates a store collapsing identical messages rejected within
+// window of the first before recording them in store
+func NewThrottle(store core.DigestStore, window time.Duration, logger *zap.Logger) *Throttle {
+	return &Throttle{
+		store:   store,
+		window:  window,
+		logger:  logger,
+		pending: make(map[string]*pendingEntry),
+	}
+}
+
+// Record counts a message against an identical one rejected within the
+// window, or holds it for the window before recording it. Messages without
+// a content hash are recorded at once.
+func (t *Throttle) Record(ctx context.Context, entry core.DigestEntry) error {
+	if entry.ContentHash == "" {
+		return t.store.Record(ctx, entry)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if pending, ok := t.pending[entry.ContentHash]; ok {
+		pending.entry.Count++
+		return nil
+	}
+
+	if entry.Count < 1 {
+		entry.Count = 1
+	}
+	hash := entry.ContentHash
+	t.pending[hash] = &pendingEntry{
+		entry: entry,
+		timer: time.AfterFunc(t.window, func() { t.flush(hash) }),
+	}
+	return nil
+}
+
+// flush records the collapsed entry for a content hash once its window
+// has closed
+func (t *Throttle) flush(hash string) {
+	t.mu.Lock()
+	pending, ok := t.pending[hash]
+	delete(t.pending, hash)
+	t.mu.Unlock()
+	if !ok {
+		return
+	}
+	t.record(pending.entry)
+}
+
+// record writes a collapsed entry to the store, logging failures since
+// the message that caused it has long been rejected
+func (t *Throttle) record(entry core.DigestEntry) {
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+	if err := t.store.Record(ctx, entry); err != nil {
+		t.logger.Error("Failed to record rejected spam in the digest",
+			zap.Error(err),
+			zap.String("from", entry.Sender),
+			zap.Int("count", entry.Count))
+	}
+}
+
+// List returns the messages rejected since the given time. Entries still
+// waiting for their window to close are not included.
+func (t *Throttle) List(ctx context.Context, since time.Time) ([]core.DigestEntry, error) {
+	return t.store.List(ctx, since)
+}
+
+// Prune removes messages rejected before the given time
+func (t *Throttle) Prune(ctx context.Context, before time.Time) error {
+	return t.store.Prune(ctx, before)
+}
+
+// Close records the entries waiting for their window to close and closes
+// the store
+func (t *Throttle) Close() error {
+	t.mu.Lock()
+	pending := t.pending
+	t.pending = make(map[string]*pendingEntry)
+	t.mu.Unlock()
+
+	for _, p := range pending {
+		p.timer.Stop()
+		t.record(p.entry)
+	}
+	if closer, ok := t.store.(interface{ Close() error }); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package digest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"go.uber.org/zap"
+)
+
+// campaignEntry returns a rejected message from a campaign whose messages
+// share a content hash
+func campaignEntry(sender, hash string) core.DigestEntry {
+	return core.DigestEntry{Sender: sender, Subject: "You have won", Score: 0.95, RejectedAt: time.Now(), ContentHash: hash}
+}
+
+// waitForEntries lists store until it holds want entries or a second passes
+func waitForEntries(t *testing.T, store core.DigestStore, want int) []core.DigestEntry {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		entries, err := store.List(context.Background(), time.Time{})
+		if err != nil {
+			t.Fatalf("List() error = %v", err)
+		}
+		if len(entries) >= want || time.Now().After(deadline) {
+			return entries
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestThrottleCollapsesIdenticalMessages(t *testing.T) {
+	store := newTestStore(t)
+	throttle := NewThrottle(store, 100*time.Millisecond, zap.NewNop())
+
+	const n = 5
+	for i := 0; i < n; i++ {
+		if err := throttle.Record(context.Background(), campaignEntry("spammer@example.com", "campaign")); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+	throttle.Record(context.Background(), campaignEntry("other@example.com", "other"))
+
+	if entries, _ := store.List(context.Background(), time.Time{}); len(entries) != 0 {
+		t.Fatalf("store has %d entries before the window closed, want none", len(entries))
+	}
+
+	entries := waitForEntries(t, store, 2)
+	if len(entries) != 2 {
+		t.Fatalf("store has %d entries, want one per campaign", len(entries))
+	}
+	counts := make(map[string]int)
+	for _, entry := range entries {
+		counts[entry.Sender] = entry.Count
+	}
+	if counts["spammer@example.com"] != n || counts["other@example.com"] != 1 {
+		t.Errorf("counts = %v, want %d for the campaign and 1 for the other message", counts, n)
+	}
+}
+
+func TestThrottleRecordsUnhashedMessagesAtOnce(t *testing.T) {
+	store := newTestStore(t)
+	throttle := NewThrottle(store, time.Hour, zap.NewNop())
+
+	throttle.Record(context.Background(), campaignEntry("spammer@example.com", ""))
+	if entries, _ := store.List(context.Background(), time.Time{}); len(entries) != 1 {
+		t.Errorf("store has %d entries, want the message recorded at once", len(entries))
+	}
+}
+
+// memoryStore is a DigestStore keeping entries in memory, still readable
+// once closed
+type memoryStore struct {
+	entries []core.DigestEntry
+	closed  bool
+}
+
+func (s *memoryStore) Record(ctx context.Context, entry core.DigestEntry) error {
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+func (s *memoryStore) List(ctx context.Context, since time.Time) ([]core.DigestEntry, error) {
+	return s.entries, nil
+}
+
+func (s *memoryStore) Prune(ctx context.Context, before time.Time) error {
+	return nil
+}
+
+func (s *memoryStore) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestThrottleCloseRecordsPendingEntries(t *testing.T) {
+	store := &memoryStore{}
+	throttle := NewThrottle(store, time.Hour, zap.NewNop())
+
+	for i := 0; i < 3; i++ {
+		throttle.Record(context.Background(), campaignEntry("spammer@example.com", "campaign"))
+	}
+	if len(store.entries) != 0 {
+		t.Fatalf("store has %d entries before the window closed, want none", len(store.entries))
+	}
+
+	if err := throttle.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if len(store.entries) != 1 || store.entries[0].Count != 3 || !store.closed {
+		t.Errorf("entries = %+v, closed = %t, want the pending campaign recorded and the store closed", store.entries, store.closed)
+	}
+}
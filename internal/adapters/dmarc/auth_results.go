@@ -0,0 +1,77 @@
+package dmarc
+
+import (
+	"strings"
+)
+
+// AuthResult is a passing SPF or DKIM result and the domain it is for
+type AuthResult struct {
+	Method string
+	Domain string
+}
+
+// ParseAuthenticationResults returns the passing SPF and DKIM results from
+// an Authentication-Results header, such as
+// "mx.example.com; spf=pass smtp.mailfrom=bob@example.com; dkim=pass header.d=example.com",
+// along with the header's authserv-id
+func ParseAuthenticationResults(header string) (string, []AuthResult) {
+	specs := strings.Split(stripComments(header), ";")
+
+	// The authserv-id may be followed by a version
+	fields := strings.Fields(specs[0])
+	authservID := ""
+	if len(fields) > 0 {
+		authservID = strings.ToLower(fields[0])
+	}
+
+	var results []AuthResult
+	for _, spec := range specs[1:] {
+		fields := strings.Fields(spec)
+		if len(fields) == 0 {
+			continue
+		}
+		method, result, _ := strings.Cut(strings.ToLower(fields[0]), "=")
+		if result != "pass" {
+			continue
+		}
+
+		for _, property := range fields[1:] {
+			name, value, ok := strings.Cut(property, "=")
+			if !ok {
+				continue
+			}
+			name = strings.ToLower(name)
+			if (method == "spf" && name == "smtp.mailfrom") || (method == "dkim" && name == "header.d") {
+				results = append(results, AuthResult{Method: method, Domain: addressDomain(value)})
+			}
+		}
+	}
+	return authservID, results
+}
+
+// stripComments removes parenthesized comments from a header value
+func stripComments(value string) string {
+	var b strings.Builder
+	depth := 0
+	for _, r := range value {
+		switch {
+		case r == '(':
+			depth++
+		case r == ')' && depth > 0:
+			depth--
+		case depth == 0:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// addressDomain returns the domain of an address, or the value itself if
+// it is already a domain
+func addressDomain(value string) string {
+	value = strings.Trim(value, `"<>`)
+	if at := strings.LastIndex(value, "@"); at >= 0 {
+		value = value[at+1:]
+	}
+	return strings.TrimSuffix(strings.ToLower(value), ".")
+}
@@ -0,0 +1,192 @@
+package dmarc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"github.com/mikey/llm-spam-filter/internal/utils"
+	"go.uber.org/zap"
+)
+
+// LookupTXT looks up the TXT records for a name, like net.Resolver.LookupTXT
+type LookupTXT func(ctx context.Context, name string) ([]string, error)
+
+// cachedRecord is a looked up DMARC record, or nil if the domain has none
+type cachedRecord struct {
+	record    *Record
+	expiresAt time.Time
+}
+
+// Checker is an implementation of the DMARCChecker interface. It trusts the
+// SPF and DKIM results in the Authentication-Results header added by the
+// local MTA, and looks up DMARC records with a cache.
+type Checker struct {
+	lookup     LookupTXT
+	authservID string
+	cacheTTL   time.Duration
+	logger     *zap.Logger
+	mu         sync.Mutex
+	records    map[string]cachedRecord
+}
+
+// NewChecker creates a new DMARC checker. Only Authentication-Results
+// headers with the given authserv-id are trusted, or the topmost one if it
+// is empty.
+func NewChecker(lookup LookupTXT, authservID string, cacheTTL time.Duration, logger *zap.Logger) *Checker {
+	return &Checker{
+		lookup:     lookup,
+		authservID: strings.ToLower(strings.TrimSpace(authservID)),
+		cacheTTL:   cacheTTL,
+		logger:     logger,
+		records:    make(map[string]cachedRecord),
+	}
+}
+
+// Reject returns whether the From domain publishes a reject policy that the
+// email fails, because neither a passing SPF nor a passing DKIM result is
+// aligned with it. Emails without trusted authentication results are not
+// rejected.
+func (c *Checker) Reject(ctx context.Context, email *core.Email) (bool, string, error) {
+	fromDomain := headerFromDomain(email)
+	if fromDomain == "" {
+		return false, "", nil
+	}
+
+	results, found := c.trustedResults(email)
+	if !found {
+		c.logger.Debug("No trusted Authentication-Results header, not enforcing DMARC",
+			zap.String("from", email.From))
+		return false, "", nil
+	}
+
+	record, policy, err := c.policy(ctx, fromDomain)
+	if err != nil || record == nil || policy != PolicyReject {
+		return false, "", err
+	}
+
+	for _, result := range results {
+		strict := record.StrictSPF
+		if result.Method == "dkim" {
+			strict = record.StrictDKIM
+		}
+		if aligned(result.Domain, fromDomain, strict) {
+			return false, "", nil
+		}
+	}
+
+	return true, fmt.Sprintf("Fails the DMARC reject policy for %s: no aligned SPF or DKIM pass", fromDomain), nil
+}
+
+// trustedResults returns the passing results from the trusted
+// Authentication-Results header, and whether there is one
+func (c *Checker) trustedResults(email *core.Email) ([]AuthResult, bool) {
+	for key, values := range email.Headers {
+		if !strings.EqualFold(key, "Authentication-Results") {
+			continue
+		}
+		for _, value := range values {
+			authservID, results := ParseAuthenticationResults(value)
+			if c.authservID == "" || authservID == c.authservID {
+				return results, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// policy returns the DMARC record for a domain and the policy that applies
+// to it, falling back to the organizational domain's record and its
+// subdomain policy
+func (c *Checker) policy(ctx context.Context, domain string) (*Record, string, error) {
+	record, err := c.record(ctx, domain)
+	if err != nil {
+		return nil, "", err
+	}
+	if record != nil {
+		return record, record.Policy, nil
+	}
+
+	orgDomain := utils.RegistrableDomain(domain)
+	if orgDomain == domain {
+		return nil, "", nil
+	}
+	record, err = c.record(ctx, orgDomain)
+	if err != nil || record == nil {
+		return nil, "", err
+	}
+	if record.SubdomainPolicy != "" {
+		return record, record.SubdomainPolicy, nil
+	}
+	return record, record.Policy, nil
+}
+
+// record returns the cached DMARC record for a domain, looking it up if it
+// is not cached. Domains without a record are cached too.
+func (c *Checker) record(ctx context.Context, domain string) (*Record, error) {
+	c.mu.Lock()
+	cached, ok := c.records[domain]
+	c.mu.Unlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.record, nil
+	}
+
+	txts, err := c.lookup(ctx, "_dmarc."+domain)
+	if err != nil && !isNotFound(err) {
+		return nil, fmt.Errorf("failed to look up DMARC record for %s: %w", domain, err)
+	}
+
+	var record *Record
+	for _, txt := range txts {
+		if parsed, err := ParseRecord(txt); err == nil {
+			record = parsed
+			break
+		}
+	}
+
+	c.mu.Lock()
+	c.records[domain] = cachedRecord{record: record, expiresAt: time.Now().Add(c.cacheTTL)}
+	c.mu.Unlock()
+	return record, nil
+}
+
+// aligned returns whether an authenticated domain is aligned with the From
+// domain, exactly in strict mode or by organizational domain otherwise
+func aligned(domain, fromDomain string, strict bool) bool {
+	if strict {
+		return domain == fromDomain
+	}
+	return utils.RegistrableDomain(domain) == utils.RegistrableDomain(fromDomain)
+}
+
+// headerFromDomain returns the domain of the From header, falling back to
+// the envelope sender
+func headerFromDomain(email *core.Email) string {
+	from := email.From
+	for key, values := range email.Headers {
+		if strings.EqualFold(key, "From") && len(values) > 0 {
+			from = values[0]
+			break
+		}
+	}
+	if parsed, err := mail.ParseAddress(from); err == nil {
+		from = parsed.Address
+	}
+	at := strings.LastIndex(from, "@")
+	if at < 0 {
+		return ""
+	}
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(from[at+1:])), ".")
+}
+
+// isNotFound returns whether a lookup error means the name has no records
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
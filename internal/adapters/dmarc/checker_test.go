@@ -0,0 +1,117 @@
+package dmarc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"go.uber.org/zap"
+)
+
+// fakeResolver answers TXT lookups from fixed records, counting them.
+// Names without records are not found.
+type fakeResolver struct {
+	records map[string]string
+	lookups int
+}
+
+func (r *fakeResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	r.lookups++
+	record, ok := r.records[name]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return []string{record}, nil
+}
+
+// authenticatedEmail returns an email from the given From header, with
+// results from the trusted MTA
+func authenticatedEmail(from, results string) *core.Email {
+	return &core.Email{
+		From:    "bounce@mailer.example.net",
+		To:      []string{"user@example.org"},
+		Subject: "Your account",
+		Body:    "Please confirm your details.",
+		Headers: map[string][]string{
+			"From":                   {from},
+			"Authentication-Results": {"mx.example.org; " + results},
+		},
+	}
+}
+
+var rejectRecords = map[string]string{
+	"_dmarc.bank.example":    "v=DMARC1; p=reject",
+	"_dmarc.strict.example":  "v=DMARC1; p=reject; adkim=s; aspf=s",
+	"_dmarc.parent.example":  "v=DMARC1; p=none; sp=reject",
+	"_dmarc.relaxed.example": "v=DMARC1; p=none",
+}
+
+func TestCheckerReject(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    string
+		results string
+		reject  bool
+	}{
+		{"reject policy without alignment", "Bank <alerts@bank.example>", "spf=pass smtp.mailfrom=bounce@mailer.example.net; dkim=fail header.d=bank.example", true},
+		{"reject policy with aligned DKIM", "alerts@bank.example", "dkim=pass header.d=mail.bank.example", false},
+		{"reject policy with aligned SPF", "alerts@bank.example", "spf=pass smtp.mailfrom=bounce@bank.example", false},
+		{"strict alignment of a subdomain", "alerts@strict.example", "dkim=pass header.d=mail.strict.example", true},
+		{"subdomain policy of the organizational domain", "alerts@news.parent.example", "spf=pass smtp.mailfrom=bounce@mailer.example.net", true},
+		{"none policy", "alerts@relaxed.example", "spf=fail smtp.mailfrom=bounce@relaxed.example", false},
+		{"no record", "alerts@unlisted.example", "spf=fail smtp.mailfrom=bounce@unlisted.example", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver := &fakeResolver{records: rejectRecords}
+			checker := NewChecker(resolver.LookupTXT, "mx.example.org", time.Hour, zap.NewNop())
+
+			reject, reason, err := checker.Reject(context.Background(), authenticatedEmail(tt.from, tt.results))
+			if err != nil {
+				t.Fatalf("Reject() error = %v", err)
+			}
+			if reject != tt.reject {
+				t.Errorf("Reject() = %t (%s), want %t", reject, reason, tt.reject)
+			}
+		})
+	}
+}
+
+func TestCheckerIgnoresUntrustedResults(t *testing.T) {
+	resolver := &fakeResolver{records: rejectRecords}
+	checker := NewChecker(resolver.LookupTXT, "mx.other.example", time.Hour, zap.NewNop())
+
+	email := authenticatedEmail("alerts@bank.example", "spf=fail smtp.mailfrom=bounce@mailer.example.net")
+	if reject, _, _ := checker.Reject(context.Background(), email); reject {
+		t.Error("Reject() = true, want results from another authserv-id ignored")
+	}
+}
+
+func TestCheckerCachesRecords(t *testing.T) {
+	resolver := &fakeResolver{records: rejectRecords}
+	checker := NewChecker(resolver.LookupTXT, "", time.Hour, zap.NewNop())
+
+	for i := 0; i < 3; i++ {
+		checker.Reject(context.Background(), authenticatedEmail("alerts@bank.example", "spf=pass smtp.mailfrom=bounce@mailer.example.net"))
+	}
+	if resolver.lookups != 1 {
+		t.Errorf("lookups = %d, want the record looked up once", resolver.lookups)
+	}
+}
+
+func TestFailingRejectPolicyIsSpam(t *testing.T) {
+	resolver := &fakeResolver{records: rejectRecords}
+	checker := NewChecker(resolver.LookupTXT, "mx.example.org", time.Hour, zap.NewNop())
+	service := core.NewSpamFilterService(nil, nil, zap.NewNop(), false, time.Hour, 0.7, nil, nil, nil, core.ServiceOptions{DMARCChecker: checker})
+
+	email := authenticatedEmail("Bank <alerts@bank.example>", "spf=pass smtp.mailfrom=bounce@mailer.example.net")
+	result, err := service.AnalyzeEmail(context.Background(), email)
+	if err != nil {
+		t.Fatalf("AnalyzeEmail() error = %v", err)
+	}
+	if !result.IsSpam || result.Score != 1.0 || result.ModelUsed != "dmarc-policy" {
+		t.Errorf("result = %+v, want a DMARC spam verdict", result)
+	}
+}
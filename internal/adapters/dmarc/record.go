@@ -0,0 +1,63 @@
+package dmarc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DMARC policies
+const (
+	PolicyNone       = "none"
+	PolicyQuarantine = "quarantine"
+	PolicyReject     = "reject"
+)
+
+// Record is a parsed DMARC record
+type Record struct {
+	// Policy applies to the domain itself
+	Policy string
+
+	// SubdomainPolicy applies to subdomains of an organizational domain
+	// (empty to use Policy)
+	SubdomainPolicy string
+
+	// StrictDKIM and StrictSPF require an exact domain match for alignment
+	// instead of a match of organizational domains
+	StrictDKIM bool
+	StrictSPF  bool
+}
+
+// ParseRecord parses a DMARC TXT record such as
+// "v=DMARC1; p=reject; adkim=s"
+func ParseRecord(txt string) (*Record, error) {
+	tags := strings.Split(txt, ";")
+	if strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(tags[0]), " ", "")) != "V=DMARC1" {
+		return nil, fmt.Errorf("not a DMARC record: %q", txt)
+	}
+
+	record := &Record{}
+	for _, tag := range tags[1:] {
+		name, value, ok := strings.Cut(tag, "=")
+		if !ok {
+			continue
+		}
+		value = strings.ToLower(strings.TrimSpace(value))
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "p":
+			record.Policy = value
+		case "sp":
+			record.SubdomainPolicy = value
+		case "adkim":
+			record.StrictDKIM = value == "s"
+		case "aspf":
+			record.StrictSPF = value == "s"
+		}
+	}
+
+	switch record.Policy {
+	case PolicyNone, PolicyQuarantine, PolicyReject:
+	default:
+		return nil, fmt.Errorf("invalid DMARC policy %q", record.Policy)
+	}
+	return record, nil
+}
@@ -0,0 +1,62 @@
+package feedback
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Entry is a single feedback record as persisted to disk
+type Entry struct {
+	ID         string    `json:"id"`
+	IsSpam     bool      `json:"is_spam"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+// FileStore is a FeedbackStore that appends entries to a JSON lines file
+type FileStore struct {
+	path   string
+	mu     sync.Mutex
+	logger *zap.Logger
+}
+
+// NewFileStore creates a new file-backed feedback store
+func NewFileStore(path string, logger *zap.Logger) *FileStore {
+	return &FileStore{
+		path:   path,
+		logger: logger,
+	}
+}
+
+// Record appends a feedback entry to the file
+func (s *FileStore) Record(ctx context.Context, id string, isSpam bool) error {
+	line, err := json.Marshal(Entry{
+		ID:         id,
+		IsSpam:     isSpam,
+		RecordedAt: time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal feedback entry: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open feedback file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write feedback entry: %w", err)
+	}
+
+	s.logger.Debug("Wrote feedback entry", zap.String("path", s.path), zap.String("id", id))
+	return nil
+}
@@ -0,0 +1,50 @@
+package feedback
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestFileStoreAppendsEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "feedback.jsonl")
+	store := NewFileStore(path, zap.NewNop())
+
+	if err := store.Record(context.Background(), "sender@example.com", true); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+	if err := store.Record(context.Background(), "3f2c1a9e", false); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open feedback file: %v", err)
+	}
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("invalid feedback line %q: %v", scanner.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	if entries[0].ID != "sender@example.com" || !entries[0].IsSpam || entries[0].RecordedAt.IsZero() {
+		t.Errorf("first entry = %+v, want a spam label for the sender", entries[0])
+	}
+	if entries[1].ID != "3f2c1a9e" || entries[1].IsSpam {
+		t.Errorf("second entry = %+v, want a ham label for the processing ID", entries[1])
+	}
+}
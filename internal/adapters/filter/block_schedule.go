@@ -0,0 +1,156 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// weekdays maps day abbreviations to weekdays
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// blockWindow is a daily time range, in minutes since midnight, on a set of
+// weekdays. A window whose end is before its start runs past midnight into
+// the next day.
+type blockWindow struct {
+	days  [7]bool
+	start int
+	end   int
+}
+
+// BlockSchedule holds the windows during which spam is rejected. Outside
+// them, spam is only tagged.
+type BlockSchedule struct {
+	windows  []blockWindow
+	location *time.Location
+}
+
+// ParseBlockSchedule parses windows such as "Mon-Fri 09:00-17:00",
+// "Sat,Sun 10:00-14:00" or "22:00-06:00" (every day) in the given location
+func ParseBlockSchedule(specs []string, location *time.Location) (*BlockSchedule, error) {
+	schedule := &BlockSchedule{location: location}
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		window, err := parseBlockWindow(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid block schedule %q: %w", spec, err)
+		}
+		schedule.windows = append(schedule.windows, window)
+	}
+	return schedule, nil
+}
+
+// parseBlockWindow parses a single "[days] HH:MM-HH:MM" window
+func parseBlockWindow(spec string) (blockWindow, error) {
+	var window blockWindow
+
+	fields := strings.Fields(spec)
+	var days, times string
+	switch len(fields) {
+	case 1:
+		times = fields[0]
+		for i := range window.days {
+			window.days[i] = true
+		}
+	case 2:
+		days, times = fields[0], fields[1]
+		if err := parseDays(days, &window.days); err != nil {
+			return window, err
+		}
+	default:
+		return window, fmt.Errorf("expected [days] HH:MM-HH:MM")
+	}
+
+	from, to, ok := strings.Cut(times, "-")
+	if !ok {
+		return window, fmt.Errorf("expected a time range HH:MM-HH:MM")
+	}
+	var err error
+	if window.start, err = parseClock(from); err != nil {
+		return window, err
+	}
+	if window.end, err = parseClock(to); err != nil {
+		return window, err
+	}
+	if window.start == window.end {
+		return window, fmt.Errorf("time range is empty")
+	}
+	return window, nil
+}
+
+// parseDays parses a comma-separated list of days or day ranges, e.g.
+// "Mon-Fri" or "Sat,Sun"
+func parseDays(spec string, days *[7]bool) error {
+	for _, part := range strings.Split(spec, ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		first, ok := weekdays[strings.ToLower(from)]
+		if !ok {
+			return fmt.Errorf("unknown day %q", from)
+		}
+		last := first
+		if isRange {
+			if last, ok = weekdays[strings.ToLower(to)]; !ok {
+				return fmt.Errorf("unknown day %q", to)
+			}
+		}
+		// Ranges may wrap around the week, e.g. Fri-Mon
+		for day := first; ; day = (day + 1) % 7 {
+			days[day] = true
+			if day == last {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// parseClock parses HH:MM into minutes since midnight
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", clock)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Active returns whether blocking is active at the given time. A nil or
+// empty schedule is always active.
+func (s *BlockSchedule) Active(t time.Time) bool {
+	if s == nil || len(s.windows) == 0 {
+		return true
+	}
+
+	t = t.In(s.location)
+	minute := t.Hour()*60 + t.Minute()
+	today := t.Weekday()
+	yesterday := (today + 6) % 7
+
+	for _, window := range s.windows {
+		if window.start < window.end {
+			if window.days[today] && minute >= window.start && minute < window.end {
+				return true
+			}
+			continue
+		}
+		// The window runs past midnight, so it may have started today or
+		// yesterday
+		if window.days[today] && minute >= window.start {
+			return true
+		}
+		if window.days[yesterday] && minute < window.end {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package filter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBlockScheduleActive(t *testing.T) {
+	schedule, err := ParseBlockSchedule([]string{"Mon-Fri 09:00-17:00", "Sat 22:00-02:00"}, time.UTC)
+	if err != nil {
+		t.Fatalf("ParseBlockSchedule() error = %v", err)
+	}
+
+	// 1 January 2024 was a Monday
+	tests := []struct {
+		name   string
+		now    time.Time
+		active bool
+	}{
+		{"weekday inside window", time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC), true},
+		{"weekday at window start", time.Date(2024, 1, 3, 9, 0, 0, 0, time.UTC), true},
+		{"weekday at window end", time.Date(2024, 1, 5, 17, 0, 0, 0, time.UTC), false},
+		{"weekday before window", time.Date(2024, 1, 1, 8, 59, 0, 0, time.UTC), false},
+		{"Saturday before midnight", time.Date(2024, 1, 6, 23, 0, 0, 0, time.UTC), true},
+		{"Sunday after midnight", time.Date(2024, 1, 7, 1, 30, 0, 0, time.UTC), true},
+		{"Sunday daytime", time.Date(2024, 1, 7, 12, 0, 0, 0, time.UTC), false},
+		{"Monday after midnight", time.Date(2024, 1, 8, 1, 30, 0, 0, time.UTC), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := schedule.Active(tt.now); got != tt.active {
+				t.Errorf("Active(%s) = %t, want %t", tt.now.Format(time.RFC1123), got, tt.active)
+			}
+		})
+	}
+}
+
+func TestBlockScheduleUsesLocation(t *testing.T) {
+	location := time.FixedZone("UTC+10", 10*60*60)
+	schedule, err := ParseBlockSchedule([]string{"09:00-17:00"}, location)
+	if err != nil {
+		t.Fatalf("ParseBlockSchedule() error = %v", err)
+	}
+
+	// 23:30 UTC is 09:30 the next morning in the schedule's location
+	if !schedule.Active(time.Date(2024, 1, 1, 23, 30, 0, 0, time.UTC)) {
+		t.Error("Active() = false at 09:30 local time, want true")
+	}
+	if schedule.Active(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Error("Active() = true at 22:00 local time, want false")
+	}
+}
+
+func TestEmptyBlockScheduleIsAlwaysActive(t *testing.T) {
+	schedule, err := ParseBlockSchedule(nil, time.UTC)
+	if err != nil {
+		t.Fatalf("ParseBlockSchedule() error = %v", err)
+	}
+	if !schedule.Active(time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC)) {
+		t.Error("Active() = false for an empty schedule, want true")
+	}
+
+	var unset *BlockSchedule
+	if !unset.Active(time.Now()) {
+		t.Error("Active() = false for a nil schedule, want true")
+	}
+}
+
+func TestParseBlockScheduleRejectsInvalidWindows(t *testing.T) {
+	for _, spec := range []string{"Mon-Fri", "Funday 09:00-17:00", "09:00-25:00", "09:00-09:00", "Mon 09:00 17:00"} {
+		if _, err := ParseBlockSchedule([]string{spec}, time.UTC); err == nil {
+			t.Errorf("ParseBlockSchedule(%q) succeeded, want an error", spec)
+		}
+	}
+}
@@ -66,6 +66,19 @@ func (f *CliFilter) ProcessEmail(ctx context.Context, email *core.Email) (*core.
 	fmt.Printf("Confidence: %.4f\n", result.Confidence)
 	fmt.Printf("Explanation: %s\n", result.Explanation)
 	fmt.Printf("Model used: %s\n", result.ModelUsed)
+	for _, verdict := range result.ProviderVerdicts {
+		if !verdict.Responded {
+			fmt.Printf("  %s (weight %g): failed: %s\n", verdict.Provider, verdict.Weight, verdict.Error)
+			continue
+		}
+		fmt.Printf("  %s (weight %g): spam %t, score %.4f\n", verdict.Provider, verdict.Weight, verdict.IsSpam, verdict.Score)
+	}
+	if result.SkipReason != "" {
+		fmt.Printf("Analysis skipped: %s\n", result.SkipReason)
+	}
+	if result.Trace != nil {
+		fmt.Printf("Decision trace: %s\n", result.Trace)
+	}
 	fmt.Printf("Processing time: %v\n", duration)
 
 	return result, nil
@@ -0,0 +1,71 @@
+package filter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"github.com/mikey/llm-spam-filter/internal/ports"
+	"go.uber.org/zap"
+)
+
+// CompositeFilter runs several email filters side by side, starting and
+// stopping them together
+type CompositeFilter struct {
+	filters []ports.EmailFilter
+	names   []string
+	logger  *zap.Logger
+}
+
+// NewCompositeFilter creates a filter that runs each of the given filters,
+// named for logging
+func NewCompositeFilter(filters []ports.EmailFilter, names []string, logger *zap.Logger) (*CompositeFilter, error) {
+	if len(filters) == 0 {
+		return nil, fmt.Errorf("composite filter needs at least one filter")
+	}
+	if len(names) != len(filters) {
+		return nil, fmt.Errorf("composite filter has %d filters but %d names", len(filters), len(names))
+	}
+	return &CompositeFilter{
+		filters: filters,
+		names:   names,
+		logger:  logger,
+	}, nil
+}
+
+// Start starts every filter in order. If one fails to start, the filters
+// already started are stopped again.
+func (f *CompositeFilter) Start() error {
+	for i, filter := range f.filters {
+		if err := filter.Start(); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				if stopErr := f.filters[j].Stop(); stopErr != nil {
+					f.logger.Error("Failed to stop filter",
+						zap.String("filter", f.names[j]),
+						zap.Error(stopErr))
+				}
+			}
+			return fmt.Errorf("failed to start %s filter: %w", f.names[i], err)
+		}
+		f.logger.Info("Started filter", zap.String("filter", f.names[i]))
+	}
+	return nil
+}
+
+// Stop stops every filter in the reverse order they were started, returning
+// any errors together
+func (f *CompositeFilter) Stop() error {
+	var errs []error
+	for i := len(f.filters) - 1; i >= 0; i-- {
+		if err := f.filters[i].Stop(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to stop %s filter: %w", f.names[i], err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ProcessEmail processes an email with the first filter
+func (f *CompositeFilter) ProcessEmail(ctx context.Context, email *core.Email) (*core.SpamAnalysisResult, error) {
+	return f.filters[0].ProcessEmail(ctx, email)
+}
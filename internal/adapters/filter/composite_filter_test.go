@@ -0,0 +1,122 @@
+package filter
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"github.com/mikey/llm-spam-filter/internal/ports"
+	"go.uber.org/zap"
+)
+
+// stubFilter is an EmailFilter recording its starts and stops in a shared
+// event log
+type stubFilter struct {
+	name     string
+	events   *[]string
+	startErr error
+	stopErr  error
+	result   core.SpamAnalysisResult
+}
+
+func (f *stubFilter) Start() error {
+	*f.events = append(*f.events, "start "+f.name)
+	return f.startErr
+}
+
+func (f *stubFilter) Stop() error {
+	*f.events = append(*f.events, "stop "+f.name)
+	return f.stopErr
+}
+
+func (f *stubFilter) ProcessEmail(ctx context.Context, email *core.Email) (*core.SpamAnalysisResult, error) {
+	result := f.result
+	return &result, nil
+}
+
+// newStubFilters returns a composite of stub filters named names, sharing
+// one event log
+func newStubFilters(t *testing.T, names ...string) (*CompositeFilter, []*stubFilter, *[]string) {
+	t.Helper()
+	events := &[]string{}
+	stubs := make([]*stubFilter, len(names))
+	filters := make([]ports.EmailFilter, len(names))
+	for i, name := range names {
+		stubs[i] = &stubFilter{name: name, events: events}
+		filters[i] = stubs[i]
+	}
+	composite, err := NewCompositeFilter(filters, names, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewCompositeFilter() error = %v", err)
+	}
+	return composite, stubs, events
+}
+
+func TestCompositeFilterStartsAndStopsAll(t *testing.T) {
+	composite, _, events := newStubFilters(t, "postfix", "milter", "http")
+
+	if err := composite.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if err := composite.Stop(); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+
+	want := []string{"start postfix", "start milter", "start http", "stop http", "stop milter", "stop postfix"}
+	if !reflect.DeepEqual(*events, want) {
+		t.Errorf("events = %q, want %q", *events, want)
+	}
+}
+
+func TestCompositeFilterStopsStartedFiltersOnFailure(t *testing.T) {
+	composite, stubs, events := newStubFilters(t, "postfix", "milter", "http")
+	stubs[1].startErr = errors.New("address in use")
+
+	if err := composite.Start(); err == nil {
+		t.Fatal("Start() succeeded, want an error")
+	}
+
+	want := []string{"start postfix", "start milter", "stop postfix"}
+	if !reflect.DeepEqual(*events, want) {
+		t.Errorf("events = %q, want %q", *events, want)
+	}
+}
+
+func TestCompositeFilterStopsAllDespiteErrors(t *testing.T) {
+	composite, stubs, events := newStubFilters(t, "postfix", "milter")
+	stubs[1].stopErr = errors.New("stuck")
+
+	err := composite.Stop()
+	if !errors.Is(err, stubs[1].stopErr) {
+		t.Errorf("Stop() error = %v, want the milter's error", err)
+	}
+	if want := []string{"stop milter", "stop postfix"}; !reflect.DeepEqual(*events, want) {
+		t.Errorf("events = %q, want %q", *events, want)
+	}
+}
+
+func TestCompositeFilterProcessesWithFirstFilter(t *testing.T) {
+	composite, stubs, _ := newStubFilters(t, "postfix", "milter")
+	stubs[0].result = core.SpamAnalysisResult{Explanation: "postfix"}
+	stubs[1].result = core.SpamAnalysisResult{Explanation: "milter"}
+
+	result, err := composite.ProcessEmail(context.Background(), &core.Email{})
+	if err != nil {
+		t.Fatalf("ProcessEmail() error = %v", err)
+	}
+	if result.Explanation != "postfix" {
+		t.Errorf("ProcessEmail() used the %s filter, want postfix", result.Explanation)
+	}
+}
+
+func TestNewCompositeFilterValidates(t *testing.T) {
+	if _, err := NewCompositeFilter(nil, nil, zap.NewNop()); err == nil {
+		t.Error("NewCompositeFilter() with no filters succeeded, want an error")
+	}
+	filters := []ports.EmailFilter{&stubFilter{events: &[]string{}}}
+	if _, err := NewCompositeFilter(filters, []string{"a", "b"}, zap.NewNop()); err == nil {
+		t.Error("NewCompositeFilter() with mismatched names succeeded, want an error")
+	}
+}
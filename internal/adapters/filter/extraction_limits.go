@@ -0,0 +1,93 @@
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ErrExtractionLimit is returned when extracting a message's content
+// exceeds one of its limits, as crafted messages such as deeply nested or
+// bloated multiparts do
+var ErrExtractionLimit = errors.New("message exceeds content extraction limits")
+
+// ExtractionLimits bounds the work of extracting a message's content, so
+// that a single crafted message can't exhaust the server's memory or hold
+// up the filter. Zero values disable a limit.
+type ExtractionLimits struct {
+	// MaxBytes caps the bytes read from the message's bodies and parts,
+	// counting each level of nesting again since every level is copied
+	MaxBytes int
+
+	// MaxParts caps the MIME parts read across all levels
+	MaxParts int
+
+	// MaxDepth caps how deeply multiparts may be nested
+	MaxDepth int
+
+	// Timeout caps the time spent extracting
+	Timeout time.Duration
+}
+
+// readAll reads r, charging what it reads to the byte limit. Reading stops
+// as soon as the limit is exceeded, so an oversized part is never held in
+// memory whole.
+func (c *messageContent) readAll(r io.Reader) ([]byte, error) {
+	if err := c.checkLimits(); err != nil {
+		return nil, err
+	}
+	if c.limits.MaxBytes <= 0 {
+		return io.ReadAll(r)
+	}
+
+	remaining := c.limits.MaxBytes - c.bytesRead
+	data, err := io.ReadAll(io.LimitReader(r, int64(remaining)+1))
+	c.bytesRead += len(data)
+	if len(data) > remaining {
+		return nil, c.exceeded(fmt.Sprintf("more than %d bytes", c.limits.MaxBytes))
+	}
+	return data, err
+}
+
+// countPart charges a MIME part to the part limit
+func (c *messageContent) countPart() error {
+	c.parts++
+	if c.limits.MaxParts > 0 && c.parts > c.limits.MaxParts {
+		return c.exceeded(fmt.Sprintf("more than %d MIME parts", c.limits.MaxParts))
+	}
+	return c.checkLimits()
+}
+
+// enterMultipart charges a level of multipart nesting to the depth limit,
+// returning the function to call on leaving it
+func (c *messageContent) enterMultipart() (func(), error) {
+	c.nesting++
+	leave := func() { c.nesting-- }
+	if c.limits.MaxDepth > 0 && c.nesting > c.limits.MaxDepth {
+		leave()
+		return nil, c.exceeded(fmt.Sprintf("multiparts nested more than %d deep", c.limits.MaxDepth))
+	}
+	return leave, nil
+}
+
+// checkLimits returns the limit already exceeded, if any, or whether the
+// time limit has passed
+func (c *messageContent) checkLimits() error {
+	if c.limitErr != nil {
+		return c.limitErr
+	}
+	if !c.deadline.IsZero() && time.Now().After(c.deadline) {
+		return c.exceeded(fmt.Sprintf("extraction took more than %s", c.limits.Timeout))
+	}
+	return nil
+}
+
+// exceeded records that a limit was exceeded, so that extraction stops at
+// every level rather than carrying on with the next part
+func (c *messageContent) exceeded(reason string) error {
+	if c.limitErr == nil {
+		c.limitErr = fmt.Errorf("%w: %s", ErrExtractionLimit, reason)
+	}
+	return c.limitErr
+}
@@ -0,0 +1,95 @@
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-smtp"
+	"go.uber.org/zap"
+)
+
+// nestedMessage returns a message whose text part is wrapped in depth
+// levels of multipart/mixed
+func nestedMessage(depth int) string {
+	entity := "Content-Type: text/plain\r\n\r\nhello"
+	for i := 0; i < depth; i++ {
+		boundary := fmt.Sprintf("b%d", i)
+		entity = "Content-Type: multipart/mixed; boundary=" + boundary + "\r\n\r\n" +
+			"--" + boundary + "\r\n" + entity + "\r\n--" + boundary + "--\r\n"
+	}
+	return "From: sender@example.com\r\nMIME-Version: 1.0\r\n" + entity
+}
+
+// manyPartsMessage returns a multipart message with count text parts
+func manyPartsMessage(count int) string {
+	var sb strings.Builder
+	sb.WriteString("From: sender@example.com\r\nContent-Type: multipart/mixed; boundary=x\r\n\r\n")
+	for i := 0; i < count; i++ {
+		sb.WriteString("--x\r\nContent-Type: text/plain\r\n\r\nhi\r\n")
+	}
+	sb.WriteString("--x--\r\n")
+	return sb.String()
+}
+
+// defaultLimits are the configured defaults
+var defaultLimits = ExtractionLimits{MaxBytes: 52428800, MaxParts: 500, MaxDepth: 20, Timeout: 10 * time.Second}
+
+var extractionOverruns = []struct {
+	name    string
+	message string
+	limits  ExtractionLimits
+}{
+	{"nesting depth", nestedMessage(25), defaultLimits},
+	{"part count", manyPartsMessage(600), defaultLimits},
+	{"bytes read", nestedMessage(3), ExtractionLimits{MaxBytes: 50}},
+	{"time taken", nestedMessage(3), ExtractionLimits{Timeout: time.Nanosecond}},
+}
+
+func TestExtractionLimitsStopOverruns(t *testing.T) {
+	for _, tt := range extractionOverruns {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := mail.ReadMessage(strings.NewReader(tt.message))
+			if err != nil {
+				t.Fatalf("ReadMessage() error = %v", err)
+			}
+			_, err = extractContentFromMessage(msg, 0, false, false, tt.limits, zap.NewNop())
+			if !errors.Is(err, ErrExtractionLimit) {
+				t.Errorf("extractContentFromMessage() error = %v, want ErrExtractionLimit", err)
+			}
+		})
+	}
+}
+
+func TestExtractionLimitsAllowOrdinaryMessages(t *testing.T) {
+	for _, message := range []string{nestedMessage(3), manyPartsMessage(10)} {
+		msg, err := mail.ReadMessage(strings.NewReader(message))
+		if err != nil {
+			t.Fatalf("ReadMessage() error = %v", err)
+		}
+		content, err := extractContentFromMessage(msg, 0, false, false, defaultLimits, zap.NewNop())
+		if err != nil {
+			t.Fatalf("extractContentFromMessage() error = %v", err)
+		}
+		if !strings.Contains(content.Text, "h") {
+			t.Errorf("Text = %q, want the text parts", content.Text)
+		}
+	}
+}
+
+func TestDataRejectsExtractionOverrunsWith552(t *testing.T) {
+	for _, tt := range extractionOverruns {
+		t.Run(tt.name, func(t *testing.T) {
+			session := &smtpSession{filter: &PostfixFilter{logger: zap.NewNop(), extractionLimits: tt.limits}}
+			err := session.Data(strings.NewReader(tt.message))
+
+			var smtpErr *smtp.SMTPError
+			if !errors.As(err, &smtpErr) || smtpErr.Code != 552 {
+				t.Errorf("Data() error = %v, want a 552 reply", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package filter
+
+import (
+	"bytes"
+	"encoding/base64"
+	"mime"
+	"strings"
+	"unicode/utf8"
+)
+
+// foldLineLength is the length long header lines are folded at, as
+// RFC 5322 recommends
+const foldLineLength = 78
+
+// maxLineLength is the longest a header line may be, excluding the CRLF,
+// under RFC 5322
+const maxLineLength = 998
+
+// maxEncodedChunk is the most bytes of a word put in one RFC 2047 encoded
+// word, keeping it within the 75 characters allowed
+const maxEncodedChunk = 45
+
+// headerLineBreaks replaces line breaks in header values, so a value such
+// as a model's explanation can't end the field early and add others
+var headerLineBreaks = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ")
+
+// writeHeader writes a header field we generate. With folding enabled,
+// non-ASCII values are RFC 2047 encoded and lines longer than
+// foldLineLength are folded at whitespace.
+func (f *PostfixFilter) writeHeader(buf *bytes.Buffer, name, value string) {
+	value = headerLineBreaks.Replace(value)
+	if !f.foldHeaders {
+		buf.WriteString(name + ": " + value + "\r\n")
+		return
+	}
+	buf.WriteString(foldHeader(name, mime.QEncoding.Encode("utf-8", value)))
+}
+
+// foldHeader renders a header field, folding it before words that would
+// take a line past foldLineLength. Words longer than a line are left whole,
+// unless they would pass maxLineLength, when they are split into encoded
+// words that decode back to the original word.
+func foldHeader(name, value string) string {
+	var words []string
+	for _, word := range strings.Split(value, " ") {
+		if len(name)+2+len(word) > maxLineLength {
+			words = append(words, encodeLongWord(word)...)
+		} else {
+			words = append(words, word)
+		}
+	}
+
+	var folded strings.Builder
+	line := name + ":"
+	for _, word := range words {
+		if len(line)+1+len(word) > foldLineLength && strings.TrimSpace(line) != name+":" {
+			folded.WriteString(line + "\r\n")
+			line = ""
+		}
+		line += " " + word
+	}
+	folded.WriteString(line + "\r\n")
+	return folded.String()
+}
+
+// encodeLongWord splits word into RFC 2047 encoded words, which decoders
+// join back together without the whitespace between them. Multibyte
+// characters are not split across encoded words.
+func encodeLongWord(word string) []string {
+	var encoded []string
+	for len(word) > 0 {
+		n := min(maxEncodedChunk, len(word))
+		for n < len(word) && n > 0 && !utf8.RuneStart(word[n]) {
+			n--
+		}
+		if n == 0 {
+			n = min(maxEncodedChunk, len(word))
+		}
+		encoded = append(encoded, "=?utf-8?b?"+base64.StdEncoding.EncodeToString([]byte(word[:n]))+"?=")
+		word = word[n:]
+	}
+	return encoded
+}
@@ -0,0 +1,119 @@
+package filter
+
+import (
+	"bytes"
+	"mime"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/mikey/llm-spam-filter/internal/core"
+)
+
+// deliveredReason delivers a message whose analysis explains itself with
+// explanation through a filter folding headers as set, returning the
+// X-Spam-Reason field as written and its decoded value
+func deliveredReason(t *testing.T, explanation string, fold bool) (raw string, decoded string) {
+	t.Helper()
+	llm := &recordingLLM{result: core.SpamAnalysisResult{Score: 0.1, Explanation: explanation}}
+	f, mta := newAnalyzingFilter(t, llm, core.ServiceOptions{})
+	f.foldHeaders = fold
+
+	if err := receive(f, "sender@example.com", []string{"user@example.org"}, testMessage); err != nil {
+		t.Fatalf("Data() error = %v", err)
+	}
+	delivered := mta.delivered()
+	if len(delivered) != 1 {
+		t.Fatalf("next hop received %d messages, want 1", len(delivered))
+	}
+	data := string(delivered[0].data)
+	start := strings.Index(data, "X-Spam-Reason:")
+	if start < 0 {
+		t.Fatalf("delivered message has no X-Spam-Reason:\n%s", data)
+	}
+	// The field ends at the first line not continuing it
+	end := start
+	for {
+		next := strings.Index(data[end:], "\r\n") + end + 2
+		end = next
+		if !strings.HasPrefix(data[next:], " ") && !strings.HasPrefix(data[next:], "\t") {
+			break
+		}
+	}
+	raw = data[start:end]
+
+	msg, err := mail.ReadMessage(bytes.NewReader(delivered[0].data))
+	if err != nil {
+		t.Fatalf("failed to parse delivered message: %v", err)
+	}
+	decoded, err = new(mime.WordDecoder).DecodeHeader(msg.Header.Get("X-Spam-Reason"))
+	if err != nil {
+		t.Fatalf("failed to decode X-Spam-Reason: %v", err)
+	}
+	return raw, decoded
+}
+
+func TestLongExplanationIsFolded(t *testing.T) {
+	explanation := strings.TrimSpace(strings.Repeat("The sender asks for account credentials urgently. ", 6))
+	raw, decoded := deliveredReason(t, explanation, true)
+
+	lines := strings.Split(strings.TrimSuffix(raw, "\r\n"), "\r\n")
+	if len(lines) < 2 {
+		t.Fatalf("X-Spam-Reason = %q, want it folded", raw)
+	}
+	for i, line := range lines {
+		if len(line) > foldLineLength {
+			t.Errorf("line %d is %d long, want at most %d: %q", i, len(line), foldLineLength, line)
+		}
+		if i > 0 && !strings.HasPrefix(line, " ") {
+			t.Errorf("continuation line %d = %q, want it to start with whitespace", i, line)
+		}
+	}
+	if decoded != explanation {
+		t.Errorf("unfolded X-Spam-Reason = %q, want %q", decoded, explanation)
+	}
+
+	if raw, _ := deliveredReason(t, explanation, false); strings.Count(raw, "\r\n") != 1 {
+		t.Errorf("X-Spam-Reason = %q, want one line with folding off", raw)
+	}
+}
+
+func TestUTF8ExplanationIsEncoded(t *testing.T) {
+	explanation := "Der Absender verlangt dringend Zugangsdaten für Ihr Konto — typischer Phishing-Versuch"
+	raw, decoded := deliveredReason(t, explanation, true)
+
+	for i := 0; i < len(raw); i++ {
+		if raw[i] >= 0x80 {
+			t.Fatalf("X-Spam-Reason = %q, want only ASCII", raw)
+		}
+	}
+	if !strings.Contains(raw, "=?utf-8?q?") {
+		t.Errorf("X-Spam-Reason = %q, want RFC 2047 encoded words", raw)
+	}
+	if decoded != explanation {
+		t.Errorf("decoded X-Spam-Reason = %q, want %q", decoded, explanation)
+	}
+}
+
+func TestFoldHeaderKeepsLongWordsWhole(t *testing.T) {
+	word := strings.Repeat("x", 2*foldLineLength)
+	if got, want := foldHeader("X-Test", word+" end"), "X-Test: "+word+"\r\n end\r\n"; got != want {
+		t.Errorf("foldHeader() = %q, want %q", got, want)
+	}
+}
+
+func TestOverlongWordIsSplitWithinLineLimit(t *testing.T) {
+	word := "https://example.com/" + strings.Repeat("a", 2*maxLineLength)
+	explanation := "Links to " + word + " in the body"
+	raw, decoded := deliveredReason(t, explanation, true)
+
+	lines := strings.Split(strings.TrimSuffix(raw, "\r\n"), "\r\n")
+	for i, line := range lines {
+		if len(line) > maxLineLength {
+			t.Errorf("line %d is %d long, want at most %d", i, len(line), maxLineLength)
+		}
+	}
+	if decoded != explanation {
+		t.Errorf("decoded X-Spam-Reason = %q, want %q", decoded, explanation)
+	}
+}
@@ -0,0 +1,105 @@
+package filter
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// countLinkMismatches parses HTML content and counts anchors whose visible
+// text names a host other than the one the link points to, e.g. text of
+// "www.yourbank.com" linking to evil.ru
+func countLinkMismatches(content string) int {
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return 0
+	}
+
+	mismatches := 0
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "a" {
+			if linkMismatch(anchorHref(n), anchorText(n)) {
+				mismatches++
+			}
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	return mismatches
+}
+
+// anchorHref returns the href attribute of an anchor element
+func anchorHref(n *html.Node) string {
+	for _, attr := range n.Attr {
+		if strings.EqualFold(attr.Key, "href") {
+			return strings.TrimSpace(attr.Val)
+		}
+	}
+	return ""
+}
+
+// anchorText returns the visible text of an anchor element
+func anchorText(n *html.Node) string {
+	var text strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			text.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.TrimSpace(text.String())
+}
+
+// linkMismatch reports whether an anchor's text looks like a host that
+// differs from the host of its http(s) href. Links to a subdomain of the
+// displayed host are not considered mismatches.
+func linkMismatch(href, text string) bool {
+	target, err := url.Parse(href)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") {
+		return false
+	}
+	targetHost := normalizeHost(target.Hostname())
+
+	textHost := textHostname(text)
+	if textHost == "" || targetHost == "" {
+		return false
+	}
+
+	return targetHost != textHost && !strings.HasSuffix(targetHost, "."+textHost)
+}
+
+// textHostname returns the host named by anchor text that looks like a URL
+// or a bare domain, or an empty string if it doesn't
+func textHostname(text string) string {
+	if text == "" || strings.ContainsAny(text, " \t\n@") {
+		return ""
+	}
+	if !strings.Contains(text, "://") {
+		text = "http://" + text
+	}
+	parsed, err := url.Parse(text)
+	if err != nil {
+		return ""
+	}
+	host := normalizeHost(parsed.Hostname())
+	if !strings.Contains(host, ".") {
+		return ""
+	}
+	return host
+}
+
+// normalizeHost lowercases a host and strips a leading www.
+func normalizeHost(host string) string {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	return strings.TrimPrefix(host, "www.")
+}
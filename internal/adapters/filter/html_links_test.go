@@ -0,0 +1,51 @@
+package filter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mikey/llm-spam-filter/internal/core"
+)
+
+func TestCountLinkMismatches(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want int
+	}{
+		{"mismatched host", `<a href="http://evil.example.ru/login">www.yourbank.com</a>`, 1},
+		{"mismatched URL text", `<a href="https://evil.example.ru/">https://yourbank.com/login</a>`, 1},
+		{"matching host", `<a href="https://www.yourbank.com/login">yourbank.com</a>`, 0},
+		{"subdomain of the shown host", `<a href="https://secure.yourbank.com/">www.yourbank.com</a>`, 0},
+		{"descriptive text", `<a href="https://evil.example.ru/">Log in to your account</a>`, 0},
+		{"mailto link", `<a href="mailto:help@evil.example.ru">yourbank.com</a>`, 0},
+		{"nested text", `<p><a href="http://evil.example.ru"><b>yourbank</b>.com</a> and <a href="http://other.example">paypal.com</a></p>`, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := countLinkMismatches(tt.html); got != tt.want {
+				t.Errorf("countLinkMismatches() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinkMismatchSignal(t *testing.T) {
+	llm := &recordingLLM{result: core.SpamAnalysisResult{Score: 0.2}}
+	f, _ := newAnalyzingFilter(t, llm, core.ServiceOptions{})
+
+	message := "From: sender@example.com\r\nTo: user@example.org\r\nSubject: Verify your account\r\n" +
+		"Content-Type: text/html\r\n\r\n" +
+		"<p>Visit <a href=\"http://evil.example.ru/login\">www.yourbank.com</a> to verify your account.</p>\r\n"
+	if err := receive(f, "sender@example.com", []string{"user@example.org"}, message); err != nil {
+		t.Fatalf("Data() error = %v", err)
+	}
+
+	analyzed := llm.analyzed()
+	if len(analyzed) != 1 {
+		t.Fatalf("got %d analyses, want 1", len(analyzed))
+	}
+	if signals := strings.Join(analyzed[0].Signals, "\n"); !strings.Contains(signals, "Link text/target mismatches: 1") {
+		t.Errorf("Signals = %q, want the link mismatch", signals)
+	}
+}
@@ -0,0 +1,21 @@
+package filter
+
+import "regexp"
+
+// inlineImageMarker replaces inline images removed from the body
+const inlineImageMarker = "[inline image]"
+
+var (
+	// inlineImageTagPattern matches <img> tags whose source is a data: URI
+	inlineImageTagPattern = regexp.MustCompile(`(?is)<img\b[^>]*?\bsrc\s*=\s*["']?\s*data:[^>]*>`)
+
+	// dataURIPattern matches base64 data: URIs left elsewhere, e.g. in CSS
+	dataURIPattern = regexp.MustCompile(`(?i)data:[a-z0-9.+-]+/[a-z0-9.+-]+(?:;[a-z0-9=.+-]+)*;base64,[a-z0-9+/=\s]+`)
+)
+
+// removeInlineImages replaces inline images and base64 data: URIs in a body
+// with a short marker, as they waste tokens without adding signal
+func removeInlineImages(text string) string {
+	text = inlineImageTagPattern.ReplaceAllString(text, inlineImageMarker)
+	return dataURIPattern.ReplaceAllString(text, inlineImageMarker)
+}
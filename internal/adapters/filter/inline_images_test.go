@@ -0,0 +1,58 @@
+package filter
+
+import (
+	"net/mail"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// bigImage is a base64 payload the size of a typical inline image
+var bigImage = strings.Repeat("iVBORw0KGgoAAAANSUhEUgAA", 4000)
+
+func TestRemoveInlineImages(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"img tag", `<p>Hi</p><img alt="logo" src="data:image/png;base64,` + bigImage + `"><p>Bye</p>`, "<p>Hi</p>[inline image]<p>Bye</p>"},
+		{"css background", `<div style="background:url(data:image/gif;base64,` + bigImage + `)">x</div>`, `<div style="background:url([inline image])">x</div>`},
+		{"remote image kept", `<img src="https://example.com/logo.png">`, `<img src="https://example.com/logo.png">`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := removeInlineImages(tt.text); got != tt.want {
+				t.Errorf("removeInlineImages() = %.200q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractStripsInlineImages(t *testing.T) {
+	raw := "From: sender@example.com\r\n" +
+		"Content-Type: text/html; charset=utf-8\r\n\r\n" +
+		`<html><body><p>Your invoice is attached.</p><img src="data:image/png;base64,` + bigImage + `"></body></html>`
+
+	for _, strip := range []bool{false, true} {
+		msg, err := mail.ReadMessage(strings.NewReader(raw))
+		if err != nil {
+			t.Fatalf("ReadMessage() error = %v", err)
+		}
+		content, err := extractContentFromMessage(msg, 0, strip, false, defaultLimits, zap.NewNop())
+		if err != nil {
+			t.Fatalf("extractContentFromMessage() error = %v", err)
+		}
+
+		if !strings.Contains(content.Text, "Your invoice is attached.") {
+			t.Errorf("strip=%t: Text = %.200q, want the message text", strip, content.Text)
+		}
+		if got := strings.Contains(content.Text, bigImage); got == strip {
+			t.Errorf("strip=%t: image payload present = %t", strip, got)
+		}
+		if got := strings.Contains(content.Text, inlineImageMarker); got != strip {
+			t.Errorf("strip=%t: marker present = %t", strip, got)
+		}
+	}
+}
@@ -3,12 +3,21 @@ package filter
 import (
 	"bytes"
 	"encoding/base64"
+	"errors"
+	"fmt"
 	"io"
 	"mime"
 	"mime/multipart"
 	"mime/quotedprintable"
 	"net/mail"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"github.com/mikey/llm-spam-filter/internal/qr"
+	"go.uber.org/zap"
 
 	"golang.org/x/text/encoding"
 	"golang.org/x/text/encoding/charmap"
@@ -16,33 +25,153 @@ import (
 	"golang.org/x/text/encoding/ianaindex"
 )
 
+// messageContent holds the content extracted from an email message
+type messageContent struct {
+	Text           string
+	Attachments    []core.Attachment
+	AttachmentText string
+
+	// LinkMismatches counts HTML anchors whose text names a different host
+	// than their target
+	LinkMismatches int
+
+	// attachmentTextLimit is the maximum number of bytes of attachment text
+	// to extract (0 to skip attachment text)
+	attachmentTextLimit int
+
+	// QRLinks holds the URLs decoded from QR codes in image parts
+	QRLinks []string
+
+	// PartFailures counts MIME parts that could not be read or decoded
+	PartFailures int
+
+	// Embedded holds the sender and subject of the first message/rfc822
+	// part of the outer message
+	Embedded *core.EmbeddedMessage
+
+	logger *zap.Logger
+
+	// stripInlineImages replaces inline images and data: URIs in the text
+	// with a marker
+	stripInlineImages bool
+
+	// decodeQR decodes QR codes in image parts
+	decodeQR bool
+
+	// imagesScanned counts the image parts scanned for QR codes
+	imagesScanned int
+
+	// depth is the current nesting level of embedded messages
+	depth int
+
+	// limits bounds the extraction, which has read bytesRead bytes and
+	// parts parts so far, nesting multiparts nesting deep, and must finish
+	// by deadline. limitErr is set once a limit is exceeded.
+	limits    ExtractionLimits
+	bytesRead int
+	parts     int
+	nesting   int
+	deadline  time.Time
+	limitErr  error
+}
+
+// maxEmbeddedDepth limits how deeply embedded messages are extracted, to
+// guard against maliciously nested forwards
+const maxEmbeddedDepth = 3
+
+// QR code scanning limits, to bound the work spent on each message
+const (
+	maxQRImages    = 5
+	maxQRImageSize = 2 * 1024 * 1024
+)
+
+// extractContentFromMessage extracts the text content and attachment
+// metadata from an email message, along with up to attachmentTextLimit
+// bytes of text from text/* attachments. Inline images are replaced with a
+// marker if stripInlineImages is set, and QR codes in image parts are
+// decoded if decodeQR is set. Parts that fail to read or decode are logged
+// and counted. A message exceeding the extraction limits returns an error
+// wrapping ErrExtractionLimit.
+func extractContentFromMessage(msg *mail.Message, attachmentTextLimit int, stripInlineImages bool, decodeQR bool, limits ExtractionLimits, logger *zap.Logger) (*messageContent, error) {
+	content := &messageContent{attachmentTextLimit: attachmentTextLimit, stripInlineImages: stripInlineImages, decodeQR: decodeQR, limits: limits, logger: logger}
+	if limits.Timeout <= 0 {
+		return extractContent(msg, content)
+	}
+	content.deadline = time.Now().Add(limits.Timeout)
+
+	// Extraction checks the deadline between steps, but a single slow
+	// step, such as decoding a QR code, could still run past it, so stop
+	// waiting at the deadline regardless. The abandoned extraction stops at
+	// its next check.
+	type extraction struct {
+		content *messageContent
+		err     error
+	}
+	done := make(chan extraction, 1)
+	go func() {
+		extracted, err := extractContent(msg, content)
+		done <- extraction{extracted, err}
+	}()
+	timer := time.NewTimer(limits.Timeout)
+	defer timer.Stop()
+	select {
+	case result := <-done:
+		return result.content, result.err
+	case <-timer.C:
+		return nil, fmt.Errorf("%w: extraction took more than %s", ErrExtractionLimit, limits.Timeout)
+	}
+}
+
+// extractContent extracts the content of a message into content, as
+// described by extractContentFromMessage
+func extractContent(msg *mail.Message, content *messageContent) (*messageContent, error) {
+	text, err := extractTextFromMessage(msg, content)
+	if err == nil {
+		// Limits exceeded within swallowed part failures still count
+		err = content.limitErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	content.checkSinglePartHTML(msg, text)
+	if content.stripInlineImages {
+		text = removeInlineImages(text)
+	}
+	content.Text = text
+	return content, nil
+}
+
 // extractTextFromMessage extracts the text content from an email message
-// For multipart messages, it tries to find text/plain parts
-func extractTextFromMessage(msg *mail.Message) (string, error) {
+// For multipart messages, it tries to find text/plain parts, recording any
+// attachments found along the way in content
+func extractTextFromMessage(msg *mail.Message, content *messageContent) (string, error) {
 	contentType := msg.Header.Get("Content-Type")
 	
 	// If it's not a multipart message, decode and return the body
 	if !strings.Contains(strings.ToLower(contentType), "multipart/") {
-		bodyBytes, err := io.ReadAll(msg.Body)
+		bodyBytes, err := content.readAll(msg.Body)
 		if err != nil {
 			return "", err
 		}
 		
 		// Check for Content-Transfer-Encoding and decode if necessary
+		if err := content.checkLimits(); err != nil {
+			return "", err
+		}
 		encoding := msg.Header.Get("Content-Transfer-Encoding")
 		decodedBytes, err := decodeContent(bodyBytes, encoding)
 		if err != nil {
 			// If decoding fails, use the original content
 			return string(bodyBytes), nil
 		}
-		return string(decodedBytes), nil
+		return string(decodeCharset(decodedBytes, contentType)), nil
 	}
 	
 	// Parse the Content-Type header to get the boundary
 	mediaType, params, err := mime.ParseMediaType(contentType)
 	if err != nil {
 		// If we can't parse the Content-Type, just return the body
-		bodyBytes, err := io.ReadAll(msg.Body)
+		bodyBytes, err := content.readAll(msg.Body)
 		if err != nil {
 			return "", err
 		}
@@ -51,32 +180,42 @@ func extractTextFromMessage(msg *mail.Message) (string, error) {
 	
 	if !strings.HasPrefix(mediaType, "multipart/") {
 		// Not a multipart message, decode and return the body
-		bodyBytes, err := io.ReadAll(msg.Body)
+		bodyBytes, err := content.readAll(msg.Body)
 		if err != nil {
 			return "", err
 		}
 		
 		// Check for Content-Transfer-Encoding and decode if necessary
+		if err := content.checkLimits(); err != nil {
+			return "", err
+		}
 		encoding := msg.Header.Get("Content-Transfer-Encoding")
 		decodedBytes, err := decodeContent(bodyBytes, encoding)
 		if err != nil {
 			// If decoding fails, use the original content
 			return string(bodyBytes), nil
 		}
-		return string(decodedBytes), nil
+		return string(decodeCharset(decodedBytes, contentType)), nil
 	}
 	
 	// Get the boundary
 	boundary, ok := params["boundary"]
 	if !ok {
 		// No boundary found, return the body as is
-		bodyBytes, err := io.ReadAll(msg.Body)
+		bodyBytes, err := content.readAll(msg.Body)
 		if err != nil {
 			return "", err
 		}
 		return string(bodyBytes), nil
 	}
 	
+	// Bound how deeply multiparts nest
+	leave, err := content.enterMultipart()
+	if err != nil {
+		return "", err
+	}
+	defer leave()
+
 	// Create a multipart reader
 	mr := multipart.NewReader(msg.Body, boundary)
 	
@@ -84,44 +223,63 @@ func extractTextFromMessage(msg *mail.Message) (string, error) {
 	var textContent bytes.Buffer
 	
 	// Read each part
-	for {
+	for index := 0; ; index++ {
 		part, err := mr.NextPart()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
+			content.PartFailures++
+			content.logger.Warn("Failed to read MIME part, skipping the rest of the message",
+				zap.Int("part", index),
+				zap.Int("depth", content.depth),
+				zap.Error(err))
+
 			// If we encounter an error reading parts, just return what we have so far
 			if textContent.Len() > 0 {
 				return textContent.String(), nil
 			}
 			// If we haven't found any text content yet, try to read the original body
-			bodyBytes, err := io.ReadAll(msg.Body)
+			bodyBytes, err := content.readAll(msg.Body)
 			if err != nil {
 				return "", err
 			}
 			return string(bodyBytes), nil
 		}
+		if err := content.countPart(); err != nil {
+			return "", err
+		}
 		
 		// Get the Content-Type of this part
 		partContentType := part.Header.Get("Content-Type")
 		
-		// If it's a text part, add it to our text content
-		if strings.Contains(strings.ToLower(partContentType), "text/plain") {
-			partBytes, err := io.ReadAll(part)
-			if err != nil {
+		// When scanning attachment text, keep named text parts out of the body
+		if content.attachmentTextLimit > 0 && isTextAttachment(part) {
+			content.addTextAttachment(part, index)
+		} else if strings.Contains(strings.ToLower(partContentType), "text/plain") {
+			// If it's a text part, add it to our text content
+			partBytes, ok := content.readPart(part, index)
+			if !ok {
 				continue // Skip this part if we can't read it
 			}
-			
-			// Check for Content-Transfer-Encoding and decode if necessary
-			encoding := part.Header.Get("Content-Transfer-Encoding")
-			decodedBytes, err := decodeContent(partBytes, encoding)
-			if err != nil {
-				// If decoding fails, use the original content
-				textContent.Write(partBytes)
-			} else {
-				textContent.Write(decodedBytes)
-			}
+			textContent.Write(partBytes)
 			textContent.WriteString("\n")
+		} else if strings.Contains(strings.ToLower(partContentType), "message/rfc822") {
+			// Forwarded messages often carry the actual spam or phishing
+			if embeddedText := extractEmbeddedMessage(part, index, content); embeddedText != "" {
+				textContent.WriteString(embeddedText)
+				textContent.WriteString("\n")
+			}
+		} else if strings.Contains(strings.ToLower(partContentType), "text/html") && partFilename(part) == "" {
+			// Check HTML alternatives for deceptive links
+			partBytes, ok := content.readPart(part, index)
+			if !ok {
+				continue
+			}
+			if err := content.checkLimits(); err != nil {
+				return "", err
+			}
+			content.LinkMismatches += countLinkMismatches(string(partBytes))
 		} else if strings.Contains(strings.ToLower(partContentType), "multipart/") {
 			// For nested multipart messages, we'll extract text recursively
 			nestedContentType := part.Header.Get("Content-Type")
@@ -138,8 +296,12 @@ func extractTextFromMessage(msg *mail.Message) (string, error) {
 			}
 			
 			// Read the entire part into a buffer
-			partBytes, err := io.ReadAll(part)
+			partBytes, err := content.readAll(part)
+			if errors.Is(err, ErrExtractionLimit) {
+				return "", err
+			}
 			if err != nil {
+				content.partFailed(part, index, "read", err)
 				continue
 			}
 			
@@ -152,11 +314,27 @@ func extractTextFromMessage(msg *mail.Message) (string, error) {
 			}
 			
 			// Extract text from the nested multipart message
-			nestedText, err := extractTextFromMessage(nestedMsg)
+			nestedText, err := extractTextFromMessage(nestedMsg, content)
+			if errors.Is(err, ErrExtractionLimit) {
+				return "", err
+			}
 			if err == nil && nestedText != "" {
 				textContent.WriteString(nestedText)
 				textContent.WriteString("\n")
 			}
+		} else if content.decodeQR && strings.HasPrefix(strings.ToLower(partContentType), "image/") {
+			// Images may carry a QR code linking to a phishing site
+			content.addImage(part, index)
+		} else if filename := partFilename(part); filename != "" {
+			// Record attachment metadata, but skip the content
+			mediaType, _, err := mime.ParseMediaType(partContentType)
+			if err != nil {
+				mediaType = partContentType
+			}
+			content.Attachments = append(content.Attachments, core.Attachment{
+				Filename:    filename,
+				ContentType: strings.ToLower(mediaType),
+			})
 		}
 		// Skip other parts (attachments, etc.)
 	}
@@ -170,6 +348,237 @@ func extractTextFromMessage(msg *mail.Message) (string, error) {
 	return "[No text content found in multipart message]", nil
 }
 
+// checkSinglePartHTML counts deceptive links in a single-part HTML message,
+// whose body is returned as is rather than walked as parts
+func (c *messageContent) checkSinglePartHTML(msg *mail.Message, text string) {
+	if mediaType, _, err := mime.ParseMediaType(msg.Header.Get("Content-Type")); err == nil && strings.EqualFold(mediaType, "text/html") {
+		c.LinkMismatches += countLinkMismatches(text)
+	}
+}
+
+// extractEmbeddedMessage extracts the text of a message/rfc822 part, such as
+// a forwarded .eml attachment, so that it is analyzed with the outer message.
+// Signals found in the embedded message are recorded in content.
+func extractEmbeddedMessage(part *multipart.Part, index int, content *messageContent) string {
+	if filename := partFilename(part); filename != "" {
+		content.Attachments = append(content.Attachments, core.Attachment{
+			Filename:    filename,
+			ContentType: "message/rfc822",
+		})
+	}
+
+	if content.depth >= maxEmbeddedDepth {
+		return ""
+	}
+
+	partBytes, ok := content.readPart(part, index)
+	if !ok {
+		return ""
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(partBytes))
+	if err != nil {
+		return ""
+	}
+
+	subject, _ := decodeEncodedHeader(msg.Header.Get("Subject"))
+	if content.depth == 0 && content.Embedded == nil {
+		content.Embedded = &core.EmbeddedMessage{From: msg.Header.Get("From"), Subject: subject}
+	}
+
+	content.depth++
+	defer func() { content.depth-- }()
+
+	text, err := extractTextFromMessage(msg, content)
+	if err != nil {
+		return ""
+	}
+	content.checkSinglePartHTML(msg, text)
+
+	return fmt.Sprintf("[Embedded message from %s with subject %q]\n%s", msg.Header.Get("From"), subject, text)
+}
+
+// isTextAttachment reports whether a MIME part is a named text/* attachment
+func isTextAttachment(part *multipart.Part) bool {
+	if partFilename(part) == "" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(part.Header.Get("Content-Type"))
+	return err == nil && strings.HasPrefix(strings.ToLower(mediaType), "text/")
+}
+
+// addTextAttachment records a text attachment and appends its decoded
+// content to the attachment text, up to the configured limit
+func (c *messageContent) addTextAttachment(part *multipart.Part, index int) {
+	filename := partFilename(part)
+	mediaType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+	c.Attachments = append(c.Attachments, core.Attachment{
+		Filename:    filename,
+		ContentType: strings.ToLower(mediaType),
+	})
+
+	remaining := c.attachmentTextLimit - len(c.AttachmentText)
+	if remaining <= 0 {
+		return
+	}
+
+	partBytes, ok := c.readPart(part, index)
+	if !ok {
+		return
+	}
+
+	text := fmt.Sprintf("--- %s ---\n%s\n", filename, partBytes)
+	if len(text) > remaining {
+		text = text[:remaining]
+	}
+	c.AttachmentText += text
+}
+
+// addImage records an image attachment and decodes any QR code in it,
+// keeping the decoded text if it is a link. Oversized images and images
+// past the per-message limit are not decoded.
+func (c *messageContent) addImage(part *multipart.Part, index int) {
+	mediaType, _, err := mime.ParseMediaType(part.Header.Get("Content-Type"))
+	if err != nil {
+		mediaType = part.Header.Get("Content-Type")
+	}
+	if filename := partFilename(part); filename != "" {
+		c.Attachments = append(c.Attachments, core.Attachment{
+			Filename:    filename,
+			ContentType: strings.ToLower(mediaType),
+		})
+	}
+
+	if c.imagesScanned >= maxQRImages || declaredSize(part) > maxQRImageSize {
+		return
+	}
+	c.imagesScanned++
+
+	// Read no more than the largest encoding of an image within the limit,
+	// skipping larger images rather than decoding a truncated one
+	encoding := part.Header.Get("Content-Transfer-Encoding")
+	limit := maxEncodedSize(maxQRImageSize, encoding)
+	partBytes, err := c.readAll(io.LimitReader(part, limit+1))
+	if errors.Is(err, ErrExtractionLimit) {
+		return
+	}
+	if err != nil {
+		c.partFailed(part, index, "read", err)
+		return
+	}
+	if int64(len(partBytes)) > limit {
+		return
+	}
+	imageBytes, err := decodeContent(partBytes, encoding)
+	if err != nil {
+		c.partFailed(part, index, "decode", err)
+		return
+	}
+	if len(imageBytes) > maxQRImageSize || c.checkLimits() != nil {
+		return
+	}
+
+	text, err := qr.DecodeBytes(imageBytes)
+	if err != nil {
+		return
+	}
+	if link := qrLink(text); link != "" {
+		c.QRLinks = append(c.QRLinks, link)
+	}
+}
+
+// declaredSize returns the size in bytes a MIME part declares in the size
+// parameter of its Content-Disposition, or 0 if it declares none
+func declaredSize(part *multipart.Part) int64 {
+	_, params, err := mime.ParseMediaType(part.Header.Get("Content-Disposition"))
+	if err != nil {
+		return 0
+	}
+	size, err := strconv.ParseInt(params["size"], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return size
+}
+
+// maxEncodedSize returns the most bytes content of up to size bytes can
+// take in a Content-Transfer-Encoding. Base64 is allowed lines as short as
+// 64 characters, each with a CRLF, and quoted-printable three bytes for
+// every byte.
+func maxEncodedSize(size int64, encoding string) int64 {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		chars := (size + 2) / 3 * 4
+		return chars + (chars/64+1)*2
+	case "quoted-printable":
+		return size * 3
+	default:
+		return size
+	}
+}
+
+// qrLink returns the URL in the text of a QR code, or an empty string if
+// it is not an http or https URL. Long URLs are truncated.
+func qrLink(text string) string {
+	text = strings.TrimSpace(text)
+	u, err := url.Parse(text)
+	if err != nil || u.Host == "" || (!strings.EqualFold(u.Scheme, "http") && !strings.EqualFold(u.Scheme, "https")) {
+		return ""
+	}
+	const maxLen = 200
+	if len(text) > maxLen {
+		text = text[:maxLen] + "..."
+	}
+	return text
+}
+
+// readPart reads a MIME part and decodes its Content-Transfer-Encoding and
+// charset. A part that fails to decode is returned as is, and a part that
+// fails to read returns false. Either failure is recorded.
+func (c *messageContent) readPart(part *multipart.Part, index int) ([]byte, bool) {
+	partBytes, err := c.readAll(part)
+	if errors.Is(err, ErrExtractionLimit) {
+		return nil, false
+	}
+	if err != nil {
+		c.partFailed(part, index, "read", err)
+		return nil, false
+	}
+	if c.checkLimits() != nil {
+		return nil, false
+	}
+	decodedBytes, err := decodeContent(partBytes, part.Header.Get("Content-Transfer-Encoding"))
+	if err != nil {
+		c.partFailed(part, index, "decode", err)
+		return partBytes, true
+	}
+	return decodeCharset(decodedBytes, part.Header.Get("Content-Type")), true
+}
+
+// partFailed logs and counts a MIME part that failed to read or decode
+func (c *messageContent) partFailed(part *multipart.Part, index int, action string, err error) {
+	c.PartFailures++
+	c.logger.Warn("Failed to "+action+" MIME part",
+		zap.Int("part", index),
+		zap.Int("depth", c.depth),
+		zap.String("content_type", part.Header.Get("Content-Type")),
+		zap.String("encoding", part.Header.Get("Content-Transfer-Encoding")),
+		zap.Error(err))
+}
+
+// partFilename returns the filename of a MIME part from its
+// Content-Disposition, falling back to the Content-Type name parameter
+func partFilename(part *multipart.Part) string {
+	if filename := part.FileName(); filename != "" {
+		return filename
+	}
+	_, params, err := mime.ParseMediaType(part.Header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	return params["name"]
+}
+
 // decodeContent decodes content based on the Content-Transfer-Encoding
 func decodeContent(content []byte, encoding string) ([]byte, error) {
 	switch strings.ToLower(encoding) {
@@ -193,6 +602,34 @@ func decodeContent(content []byte, encoding string) ([]byte, error) {
 	}
 }
 
+// decodeCharset converts a text body to UTF-8 using the charset parameter
+// of its Content-Type. 7bit, 8bit and binary bodies are passed through by
+// decodeContent untouched, so this is where a Windows-1251 or ISO-8859-1
+// body becomes readable. Bodies without a charset, or already UTF-8, are
+// returned as is, as are bodies that fail to convert.
+func decodeCharset(content []byte, contentType string) []byte {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || !strings.HasPrefix(mediaType, "text/") {
+		return content
+	}
+
+	charset := strings.ToLower(strings.TrimSpace(params["charset"]))
+	switch charset {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		return content
+	}
+
+	enc, err := getEncoding(charset)
+	if err != nil {
+		return content
+	}
+	decoded, err := enc.NewDecoder().Bytes(content)
+	if err != nil {
+		return content
+	}
+	return decoded
+}
+
 // decodeEncodedHeader decodes MIME encoded-word syntax in headers
 // as per RFC 2047, e.g. "=?UTF-8?B?U3ViamVjdA==?="
 func decodeEncodedHeader(header string) (string, error) {
@@ -0,0 +1,355 @@
+package filter
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"net/mail"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// extractTestMessage extracts the content of a raw message with the default
+// limits
+func extractTestMessage(t *testing.T, raw string, attachmentTextLimit int) *messageContent {
+	t.Helper()
+	msg, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+	content, err := extractContentFromMessage(msg, attachmentTextLimit, false, false, defaultLimits, zap.NewNop())
+	if err != nil {
+		t.Fatalf("extractContentFromMessage() error = %v", err)
+	}
+	return content
+}
+
+// attachmentMessage has a text body and a base64 text/plain attachment
+const attachmentMessage = "From: sender@example.com\r\n" +
+	"Content-Type: multipart/mixed; boundary=x\r\n\r\n" +
+	"--x\r\nContent-Type: text/plain\r\n\r\nSee the attached instructions.\r\n" +
+	"--x\r\nContent-Type: text/plain; name=\"notes.txt\"\r\n" +
+	"Content-Disposition: attachment; filename=\"notes.txt\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n\r\n" +
+	"V2lyZSB0aGUgZnVuZHMgdG8gYWNjb3VudCAxMjM0NSB0b2RheS4=\r\n" +
+	"--x--\r\n"
+
+func TestExtractAttachmentText(t *testing.T) {
+	content := extractTestMessage(t, attachmentMessage, 4096)
+
+	if want := "--- notes.txt ---\nWire the funds to account 12345 today.\n"; content.AttachmentText != want {
+		t.Errorf("AttachmentText = %q, want %q", content.AttachmentText, want)
+	}
+	if strings.Contains(content.Text, "Wire the funds") {
+		t.Errorf("Text = %q, want the attachment kept out of the body", content.Text)
+	}
+	if len(content.Attachments) != 1 || content.Attachments[0].Filename != "notes.txt" {
+		t.Errorf("Attachments = %+v, want notes.txt", content.Attachments)
+	}
+}
+
+func TestExtractAttachmentTextLimit(t *testing.T) {
+	if content := extractTestMessage(t, attachmentMessage, 20); content.AttachmentText != "--- notes.txt ---\nWi" {
+		t.Errorf("AttachmentText = %q, want the first 20 bytes", content.AttachmentText)
+	}
+	if content := extractTestMessage(t, attachmentMessage, 0); content.AttachmentText != "" {
+		t.Errorf("AttachmentText = %q, want none when disabled", content.AttachmentText)
+	}
+}
+
+func TestExtractCountsLinkMismatches(t *testing.T) {
+	message := "From: sender@example.com\r\n" +
+		"Content-Type: multipart/alternative; boundary=x\r\n\r\n" +
+		"--x\r\nContent-Type: text/plain\r\n\r\nVisit www.yourbank.com to verify your account.\r\n" +
+		"--x\r\nContent-Type: text/html\r\n\r\n" +
+		"<p>Visit <a href=\"http://evil.example.ru/login\">www.yourbank.com</a> to verify your account.</p>\r\n" +
+		"--x--\r\n"
+
+	if content := extractTestMessage(t, message, 0); content.LinkMismatches != 1 {
+		t.Errorf("LinkMismatches = %d, want 1", content.LinkMismatches)
+	}
+}
+
+// forwardedAttachmentMessage carries a phishing message as an .eml attachment
+const forwardedAttachmentMessage = "From: colleague@example.org\r\n" +
+	"Subject: Fwd: is this real?\r\n" +
+	"Content-Type: multipart/mixed; boundary=outer\r\n\r\n" +
+	"--outer\r\nContent-Type: text/plain\r\n\r\nGot this today, is it legitimate?\r\n" +
+	"--outer\r\nContent-Type: message/rfc822\r\n" +
+	"Content-Disposition: attachment; filename=\"prize.eml\"\r\n\r\n" +
+	"From: Lottery Office <claims@lottery.example>\r\n" +
+	"Subject: =?UTF-8?Q?You=E2=80=99ve_won?=\r\n" +
+	"Content-Type: text/plain\r\n\r\n" +
+	"Congratulations! Send your bank details to claim your $1,000,000 prize.\r\n" +
+	"--outer--\r\n"
+
+func TestExtractEmbeddedMessage(t *testing.T) {
+	content := extractTestMessage(t, forwardedAttachmentMessage, 0)
+
+	if !strings.Contains(content.Text, "Send your bank details to claim your $1,000,000 prize.") {
+		t.Errorf("Text = %q, want the embedded message's body", content.Text)
+	}
+	if !strings.Contains(content.Text, "[Embedded message from Lottery Office <claims@lottery.example> with subject \"You’ve won\"]") {
+		t.Errorf("Text = %q, want the embedded message introduced", content.Text)
+	}
+	if len(content.Attachments) != 1 || content.Attachments[0].Filename != "prize.eml" || content.Attachments[0].ContentType != "message/rfc822" {
+		t.Errorf("Attachments = %+v, want prize.eml", content.Attachments)
+	}
+	if content.Embedded == nil || content.Embedded.Subject != "You’ve won" {
+		t.Errorf("Embedded = %+v, want the embedded sender and subject", content.Embedded)
+	}
+}
+
+func TestExtractEmbeddedMessageDepthLimit(t *testing.T) {
+	message := "From: a@example.org\r\nContent-Type: text/plain\r\n\r\ninnermost text\r\n"
+	for i := 0; i <= maxEmbeddedDepth; i++ {
+		boundary := fmt.Sprintf("b%d", i)
+		message = "From: a@example.org\r\nContent-Type: multipart/mixed; boundary=" + boundary + "\r\n\r\n" +
+			"--" + boundary + "\r\nContent-Type: message/rfc822\r\n\r\n" + message + "\r\n--" + boundary + "--\r\n"
+	}
+
+	if content := extractTestMessage(t, message, 0); strings.Contains(content.Text, "innermost text") {
+		t.Errorf("Text = %q, want messages past the embedding limit left out", content.Text)
+	}
+}
+
+// qrMessage returns a message with a text body and a PNG of a QR code
+// linking to https://phish.example/login
+func qrMessage(t *testing.T) string {
+	t.Helper()
+	image, err := os.ReadFile("../../qr/testdata/link.png")
+	if err != nil {
+		t.Fatalf("failed to read QR fixture: %v", err)
+	}
+	return "From: sender@example.com\r\n" +
+		"To: user@example.org\r\n" +
+		"Subject: Verify your account\r\n" +
+		"Content-Type: multipart/mixed; boundary=x\r\n\r\n" +
+		"--x\r\nContent-Type: text/plain\r\n\r\nScan the code to keep your account.\r\n" +
+		"--x\r\nContent-Type: image/png\r\nContent-Transfer-Encoding: base64\r\n" +
+		"Content-Disposition: inline; filename=code.png\r\n\r\n" +
+		base64.StdEncoding.EncodeToString(image) + "\r\n" +
+		"--x--\r\n"
+}
+
+func TestQRCodeLinkBecomesSignal(t *testing.T) {
+	for _, decodeQR := range []bool{false, true} {
+		llm := &recordingLLM{result: core.SpamAnalysisResult{Score: 0.2}}
+		f, _ := newAnalyzingFilter(t, llm, core.ServiceOptions{})
+		f.decodeQR = decodeQR
+
+		if err := receive(f, "sender@example.com", []string{"user@example.org"}, qrMessage(t)); err != nil {
+			t.Fatalf("Data() error = %v", err)
+		}
+		emails := llm.analyzed()
+		if len(emails) != 1 {
+			t.Fatalf("analyzed %d emails, want 1", len(emails))
+		}
+
+		signalled := false
+		for _, signal := range emails[0].Signals {
+			signalled = signalled || signal == "QR code in image links to https://phish.example/login"
+		}
+		if signalled != decodeQR {
+			t.Errorf("decodeQR=%t: signals = %q, want QR link signal %t", decodeQR, emails[0].Signals, decodeQR)
+		}
+		if strings.Contains(emails[0].Body, "iVBOR") {
+			t.Errorf("decodeQR=%t: body = %q, want the image left out", decodeQR, emails[0].Body)
+		}
+	}
+}
+
+// paddedPNG returns the QR fixture padded with a text chunk to size bytes
+func paddedPNG(t *testing.T, size int) []byte {
+	t.Helper()
+	image, err := os.ReadFile("../../qr/testdata/link.png")
+	if err != nil {
+		t.Fatalf("failed to read QR fixture: %v", err)
+	}
+	// The chunk adds 12 bytes of length, type and CRC to its data, and goes
+	// after the 8 byte signature and 25 byte IHDR chunk
+	chunk := append([]byte("tEXt"), []byte("Comment\x00")...)
+	chunk = append(chunk, bytes.Repeat([]byte("x"), size-len(image)-len(chunk)-8)...)
+	padded := binary.BigEndian.AppendUint32(append([]byte(nil), image[:33]...), uint32(len(chunk)-4))
+	padded = append(padded, chunk...)
+	padded = binary.BigEndian.AppendUint32(padded, crc32.ChecksumIEEE(chunk))
+	return append(padded, image[33:]...)
+}
+
+// wrappedImageMessage returns a message with a PNG base64 encoded in lines
+// of 76 characters, as mail clients send it
+func wrappedImageMessage(image []byte) string {
+	encoded := base64.StdEncoding.EncodeToString(image)
+	var wrapped strings.Builder
+	for len(encoded) > 76 {
+		wrapped.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	wrapped.WriteString(encoded + "\r\n")
+	return "From: sender@example.com\r\n" +
+		"Content-Type: multipart/mixed; boundary=x\r\n\r\n" +
+		"--x\r\nContent-Type: text/plain\r\n\r\nScan the code.\r\n" +
+		"--x\r\nContent-Type: image/png\r\nContent-Transfer-Encoding: base64\r\n\r\n" +
+		wrapped.String() +
+		"--x--\r\n"
+}
+
+func TestLargeImagesAreNotPartFailures(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+		link bool
+	}{
+		{"just under the limit", maxQRImageSize - 100, true},
+		{"over the limit", maxQRImageSize + 100, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			image := paddedPNG(t, tt.size)
+			if len(image) != tt.size {
+				t.Fatalf("padded image is %d bytes, want %d", len(image), tt.size)
+			}
+			msg, err := mail.ReadMessage(strings.NewReader(wrappedImageMessage(image)))
+			if err != nil {
+				t.Fatalf("ReadMessage() error = %v", err)
+			}
+			content, err := extractContentFromMessage(msg, 0, false, true, defaultLimits, zap.NewNop())
+			if err != nil {
+				t.Fatalf("extractContentFromMessage() error = %v", err)
+			}
+			if content.PartFailures != 0 {
+				t.Errorf("PartFailures = %d, want large images skipped quietly", content.PartFailures)
+			}
+			if link := len(content.QRLinks) == 1; link != tt.link {
+				t.Errorf("QRLinks = %q, want decoded %t", content.QRLinks, tt.link)
+			}
+		})
+	}
+}
+
+func TestDeclaredOversizeImageIsNotRead(t *testing.T) {
+	message := strings.Replace(wrappedImageMessage(paddedPNG(t, 4096)),
+		"Content-Transfer-Encoding: base64\r\n",
+		"Content-Transfer-Encoding: base64\r\nContent-Disposition: inline; filename=code.png; size=5000000\r\n", 1)
+	msg, _ := mail.ReadMessage(strings.NewReader(message))
+	content, err := extractContentFromMessage(msg, 0, false, true, defaultLimits, zap.NewNop())
+	if err != nil {
+		t.Fatalf("extractContentFromMessage() error = %v", err)
+	}
+	if len(content.QRLinks) != 0 || content.PartFailures != 0 || len(content.Attachments) != 1 {
+		t.Errorf("content = %+v, want the image recorded but not decoded", content)
+	}
+}
+
+func TestQRLink(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{" https://phish.example/login ", "https://phish.example/login"},
+		{"HTTP://example.com", "HTTP://example.com"},
+		{"WIFI:S:guest;T:WPA;P:secret;;", ""},
+		{"mailto:someone@example.com", ""},
+		{"https://example.com/" + strings.Repeat("a", 300), "https://example.com/" + strings.Repeat("a", 180) + "..."},
+	}
+	for _, tt := range tests {
+		if got := qrLink(tt.text); got != tt.want {
+			t.Errorf("qrLink(%.40q) = %.40q, want %.40q", tt.text, got, tt.want)
+		}
+	}
+}
+
+// badPartMessage has two readable text parts around one with invalid base64
+const badPartMessage = "From: sender@example.com\r\n" +
+	"Content-Type: multipart/mixed; boundary=x\r\n\r\n" +
+	"--x\r\nContent-Type: text/plain\r\n\r\nFirst part.\r\n" +
+	"--x\r\nContent-Type: text/plain\r\nContent-Transfer-Encoding: base64\r\n\r\n!!! not base64 !!!\r\n" +
+	"--x\r\nContent-Type: text/plain\r\nContent-Transfer-Encoding: base64\r\n\r\nVGhpcmQgcGFydC4=\r\n" +
+	"--x--\r\n"
+
+func TestExtractSurvivesBadBase64Part(t *testing.T) {
+	msg, err := mail.ReadMessage(strings.NewReader(badPartMessage))
+	if err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+	observed, logs := observer.New(zapcore.WarnLevel)
+	content, err := extractContentFromMessage(msg, 0, false, false, defaultLimits, zap.New(observed))
+	if err != nil {
+		t.Fatalf("extractContentFromMessage() error = %v", err)
+	}
+
+	for _, want := range []string{"First part.", "Third part."} {
+		if !strings.Contains(content.Text, want) {
+			t.Errorf("Text = %q, want %q", content.Text, want)
+		}
+	}
+	if content.PartFailures != 1 {
+		t.Errorf("PartFailures = %d, want 1", content.PartFailures)
+	}
+	warnings := logs.FilterMessage("Failed to decode MIME part").All()
+	if len(warnings) != 1 {
+		t.Fatalf("logged %d decode warnings, want 1", len(warnings))
+	}
+	if fields := warnings[0].ContextMap(); fields["part"] != int64(1) || fields["encoding"] != "base64" {
+		t.Errorf("warning fields = %v, want part 1 with base64 encoding", fields)
+	}
+}
+
+// windows1251Body is "Привет, мир" encoded in Windows-1251 and then
+// quoted-printable
+const windows1251Body = "=CF=F0=E8=E2=E5=F2, =EC=E8=F0"
+
+func TestWindows1251BodyDecodesToUTF8(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+	}{
+		{"single part", "From: sender@example.com\r\n" +
+			"Content-Type: text/plain; charset=windows-1251\r\n" +
+			"Content-Transfer-Encoding: quoted-printable\r\n\r\n" +
+			windows1251Body + "\r\n"},
+		{"multipart", "From: sender@example.com\r\n" +
+			"Content-Type: multipart/alternative; boundary=x\r\n\r\n" +
+			"--x\r\nContent-Type: text/plain; charset=\"Windows-1251\"\r\n" +
+			"Content-Transfer-Encoding: quoted-printable\r\n\r\n" +
+			windows1251Body + "\r\n--x--\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := extractTestMessage(t, tt.raw, 0)
+			if !strings.Contains(content.Text, "Привет, мир") {
+				t.Errorf("Text = %q, want the body decoded to UTF-8", content.Text)
+			}
+		})
+	}
+}
+
+func TestDecodeCharset(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		contentType string
+		want        string
+	}{
+		{"windows-1251", "\xcf\xf0\xe8\xe2\xe5\xf2", "text/plain; charset=windows-1251", "Привет"},
+		{"utf-8 unchanged", "Привет", "text/plain; charset=utf-8", "Привет"},
+		{"no charset", "hello", "text/plain", "hello"},
+		{"unknown charset", "hello", "text/plain; charset=x-unknown", "hello"},
+		{"not text", "\xcf\xf0", "application/octet-stream; charset=windows-1251", "\xcf\xf0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(decodeCharset([]byte(tt.content), tt.contentType)); got != tt.want {
+				t.Errorf("decodeCharset() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
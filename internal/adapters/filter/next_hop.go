@@ -0,0 +1,38 @@
+package filter
+
+import (
+	"crypto/tls"
+	"net"
+	"strconv"
+)
+
+// NextHop is the MTA that processed mail is delivered to, normally the
+// Postfix reinjection port but possibly any smarthost
+type NextHop struct {
+	// Address is the host:port to connect to
+	Address string
+
+	// StartTLS requires upgrading the connection with STARTTLS before
+	// sending mail, using TLSConfig
+	StartTLS  bool
+	TLSConfig *tls.Config
+
+	// Username and Password authenticate with AUTH PLAIN if set
+	Username string
+	Password string
+}
+
+// NewNextHop creates a delivery target. skipVerify disables certificate
+// verification for STARTTLS, for relays with self-signed certificates.
+func NewNextHop(host string, port int, startTLS bool, skipVerify bool, username string, password string) *NextHop {
+	return &NextHop{
+		Address:  net.JoinHostPort(host, strconv.Itoa(port)),
+		StartTLS: startTLS,
+		TLSConfig: &tls.Config{
+			ServerName:         host,
+			InsecureSkipVerify: skipVerify,
+		},
+		Username: username,
+		Password: password,
+	}
+}
@@ -0,0 +1,121 @@
+package filter
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newTLSMTA starts a next hop offering STARTTLS with a self-signed
+// certificate for 127.0.0.1, and returns it with a pool trusting the
+// certificate
+func newTLSMTA(t *testing.T) (*fakeMTA, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+
+	mta := newFakeMTA(t)
+	mta.server.TLSConfig = &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	}
+	return mta, roots
+}
+
+// splitAddr splits a next hop address into the host and port NewNextHop
+// takes
+func splitAddr(t *testing.T, addr string) (string, int) {
+	t.Helper()
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatalf("SplitHostPort(%q) error = %v", addr, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		t.Fatalf("invalid port %q: %v", portStr, err)
+	}
+	return host, port
+}
+
+func TestDeliveryUsesConfiguredHostAndPort(t *testing.T) {
+	mta := newFakeMTA(t)
+	host, port := splitAddr(t, mta.addr())
+	f := newDeliveringFilter(NewNextHop(host, port, false, false, "", ""), "filter.example.net")
+
+	if err := f.sendToNextHop("sender@example.com", []string{"user@example.org"}, []byte(testMessage)); err != nil {
+		t.Fatalf("sendToNextHop() error = %v", err)
+	}
+	delivered := mta.delivered()
+	if len(delivered) != 1 {
+		t.Fatalf("next hop received %d messages, want 1", len(delivered))
+	}
+	if delivered[0].tls {
+		t.Error("message was delivered over TLS, want plain SMTP when STARTTLS is disabled")
+	}
+}
+
+func TestDeliveryNegotiatesStartTLS(t *testing.T) {
+	mta, roots := newTLSMTA(t)
+	host, port := splitAddr(t, mta.addr())
+	nextHop := NewNextHop(host, port, true, false, "", "")
+	nextHop.TLSConfig.RootCAs = roots
+	f := newDeliveringFilter(nextHop, "filter.example.net")
+
+	if err := f.sendToNextHop("sender@example.com", []string{"user@example.org"}, []byte(testMessage)); err != nil {
+		t.Fatalf("sendToNextHop() error = %v", err)
+	}
+	delivered := mta.delivered()
+	if len(delivered) != 1 {
+		t.Fatalf("next hop received %d messages, want 1", len(delivered))
+	}
+	if !delivered[0].tls {
+		t.Error("message was delivered in plain text, want it sent after STARTTLS")
+	}
+}
+
+func TestDeliveryVerifiesStartTLSCertificate(t *testing.T) {
+	mta, _ := newTLSMTA(t)
+	host, port := splitAddr(t, mta.addr())
+
+	f := newDeliveringFilter(NewNextHop(host, port, true, false, "", ""), "filter.example.net")
+	if err := f.sendToNextHop("sender@example.com", []string{"user@example.org"}, []byte(testMessage)); err == nil {
+		t.Error("sendToNextHop() succeeded, want the untrusted certificate rejected")
+	}
+	if delivered := mta.delivered(); len(delivered) != 0 {
+		t.Fatalf("next hop received %d messages, want none", len(delivered))
+	}
+
+	f = newDeliveringFilter(NewNextHop(host, port, true, true, "", ""), "filter.example.net")
+	if err := f.sendToNextHop("sender@example.com", []string{"user@example.org"}, []byte(testMessage)); err != nil {
+		t.Fatalf("sendToNextHop() with verification skipped error = %v", err)
+	}
+	if delivered := mta.delivered(); len(delivered) != 1 || !delivered[0].tls {
+		t.Error("want the message delivered over TLS when verification is skipped")
+	}
+}
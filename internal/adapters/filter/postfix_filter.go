@@ -3,6 +3,9 @@ package filter
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -11,11 +14,42 @@ import (
 	"strings"
 	"time"
 
+	"github.com/emersion/go-sasl"
 	"github.com/emersion/go-smtp"
+	"github.com/google/uuid"
 	"github.com/mikey/llm-spam-filter/internal/core"
+	"github.com/mikey/llm-spam-filter/internal/utils"
 	"go.uber.org/zap"
 )
 
+// Oversize modes control how messages over the analysis size limit are
+// handled
+const (
+	// OversizeSkip passes oversized messages through without analysis
+	OversizeSkip = "skip"
+
+	// OversizeText analyzes only the body text of oversized messages,
+	// leaving out attachment text and images
+	OversizeText = "text"
+)
+
+// Headers on error control which headers are added when analysis fails
+const (
+	// HeadersOnErrorAll adds the fallback non-spam verdict's headers and
+	// the analysis error header
+	HeadersOnErrorAll = "all"
+
+	// HeadersOnErrorOnly adds only the analysis error header, so nothing
+	// downstream mistakes the fallback for a verdict
+	HeadersOnErrorOnly = "error_only"
+
+	// HeadersOnErrorNone adds no headers
+	HeadersOnErrorNone = "none"
+)
+
+// errAllRecipientsRejected is returned when Postfix rejects every recipient
+var errAllRecipientsRejected = errors.New("all recipients were rejected")
+
 // PostfixFilter implements a Postfix content filter
 type PostfixFilter struct {
 	service           *core.SpamFilterService
@@ -26,11 +60,39 @@ type PostfixFilter struct {
 	spamHeader        string
 	scoreHeader       string
 	reasonHeader      string
-	postfixAddr       string
-	postfixPort       int
+	skippedHeader     string
+	idHeader          string
+	traceHeader       string
+	bulkHeader        string
+	nextHop           *NextHop
 	postfixEnabled    bool
+	postfixRetries    int
+	postfixRetryDelay time.Duration
 	subjectPrefix     string
 	modifySubject     bool
+	subjectPrefixMinScore float64
+	foldHeaders       bool
+	heloHostname      string
+	attachmentTextLimit int
+	auth              *SMTPAuth
+	trustedNetworks   []*net.IPNet
+	spamAssassinCompat bool
+	spamThreshold     float64
+	blockSchedule     *BlockSchedule
+	stripInlineImages bool
+	decodeQR          bool
+	maxAnalyzeBytes   int
+	oversizeMode      string
+	headersOnError    string
+	extractionLimits  ExtractionLimits
+	digestStore       core.DigestStore
+}
+
+// errTooComplex rejects a message exceeding the content extraction limits
+var errTooComplex = &smtp.SMTPError{
+	Code:         552,
+	EnhancedCode: smtp.EnhancedCode{5, 3, 4},
+	Message:      "Message too complex to analyze",
 }
 
 // NewPostfixFilter creates a new Postfix content filter
@@ -42,11 +104,32 @@ func NewPostfixFilter(
 	spamHeader string,
 	scoreHeader string,
 	reasonHeader string,
-	postfixAddr string,
-	postfixPort int,
+	skippedHeader string,
+	bulkHeader string,
+	idHeader string,
+	traceHeader string,
+	nextHop *NextHop,
 	postfixEnabled bool,
+	postfixRetries int,
+	postfixRetryDelay time.Duration,
 	subjectPrefix string,
 	modifySubject bool,
+	subjectPrefixMinScore float64,
+	foldHeaders bool,
+	heloHostname string,
+	attachmentTextLimit int,
+	auth *SMTPAuth,
+	trustedNetworks []*net.IPNet,
+	spamAssassinCompat bool,
+	spamThreshold float64,
+	blockSchedule *BlockSchedule,
+	stripInlineImages bool,
+	decodeQR bool,
+	maxAnalyzeBytes int,
+	oversizeMode string,
+	headersOnError string,
+	extractionLimits ExtractionLimits,
+	digestStore core.DigestStore,
 ) *PostfixFilter {
 	// If subject prefix is not set but modify subject is enabled, use default prefix
 	if subjectPrefix == "" && modifySubject {
@@ -61,11 +144,69 @@ func NewPostfixFilter(
 		spamHeader:     spamHeader,
 		scoreHeader:    scoreHeader,
 		reasonHeader:   reasonHeader,
-		postfixAddr:    postfixAddr,
-		postfixPort:    postfixPort,
+		skippedHeader:  skippedHeader,
+		bulkHeader:     bulkHeader,
+		idHeader:       idHeader,
+		traceHeader:    traceHeader,
+		nextHop:        nextHop,
 		postfixEnabled: postfixEnabled,
+		postfixRetries: postfixRetries,
+		postfixRetryDelay: postfixRetryDelay,
 		subjectPrefix:  subjectPrefix,
 		modifySubject:  modifySubject,
+		subjectPrefixMinScore: subjectPrefixMinScore,
+		foldHeaders:    foldHeaders,
+		heloHostname:   heloHostname,
+		attachmentTextLimit: attachmentTextLimit,
+		auth:           auth,
+		trustedNetworks: trustedNetworks,
+		spamAssassinCompat: spamAssassinCompat,
+		spamThreshold:  spamThreshold,
+		blockSchedule:  blockSchedule,
+		stripInlineImages: stripInlineImages,
+		decodeQR:       decodeQR,
+		maxAnalyzeBytes: maxAnalyzeBytes,
+		oversizeMode:   oversizeMode,
+		headersOnError: headersOnError,
+		extractionLimits: extractionLimits,
+		digestStore:    digestStore,
+	}
+}
+
+// writeVerdictHeaders writes the headers describing a verdict
+func (s *smtpSession) writeVerdictHeaders(buf *bytes.Buffer, result *core.SpamAnalysisResult) {
+	if s.filter.spamAssassinCompat {
+		// Report the threshold the verdict was decided against, which
+		// domain thresholds and reputation may have moved
+		threshold := s.filter.spamThreshold
+		if result.Threshold > 0 {
+			threshold = result.Threshold
+		}
+		status, level := spamAssassinHeaders(result.IsSpam, result.Score, threshold)
+		fmt.Fprintf(buf, "%s: %s\r\n", spamAssassinStatusHeader, status)
+		fmt.Fprintf(buf, "%s: %s\r\n", spamAssassinLevelHeader, level)
+	}
+	// The compat status header replaces a custom header of the same name
+	if !s.filter.spamAssassinCompat || !strings.EqualFold(s.filter.spamHeader, spamAssassinStatusHeader) {
+		fmt.Fprintf(buf, "%s: %t\r\n", s.filter.spamHeader, result.IsSpam)
+	}
+	fmt.Fprintf(buf, "%s: %.4f\r\n", s.filter.scoreHeader, result.Score)
+	s.filter.writeHeader(buf, s.filter.reasonHeader, result.Explanation)
+	if s.filter.idHeader != "" {
+		fmt.Fprintf(buf, "%s: %s\r\n", s.filter.idHeader, result.ProcessingID)
+	}
+
+	// Note when analysis was skipped
+	if result.SkipReason != "" && s.filter.skippedHeader != "" {
+		s.filter.writeHeader(buf, s.filter.skippedHeader, result.SkipReason)
+	}
+	if result.Bulk && s.filter.bulkHeader != "" {
+		fmt.Fprintf(buf, "%s: yes\r\n", s.filter.bulkHeader)
+	}
+
+	// Show how the verdict was reached if decision traces are enabled
+	if result.Trace != nil && s.filter.traceHeader != "" {
+		s.filter.writeHeader(buf, s.filter.traceHeader, result.Trace.String())
 	}
 }
 
@@ -77,10 +218,15 @@ func (f *PostfixFilter) Start() error {
 	// Configure the server
 	f.server.Addr = f.listenAddr
 	f.server.Domain = "localhost"
+	if f.heloHostname != "" {
+		f.server.Domain = f.heloHostname
+	}
 	f.server.ReadTimeout = 30 * time.Second
 	f.server.WriteTimeout = 30 * time.Second
 	f.server.MaxMessageBytes = 30 * 1024 * 1024 // 30MB
 	f.server.MaxRecipients = 50
+	// The filter normally listens on a trusted local port without TLS, so
+	// AUTH must be allowed over plain connections when required
 	f.server.AllowInsecureAuth = true
 	
 	f.logger.Info("Postfix filter starting", zap.String("address", f.listenAddr))
@@ -111,41 +257,94 @@ func (f *PostfixFilter) ProcessEmail(ctx context.Context, email *core.Email) (*c
 	return f.service.AnalyzeEmail(ctx, email)
 }
 
-// sendToPostfix sends the processed email back to Postfix on the configured port using go-smtp
-func (f *PostfixFilter) sendToPostfix(sender string, recipients []string, emailData []byte) error {
-	// Connect to Postfix using go-smtp
-	postfixAddr := fmt.Sprintf("%s:%d", f.postfixAddr, f.postfixPort)
-	
-	// Get hostname for EHLO
-	hostname, err := os.Hostname()
-	if err != nil {
-		hostname = "localhost"
+// sendToNextHop sends the processed email to the next hop, retrying with
+// exponential backoff on transient failures. Once the next hop may have
+// accepted the message the delivery is never retried, to avoid duplicates.
+func (f *PostfixFilter) sendToNextHop(sender string, recipients []string, emailData []byte) error {
+	delay := f.postfixRetryDelay
+	for attempt := 0; ; attempt++ {
+		committed, err := f.deliverToNextHop(sender, recipients, emailData)
+		if err == nil {
+			return nil
+		}
+		if committed || !isTransientSMTPError(err) || attempt >= f.postfixRetries {
+			return err
+		}
+		
+		f.logger.Warn("Failed to send email to next hop, retrying",
+			zap.String("next_hop", f.nextHop.Address),
+			zap.Error(err),
+			zap.Int("attempt", attempt+1),
+			zap.Int("max_retries", f.postfixRetries),
+			zap.Duration("delay", delay))
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// isTransientSMTPError returns whether a delivery error may succeed on
+// retry. Permanent (5xx) SMTP replies are not retried.
+func isTransientSMTPError(err error) bool {
+	var smtpErr *smtp.SMTPError
+	if errors.As(err, &smtpErr) {
+		return smtpErr.Code < 500
+	}
+	return !errors.Is(err, errAllRecipientsRejected)
+}
+
+// deliverToNextHop makes a single attempt to send the processed email to the
+// next hop using go-smtp, upgrading the connection with STARTTLS and
+// authenticating if configured. It reports whether the data may have been
+// committed, in which case the delivery must not be retried.
+func (f *PostfixFilter) deliverToNextHop(sender string, recipients []string, emailData []byte) (bool, error) {
+	// Get hostname for EHLO, preferring the configured hostname
+	hostname := f.heloHostname
+	if hostname == "" {
+		var err error
+		if hostname, err = os.Hostname(); err != nil {
+			hostname = "localhost"
+		}
 	}
 	
 	// Connect to the server with a timeout
-	conn, err := net.DialTimeout("tcp", postfixAddr, 10*time.Second)
+	conn, err := net.DialTimeout("tcp", f.nextHop.Address, 10*time.Second)
 	if err != nil {
-		return fmt.Errorf("failed to connect to Postfix: %w", err)
+		return false, fmt.Errorf("failed to connect to next hop %s: %w", f.nextHop.Address, err)
 	}
 	
 	// Set a deadline for the connection
 	if err := conn.SetDeadline(time.Now().Add(30 * time.Second)); err != nil {
 		conn.Close()
-		return fmt.Errorf("failed to set connection deadline: %w", err)
+		return false, fmt.Errorf("failed to set connection deadline: %w", err)
 	}
 	
-	// Create a client
-	c := smtp.NewClient(conn)
+	// Create a client, upgrading the connection first if required
+	var c *smtp.Client
+	if f.nextHop.StartTLS {
+		if c, err = smtp.NewClientStartTLS(conn, f.nextHop.TLSConfig); err != nil {
+			conn.Close()
+			return false, fmt.Errorf("STARTTLS failed: %w", err)
+		}
+	} else {
+		c = smtp.NewClient(conn)
+	}
 	defer c.Close()
 	
 	// Send EHLO
 	if err := c.Hello(hostname); err != nil {
-		return fmt.Errorf("EHLO failed: %w", err)
+		return false, fmt.Errorf("EHLO failed: %w", err)
+	}
+	
+	// Authenticate if credentials are configured
+	if f.nextHop.Username != "" {
+		if err := c.Auth(sasl.NewPlainClient("", f.nextHop.Username, f.nextHop.Password)); err != nil {
+			return false, fmt.Errorf("AUTH failed: %w", err)
+		}
 	}
 	
 	// Set the sender
 	if err := c.Mail(sender, nil); err != nil {
-		return fmt.Errorf("MAIL FROM failed: %w", err)
+		return false, fmt.Errorf("MAIL FROM failed: %w", err)
 	}
 	
 	// Set the recipients
@@ -162,23 +361,25 @@ func (f *PostfixFilter) sendToPostfix(sender string, recipients []string, emailD
 	}
 	
 	if !recipientOK {
-		return fmt.Errorf("all recipients were rejected")
+		return false, errAllRecipientsRejected
 	}
 	
 	// Send the email data
 	wc, err := c.Data()
 	if err != nil {
-		return fmt.Errorf("DATA command failed: %w", err)
+		return false, fmt.Errorf("DATA command failed: %w", err)
 	}
 	
+	// On a write error, drop the connection rather than closing the data
+	// writer, which would terminate and commit a partial message
 	_, err = wc.Write(emailData)
 	if err != nil {
-		wc.Close()
-		return fmt.Errorf("failed to send email data: %w", err)
+		return false, fmt.Errorf("failed to send email data: %w", err)
 	}
 	
+	// The next hop may have queued the message even if the final reply is lost
 	if err := wc.Close(); err != nil {
-		return fmt.Errorf("failed to close data writer: %w", err)
+		return true, fmt.Errorf("failed to close data writer: %w", err)
 	}
 	
 	// Quit the connection
@@ -187,7 +388,50 @@ func (f *PostfixFilter) sendToPostfix(sender string, recipients []string, emailD
 		// Not returning an error here as the email has already been sent
 	}
 	
-	return nil
+	return true, nil
+}
+
+// isTrustedClient returns whether a client IP is within a trusted network
+func (f *PostfixFilter) isTrustedClient(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range f.trustedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTrustedNetworks parses a list of CIDRs, or bare IP addresses, into
+// networks whose clients bypass analysis
+func ParseTrustedNetworks(cidrs []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted network: %s", cidr)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted network %s: %w", cidr, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
 }
 
 // smtpBackend implements the go-smtp Backend interface
@@ -197,10 +441,14 @@ type smtpBackend struct {
 
 // NewSession creates a new SMTP session
 func (b *smtpBackend) NewSession(c *smtp.Conn) (smtp.Session, error) {
-	return &smtpSession{
+	session := &smtpSession{
 		filter:     b.filter,
 		recipients: make([]string, 0),
-	}, nil
+	}
+	if addr, ok := c.Conn().RemoteAddr().(*net.TCPAddr); ok {
+		session.clientIP = addr.IP
+	}
+	return session, nil
 }
 
 // smtpSession implements the go-smtp Session interface
@@ -209,6 +457,8 @@ type smtpSession struct {
 	sender     string
 	recipients []string
 	data       []byte
+	authenticated bool
+	clientIP   net.IP
 }
 
 // Reset resets the session state
@@ -218,13 +468,38 @@ func (s *smtpSession) Reset() {
 	s.data = nil
 }
 
-// AuthPlain handles PLAIN authentication (not needed for our filter)
-func (s *smtpSession) AuthPlain(_ []byte) error {
-	return smtp.ErrAuthUnsupported
+// AuthMechanisms returns the supported AUTH mechanisms, which are only
+// advertised when authentication is required
+func (s *smtpSession) AuthMechanisms() []string {
+	if s.filter.auth == nil {
+		return nil
+	}
+	return []string{sasl.Plain}
+}
+
+// Auth handles PLAIN authentication against the configured credentials
+func (s *smtpSession) Auth(mech string) (sasl.Server, error) {
+	if s.filter.auth == nil || mech != sasl.Plain {
+		return nil, smtp.ErrAuthUnknownMechanism
+	}
+	return sasl.NewPlainServer(func(identity, username, password string) error {
+		if identity != "" && identity != username {
+			return smtp.ErrAuthFailed
+		}
+		if err := s.filter.auth.Authenticate(username, password); err != nil {
+			s.filter.logger.Warn("SMTP authentication failed", zap.String("username", username))
+			return smtp.ErrAuthFailed
+		}
+		s.authenticated = true
+		return nil
+	}), nil
 }
 
 // Mail sets the sender address
 func (s *smtpSession) Mail(from string, _ *smtp.MailOptions) error {
+	if s.filter.auth != nil && !s.authenticated {
+		return smtp.ErrAuthRequired
+	}
 	s.sender = from
 	return nil
 }
@@ -237,13 +512,22 @@ func (s *smtpSession) Rcpt(to string, _ *smtp.RcptOptions) error {
 
 // Data handles the email data
 func (s *smtpSession) Data(r io.Reader) error {
+	// Every message gets an ID to follow it across the logs, the LLM
+	// analysis and the emitted headers
+	processingID := uuid.NewString()
+	logger := s.filter.logger.With(zap.String("processing_id", processingID))
+	
 	// Read the complete raw message data
 	rawData, err := io.ReadAll(r)
 	if err != nil {
-		s.filter.logger.Error("Failed to read message data", zap.Error(err))
+		logger.Error("Failed to read message data", zap.Error(err))
 		return err
 	}
 	
+	logger.Debug("Received email",
+		zap.String("from", s.sender),
+		zap.Int("size", len(rawData)))
+	
 	// Keep a copy of the raw data for later reconstruction
 	rawDataCopy := make([]byte, len(rawData))
 	copy(rawDataCopy, rawData)
@@ -251,23 +535,49 @@ func (s *smtpSession) Data(r io.Reader) error {
 	// Parse the email message
 	msg, err := mail.ReadMessage(bytes.NewReader(rawData))
 	if err != nil {
-		s.filter.logger.Error("Failed to parse email message", zap.Error(err))
+		logger.Error("Failed to parse email message", zap.Error(err))
 		return err
 	}
 	
-	// Extract the text content for analysis
-	textContent, err := extractTextFromMessage(msg)
+	// Messages over the size limit are passed through, or analyzed on
+	// their body text alone
+	oversized := s.filter.maxAnalyzeBytes > 0 && len(rawData) > s.filter.maxAnalyzeBytes
+	attachmentTextLimit, decodeQR := s.filter.attachmentTextLimit, s.filter.decodeQR
+	if oversized && s.filter.oversizeMode == OversizeText {
+		attachmentTextLimit, decodeQR = 0, false
+	}
+	
+	// Extract the text content and attachments for analysis
+	content, err := extractContentFromMessage(msg, attachmentTextLimit, s.filter.stripInlineImages, decodeQR, s.filter.extractionLimits, logger)
+	if errors.Is(err, ErrExtractionLimit) {
+		// Reject rather than fail temporarily, since a retry would only
+		// exceed the limits again
+		logger.Warn("Rejecting message exceeding content extraction limits", zap.Error(err))
+		return errTooComplex
+	}
 	if err != nil {
-		s.filter.logger.Error("Failed to extract text content", zap.Error(err))
+		logger.Error("Failed to extract text content", zap.Error(err))
 		return err
 	}
 	
 	// Create email object for analysis
 	email := &core.Email{
-		Headers: make(map[string][]string),
-		Body:    textContent,
-		From:    s.sender,
-		To:      s.recipients,
+		Headers:     make(map[string][]string),
+		Body:        content.Text,
+		From:        s.sender,
+		To:          s.recipients,
+		Attachments: content.Attachments,
+		AttachmentText: content.AttachmentText,
+		Embedded:    content.Embedded,
+	}
+	if content.LinkMismatches > 0 {
+		email.Signals = append(email.Signals, fmt.Sprintf("Link text/target mismatches: %d", content.LinkMismatches))
+	}
+	if content.PartFailures > 0 {
+		email.Signals = append(email.Signals, fmt.Sprintf("MIME parts that failed to read or decode: %d", content.PartFailures))
+	}
+	for _, link := range content.QRLinks {
+		email.Signals = append(email.Signals, fmt.Sprintf("QR code in image links to %s", link))
 	}
 	
 	// Convert headers
@@ -280,6 +590,13 @@ func (s *smtpSession) Data(r io.Reader) error {
 		}
 	}
 	
+	// Recipients come from the envelope, as the To header may be missing,
+	// an empty group such as "undisclosed-recipients:;", or omit Bcc
+	// recipients entirely
+	if len(email.To) > 0 && len(utils.ParseAddressList(msg.Header.Get("To"))) == 0 {
+		email.Signals = append(email.Signals, "To header lists no recipients (undisclosed or Bcc only)")
+	}
+	
 	// Extract sender domain for logging
 	senderDomain := "unknown"
 	if parts := strings.Split(email.From, "@"); len(parts) == 2 {
@@ -287,16 +604,53 @@ func (s *smtpSession) Data(r io.Reader) error {
 	}
 	
 	// Process the email
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(core.WithProcessingID(context.Background(), processingID), 10*time.Second)
 	defer cancel()
 	
 	// Analyze the email, but handle errors gracefully
 	var result *core.SpamAnalysisResult
 	var analysisErr error
 	
-	result, analysisErr = s.filter.service.AnalyzeEmail(ctx, email)
+	if s.filter.isTrustedClient(s.clientIP) {
+		// Mail relayed from our own infrastructure is not analyzed
+		logger.Info("Skipping analysis for trusted network",
+			zap.String("from", email.From),
+			zap.String("client_ip", s.clientIP.String()))
+		result = &core.SpamAnalysisResult{
+			IsSpam:      false,
+			Score:       0.0,
+			Confidence:  1.0,
+			Explanation: "Relayed from a trusted network",
+			AnalyzedAt:  time.Now(),
+			ModelUsed:   "trusted-network",
+			SkipReason:  "trusted network " + s.clientIP.String(),
+		}
+	} else if oversized && s.filter.oversizeMode == OversizeSkip {
+		// Large messages are expensive to analyze and rarely benefit from it
+		logger.Info("Skipping analysis for oversized message",
+			zap.String("from", email.From),
+			zap.Int("size", len(rawData)),
+			zap.Int("max_analyze_bytes", s.filter.maxAnalyzeBytes))
+		result = &core.SpamAnalysisResult{
+			IsSpam:      false,
+			Score:       0.0,
+			Confidence:  0.0,
+			Explanation: "Message too large to analyze",
+			AnalyzedAt:  time.Now(),
+			ModelUsed:   "oversize",
+			SkipReason:  fmt.Sprintf("too large (%d bytes)", len(rawData)),
+		}
+	} else {
+		if oversized {
+			logger.Info("Analyzing only the text of oversized message",
+				zap.String("from", email.From),
+				zap.Int("size", len(rawData)),
+				zap.Int("max_analyze_bytes", s.filter.maxAnalyzeBytes))
+		}
+		result, analysisErr = s.filter.service.AnalyzeEmail(ctx, email)
+	}
 	if analysisErr != nil {
-		s.filter.logger.Error("Failed to analyze email",
+		logger.Error("Failed to analyze email",
 			zap.Error(analysisErr),
 			zap.String("sender", email.From),
 			zap.String("sender_domain", senderDomain))
@@ -312,36 +666,60 @@ func (s *smtpSession) Data(r io.Reader) error {
 		}
 	}
 	
+	// The message ID replaces any provider ID, which is kept in the logs
+	providerID := result.ProcessingID
+	result.ProcessingID = processingID
+	
 	// Add headers to the email
 	isSpam := result.IsSpam
 	
 	// Determine action based on spam status
 	if isSpam && s.filter.blockSpam && analysisErr == nil {
-		// Only reject if it's spam AND there was no error in analysis
-		s.filter.logger.Info("Rejecting spam email",
-			zap.String("from", email.From),
-			zap.String("sender_domain", senderDomain),
-			zap.Float64("score", result.Score),
-			zap.String("reason", result.Explanation),
-			zap.String("model", result.ModelUsed))
-		return fmt.Errorf("550 Rejected as spam (score: %.2f)", result.Score)
+		if s.filter.service != nil && s.filter.service.Monitored(email) {
+			// Monitored senders and recipients are warned about, never rejected
+			logger.Info("Tagging spam instead of rejecting for monitored sender or recipient",
+				zap.String("from", email.From),
+				zap.Float64("score", result.Score))
+		} else if !s.filter.blockSchedule.Active(time.Now()) {
+			// Outside the block schedule, spam is only tagged
+			logger.Info("Tagging spam instead of rejecting outside the block schedule",
+				zap.String("from", email.From),
+				zap.Float64("score", result.Score))
+		} else if !s.confirmReject(ctx, email, result) {
+			// A verification pass that disagrees downgrades the reject to a tag
+			logger.Info("Tagging spam instead of rejecting after verification",
+				zap.String("from", email.From),
+				zap.Float64("score", result.Score))
+		} else {
+			// Only reject if it's spam AND there was no error in analysis
+			logger.Info("Rejecting spam email",
+				zap.String("from", email.From),
+				zap.String("sender_domain", senderDomain),
+				zap.Float64("score", result.Score),
+				zap.String("reason", result.Explanation),
+				zap.String("model", result.ModelUsed))
+			s.recordRejection(logger, email, result)
+			return fmt.Errorf("550 Rejected as spam (score: %.2f)", result.Score)
+		}
 	}
 	
 	// Prepare the modified email with spam headers
 	var modifiedEmail bytes.Buffer
 	
-	// Add our spam detection headers first
-	fmt.Fprintf(&modifiedEmail, "%s: %t\r\n", s.filter.spamHeader, isSpam)
-	fmt.Fprintf(&modifiedEmail, "%s: %.4f\r\n", s.filter.scoreHeader, result.Score)
-	fmt.Fprintf(&modifiedEmail, "%s: %s\r\n", s.filter.reasonHeader, result.Explanation)
+	// Add our spam detection headers first, unless analysis failed and
+	// the fallback verdict's headers are suppressed
+	if analysisErr == nil || s.filter.headersOnError == HeadersOnErrorAll {
+		s.writeVerdictHeaders(&modifiedEmail, result)
+	}
 	
 	// Add error header if there was an analysis error
-	if analysisErr != nil {
-		fmt.Fprintf(&modifiedEmail, "X-Spam-Analysis-Error: %s\r\n", analysisErr.Error())
+	if analysisErr != nil && s.filter.headersOnError != HeadersOnErrorNone {
+		s.filter.writeHeader(&modifiedEmail, "X-Spam-Analysis-Error", analysisErr.Error())
 	}
 	
-	// Modify the subject if it's spam and subject modification is enabled
-	if isSpam && s.filter.modifySubject && s.filter.subjectPrefix != "" {
+	// Modify the subject if it's spam scoring at least the prefix minimum
+	// and subject modification is enabled
+	if isSpam && s.filter.modifySubject && s.filter.subjectPrefix != "" && result.Score >= s.filter.subjectPrefixMinScore {
 		// Get the original subject
 		originalSubject := msg.Header.Get("Subject")
 		
@@ -357,7 +735,7 @@ func (s *smtpSession) Data(r io.Reader) error {
 			newSubject := s.filter.subjectPrefix + decodedSubject
 			
 			// Write the modified subject header
-			fmt.Fprintf(&modifiedEmail, "Subject: %s\r\n", newSubject)
+			s.filter.writeHeader(&modifiedEmail, "Subject", newSubject)
 			
 			// Skip the original subject when writing other headers
 			for key, values := range msg.Header {
@@ -395,7 +773,7 @@ func (s *smtpSession) Data(r io.Reader) error {
 			// Fallback: if we can't find the body separator, just use the original message body
 			bodyBytes, err := io.ReadAll(msg.Body)
 			if err != nil {
-				s.filter.logger.Error("Failed to read message body", zap.Error(err))
+				logger.Error("Failed to read message body", zap.Error(err))
 				return err
 			}
 			modifiedEmail.Write(bodyBytes)
@@ -409,9 +787,9 @@ func (s *smtpSession) Data(r io.Reader) error {
 	}
 	
 	if s.filter.postfixEnabled {
-		// Send the email back to Postfix on the configured port
-		if err := s.filter.sendToPostfix(s.sender, s.recipients, modifiedEmail.Bytes()); err != nil {
-			s.filter.logger.Error("Failed to send email back to Postfix",
+		// Send the email on to the next hop, normally back to Postfix
+		if err := s.filter.sendToNextHop(s.sender, s.recipients, modifiedEmail.Bytes()); err != nil {
+			logger.Error("Failed to send email to next hop",
 				zap.Error(err),
 				zap.String("sender", email.From))
 			return err
@@ -419,19 +797,63 @@ func (s *smtpSession) Data(r io.Reader) error {
 	} else {
 		// This should never happen in practice as we always want to send back to Postfix
 		// But we keep it for completeness
-		s.filter.logger.Warn("Postfix forwarding disabled, this is likely a misconfiguration")
+		logger.Warn("Postfix forwarding disabled, this is likely a misconfiguration")
 	}
 	
-	s.filter.logger.Info("Processed email",
+	logger.Info("Processed email",
 		zap.String("from", email.From),
 		zap.String("sender_domain", senderDomain),
 		zap.Bool("is_spam", isSpam),
 		zap.Float64("score", result.Score),
-		zap.String("model", result.ModelUsed))
+		zap.String("model", result.ModelUsed),
+		zap.String("provider_id", providerID))
 	
 	return nil
 }
 
+// confirmReject asks the service to verify a spam verdict before it is
+// rejected. The verification gets its own deadline, as the first analysis
+// may have used up most of the message's.
+func (s *smtpSession) confirmReject(ctx context.Context, email *core.Email, result *core.SpamAnalysisResult) bool {
+	if s.filter.service == nil {
+		return true
+	}
+	verifyCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+	return s.filter.service.ConfirmReject(verifyCtx, email, result)
+}
+
+// recordRejection adds a rejected message to the digest if enabled. Failures
+// are only logged, since the message is rejected either way.
+func (s *smtpSession) recordRejection(logger *zap.Logger, email *core.Email, result *core.SpamAnalysisResult) {
+	if s.filter.digestStore == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := s.filter.digestStore.Record(ctx, core.DigestEntry{
+		Sender:      email.From,
+		Subject:     email.Subject,
+		Score:       result.Score,
+		Reason:      result.Explanation,
+		RejectedAt:  time.Now(),
+		ContentHash: contentHash(email),
+	})
+	if err != nil {
+		logger.Error("Failed to record rejected spam in the digest",
+			zap.Error(err),
+			zap.String("from", email.From))
+	}
+}
+
+// contentHash identifies the content of an email by its subject and body,
+// which a spam campaign repeats across senders
+func contentHash(email *core.Email) string {
+	sum := sha256.Sum256([]byte(email.Subject + "\n" + email.Body))
+	return hex.EncodeToString(sum[:])
+}
+
 // Logout handles SMTP logout (not needed for our filter)
 func (s *smtpSession) Logout() error {
 	return nil
@@ -0,0 +1,730 @@
+package filter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/mail"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-smtp"
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// deliveredMessage is a message received by fakeMTA
+type deliveredMessage struct {
+	hostname   string
+	from       string
+	recipients []string
+	data       []byte
+	tls        bool
+}
+
+// fakeMTA is a next hop SMTP server recording the messages it receives
+type fakeMTA struct {
+	mu       sync.Mutex
+	server   *smtp.Server
+	listener net.Listener
+	messages []deliveredMessage
+}
+
+// newFakeMTA starts a next hop on a local port, stopped with the test
+func newFakeMTA(t *testing.T) *fakeMTA {
+	return newFlakyMTA(t, 0)
+}
+
+// newFlakyMTA starts a next hop that drops its first drops connections
+// before greeting them
+func newFlakyMTA(t *testing.T, drops int) *fakeMTA {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	if drops > 0 {
+		listener = &droppingListener{Listener: listener, drops: drops}
+	}
+	mta := &fakeMTA{listener: listener}
+	mta.server = smtp.NewServer(mta)
+	mta.server.Domain = "next-hop.test"
+	mta.server.AllowInsecureAuth = true
+	go mta.server.Serve(listener)
+	t.Cleanup(func() { mta.server.Close() })
+	return mta
+}
+
+// addr returns the host:port the next hop listens on
+func (m *fakeMTA) addr() string {
+	return m.listener.Addr().String()
+}
+
+// delivered returns the messages received so far
+func (m *fakeMTA) delivered() []deliveredMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]deliveredMessage(nil), m.messages...)
+}
+
+// droppingListener closes its first drops connections as soon as they are
+// accepted
+type droppingListener struct {
+	net.Listener
+	mu    sync.Mutex
+	drops int
+}
+
+func (l *droppingListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		l.mu.Lock()
+		drop := l.drops > 0
+		if drop {
+			l.drops--
+		}
+		l.mu.Unlock()
+		if !drop {
+			return conn, nil
+		}
+		conn.Close()
+	}
+}
+
+func (m *fakeMTA) NewSession(c *smtp.Conn) (smtp.Session, error) {
+	return &fakeMTASession{mta: m, conn: c}, nil
+}
+
+// fakeMTASession is a session with fakeMTA
+type fakeMTASession struct {
+	mta     *fakeMTA
+	conn    *smtp.Conn
+	message deliveredMessage
+}
+
+func (s *fakeMTASession) Mail(from string, _ *smtp.MailOptions) error {
+	_, isTLS := s.conn.TLSConnectionState()
+	s.message = deliveredMessage{hostname: s.conn.Hostname(), from: from, tls: isTLS}
+	return nil
+}
+
+func (s *fakeMTASession) Rcpt(to string, _ *smtp.RcptOptions) error {
+	s.message.recipients = append(s.message.recipients, to)
+	return nil
+}
+
+func (s *fakeMTASession) Data(r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.message.data = data
+	s.mta.mu.Lock()
+	defer s.mta.mu.Unlock()
+	s.mta.messages = append(s.mta.messages, s.message)
+	return nil
+}
+
+func (s *fakeMTASession) Reset()        {}
+func (s *fakeMTASession) Logout() error { return nil }
+
+// newDeliveringFilter creates a filter delivering to nextHop, without a
+// service or a listener of its own
+func newDeliveringFilter(nextHop *NextHop, heloHostname string) *PostfixFilter {
+	return &PostfixFilter{
+		logger:       zap.NewNop(),
+		nextHop:      nextHop,
+		heloHostname: heloHostname,
+	}
+}
+
+// recordingLLM is an LLMClient returning a fixed result or error and
+// recording the emails it analyzes
+type recordingLLM struct {
+	mu     sync.Mutex
+	result core.SpamAnalysisResult
+	err    error
+	emails []*core.Email
+}
+
+func (c *recordingLLM) AnalyzeEmail(ctx context.Context, email *core.Email) (*core.SpamAnalysisResult, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.emails = append(c.emails, email)
+	if c.err != nil {
+		return nil, c.err
+	}
+	result := c.result
+	return &result, nil
+}
+
+// analyzed returns the emails analyzed so far
+func (c *recordingLLM) analyzed() []*core.Email {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*core.Email(nil), c.emails...)
+}
+
+// newAnalyzingFilter creates a filter analyzing mail with llm against a 0.7
+// threshold, without caching, and delivering it to a fake next hop
+func newAnalyzingFilter(t *testing.T, llm core.LLMClient, opts core.ServiceOptions) (*PostfixFilter, *fakeMTA) {
+	t.Helper()
+	mta := newFakeMTA(t)
+	logger := zap.NewNop()
+	service := core.NewSpamFilterService(llm, nil, logger, false, time.Hour, 0.7, nil, nil, nil, opts)
+	return &PostfixFilter{
+		service:        service,
+		logger:         logger,
+		spamHeader:     "X-Spam-Status",
+		scoreHeader:    "X-Spam-Score",
+		reasonHeader:   "X-Spam-Reason",
+		skippedHeader:  "X-Spam-Skipped",
+		nextHop:        &NextHop{Address: mta.addr()},
+		postfixEnabled: true,
+		spamThreshold:  0.7,
+	}, mta
+}
+
+// receive passes a message from sender to recipients through the filter as
+// an SMTP session would
+func receive(f *PostfixFilter, sender string, recipients []string, message string) error {
+	session := &smtpSession{filter: f, sender: sender, recipients: recipients}
+	return session.Data(strings.NewReader(message))
+}
+
+const testMessage = "From: sender@example.com\r\nTo: user@example.org\r\nSubject: Hello\r\n\r\nJust checking in.\r\n"
+
+func TestDeliveryUsesConfiguredHELOHostname(t *testing.T) {
+	mta := newFakeMTA(t)
+	f := newDeliveringFilter(&NextHop{Address: mta.addr()}, "filter.example.net")
+
+	if err := f.sendToNextHop("sender@example.com", []string{"user@example.org"}, []byte(testMessage)); err != nil {
+		t.Fatalf("sendToNextHop() error = %v", err)
+	}
+
+	delivered := mta.delivered()
+	if len(delivered) != 1 {
+		t.Fatalf("next hop received %d messages, want 1", len(delivered))
+	}
+	if delivered[0].hostname != "filter.example.net" {
+		t.Errorf("EHLO hostname = %q, want filter.example.net", delivered[0].hostname)
+	}
+}
+
+// startFilter starts f listening on a free local port, stopped with the
+// test, and returns its address
+func startFilter(t *testing.T, f *PostfixFilter) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to find a free port: %v", err)
+	}
+	f.listenAddr = listener.Addr().String()
+	listener.Close()
+
+	if err := f.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	t.Cleanup(func() { f.Stop() })
+
+	for i := 0; ; i++ {
+		conn, err := net.Dial("tcp", f.listenAddr)
+		if err == nil {
+			conn.Close()
+			return f.listenAddr
+		}
+		if i == 100 {
+			t.Fatalf("filter did not start listening: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDeliveryRetriesTransientFailures(t *testing.T) {
+	mta := newFlakyMTA(t, 2)
+	f := newDeliveringFilter(&NextHop{Address: mta.addr()}, "filter.example.net")
+	f.postfixRetries = 2
+	f.postfixRetryDelay = time.Millisecond
+
+	if err := f.sendToNextHop("sender@example.com", []string{"user@example.org"}, []byte(testMessage)); err != nil {
+		t.Fatalf("sendToNextHop() error = %v", err)
+	}
+	if delivered := mta.delivered(); len(delivered) != 1 || string(delivered[0].data) != testMessage {
+		t.Errorf("next hop received %d messages, want the message once", len(delivered))
+	}
+}
+
+func TestDeliveryGivesUpAfterRetries(t *testing.T) {
+	mta := newFlakyMTA(t, 3)
+	f := newDeliveringFilter(&NextHop{Address: mta.addr()}, "filter.example.net")
+	f.postfixRetries = 2
+	f.postfixRetryDelay = time.Millisecond
+
+	if err := f.sendToNextHop("sender@example.com", []string{"user@example.org"}, []byte(testMessage)); err == nil {
+		t.Error("sendToNextHop() succeeded, want the third failure reported")
+	}
+	if delivered := mta.delivered(); len(delivered) != 0 {
+		t.Errorf("next hop received %d messages, want none", len(delivered))
+	}
+}
+
+func TestIsTransientSMTPError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		transient bool
+	}{
+		{"connection refused", errors.New("dial tcp: connection refused"), true},
+		{"temporary reply", &smtp.SMTPError{Code: 451, Message: "try again later"}, true},
+		{"permanent reply", fmt.Errorf("MAIL FROM failed: %w", &smtp.SMTPError{Code: 550, Message: "no"}), false},
+		{"all recipients rejected", errAllRecipientsRejected, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTransientSMTPError(tt.err); got != tt.transient {
+				t.Errorf("isTransientSMTPError() = %t, want %t", got, tt.transient)
+			}
+		})
+	}
+}
+
+func TestTrustedNetworks(t *testing.T) {
+	networks, err := ParseTrustedNetworks([]string{"10.0.0.0/8", " 192.0.2.25 ", "2001:db8::/32", ""})
+	if err != nil {
+		t.Fatalf("ParseTrustedNetworks() error = %v", err)
+	}
+	f := &PostfixFilter{trustedNetworks: networks}
+
+	tests := []struct {
+		ip      string
+		trusted bool
+	}{
+		{"10.1.2.3", true},
+		{"192.0.2.25", true},
+		{"192.0.2.26", false},
+		{"2001:db8::1", true},
+		{"203.0.113.5", false},
+	}
+	for _, tt := range tests {
+		if got := f.isTrustedClient(net.ParseIP(tt.ip)); got != tt.trusted {
+			t.Errorf("isTrustedClient(%s) = %t, want %t", tt.ip, got, tt.trusted)
+		}
+	}
+	if f.isTrustedClient(nil) {
+		t.Error("client without an address is trusted")
+	}
+
+	if _, err := ParseTrustedNetworks([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("ParseTrustedNetworks() accepted an invalid CIDR")
+	}
+	if _, err := ParseTrustedNetworks([]string{"relay.example.net"}); err == nil {
+		t.Error("ParseTrustedNetworks() accepted a host name")
+	}
+}
+
+func TestTrustedClientsSkipAnalysis(t *testing.T) {
+	tests := []struct {
+		ip       string
+		analyzed bool
+	}{
+		{"10.1.2.3", false},
+		{"203.0.113.5", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			llm := &recordingLLM{result: core.SpamAnalysisResult{IsSpam: true, Score: 0.9}}
+			f, mta := newAnalyzingFilter(t, llm, core.ServiceOptions{})
+			f.trustedNetworks, _ = ParseTrustedNetworks([]string{"10.0.0.0/8"})
+
+			session := &smtpSession{filter: f, sender: "sender@example.com", recipients: []string{"user@example.org"}, clientIP: net.ParseIP(tt.ip)}
+			if err := session.Data(strings.NewReader(testMessage)); err != nil {
+				t.Fatalf("Data() error = %v", err)
+			}
+
+			if analyzed := len(llm.analyzed()) == 1; analyzed != tt.analyzed {
+				t.Errorf("analyzed = %t, want %t", analyzed, tt.analyzed)
+			}
+			delivered := mta.delivered()
+			if len(delivered) != 1 {
+				t.Fatalf("next hop received %d messages, want 1", len(delivered))
+			}
+			if skipped := strings.Contains(string(delivered[0].data), "X-Spam-Skipped: trusted network 10.1.2.3"); skipped == tt.analyzed {
+				t.Errorf("skipped header present = %t, want %t", skipped, !tt.analyzed)
+			}
+		})
+	}
+}
+
+func TestEnvelopeRecipientsReplaceUndisclosedTo(t *testing.T) {
+	tests := []struct {
+		name   string
+		to     string
+		signal bool
+	}{
+		{"undisclosed recipients", "To: undisclosed-recipients:;\r\n", true},
+		{"missing To", "", true},
+		{"listed recipient", "To: user@example.org\r\n", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			llm := &recordingLLM{result: core.SpamAnalysisResult{Score: 0.2}}
+			f, _ := newAnalyzingFilter(t, llm, core.ServiceOptions{})
+
+			message := "From: sender@example.com\r\n" + tt.to + "Subject: Hello\r\n\r\nJust checking in.\r\n"
+			envelope := []string{"user@example.org", "hidden@example.org"}
+			if err := receive(f, "sender@example.com", envelope, message); err != nil {
+				t.Fatalf("Data() error = %v", err)
+			}
+
+			emails := llm.analyzed()
+			if len(emails) != 1 {
+				t.Fatalf("analyzed %d emails, want 1", len(emails))
+			}
+			if !reflect.DeepEqual(emails[0].To, envelope) {
+				t.Errorf("To = %q, want the envelope recipients %q", emails[0].To, envelope)
+			}
+			hasSignal := false
+			for _, signal := range emails[0].Signals {
+				hasSignal = hasSignal || strings.Contains(signal, "To header lists no recipients")
+			}
+			if hasSignal != tt.signal {
+				t.Errorf("Signals = %q, want undisclosed signal %t", emails[0].Signals, tt.signal)
+			}
+		})
+	}
+}
+
+// memoryDigest is a DigestStore keeping entries in memory
+type memoryDigest struct {
+	mu      sync.Mutex
+	entries []core.DigestEntry
+}
+
+func (d *memoryDigest) Record(ctx context.Context, entry core.DigestEntry) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.entries = append(d.entries, entry)
+	return nil
+}
+
+func (d *memoryDigest) List(ctx context.Context, since time.Time) ([]core.DigestEntry, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]core.DigestEntry(nil), d.entries...), nil
+}
+
+func (d *memoryDigest) Prune(ctx context.Context, before time.Time) error {
+	return nil
+}
+
+func TestRejectedSpamIsRecordedInDigest(t *testing.T) {
+	llm := &recordingLLM{result: core.SpamAnalysisResult{IsSpam: true, Score: 0.95, Explanation: "Prize scam"}}
+	f, mta := newAnalyzingFilter(t, llm, core.ServiceOptions{})
+	f.blockSpam = true
+	digest := &memoryDigest{}
+	f.digestStore = digest
+
+	message := "From: spammer@example.com\r\nTo: user@example.org\r\nSubject: You have won\r\n\r\nClaim your prize.\r\n"
+	if err := receive(f, "spammer@example.com", []string{"user@example.org"}, message); err == nil {
+		t.Fatal("Data() accepted spam, want a rejection")
+	}
+	if len(mta.delivered()) != 0 {
+		t.Error("rejected spam was delivered")
+	}
+
+	entries, _ := digest.List(context.Background(), time.Time{})
+	if len(entries) != 1 {
+		t.Fatalf("digest has %d entries, want 1", len(entries))
+	}
+	entry := entries[0]
+	if entry.Sender != "spammer@example.com" || entry.Subject != "You have won" || entry.Reason != "Prize scam" || entry.ContentHash == "" {
+		t.Errorf("entry = %+v, want the rejected message", entry)
+	}
+	if out := core.FormatDigest(entries, time.Now().Add(-time.Hour)); !strings.Contains(out, "Subject: You have won") {
+		t.Errorf("digest = %q, want the rejected message", out)
+	}
+}
+
+func TestTaggedSpamIsNotRecordedInDigest(t *testing.T) {
+	llm := &recordingLLM{result: core.SpamAnalysisResult{IsSpam: true, Score: 0.95}}
+	f, _ := newAnalyzingFilter(t, llm, core.ServiceOptions{})
+	digest := &memoryDigest{}
+	f.digestStore = digest
+
+	if err := receive(f, "spammer@example.com", []string{"user@example.org"}, testMessage); err != nil {
+		t.Fatalf("Data() error = %v", err)
+	}
+	if entries, _ := digest.List(context.Background(), time.Time{}); len(entries) != 0 {
+		t.Errorf("digest = %+v, want no entries for tagged spam", entries)
+	}
+}
+
+func TestOversizedMessagesSkipAnalysis(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxBytes int
+		analyzed bool
+	}{
+		{"above the threshold", len(testMessage) - 1, false},
+		{"at the threshold", len(testMessage), true},
+		{"no threshold", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			llm := &recordingLLM{result: core.SpamAnalysisResult{IsSpam: true, Score: 0.9}}
+			f, mta := newAnalyzingFilter(t, llm, core.ServiceOptions{})
+			f.maxAnalyzeBytes = tt.maxBytes
+			f.oversizeMode = OversizeSkip
+
+			if err := receive(f, "sender@example.com", []string{"user@example.org"}, testMessage); err != nil {
+				t.Fatalf("Data() error = %v", err)
+			}
+
+			if analyzed := len(llm.analyzed()) == 1; analyzed != tt.analyzed {
+				t.Errorf("analyzed = %t, want %t", analyzed, tt.analyzed)
+			}
+			delivered := mta.delivered()
+			if len(delivered) != 1 {
+				t.Fatalf("next hop received %d messages, want 1", len(delivered))
+			}
+			header := fmt.Sprintf("X-Spam-Skipped: too large (%d bytes)", len(testMessage))
+			if skipped := strings.Contains(string(delivered[0].data), header); skipped == tt.analyzed {
+				t.Errorf("skipped header present = %t, want %t", skipped, !tt.analyzed)
+			}
+		})
+	}
+}
+
+func TestOversizedMessagesAnalyzeTextOnly(t *testing.T) {
+	tests := []struct {
+		name           string
+		maxBytes       int
+		attachmentText bool
+	}{
+		{"above the threshold", len(attachmentMessage) - 1, false},
+		{"below the threshold", len(attachmentMessage) + 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			llm := &recordingLLM{result: core.SpamAnalysisResult{Score: 0.1}}
+			f, _ := newAnalyzingFilter(t, llm, core.ServiceOptions{})
+			f.maxAnalyzeBytes = tt.maxBytes
+			f.oversizeMode = OversizeText
+			f.attachmentTextLimit = 4096
+
+			if err := receive(f, "sender@example.com", []string{"user@example.org"}, attachmentMessage); err != nil {
+				t.Fatalf("Data() error = %v", err)
+			}
+
+			analyzed := llm.analyzed()
+			if len(analyzed) != 1 {
+				t.Fatalf("analyzed %d emails, want the message analyzed", len(analyzed))
+			}
+			if !strings.Contains(analyzed[0].Body, "See the attached instructions.") {
+				t.Errorf("Body = %q, want the body text", analyzed[0].Body)
+			}
+			if got := analyzed[0].AttachmentText != ""; got != tt.attachmentText {
+				t.Errorf("AttachmentText = %q, want attachment text %t", analyzed[0].AttachmentText, tt.attachmentText)
+			}
+		})
+	}
+}
+
+// loggingLLM is a recordingLLM that logs each analysis with the processing
+// ID of its context, as the provider clients do
+type loggingLLM struct {
+	recordingLLM
+	logger *zap.Logger
+}
+
+func (c *loggingLLM) AnalyzeEmail(ctx context.Context, email *core.Email) (*core.SpamAnalysisResult, error) {
+	core.ContextLogger(ctx, c.logger).Info("Analyzing email with LLM")
+	return c.recordingLLM.AnalyzeEmail(ctx, email)
+}
+
+func TestProcessingIDFollowsMessage(t *testing.T) {
+	observed, logs := observer.New(zapcore.DebugLevel)
+	logger := zap.New(observed)
+	llm := &loggingLLM{recordingLLM: recordingLLM{result: core.SpamAnalysisResult{Score: 0.2}}, logger: logger}
+	f, mta := newAnalyzingFilter(t, llm, core.ServiceOptions{})
+	f.logger = logger
+	f.service = core.NewSpamFilterService(llm, nil, logger, false, time.Hour, 0.7, nil, nil, nil, core.ServiceOptions{})
+	f.idHeader = "X-Spam-ID"
+
+	if err := receive(f, "sender@example.com", []string{"user@example.org"}, testMessage); err != nil {
+		t.Fatalf("Data() error = %v", err)
+	}
+
+	ids := make(map[string]string)
+	for _, message := range []string{"Received email", "Analyzing email with LLM", "Processed email"} {
+		entries := logs.FilterMessage(message).All()
+		if len(entries) != 1 {
+			t.Fatalf("got %d %q logs, want 1", len(entries), message)
+		}
+		id, _ := entries[0].ContextMap()["processing_id"].(string)
+		if id == "" {
+			t.Errorf("%q log has no processing ID", message)
+		}
+		ids[message] = id
+	}
+
+	delivered := mta.delivered()
+	if len(delivered) != 1 {
+		t.Fatalf("next hop received %d messages, want 1", len(delivered))
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(delivered[0].data))
+	if err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+	header := msg.Header.Get("X-Spam-ID")
+	for message, id := range ids {
+		if id != header {
+			t.Errorf("%q log has processing ID %q, want the X-Spam-ID header %q", message, id, header)
+		}
+	}
+}
+
+// pgpMessage is a PGP/MIME encrypted message
+const pgpMessage = "From: sender@example.com\r\nTo: user@example.org\r\nSubject: Private\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/encrypted; protocol=\"application/pgp-encrypted\"; boundary=x\r\n\r\n" +
+	"--x\r\nContent-Type: application/pgp-encrypted\r\n\r\nVersion: 1\r\n" +
+	"--x\r\nContent-Type: application/octet-stream; name=\"encrypted.asc\"\r\n\r\n" +
+	"-----BEGIN PGP MESSAGE-----\r\n\r\nhQEMA8Xk2mBr7GJzAQf/Z3kq\r\n=Qx5T\r\n-----END PGP MESSAGE-----\r\n" +
+	"--x--\r\n"
+
+func TestPGPEncryptedMessageIsSkipped(t *testing.T) {
+	llm := &recordingLLM{result: core.SpamAnalysisResult{IsSpam: true, Score: 0.9}}
+	f, mta := newAnalyzingFilter(t, llm, core.ServiceOptions{SkipEncrypted: true})
+
+	if err := receive(f, "sender@example.com", []string{"user@example.org"}, pgpMessage); err != nil {
+		t.Fatalf("Data() error = %v", err)
+	}
+
+	if analyzed := llm.analyzed(); len(analyzed) != 0 {
+		t.Errorf("analyzed %d emails, want the encrypted message skipped", len(analyzed))
+	}
+	delivered := mta.delivered()
+	if len(delivered) != 1 {
+		t.Fatalf("next hop received %d messages, want 1", len(delivered))
+	}
+	if !strings.Contains(string(delivered[0].data), "X-Spam-Skipped: encrypted (PGP)") {
+		t.Errorf("delivered message has no skipped header:\n%s", delivered[0].data)
+	}
+}
+
+func TestSubjectPrefixMinScore(t *testing.T) {
+	tests := []struct {
+		name    string
+		score   float64
+		subject string
+	}{
+		{"borderline spam", 0.75, "Subject: Hello"},
+		{"high-confidence spam", 0.95, "Subject: [SPAM] Hello"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			llm := &recordingLLM{result: core.SpamAnalysisResult{IsSpam: true, Score: tt.score}}
+			f, mta := newAnalyzingFilter(t, llm, core.ServiceOptions{})
+			f.modifySubject = true
+			f.subjectPrefix = "[SPAM] "
+			f.subjectPrefixMinScore = 0.9
+
+			if err := receive(f, "sender@example.com", []string{"user@example.org"}, testMessage); err != nil {
+				t.Fatalf("Data() error = %v", err)
+			}
+			delivered := mta.delivered()
+			if len(delivered) != 1 {
+				t.Fatalf("next hop received %d messages, want 1", len(delivered))
+			}
+			if !strings.Contains(string(delivered[0].data), tt.subject+"\r\n") {
+				t.Errorf("delivered message:\n%s\nwant %q", delivered[0].data, tt.subject)
+			}
+		})
+	}
+}
+
+func TestMonitoredSpamIsTaggedNotRejected(t *testing.T) {
+	tests := []struct {
+		name     string
+		sender   string
+		rejected bool
+	}{
+		{"monitored sender", "alerts@partner.example", false},
+		{"monitored subdomain", "alerts@mail.partner.example", false},
+		{"other sender", "spammer@example.com", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			llm := &recordingLLM{result: core.SpamAnalysisResult{IsSpam: true, Score: 0.95}}
+			f, mta := newAnalyzingFilter(t, llm, core.ServiceOptions{MonitorSenders: []string{"partner.example"}})
+			f.blockSpam = true
+
+			err := receive(f, tt.sender, []string{"user@example.org"}, testMessage)
+			if rejected := err != nil; rejected != tt.rejected {
+				t.Fatalf("Data() error = %v, want rejected %t", err, tt.rejected)
+			}
+			if tt.rejected {
+				return
+			}
+			delivered := mta.delivered()
+			if len(delivered) != 1 || !strings.Contains(string(delivered[0].data), "X-Spam-Status: true\r\n") {
+				t.Errorf("next hop received %d messages, want the spam delivered tagged", len(delivered))
+			}
+		})
+	}
+}
+
+func TestHeadersOnErrorModes(t *testing.T) {
+	tests := []struct {
+		mode    string
+		verdict bool
+		error   bool
+	}{
+		{HeadersOnErrorAll, true, true},
+		{HeadersOnErrorOnly, false, true},
+		{HeadersOnErrorNone, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			llm := &recordingLLM{err: errors.New("provider unavailable")}
+			f, mta := newAnalyzingFilter(t, llm, core.ServiceOptions{})
+			f.headersOnError = tt.mode
+
+			if err := receive(f, "sender@example.com", []string{"user@example.org"}, testMessage); err != nil {
+				t.Fatalf("Data() error = %v", err)
+			}
+			delivered := mta.delivered()
+			if len(delivered) != 1 {
+				t.Fatalf("next hop received %d messages, want 1", len(delivered))
+			}
+			msg, err := mail.ReadMessage(bytes.NewReader(delivered[0].data))
+			if err != nil {
+				t.Fatalf("failed to parse delivered message: %v", err)
+			}
+
+			for _, header := range []string{"X-Spam-Status", "X-Spam-Score", "X-Spam-Reason"} {
+				if _, ok := msg.Header[header]; ok != tt.verdict {
+					t.Errorf("%s present = %t, want %t", header, ok, tt.verdict)
+				}
+			}
+			if _, ok := msg.Header["X-Spam-Analysis-Error"]; ok != tt.error {
+				t.Errorf("X-Spam-Analysis-Error present = %t, want %t", ok, tt.error)
+			}
+			if msg.Header.Get("Subject") != "Hello" {
+				t.Errorf("Subject = %q, want the original message kept", msg.Header.Get("Subject"))
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package filter
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrInvalidCredentials is returned when SMTP AUTH credentials are rejected
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// SMTPAuth validates SMTP AUTH credentials against a static user and
+// password, and/or an htpasswd file of bcrypt hashes
+type SMTPAuth struct {
+	username string
+	password string
+	hashes   map[string][]byte
+}
+
+// NewSMTPAuth creates a new SMTP AUTH validator. At least one of a static
+// username or an htpasswd file must be provided.
+func NewSMTPAuth(username, password, htpasswdPath string) (*SMTPAuth, error) {
+	auth := &SMTPAuth{
+		username: username,
+		password: password,
+		hashes:   make(map[string][]byte),
+	}
+
+	if htpasswdPath != "" {
+		if err := auth.loadHtpasswd(htpasswdPath); err != nil {
+			return nil, err
+		}
+	}
+
+	if auth.username == "" && len(auth.hashes) == 0 {
+		return nil, fmt.Errorf("SMTP AUTH requires a username or an htpasswd file with at least one user")
+	}
+
+	return auth, nil
+}
+
+// loadHtpasswd reads user:hash lines from an htpasswd file. Only bcrypt
+// hashes (htpasswd -B) are supported.
+func (a *SMTPAuth) loadHtpasswd(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open htpasswd file: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok || user == "" {
+			return fmt.Errorf("invalid htpasswd entry on line %d", lineNum)
+		}
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return fmt.Errorf("unsupported hash for user %q on line %d, only bcrypt is supported", user, lineNum)
+		}
+		a.hashes[user] = []byte(hash)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read htpasswd file: %w", err)
+	}
+
+	return nil
+}
+
+// Authenticate checks a username and password
+func (a *SMTPAuth) Authenticate(username, password string) error {
+	if a.username != "" &&
+		subtle.ConstantTimeCompare([]byte(username), []byte(a.username)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(password), []byte(a.password)) == 1 {
+		return nil
+	}
+
+	if hash, ok := a.hashes[username]; ok {
+		if bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil {
+			return nil
+		}
+	}
+
+	return ErrInvalidCredentials
+}
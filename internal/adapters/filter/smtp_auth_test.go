@@ -0,0 +1,110 @@
+package filter
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/emersion/go-sasl"
+	"github.com/emersion/go-smtp"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newAuthFilter creates a filter requiring AUTH as user "filter" with
+// password "secret"
+func newAuthFilter(t *testing.T) *PostfixFilter {
+	t.Helper()
+	auth, err := NewSMTPAuth("filter", "secret", "")
+	if err != nil {
+		t.Fatalf("NewSMTPAuth() error = %v", err)
+	}
+	return &PostfixFilter{logger: zap.NewNop(), auth: auth}
+}
+
+// dialFilter connects to a filter and says EHLO
+func dialFilter(t *testing.T, addr string) *smtp.Client {
+	t.Helper()
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	if err := c.Hello("client.example.com"); err != nil {
+		t.Fatalf("Hello() error = %v", err)
+	}
+	return c
+}
+
+func TestSMTPAuthAcceptsValidCredentials(t *testing.T) {
+	c := dialFilter(t, startFilter(t, newAuthFilter(t)))
+
+	if err := c.Auth(sasl.NewPlainClient("", "filter", "secret")); err != nil {
+		t.Fatalf("Auth() error = %v", err)
+	}
+	if err := c.Mail("sender@example.com", nil); err != nil {
+		t.Errorf("Mail() after AUTH error = %v", err)
+	}
+}
+
+func TestSMTPAuthRejectsInvalidCredentials(t *testing.T) {
+	c := dialFilter(t, startFilter(t, newAuthFilter(t)))
+
+	var smtpErr *smtp.SMTPError
+	if err := c.Auth(sasl.NewPlainClient("", "filter", "wrong")); !errors.As(err, &smtpErr) || smtpErr.Code != 535 {
+		t.Errorf("Auth() error = %v, want 535", err)
+	}
+}
+
+func TestSMTPAuthRequiredBeforeMail(t *testing.T) {
+	c := dialFilter(t, startFilter(t, newAuthFilter(t)))
+
+	var smtpErr *smtp.SMTPError
+	if err := c.Mail("sender@example.com", nil); !errors.As(err, &smtpErr) || smtpErr.Code < 500 {
+		t.Errorf("Mail() without AUTH error = %v, want a permanent rejection", err)
+	}
+}
+
+func TestSMTPAuthNotRequiredByDefault(t *testing.T) {
+	c := dialFilter(t, startFilter(t, &PostfixFilter{logger: zap.NewNop()}))
+
+	if ok, _ := c.Extension("AUTH"); ok {
+		t.Error("AUTH advertised without being required")
+	}
+	if err := c.Mail("sender@example.com", nil); err != nil {
+		t.Errorf("Mail() error = %v", err)
+	}
+}
+
+func TestSMTPAuthHtpasswd(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	if err := os.WriteFile(path, []byte("# relays\nrelay:"+string(hash)+"\n"), 0600); err != nil {
+		t.Fatalf("failed to write htpasswd: %v", err)
+	}
+
+	auth, err := NewSMTPAuth("", "", path)
+	if err != nil {
+		t.Fatalf("NewSMTPAuth() error = %v", err)
+	}
+	if err := auth.Authenticate("relay", "hunter2"); err != nil {
+		t.Errorf("Authenticate() error = %v", err)
+	}
+	if err := auth.Authenticate("relay", "hunter3"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Authenticate() with a wrong password error = %v, want ErrInvalidCredentials", err)
+	}
+}
+
+func TestSMTPAuthRejectsUnsupportedHashes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	if err := os.WriteFile(path, []byte("relay:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n"), 0600); err != nil {
+		t.Fatalf("failed to write htpasswd: %v", err)
+	}
+	if _, err := NewSMTPAuth("", "", path); err == nil {
+		t.Error("NewSMTPAuth() accepted a SHA1 hash")
+	}
+}
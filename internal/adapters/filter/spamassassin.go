@@ -0,0 +1,34 @@
+package filter
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// SpamAssassin-compatible header names
+const (
+	spamAssassinStatusHeader = "X-Spam-Status"
+	spamAssassinLevelHeader  = "X-Spam-Level"
+)
+
+// spamAssassinScale converts scores and thresholds between 0 and 1 to the
+// SpamAssassin range, where 5.0 is the usual required score
+const spamAssassinScale = 10.0
+
+// spamAssassinHeaders renders SpamAssassin-compatible status and level
+// header values, e.g. "Yes, score=8.7 required=7.0" and "********"
+func spamAssassinHeaders(isSpam bool, score, threshold float64) (string, string) {
+	verdict := "No"
+	if isSpam {
+		verdict = "Yes"
+	}
+	status := fmt.Sprintf("%s, score=%.1f required=%.1f", verdict, score*spamAssassinScale, threshold*spamAssassinScale)
+
+	// One star per whole point of the scaled score
+	stars := int(math.Floor(score * spamAssassinScale))
+	if stars < 0 {
+		stars = 0
+	}
+	return status, strings.Repeat("*", stars)
+}
@@ -0,0 +1,88 @@
+package filter
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/mikey/llm-spam-filter/internal/core"
+)
+
+func TestVerdictHeadersReportEffectiveThreshold(t *testing.T) {
+	session := &smtpSession{filter: &PostfixFilter{
+		spamAssassinCompat: true,
+		spamThreshold:      0.5,
+		spamHeader:         "X-Spam-Flag",
+		scoreHeader:        "X-Spam-Score",
+		reasonHeader:       "X-Spam-Reason",
+	}}
+
+	tests := []struct {
+		name      string
+		threshold float64
+		want      string
+	}{
+		{"lowered by domain threshold", 0.4, "X-Spam-Status: Yes, score=4.5 required=4.0"},
+		{"undecided falls back to global", 0, "X-Spam-Status: Yes, score=4.5 required=5.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			session.writeVerdictHeaders(&buf, &core.SpamAnalysisResult{IsSpam: true, Score: 0.45, Threshold: tt.threshold})
+			if !strings.Contains(buf.String(), tt.want+"\r\n") {
+				t.Errorf("headers = %q, want %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestSpamAssassinHeaders(t *testing.T) {
+	tests := []struct {
+		isSpam    bool
+		score     float64
+		threshold float64
+		status    string
+		level     string
+	}{
+		{true, 0.87, 0.7, "Yes, score=8.7 required=7.0", "********"},
+		{false, 0.25, 0.7, "No, score=2.5 required=7.0", "**"},
+		{false, 0.05, 0.5, "No, score=0.5 required=5.0", ""},
+		{true, 1.0, 0.5, "Yes, score=10.0 required=5.0", "**********"},
+		{false, -0.1, 0.5, "No, score=-1.0 required=5.0", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			status, level := spamAssassinHeaders(tt.isSpam, tt.score, tt.threshold)
+			if status != tt.status {
+				t.Errorf("status = %q, want %q", status, tt.status)
+			}
+			if level != tt.level {
+				t.Errorf("level = %q, want %q", level, tt.level)
+			}
+		})
+	}
+}
+
+func TestVerdictHeadersKeepCustomHeaders(t *testing.T) {
+	for _, compat := range []bool{false, true} {
+		session := &smtpSession{filter: &PostfixFilter{
+			spamAssassinCompat: compat,
+			spamThreshold:      0.7,
+			spamHeader:         "X-Spam-Flag",
+			scoreHeader:        "X-Spam-Score",
+			reasonHeader:       "X-Spam-Reason",
+		}}
+		var buf bytes.Buffer
+		session.writeVerdictHeaders(&buf, &core.SpamAnalysisResult{IsSpam: true, Score: 0.9, Explanation: "phishing"})
+		headers := buf.String()
+
+		for _, name := range []string{"X-Spam-Flag:", "X-Spam-Score:", "X-Spam-Reason:"} {
+			if !strings.Contains(headers, name) {
+				t.Errorf("compat=%t: headers = %q, want %s", compat, headers, name)
+			}
+		}
+		if got := strings.Contains(headers, "X-Spam-Level: *********\r\n"); got != compat {
+			t.Errorf("compat=%t: headers = %q, X-Spam-Level present = %t", compat, headers, got)
+		}
+	}
+}
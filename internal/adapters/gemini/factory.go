@@ -6,6 +6,7 @@ import (
 
 	"github.com/google/generative-ai-go/genai"
 	"github.com/mikey/llm-spam-filter/internal/config"
+	"github.com/mikey/llm-spam-filter/internal/prompt"
 	"github.com/mikey/llm-spam-filter/internal/utils"
 	"go.uber.org/zap"
 	"google.golang.org/api/option"
@@ -16,21 +17,32 @@ type Factory struct {
 	cfg          *config.Config
 	logger       *zap.Logger
 	textProcessor *utils.TextProcessor
+	errorSamples  *prompt.ErrorSamples
 }
 
 // NewFactory creates a new Gemini factory
-func NewFactory(cfg *config.Config, logger *zap.Logger, textProcessor *utils.TextProcessor) *Factory {
+func NewFactory(cfg *config.Config, logger *zap.Logger, textProcessor *utils.TextProcessor, errorSamples *prompt.ErrorSamples) *Factory {
 	return &Factory{
 		cfg:    cfg,
 		logger: logger,
 		textProcessor: textProcessor,
+		errorSamples:  errorSamples,
 	}
 }
 
-// CreateClient creates a new Gemini client
+// CreateClient creates a new Gemini client for the configured model
 func (f *Factory) CreateClient() (*GeminiClient, error) {
+	return f.CreateClientForModel(f.cfg.GetGemini().ModelName)
+}
+
+// CreateClientForModel creates a new Gemini client for the given model
+func (f *Factory) CreateClientForModel(modelName string) (*GeminiClient, error) {
 	// Get Gemini config
 	geminiCfg := f.cfg.GetGemini()
+	maxTokens, err := config.ResolveMaxTokens(geminiCfg.MaxTokens, "gemini", modelName)
+	if err != nil {
+		return nil, err
+	}
 	
 	// Create Gemini client
 	ctx := context.Background()
@@ -39,14 +51,19 @@ func (f *Factory) CreateClient() (*GeminiClient, error) {
 		return nil, fmt.Errorf("failed to create Gemini client: %w", err)
 	}
 	
+	promptOpts := prompt.OptionsFromConfig(f.cfg, geminiCfg.MaxBodySize)
+	promptOpts.ErrorSamples = f.errorSamples
+	
 	return NewGeminiClient(
 		client,
-		geminiCfg.ModelName,
-		geminiCfg.MaxTokens,
+		modelName,
+		maxTokens,
 		geminiCfg.Temperature,
 		geminiCfg.TopP,
-		geminiCfg.MaxBodySize,
+		geminiCfg.SafetyBlockThreshold,
 		f.logger,
-		f.textProcessor,
+		prompt.NewBuilder(promptOpts, f.textProcessor, f.logger),
+		f.cfg.GetLLM().ReformatOnParseError,
+		f.cfg.GetLLM().RetryOnEmpty,
 	)
 }
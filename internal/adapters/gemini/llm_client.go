@@ -2,13 +2,14 @@ package gemini
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/generative-ai-go/genai"
 	"github.com/mikey/llm-spam-filter/internal/core"
-	"github.com/mikey/llm-spam-filter/internal/utils"
+	"github.com/mikey/llm-spam-filter/internal/prompt"
 	"go.uber.org/zap"
 )
 
@@ -20,18 +21,21 @@ type GeminiClient struct {
 	maxTokens    int
 	temperature  float32
 	topP         float32
-	maxBodySize  int
 	logger       *zap.Logger
-	promptFormat string
-	textProcessor *utils.TextProcessor
+	promptBuilder *prompt.Builder
+	reformatOnParseError bool
+	retryOnEmpty int
 }
 
-// SpamAnalysisResponse represents the structured response from the LLM
-type SpamAnalysisResponse struct {
-	IsSpam      bool    `json:"is_spam"`
-	Score       float64 `json:"score"`
-	Confidence  float64 `json:"confidence"`
-	Explanation string  `json:"explanation"`
+// ErrContentBlocked is returned when Gemini's safety filters block the prompt or response
+var ErrContentBlocked = errors.New("content blocked by Gemini safety filters")
+
+// safetyCategories are the harm categories supported by Gemini models
+var safetyCategories = []genai.HarmCategory{
+	genai.HarmCategoryHarassment,
+	genai.HarmCategoryHateSpeech,
+	genai.HarmCategorySexuallyExplicit,
+	genai.HarmCategoryDangerousContent,
 }
 
 // NewGeminiClient creates a new Gemini client
@@ -41,15 +45,32 @@ func NewGeminiClient(
 	maxTokens int,
 	temperature float32,
 	topP float32,
-	maxBodySize int,
+	safetyBlockThreshold string,
 	logger *zap.Logger,
-	textProcessor *utils.TextProcessor,
+	promptBuilder *prompt.Builder,
+	reformatOnParseError bool,
+	retryOnEmpty int,
 ) (*GeminiClient, error) {
 	model := client.GenerativeModel(modelName)
 	model.SetTemperature(float32(temperature))
 	model.SetTopP(float32(topP))
 	model.SetMaxOutputTokens(int32(maxTokens))
 	
+	// Spam and phishing content is often flagged as harmful, so relax the
+	// safety settings to allow it to be analyzed
+	threshold, err := parseSafetyBlockThreshold(safetyBlockThreshold)
+	if err != nil {
+		return nil, err
+	}
+	if threshold != genai.HarmBlockUnspecified {
+		for _, category := range safetyCategories {
+			model.SafetySettings = append(model.SafetySettings, &genai.SafetySetting{
+				Category:  category,
+				Threshold: threshold,
+			})
+		}
+	}
+	
 	return &GeminiClient{
 		client:       client,
 		model:        model,
@@ -57,98 +78,159 @@ func NewGeminiClient(
 		maxTokens:    maxTokens,
 		temperature:  temperature,
 		topP:         topP,
-		maxBodySize:  maxBodySize,
 		logger:       logger,
-		textProcessor: textProcessor,
-		promptFormat: `You are a spam detection system. Analyze the following email and determine if it's spam.
-Respond with a JSON object containing:
-- is_spam: boolean (true if spam, false if not)
-- score: number between 0 and 1 (higher means more likely to be spam)
-- confidence: number between 0 and 1 (how confident you are in your assessment)
-- explanation: string (brief explanation of why you think it's spam or not)
-
-Email:
-From: %s
-To: %s
-Subject: %s
-Body:
-%s
-
-Respond only with the JSON object and nothing else.`,
+		promptBuilder: promptBuilder,
+		reformatOnParseError: reformatOnParseError,
+		retryOnEmpty: retryOnEmpty,
 	}, nil
 }
 
 // AnalyzeEmail analyzes an email to determine if it's spam
 func (c *GeminiClient) AnalyzeEmail(ctx context.Context, email *core.Email) (*core.SpamAnalysisResult, error) {
-	// Format the prompt with email details
-	to := ""
-	if len(email.To) > 0 {
-		to = email.To[0]
-		if len(email.To) > 1 {
-			to += fmt.Sprintf(" and %d others", len(email.To)-1)
+	// Render the prompt with email details
+	promptText := c.promptBuilder.Build(email)
+	
+	// Call Gemini API, retrying empty responses if configured
+	var responseText string
+	var err error
+	for attempt := 0; ; attempt++ {
+		responseText, err = c.generate(ctx, c.model, promptText)
+		if !errors.Is(err, prompt.ErrEmptyResponse) || attempt >= c.retryOnEmpty {
+			break
 		}
+		core.ContextLogger(ctx, c.logger).Warn("Empty response from Gemini, retrying",
+			zap.Int("attempt", attempt+1),
+			zap.Int("retries", c.retryOnEmpty))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse the LLM's JSON response, optionally asking the model to reformat it once
+	analysisResponse, err := c.promptBuilder.ParseResponse(responseText)
+	if err != nil && c.reformatOnParseError {
+		core.ContextLogger(ctx, c.logger).Debug("Asking Gemini to reformat unparseable response", zap.Error(err))
+		analysisResponse, err = c.reformatResponse(ctx, promptText, responseText)
 	}
-	
-	// Process the body (truncate and sanitize)
-	processedBody := c.textProcessor.ProcessText(email.Body, c.maxBodySize)
-	
-	prompt := fmt.Sprintf(c.promptFormat, email.From, to, email.Subject, processedBody)
-	
-	// Call Gemini API
-	resp, err := c.model.GenerateContent(ctx, genai.Text(prompt))
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate content with Gemini: %w", err)
+		return nil, err
 	}
+	
+	return c.newResult(analysisResponse), nil
+}
 
-	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
-		return nil, fmt.Errorf("empty response from Gemini")
+// AnalyzeEmails analyzes several emails in one request, allowing each its
+// own share of the response tokens
+func (c *GeminiClient) AnalyzeEmails(ctx context.Context, emails []*core.Email) ([]*core.SpamAnalysisResult, error) {
+	// Emails left out of the batch prompt get no result
+	results := make([]*core.SpamAnalysisResult, len(emails))
+	promptText, included := c.promptBuilder.BuildBatch(emails)
+	if len(included) == 0 {
+		return results, nil
 	}
 
-	// Extract the response text
-	responseText := fmt.Sprintf("%v", resp.Candidates[0].Content.Parts[0])
+	// The model is shared, so the larger token limit goes on a copy
+	model := *c.model
+	model.SetMaxOutputTokens(int32(c.maxTokens * len(included)))
 
-	// Parse the LLM's JSON response
-	var analysisResponse SpamAnalysisResponse
-	if err := json.Unmarshal([]byte(responseText), &analysisResponse); err != nil {
-		// Try to extract JSON from the text response
-		jsonStart := 0
-		jsonEnd := len(responseText)
-		
-		// Find JSON start
-		for i := 0; i < len(responseText); i++ {
-			if responseText[i] == '{' {
-				jsonStart = i
-				break
-			}
-		}
-		
-		// Find JSON end
-		for i := len(responseText) - 1; i >= 0; i-- {
-			if responseText[i] == '}' {
-				jsonEnd = i + 1
-				break
-			}
-		}
-		
-		if jsonStart < jsonEnd {
-			jsonStr := responseText[jsonStart:jsonEnd]
-			if err := json.Unmarshal([]byte(jsonStr), &analysisResponse); err != nil {
-				return nil, fmt.Errorf("failed to parse LLM response as JSON: %w", err)
-			}
-		} else {
-			return nil, fmt.Errorf("failed to extract JSON from LLM response: %w", err)
+	responseText, err := c.generate(ctx, &model, promptText)
+	if err != nil {
+		return nil, err
+	}
+	responses, err := c.promptBuilder.ParseBatchResponse(responseText, len(included))
+	if err != nil {
+		return nil, err
+	}
+	for i, response := range responses {
+		if response != nil {
+			results[included[i]] = c.newResult(response)
 		}
 	}
-	
-	// Create the result
-	result := &core.SpamAnalysisResult{
-		IsSpam:      analysisResponse.IsSpam,
-		Score:       analysisResponse.Score,
-		Confidence:  analysisResponse.Confidence,
-		Explanation: analysisResponse.Explanation,
+	return results, nil
+}
+
+// newResult creates the result for a parsed verdict
+func (c *GeminiClient) newResult(response *prompt.Response) *core.SpamAnalysisResult {
+	return &core.SpamAnalysisResult{
+		IsSpam:      response.IsSpam,
+		Score:       response.Score,
+		Confidence:  response.Confidence,
+		Explanation: response.Explanation,
 		AnalyzedAt:  time.Now(),
 		ModelUsed:   c.modelName,
+		Provider:    "gemini",
+	}
+}
+
+// Validate checks that Gemini accepts the API key by looking up the model
+func (c *GeminiClient) Validate(ctx context.Context) error {
+	if _, err := c.model.Info(ctx); err != nil {
+		return fmt.Errorf("failed to look up Gemini model %s: %w", c.modelName, err)
+	}
+	return nil
+}
+
+// generate asks a model for a verdict and returns the text of its answer
+func (c *GeminiClient) generate(ctx context.Context, model *genai.GenerativeModel, promptText string) (string, error) {
+	resp, err := model.GenerateContent(ctx, genai.Text(promptText))
+	if err != nil {
+		var blockedErr *genai.BlockedError
+		if errors.As(err, &blockedErr) {
+			core.ContextLogger(ctx, c.logger).Warn("Gemini blocked the analysis", zap.String("reason", blockedErr.Error()))
+			return "", fmt.Errorf("%w: %v", ErrContentBlocked, blockedErr)
+		}
+		return "", fmt.Errorf("failed to generate content with Gemini: %w", err)
+	}
+
+	if resp.PromptFeedback != nil && resp.PromptFeedback.BlockReason != genai.BlockReasonUnspecified {
+		return "", fmt.Errorf("%w: prompt blocked: %s", ErrContentBlocked, resp.PromptFeedback.BlockReason)
+	}
+	if len(resp.Candidates) > 0 && resp.Candidates[0].FinishReason == genai.FinishReasonSafety {
+		return "", fmt.Errorf("%w: candidate blocked: %s", ErrContentBlocked, resp.Candidates[0].FinishReason)
+	}
+
+	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil || len(resp.Candidates[0].Content.Parts) == 0 {
+		return "", fmt.Errorf("%w from Gemini", prompt.ErrEmptyResponse)
+	}
+
+	return fmt.Sprintf("%v", resp.Candidates[0].Content.Parts[0]), nil
+}
+
+// reformatResponse asks the model to restate an unparseable answer as the
+// required JSON object, continuing the original conversation
+func (c *GeminiClient) reformatResponse(ctx context.Context, promptText string, responseText string) (*prompt.Response, error) {
+	session := c.model.StartChat()
+	session.History = []*genai.Content{
+		{Role: "user", Parts: []genai.Part{genai.Text(promptText)}},
+		{Role: "model", Parts: []genai.Part{genai.Text(responseText)}},
+	}
+
+	resp, err := session.SendMessage(ctx, genai.Text(c.promptBuilder.ReformatPrompt()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to reformat response with Gemini: %w", err)
+	}
+	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil || len(resp.Candidates[0].Content.Parts) == 0 {
+		return nil, fmt.Errorf("empty reformat response from Gemini")
+	}
+
+	return c.promptBuilder.ParseResponse(fmt.Sprintf("%v", resp.Candidates[0].Content.Parts[0]))
+}
+
+// parseSafetyBlockThreshold maps a configured threshold name to a Gemini block threshold
+func parseSafetyBlockThreshold(threshold string) (genai.HarmBlockThreshold, error) {
+	switch strings.ToLower(strings.TrimSpace(threshold)) {
+	case "", "default":
+		// Leave the provider defaults in place
+		return genai.HarmBlockUnspecified, nil
+	case "none":
+		return genai.HarmBlockNone, nil
+	case "only_high":
+		return genai.HarmBlockOnlyHigh, nil
+	case "medium_and_above":
+		return genai.HarmBlockMediumAndAbove, nil
+	case "low_and_above":
+		return genai.HarmBlockLowAndAbove, nil
+	default:
+		return genai.HarmBlockUnspecified, fmt.Errorf("unsupported Gemini safety block threshold: %s", threshold)
 	}
-	
-	return result, nil
 }
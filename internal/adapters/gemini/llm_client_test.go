@@ -0,0 +1,164 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"github.com/mikey/llm-spam-filter/internal/prompt"
+	"github.com/mikey/llm-spam-filter/internal/utils"
+	"go.uber.org/zap"
+	"google.golang.org/api/option"
+)
+
+// newTestClient creates a client talking to a fake Gemini API answering
+// every request with response
+func newTestClient(t *testing.T, response string) *GeminiClient {
+	client, _ := newRecordingTestClient(t, 0, response)
+	return client
+}
+
+// newRecordingTestClient creates a client retrying empty responses up to
+// retryOnEmpty times, talking to a fake Gemini API answering with one of
+// responses per request and repeating the last. It also returns the bodies
+// of the requests the fake API receives.
+func newRecordingTestClient(t *testing.T, retryOnEmpty int, responses ...string) (*GeminiClient, *[][]byte) {
+	t.Helper()
+	var mu sync.Mutex
+	var requests [][]byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, body)
+		response := responses[0]
+		if len(responses) > 1 {
+			responses = responses[1:]
+		}
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(response))
+	}))
+	t.Cleanup(server.Close)
+
+	genaiClient, err := genai.NewClient(context.Background(), option.WithAPIKey("test-key"), option.WithEndpoint(server.URL))
+	if err != nil {
+		t.Fatalf("failed to create Gemini client: %v", err)
+	}
+	t.Cleanup(func() { genaiClient.Close() })
+
+	logger := zap.NewNop()
+	builder := prompt.NewBuilder(prompt.Options{}, utils.NewTextProcessor(logger), logger)
+	client, err := NewGeminiClient(genaiClient, "gemini-test", 256, 0.1, 0.9, "none", logger, builder, false, retryOnEmpty)
+	if err != nil {
+		t.Fatalf("NewGeminiClient() error = %v", err)
+	}
+	return client, &requests
+}
+
+// testEmail returns a plain email
+func testEmail() *core.Email {
+	return &core.Email{
+		From:    "sender@example.com",
+		To:      []string{"user@example.org"},
+		Subject: "Hello",
+		Body:    "Just checking in about the meeting next week.",
+		Headers: map[string][]string{},
+	}
+}
+
+func TestAnalyzeEmailReportsBlockedContent(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+	}{
+		{"prompt blocked", `{"promptFeedback": {"blockReason": "SAFETY"}}`},
+		{"candidate blocked", `{"candidates": [{"finishReason": "SAFETY"}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newTestClient(t, tt.response).AnalyzeEmail(context.Background(), testEmail())
+			if !errors.Is(err, ErrContentBlocked) {
+				t.Errorf("AnalyzeEmail() error = %v, want ErrContentBlocked", err)
+			}
+		})
+	}
+}
+
+func TestAnalyzeEmailParsesVerdict(t *testing.T) {
+	response := `{"candidates": [{"content": {"role": "model", "parts": [{"text": "{\"is_spam\": true, \"score\": 0.92, \"confidence\": 0.8, \"explanation\": \"Phishing\"}"}]}, "finishReason": "STOP"}]}`
+
+	result, err := newTestClient(t, response).AnalyzeEmail(context.Background(), testEmail())
+	if err != nil {
+		t.Fatalf("AnalyzeEmail() error = %v", err)
+	}
+	if !result.IsSpam || result.Score != 0.92 || result.Provider != "gemini" {
+		t.Errorf("result = %+v, want the parsed spam verdict", result)
+	}
+}
+
+func TestSafetySettingsFollowThreshold(t *testing.T) {
+	client := newTestClient(t, `{}`)
+	if len(client.model.SafetySettings) != len(safetyCategories) {
+		t.Fatalf("got %d safety settings, want one per category", len(client.model.SafetySettings))
+	}
+	for _, setting := range client.model.SafetySettings {
+		if setting.Threshold != genai.HarmBlockNone {
+			t.Errorf("category %v threshold = %v, want BLOCK_NONE", setting.Category, setting.Threshold)
+		}
+	}
+
+	if _, err := parseSafetyBlockThreshold("sometimes"); err == nil {
+		t.Error("parseSafetyBlockThreshold() accepted an unknown threshold")
+	}
+}
+
+func TestRequestUsesConfiguredMaxTokens(t *testing.T) {
+	client, requests := newRecordingTestClient(t, 0, `{"candidates": [{"content": {"role": "model", "parts": [{"text": "{\"is_spam\": false, \"score\": 0.1}"}]}, "finishReason": "STOP"}]}`)
+	if _, err := client.AnalyzeEmail(context.Background(), testEmail()); err != nil {
+		t.Fatalf("AnalyzeEmail() error = %v", err)
+	}
+
+	if len(*requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(*requests))
+	}
+	var req struct {
+		GenerationConfig struct {
+			MaxOutputTokens int `json:"maxOutputTokens"`
+		} `json:"generationConfig"`
+	}
+	if err := json.Unmarshal((*requests)[0], &req); err != nil {
+		t.Fatalf("failed to decode request: %v", err)
+	}
+	if req.GenerationConfig.MaxOutputTokens != 256 {
+		t.Errorf("maxOutputTokens = %d, want 256", req.GenerationConfig.MaxOutputTokens)
+	}
+}
+
+func TestRetriesEmptyResponse(t *testing.T) {
+	empty := `{"candidates": []}`
+	verdict := `{"candidates": [{"content": {"role": "model", "parts": [{"text": "{\"is_spam\": true, \"score\": 0.92}"}]}, "finishReason": "STOP"}]}`
+
+	client, requests := newRecordingTestClient(t, 1, empty, verdict)
+	result, err := client.AnalyzeEmail(context.Background(), testEmail())
+	if err != nil {
+		t.Fatalf("AnalyzeEmail() error = %v", err)
+	}
+	if !result.IsSpam || len(*requests) != 2 {
+		t.Errorf("got %+v after %d requests, want the retried verdict after 2", result, len(*requests))
+	}
+
+	client, requests = newRecordingTestClient(t, 1, empty)
+	if _, err := client.AnalyzeEmail(context.Background(), testEmail()); !errors.Is(err, prompt.ErrEmptyResponse) {
+		t.Errorf("AnalyzeEmail() error = %v, want ErrEmptyResponse", err)
+	}
+	if len(*requests) != 2 {
+		t.Errorf("got %d requests, want the first and one retry", len(*requests))
+	}
+}
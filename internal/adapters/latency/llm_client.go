@@ -0,0 +1,43 @@
+package latency
+
+import (
+	"context"
+	"time"
+
+	"github.com/mikey/llm-spam-filter/internal/core"
+)
+
+// Client is an implementation of the LLMClient interface that records how
+// long each analysis by a provider takes
+type Client struct {
+	client   core.LLMClient
+	provider string
+	recorder core.LatencyRecorder
+}
+
+// NewClient creates a client recording the latency of client's analyses
+// under the provider's name
+func NewClient(client core.LLMClient, provider string, recorder core.LatencyRecorder) *Client {
+	return &Client{
+		client:   client,
+		provider: provider,
+		recorder: recorder,
+	}
+}
+
+// AnalyzeEmail analyzes an email and records how long it took, including
+// failed analyses
+func (c *Client) AnalyzeEmail(ctx context.Context, email *core.Email) (*core.SpamAnalysisResult, error) {
+	start := time.Now()
+	result, err := c.client.AnalyzeEmail(ctx, email)
+	c.recorder.Record(c.provider, time.Since(start))
+	return result, err
+}
+
+// Close closes the wrapped client if it needs closing
+func (c *Client) Close() error {
+	if closer, ok := c.client.(interface{ Close() error }); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package latency
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mikey/llm-spam-filter/internal/core"
+)
+
+// slowLLM is an LLMClient taking a fixed time to answer, or fail
+type slowLLM struct {
+	delay time.Duration
+	err   error
+}
+
+func (c *slowLLM) AnalyzeEmail(ctx context.Context, email *core.Email) (*core.SpamAnalysisResult, error) {
+	time.Sleep(c.delay)
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &core.SpamAnalysisResult{Score: 0.1}, nil
+}
+
+// latencyLog is a LatencyRecorder keeping every recorded latency
+type latencyLog struct {
+	mu        sync.Mutex
+	latencies map[string][]time.Duration
+}
+
+func (l *latencyLog) Record(provider string, latency time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.latencies[provider] = append(l.latencies[provider], latency)
+}
+
+func TestAnalysesRecordLatency(t *testing.T) {
+	recorder := &latencyLog{latencies: make(map[string][]time.Duration)}
+	ok := NewClient(&slowLLM{delay: 20 * time.Millisecond}, "openai", recorder)
+	failing := NewClient(&slowLLM{delay: 20 * time.Millisecond, err: errors.New("timeout")}, "gemini", recorder)
+
+	if _, err := ok.AnalyzeEmail(context.Background(), &core.Email{}); err != nil {
+		t.Fatalf("AnalyzeEmail() error = %v", err)
+	}
+	if _, err := failing.AnalyzeEmail(context.Background(), &core.Email{}); err == nil {
+		t.Fatal("AnalyzeEmail() succeeded, want the provider's error")
+	}
+
+	for _, provider := range []string{"openai", "gemini"} {
+		latencies := recorder.latencies[provider]
+		if len(latencies) != 1 || latencies[0] < 20*time.Millisecond {
+			t.Errorf("%s latencies = %v, want one of at least 20ms", provider, latencies)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package learning
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"go.uber.org/zap"
+)
+
+// FileRecorder is a FeatureRecorder that appends records to a JSON lines
+// file
+type FileRecorder struct {
+	path   string
+	mu     sync.Mutex
+	logger *zap.Logger
+}
+
+// NewFileRecorder creates a new file-backed feature recorder
+func NewFileRecorder(path string, logger *zap.Logger) *FileRecorder {
+	return &FileRecorder{
+		path:   path,
+		logger: logger,
+	}
+}
+
+// Record appends a feature record to the file
+func (r *FileRecorder) Record(ctx context.Context, record core.FeatureRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal feature record: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open learning output file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write feature record: %w", err)
+	}
+
+	r.logger.Debug("Wrote feature record", zap.String("path", r.path), zap.String("sender", record.Sender))
+	return nil
+}
@@ -0,0 +1,80 @@
+package learning
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"go.uber.org/zap"
+)
+
+// fixedLLM is an LLMClient returning a fixed result
+type fixedLLM struct {
+	result core.SpamAnalysisResult
+}
+
+func (c *fixedLLM) AnalyzeEmail(ctx context.Context, email *core.Email) (*core.SpamAnalysisResult, error) {
+	result := c.result
+	return &result, nil
+}
+
+func TestProcessedMessageWritesFeatureRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "features.jsonl")
+	llm := &fixedLLM{result: core.SpamAnalysisResult{IsSpam: true, Score: 0.92, Confidence: 0.8, ModelUsed: "gpt-test"}}
+	service := core.NewSpamFilterService(llm, nil, zap.NewNop(), false, time.Hour, 0.7, nil, nil, nil, core.ServiceOptions{
+		FeatureRecorder: NewFileRecorder(path, zap.NewNop()),
+	})
+
+	email := &core.Email{
+		From:    "billing@invoices.example.com",
+		To:      []string{"alice@example.org", "bob@example.net"},
+		Subject: "Invoice overdue",
+		Body:    "Pay now at https://pay.example.com or www.example.com/pay",
+		Headers: map[string][]string{
+			"Authentication-Results": {"mx.example.org; spf=pass smtp.mailfrom=example.com; dkim=fail header.d=example.com; dmarc=fail"},
+		},
+	}
+	ctx := core.WithProcessingID(context.Background(), "msg-1")
+	if _, err := service.AnalyzeEmail(ctx, email); err != nil {
+		t.Fatalf("AnalyzeEmail() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read feature records: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("wrote %d records, want 1:\n%s", len(lines), data)
+	}
+
+	var record core.FeatureRecord
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("record is not JSON: %v", err)
+	}
+	if record.ProcessingID != "msg-1" || record.Sender != email.From || record.RecordedAt.IsZero() {
+		t.Errorf("record = %+v, want the processing ID, sender and time", record)
+	}
+	if !record.IsSpam || record.Score != 0.92 || record.Confidence != 0.8 || record.Model != "gpt-test" {
+		t.Errorf("record = %+v, want the LLM verdict", record)
+	}
+	want := core.Features{
+		BodyLength:       len(email.Body),
+		SubjectLength:    len(email.Subject),
+		LinkCount:        2,
+		RecipientCount:   2,
+		RecipientDomains: 2,
+		ValidFrom:        true,
+		SPF:              "pass",
+		DKIM:             "fail",
+		DMARC:            "fail",
+	}
+	if record.Features != want {
+		t.Errorf("features = %+v, want %+v", record.Features, want)
+	}
+}
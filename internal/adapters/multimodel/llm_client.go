@@ -0,0 +1,122 @@
+package multimodel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"go.uber.org/zap"
+)
+
+// Model selection strategies
+const (
+	// StrategyPrimary uses the first model, falling back to the next on error
+	StrategyPrimary = "primary"
+	// StrategyRoundRobin cycles through the models on successive calls
+	StrategyRoundRobin = "round_robin"
+	// StrategyRandom picks a model at random for each call
+	StrategyRandom = "random"
+)
+
+// Client is an implementation of the LLMClient interface that spreads
+// analyses across several models of the same provider, so their verdicts
+// can be compared in the logs
+type Client struct {
+	clients  []core.LLMClient
+	models   []string
+	strategy string
+	next     atomic.Uint64
+	logger   *zap.Logger
+}
+
+// NewClient creates a new multi-model client. The clients and models must
+// be in the same order.
+func NewClient(clients []core.LLMClient, models []string, strategy string, logger *zap.Logger) (*Client, error) {
+	if len(clients) == 0 || len(clients) != len(models) {
+		return nil, fmt.Errorf("expected one client per model, got %d clients for %d models", len(clients), len(models))
+	}
+
+	switch strategy {
+	case StrategyPrimary, StrategyRoundRobin, StrategyRandom:
+	default:
+		return nil, fmt.Errorf("unsupported model selection strategy: %s", strategy)
+	}
+
+	return &Client{
+		clients:  clients,
+		models:   models,
+		strategy: strategy,
+		logger:   logger,
+	}, nil
+}
+
+// AnalyzeEmail analyzes an email with a model chosen by the selection strategy
+func (c *Client) AnalyzeEmail(ctx context.Context, email *core.Email) (*core.SpamAnalysisResult, error) {
+	if c.strategy == StrategyPrimary {
+		return c.analyzeWithFallback(ctx, email)
+	}
+
+	index := c.selectIndex()
+	core.ContextLogger(ctx, c.logger).Debug("Selected model for analysis",
+		zap.String("model", c.models[index]),
+		zap.String("strategy", c.strategy))
+
+	return c.clients[index].AnalyzeEmail(ctx, email)
+}
+
+// analyzeWithFallback tries each model in order until one succeeds
+func (c *Client) analyzeWithFallback(ctx context.Context, email *core.Email) (*core.SpamAnalysisResult, error) {
+	var err error
+	for i, client := range c.clients {
+		var result *core.SpamAnalysisResult
+		result, err = client.AnalyzeEmail(ctx, email)
+		if err == nil {
+			return result, nil
+		}
+		if i < len(c.clients)-1 {
+			core.ContextLogger(ctx, c.logger).Warn("Model failed, falling back to next model",
+				zap.String("model", c.models[i]),
+				zap.String("next_model", c.models[i+1]),
+				zap.Error(err))
+		}
+	}
+	return nil, err
+}
+
+// Validate validates each model's client
+func (c *Client) Validate(ctx context.Context) error {
+	for i, client := range c.clients {
+		validator, ok := client.(core.Validator)
+		if !ok {
+			continue
+		}
+		if err := validator.Validate(ctx); err != nil {
+			return fmt.Errorf("model %s: %w", c.models[i], err)
+		}
+	}
+	return nil
+}
+
+// Close closes the models' clients that hold resources
+func (c *Client) Close() error {
+	var errs []error
+	for _, client := range c.clients {
+		if closer, ok := client.(interface{ Close() error }); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// selectIndex returns the index of the model to use for the next call
+func (c *Client) selectIndex() int {
+	if c.strategy == StrategyRandom {
+		return rand.Intn(len(c.clients))
+	}
+	return int((c.next.Add(1) - 1) % uint64(len(c.clients)))
+}
@@ -0,0 +1,128 @@
+package multimodel
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"go.uber.org/zap"
+)
+
+// modelClient is an LLMClient answering as a fixed model, or failing
+type modelClient struct {
+	model string
+	err   error
+}
+
+func (c *modelClient) AnalyzeEmail(ctx context.Context, email *core.Email) (*core.SpamAnalysisResult, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &core.SpamAnalysisResult{ModelUsed: c.model}, nil
+}
+
+// closingClient is an LLMClient that counts how often it is closed
+type closingClient struct {
+	modelClient
+	closed int
+	err    error
+}
+
+func (c *closingClient) Close() error {
+	c.closed++
+	return c.err
+}
+
+// newTestClient creates a client over models answering as themselves,
+// except those in failing
+func newTestClient(t *testing.T, strategy string, models []string, failing ...string) *Client {
+	t.Helper()
+	clients := make([]core.LLMClient, len(models))
+	for i, model := range models {
+		clients[i] = &modelClient{model: model}
+		for _, failed := range failing {
+			if model == failed {
+				clients[i] = &modelClient{model: model, err: errors.New(model + " unavailable")}
+			}
+		}
+	}
+	client, err := NewClient(clients, models, strategy, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	return client
+}
+
+func TestRoundRobinCyclesModels(t *testing.T) {
+	client := newTestClient(t, StrategyRoundRobin, []string{"model-a", "model-b", "model-c"})
+
+	want := []string{"model-a", "model-b", "model-c", "model-a", "model-b"}
+	for i, model := range want {
+		result, err := client.AnalyzeEmail(context.Background(), &core.Email{})
+		if err != nil {
+			t.Fatalf("AnalyzeEmail() error = %v", err)
+		}
+		if result.ModelUsed != model {
+			t.Errorf("call %d used %s, want %s", i, result.ModelUsed, model)
+		}
+	}
+}
+
+func TestPrimaryFallsBackOnError(t *testing.T) {
+	client := newTestClient(t, StrategyPrimary, []string{"model-a", "model-b"}, "model-a")
+
+	result, err := client.AnalyzeEmail(context.Background(), &core.Email{})
+	if err != nil {
+		t.Fatalf("AnalyzeEmail() error = %v", err)
+	}
+	if result.ModelUsed != "model-b" {
+		t.Errorf("ModelUsed = %s, want the fallback model-b", result.ModelUsed)
+	}
+
+	client = newTestClient(t, StrategyPrimary, []string{"model-a", "model-b"}, "model-a", "model-b")
+	if _, err := client.AnalyzeEmail(context.Background(), &core.Email{}); err == nil {
+		t.Error("AnalyzeEmail() succeeded with every model failing")
+	}
+}
+
+func TestRandomPicksConfiguredModels(t *testing.T) {
+	client := newTestClient(t, StrategyRandom, []string{"model-a", "model-b"})
+
+	for i := 0; i < 20; i++ {
+		result, err := client.AnalyzeEmail(context.Background(), &core.Email{})
+		if err != nil {
+			t.Fatalf("AnalyzeEmail() error = %v", err)
+		}
+		if result.ModelUsed != "model-a" && result.ModelUsed != "model-b" {
+			t.Errorf("ModelUsed = %s, want one of the configured models", result.ModelUsed)
+		}
+	}
+}
+
+func TestNewClientRejectsBadConfiguration(t *testing.T) {
+	clients := []core.LLMClient{&modelClient{model: "model-a"}}
+	if _, err := NewClient(clients, []string{"model-a"}, "fastest", zap.NewNop()); err == nil {
+		t.Error("NewClient() accepted an unknown strategy")
+	}
+	if _, err := NewClient(clients, []string{"model-a", "model-b"}, StrategyPrimary, zap.NewNop()); err == nil {
+		t.Error("NewClient() accepted more models than clients")
+	}
+}
+
+func TestCloseClosesEveryModel(t *testing.T) {
+	first := &closingClient{modelClient: modelClient{model: "first"}}
+	second := &closingClient{modelClient: modelClient{model: "second"}, err: errors.New("close failed")}
+	client, err := NewClient([]core.LLMClient{first, &modelClient{model: "plain"}, second},
+		[]string{"first", "plain", "second"}, StrategyPrimary, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	if err := client.Close(); err == nil {
+		t.Error("Close() error = nil, want the failed close reported")
+	}
+	if first.closed != 1 || second.closed != 1 {
+		t.Errorf("closed first %d and second %d times, want once each", first.closed, second.closed)
+	}
+}
@@ -1,7 +1,10 @@
 package openai
 
 import (
+	"fmt"
+
 	"github.com/mikey/llm-spam-filter/internal/config"
+	"github.com/mikey/llm-spam-filter/internal/prompt"
 	"github.com/mikey/llm-spam-filter/internal/core"
 	"github.com/mikey/llm-spam-filter/internal/utils"
 	"github.com/sashabaranov/go-openai"
@@ -13,33 +16,61 @@ type Factory struct {
 	cfg          *config.Config
 	logger       *zap.Logger
 	textProcessor *utils.TextProcessor
+	errorSamples  *prompt.ErrorSamples
 }
 
 // NewFactory creates a new factory for OpenAIClient instances
-func NewFactory(cfg *config.Config, logger *zap.Logger, textProcessor *utils.TextProcessor) *Factory {
+func NewFactory(cfg *config.Config, logger *zap.Logger, textProcessor *utils.TextProcessor, errorSamples *prompt.ErrorSamples) *Factory {
 	return &Factory{
 		cfg:          cfg,
 		logger:       logger,
 		textProcessor: textProcessor,
+		errorSamples:  errorSamples,
 	}
 }
 
-// CreateLLMClient creates a new OpenAIClient
+// CreateLLMClient creates a new OpenAIClient for the configured model
 func (f *Factory) CreateLLMClient() (core.LLMClient, error) {
+	return f.CreateClientForModel(f.cfg.GetOpenAI().ModelName)
+}
+
+// CreateClientForModel creates a new OpenAIClient for the given model
+func (f *Factory) CreateClientForModel(modelName string) (*OpenAIClient, error) {
 	// Get OpenAI config
 	openaiCfg := f.cfg.GetOpenAI()
+	maxTokens, err := config.ResolveMaxTokens(openaiCfg.MaxTokens, "openai", modelName)
+	if err != nil {
+		return nil, err
+	}
 	
-	// Create OpenAI client
-	client := openai.NewClient(openaiCfg.APIKey)
+	// Create OpenAI client, honoring Retry-After on rate limits if enabled
+	clientConfig := openai.DefaultConfig(openaiCfg.APIKey)
+	if retries := f.cfg.GetLLM().RateLimitRetries; retries > 0 {
+		maxRetryAfter, err := f.cfg.GetDuration("llm.max_retry_after")
+		if err != nil {
+			return nil, fmt.Errorf("invalid llm.max_retry_after: %w", err)
+		}
+		clientConfig.HTTPClient = newRetryAfterDoer(clientConfig.HTTPClient, retries, maxRetryAfter, f.logger)
+	}
+	client := openai.NewClientWithConfig(clientConfig)
+
+	// Truncate the body by tokens rather than bytes if enabled
+	promptOpts := prompt.OptionsFromConfig(f.cfg, openaiCfg.MaxBodySize)
+	promptOpts.ErrorSamples = f.errorSamples
+	if openaiCfg.TokenizerTruncation {
+		promptOpts.MaxBodyTokens = openaiCfg.MaxBodyTokens
+		promptOpts.Tokenizer = newTokenizer(modelName, f.logger)
+	}
 	
 	return NewOpenAIClient(
 		client,
-		openaiCfg.ModelName,
-		openaiCfg.MaxTokens,
+		modelName,
+		maxTokens,
 		openaiCfg.Temperature,
 		openaiCfg.TopP,
-		openaiCfg.MaxBodySize,
 		f.logger,
-		f.textProcessor,
+		prompt.NewBuilder(promptOpts, f.textProcessor, f.logger),
+		f.cfg.GetLLM().ReformatOnParseError,
+		f.cfg.GetLLM().RetryOnEmpty,
 	), nil
 }
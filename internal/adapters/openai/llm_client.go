@@ -2,12 +2,12 @@ package openai
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/mikey/llm-spam-filter/internal/core"
-	"github.com/mikey/llm-spam-filter/internal/utils"
+	"github.com/mikey/llm-spam-filter/internal/prompt"
 	"github.com/sashabaranov/go-openai"
 	"go.uber.org/zap"
 )
@@ -19,18 +19,10 @@ type OpenAIClient struct {
 	maxTokens    int
 	temperature  float32
 	topP         float32
-	maxBodySize  int
 	logger       *zap.Logger
-	promptFormat string
-	textProcessor *utils.TextProcessor
-}
-
-// SpamAnalysisResponse represents the structured response from the LLM
-type SpamAnalysisResponse struct {
-	IsSpam      bool    `json:"is_spam"`
-	Score       float64 `json:"score"`
-	Confidence  float64 `json:"confidence"`
-	Explanation string  `json:"explanation"`
+	promptBuilder *prompt.Builder
+	reformatOnParseError bool
+	retryOnEmpty int
 }
 
 // NewOpenAIClient creates a new OpenAI client
@@ -40,9 +32,10 @@ func NewOpenAIClient(
 	maxTokens int,
 	temperature float32,
 	topP float32,
-	maxBodySize int,
 	logger *zap.Logger,
-	textProcessor *utils.TextProcessor,
+	promptBuilder *prompt.Builder,
+	reformatOnParseError bool,
+	retryOnEmpty int,
 ) *OpenAIClient {
 	return &OpenAIClient{
 		client:       client,
@@ -50,44 +43,86 @@ func NewOpenAIClient(
 		maxTokens:    maxTokens,
 		temperature:  temperature,
 		topP:         topP,
-		maxBodySize:  maxBodySize,
 		logger:       logger,
-		textProcessor: textProcessor,
-		promptFormat: `You are a spam detection system. Analyze the following email and determine if it's spam.
-Respond with a JSON object containing:
-- is_spam: boolean (true if spam, false if not)
-- score: number between 0 and 1 (higher means more likely to be spam)
-- confidence: number between 0 and 1 (how confident you are in your assessment)
-- explanation: string (brief explanation of why you think it's spam or not)
-
-Email:
-From: %s
-To: %s
-Subject: %s
-Body:
-%s
-
-Respond only with the JSON object and nothing else.`,
+		promptBuilder: promptBuilder,
+		reformatOnParseError: reformatOnParseError,
+		retryOnEmpty: retryOnEmpty,
 	}
 }
 
 // AnalyzeEmail analyzes an email to determine if it's spam
 func (c *OpenAIClient) AnalyzeEmail(ctx context.Context, email *core.Email) (*core.SpamAnalysisResult, error) {
-	// Format the prompt with email details
-	to := ""
-	if len(email.To) > 0 {
-		to = email.To[0]
-		if len(email.To) > 1 {
-			to += fmt.Sprintf(" and %d others", len(email.To)-1)
+	// Render the prompt with email details
+	req := c.newRequest(c.promptBuilder.Build(email), c.maxTokens)
+	
+	// Call OpenAI API, retrying empty responses if configured
+	var resp openai.ChatCompletionResponse
+	var err error
+	for attempt := 0; ; attempt++ {
+		resp, err = c.client.CreateChatCompletion(ctx, req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create chat completion with OpenAI: %w", err)
+		}
+		if len(resp.Choices) > 0 && strings.TrimSpace(resp.Choices[0].Message.Content) != "" {
+			break
 		}
+		if attempt >= c.retryOnEmpty {
+			return nil, fmt.Errorf("%w from OpenAI", prompt.ErrEmptyResponse)
+		}
+		core.ContextLogger(ctx, c.logger).Warn("Empty response from OpenAI, retrying",
+			zap.Int("attempt", attempt+1),
+			zap.Int("retries", c.retryOnEmpty))
+	}
+
+	// Extract the response text
+	responseText := resp.Choices[0].Message.Content
+
+	// Parse the LLM's JSON response, optionally asking the model to reformat it once
+	analysisResponse, err := c.promptBuilder.ParseResponse(responseText)
+	if err != nil && c.reformatOnParseError {
+		core.ContextLogger(ctx, c.logger).Debug("Asking OpenAI to reformat unparseable response", zap.Error(err))
+		analysisResponse, err = c.reformatResponse(ctx, req, responseText)
+	}
+	if err != nil {
+		return nil, err
 	}
 	
-	// Process the body (truncate and sanitize)
-	processedBody := c.textProcessor.ProcessText(email.Body, c.maxBodySize)
-	
-	prompt := fmt.Sprintf(c.promptFormat, email.From, to, email.Subject, processedBody)
-	
-	// Create the request
+	return c.newResult(analysisResponse, resp.ID), nil
+}
+
+// AnalyzeEmails analyzes several emails in one request, allowing each its
+// own share of the response tokens
+func (c *OpenAIClient) AnalyzeEmails(ctx context.Context, emails []*core.Email) ([]*core.SpamAnalysisResult, error) {
+	// Emails left out of the batch prompt get no result
+	results := make([]*core.SpamAnalysisResult, len(emails))
+	promptText, included := c.promptBuilder.BuildBatch(emails)
+	if len(included) == 0 {
+		return results, nil
+	}
+
+	req := c.newRequest(promptText, c.maxTokens*len(included))
+	resp, err := c.client.CreateChatCompletion(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create batch chat completion with OpenAI: %w", err)
+	}
+	if len(resp.Choices) == 0 || strings.TrimSpace(resp.Choices[0].Message.Content) == "" {
+		return nil, fmt.Errorf("%w from OpenAI", prompt.ErrEmptyResponse)
+	}
+
+	responses, err := c.promptBuilder.ParseBatchResponse(resp.Choices[0].Message.Content, len(included))
+	if err != nil {
+		return nil, err
+	}
+	for i, response := range responses {
+		if response != nil {
+			results[included[i]] = c.newResult(response, resp.ID)
+		}
+	}
+	return results, nil
+}
+
+// newRequest creates a chat completion request for a prompt
+func (c *OpenAIClient) newRequest(promptText string, maxTokens int) openai.ChatCompletionRequest {
 	req := openai.ChatCompletionRequest{
 		Model:       c.modelName,
 		Messages: []openai.ChatCompletionMessage{
@@ -97,10 +132,10 @@ func (c *OpenAIClient) AnalyzeEmail(ctx context.Context, email *core.Email) (*co
 			},
 			{
 				Role:    openai.ChatMessageRoleUser,
-				Content: prompt,
+				Content: promptText,
 			},
 		},
-		MaxTokens:   c.maxTokens,
+		MaxTokens:   maxTokens,
 		Temperature: float32(c.temperature),
 		TopP:        float32(c.topP),
 	}
@@ -110,63 +145,55 @@ func (c *OpenAIClient) AnalyzeEmail(ctx context.Context, email *core.Email) (*co
 		Type: "json",
 	}
 	req.ResponseFormat = &responseFormat
-	
-	// Call OpenAI API
-	resp, err := c.client.CreateChatCompletion(ctx, req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create chat completion with OpenAI: %w", err)
+	return req
+}
+
+// newResult creates the result for a parsed verdict
+func (c *OpenAIClient) newResult(response *prompt.Response, id string) *core.SpamAnalysisResult {
+	return &core.SpamAnalysisResult{
+		IsSpam:      response.IsSpam,
+		Score:       response.Score,
+		Confidence:  response.Confidence,
+		Explanation: response.Explanation,
+		AnalyzedAt:  time.Now(),
+		ModelUsed:   c.modelName,
+		Provider:    "openai",
+		ProcessingID: id,
 	}
+}
 
-	if len(resp.Choices) == 0 {
-		return nil, fmt.Errorf("empty response from OpenAI")
+// Validate checks that OpenAI accepts the API key by looking up the model
+func (c *OpenAIClient) Validate(ctx context.Context) error {
+	if _, err := c.client.GetModel(ctx, c.modelName); err != nil {
+		return fmt.Errorf("failed to look up OpenAI model %s: %w", c.modelName, err)
 	}
+	return nil
+}
 
-	// Extract the response text
-	responseText := resp.Choices[0].Message.Content
+// reformatResponse asks the model to restate an unparseable answer as the
+// required JSON object, continuing the original conversation
+func (c *OpenAIClient) reformatResponse(ctx context.Context, req openai.ChatCompletionRequest, responseText string) (*prompt.Response, error) {
+	messages := make([]openai.ChatCompletionMessage, 0, len(req.Messages)+2)
+	messages = append(messages, req.Messages...)
+	messages = append(messages,
+		openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleAssistant,
+			Content: responseText,
+		},
+		openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleUser,
+			Content: c.promptBuilder.ReformatPrompt(),
+		},
+	)
+	req.Messages = messages
 
-	// Parse the LLM's JSON response
-	var analysisResponse SpamAnalysisResponse
-	if err := json.Unmarshal([]byte(responseText), &analysisResponse); err != nil {
-		// Try to extract JSON from the text response
-		jsonStart := 0
-		jsonEnd := len(responseText)
-		
-		// Find JSON start
-		for i := 0; i < len(responseText); i++ {
-			if responseText[i] == '{' {
-				jsonStart = i
-				break
-			}
-		}
-		
-		// Find JSON end
-		for i := len(responseText) - 1; i >= 0; i-- {
-			if responseText[i] == '}' {
-				jsonEnd = i + 1
-				break
-			}
-		}
-		
-		if jsonStart < jsonEnd {
-			jsonStr := responseText[jsonStart:jsonEnd]
-			if err := json.Unmarshal([]byte(jsonStr), &analysisResponse); err != nil {
-				return nil, fmt.Errorf("failed to parse LLM response as JSON: %w", err)
-			}
-		} else {
-			return nil, fmt.Errorf("failed to extract JSON from LLM response: %w", err)
-		}
+	resp, err := c.client.CreateChatCompletion(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reformat response with OpenAI: %w", err)
 	}
-	
-	// Create the result
-	result := &core.SpamAnalysisResult{
-		IsSpam:      analysisResponse.IsSpam,
-		Score:       analysisResponse.Score,
-		Confidence:  analysisResponse.Confidence,
-		Explanation: analysisResponse.Explanation,
-		AnalyzedAt:  time.Now(),
-		ModelUsed:   c.modelName,
-		ProcessingID: resp.ID,
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("empty reformat response from OpenAI")
 	}
-	
-	return result, nil
+
+	return c.promptBuilder.ParseResponse(resp.Choices[0].Message.Content)
 }
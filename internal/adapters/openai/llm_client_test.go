@@ -0,0 +1,184 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"github.com/mikey/llm-spam-filter/internal/prompt"
+	"github.com/mikey/llm-spam-filter/internal/utils"
+	"github.com/sashabaranov/go-openai"
+	"go.uber.org/zap"
+)
+
+// fakeAPI is a chat completions endpoint answering with one queued message
+// content per request, repeating the last, and recording the requests
+type fakeAPI struct {
+	mu       sync.Mutex
+	contents []string
+	requests []openai.ChatCompletionRequest
+}
+
+func (a *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req openai.ChatCompletionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	a.mu.Lock()
+	a.requests = append(a.requests, req)
+	content := a.contents[0]
+	if len(a.contents) > 1 {
+		a.contents = a.contents[1:]
+	}
+	a.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+		ID: "chatcmpl-test",
+		Choices: []openai.ChatCompletionChoice{{
+			Message: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: content},
+		}},
+	})
+}
+
+// newTestClient creates a client for the fake API
+func newTestClient(t *testing.T, api *fakeAPI, reformatOnParseError bool, retryOnEmpty int) *OpenAIClient {
+	t.Helper()
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+
+	config := openai.DefaultConfig("test-key")
+	config.BaseURL = server.URL + "/v1"
+
+	logger := zap.NewNop()
+	builder := prompt.NewBuilder(prompt.Options{}, utils.NewTextProcessor(logger), logger)
+	return NewOpenAIClient(openai.NewClientWithConfig(config), "gpt-test", 256, 0.1, 0.9, logger, builder, reformatOnParseError, retryOnEmpty)
+}
+
+// testEmail returns a plain email
+func testEmail() *core.Email {
+	return &core.Email{
+		From:    "sender@example.com",
+		To:      []string{"user@example.org"},
+		Subject: "Hello",
+		Body:    "Just checking in about the meeting next week.",
+		Headers: map[string][]string{},
+	}
+}
+
+const spamVerdict = `{"is_spam": true, "score": 0.92, "confidence": 0.8, "explanation": "Phishing"}`
+
+func TestReformatsProseResponse(t *testing.T) {
+	api := &fakeAPI{contents: []string{"This looks like phishing to me, so I'd call it spam.", spamVerdict}}
+
+	result, err := newTestClient(t, api, true, 0).AnalyzeEmail(context.Background(), testEmail())
+	if err != nil {
+		t.Fatalf("AnalyzeEmail() error = %v", err)
+	}
+	if !result.IsSpam || result.Score != 0.92 {
+		t.Errorf("result = %+v, want the reformatted spam verdict", result)
+	}
+
+	if len(api.requests) != 2 {
+		t.Fatalf("got %d requests, want the analysis and one reformat", len(api.requests))
+	}
+	messages := api.requests[1].Messages
+	if len(messages) != 4 {
+		t.Fatalf("reformat request has %d messages, want the original conversation and the reformat prompt", len(messages))
+	}
+	if messages[2].Role != openai.ChatMessageRoleAssistant || messages[2].Content != "This looks like phishing to me, so I'd call it spam." {
+		t.Errorf("reformat request doesn't carry the unparseable answer: %+v", messages[2])
+	}
+}
+
+func TestProseResponseFailsWithoutReformat(t *testing.T) {
+	api := &fakeAPI{contents: []string{"This looks like phishing to me.", spamVerdict}}
+
+	if _, err := newTestClient(t, api, false, 0).AnalyzeEmail(context.Background(), testEmail()); err == nil {
+		t.Error("AnalyzeEmail() succeeded, want a parse error")
+	}
+	if len(api.requests) != 1 {
+		t.Errorf("got %d requests, want no reformat", len(api.requests))
+	}
+}
+
+func TestRequestUsesConfiguredMaxTokens(t *testing.T) {
+	api := &fakeAPI{contents: []string{spamVerdict}}
+	if _, err := newTestClient(t, api, false, 0).AnalyzeEmail(context.Background(), testEmail()); err != nil {
+		t.Fatalf("AnalyzeEmail() error = %v", err)
+	}
+	if len(api.requests) != 1 || api.requests[0].MaxTokens != 256 {
+		t.Errorf("requests = %+v, want one with max tokens 256", api.requests)
+	}
+}
+
+func TestRetriesEmptyResponse(t *testing.T) {
+	api := &fakeAPI{contents: []string{"", spamVerdict}}
+	result, err := newTestClient(t, api, false, 1).AnalyzeEmail(context.Background(), testEmail())
+	if err != nil {
+		t.Fatalf("AnalyzeEmail() error = %v", err)
+	}
+	if !result.IsSpam || len(api.requests) != 2 {
+		t.Errorf("got %+v after %d requests, want the retried verdict after 2", result, len(api.requests))
+	}
+}
+
+func TestEmptyResponseFailsAfterRetries(t *testing.T) {
+	api := &fakeAPI{contents: []string{" "}}
+	_, err := newTestClient(t, api, true, 2).AnalyzeEmail(context.Background(), testEmail())
+	if !errors.Is(err, prompt.ErrEmptyResponse) {
+		t.Errorf("AnalyzeEmail() error = %v, want ErrEmptyResponse", err)
+	}
+	if errors.Is(err, prompt.ErrInvalidResponse) {
+		t.Errorf("AnalyzeEmail() error = %v, want it distinct from a parse failure", err)
+	}
+	// An empty response is not reformatted
+	if len(api.requests) != 3 {
+		t.Errorf("got %d requests, want the first and two retries", len(api.requests))
+	}
+}
+
+// keyCheckingAPI is a models endpoint that only accepts the API key
+// "valid-key", rejecting others as OpenAI does
+func keyCheckingAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Header.Get("Authorization") != "Bearer valid-key" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error": {"message": "Incorrect API key provided", "type": "invalid_request_error", "code": "invalid_api_key"}}`))
+		return
+	}
+	json.NewEncoder(w).Encode(openai.Model{ID: "gpt-test", Object: "model", OwnedBy: "openai"})
+}
+
+func TestValidateReportsRejectedKey(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(keyCheckingAPI))
+	t.Cleanup(server.Close)
+
+	for _, tt := range []struct {
+		key     string
+		wantErr bool
+	}{
+		{"valid-key", false},
+		{"revoked-key", true},
+	} {
+		t.Run(tt.key, func(t *testing.T) {
+			config := openai.DefaultConfig(tt.key)
+			config.BaseURL = server.URL + "/v1"
+			logger := zap.NewNop()
+			builder := prompt.NewBuilder(prompt.Options{}, utils.NewTextProcessor(logger), logger)
+			client := NewOpenAIClient(openai.NewClientWithConfig(config), "gpt-test", 256, 0.1, 0.9, logger, builder, false, 0)
+
+			err := client.Validate(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package openai
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"github.com/sashabaranov/go-openai"
+	"go.uber.org/zap"
+)
+
+// retryAfterDoer retries requests rejected with 429 Too Many Requests that
+// carry a Retry-After header, waiting the requested delay up to a cap. The
+// OpenAI client drops response headers from its errors, so this sits
+// between it and the HTTP client.
+type retryAfterDoer struct {
+	doer     openai.HTTPDoer
+	retries  int
+	maxDelay time.Duration
+	logger   *zap.Logger
+}
+
+// newRetryAfterDoer wraps doer to retry rate limited requests up to retries
+// times, waiting at most maxDelay before each retry
+func newRetryAfterDoer(doer openai.HTTPDoer, retries int, maxDelay time.Duration, logger *zap.Logger) *retryAfterDoer {
+	return &retryAfterDoer{
+		doer:     doer,
+		retries:  retries,
+		maxDelay: maxDelay,
+		logger:   logger,
+	}
+}
+
+// Do sends the request, retrying it after the delay the provider asks for
+// while it is rate limited. A 429 without a usable Retry-After, or whose
+// delay would pass the request's deadline, is returned as is.
+func (d *retryAfterDoer) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	for attempt := 0; ; attempt++ {
+		resp, err := d.doer.Do(req)
+		if err != nil || resp.StatusCode != http.StatusTooManyRequests || attempt >= d.retries {
+			return resp, err
+		}
+		if req.Body != nil && req.GetBody == nil {
+			return resp, nil
+		}
+
+		delay, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		if !ok {
+			return resp, nil
+		}
+		delay = min(delay, d.maxDelay)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return resp, nil
+		}
+
+		// Drain the response so its connection can be reused
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		core.ContextLogger(ctx, d.logger).Warn("Rate limited by OpenAI, retrying after delay",
+			zap.Duration("delay", delay),
+			zap.Int("attempt", attempt+1),
+			zap.Int("retries", d.retries))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(ctx)
+			req.Body = body
+		}
+	}
+}
+
+// parseRetryAfter parses a Retry-After value, either a number of seconds or
+// an HTTP date, into the delay from now
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	at, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	return max(at.Sub(now), 0), true
+}
@@ -0,0 +1,117 @@
+package openai
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// rateLimitedDoer answers with 429 and the given Retry-After until limited
+// requests have been made, then with 200, recording each request body and
+// when it was sent
+type rateLimitedDoer struct {
+	limited    int
+	retryAfter string
+	bodies     []string
+	sent       []time.Time
+}
+
+func (d *rateLimitedDoer) Do(req *http.Request) (*http.Response, error) {
+	body, _ := io.ReadAll(req.Body)
+	d.bodies = append(d.bodies, string(body))
+	d.sent = append(d.sent, time.Now())
+
+	resp := &http.Response{StatusCode: http.StatusOK, Header: make(http.Header), Body: io.NopCloser(strings.NewReader("{}"))}
+	if len(d.sent) <= d.limited {
+		resp.StatusCode = http.StatusTooManyRequests
+		resp.Header.Set("Retry-After", d.retryAfter)
+	}
+	return resp, nil
+}
+
+// doRequest sends a POST through a retryAfterDoer wrapping d
+func doRequest(t *testing.T, ctx context.Context, d *rateLimitedDoer, maxDelay time.Duration) *http.Response {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://openai.test/v1/chat/completions", strings.NewReader(`{"model":"gpt-test"}`))
+	if err != nil {
+		t.Fatalf("NewRequest() error = %v", err)
+	}
+	resp, err := newRetryAfterDoer(d, 2, maxDelay, zap.NewNop()).Do(req)
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	return resp
+}
+
+func TestRetryAfterDrivesWait(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter string
+		maxDelay   time.Duration
+		wait       time.Duration
+	}{
+		{"honored", "1", 5 * time.Second, time.Second},
+		{"capped", "30", 100 * time.Millisecond, 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &rateLimitedDoer{limited: 1, retryAfter: tt.retryAfter}
+			resp := doRequest(t, context.Background(), d, tt.maxDelay)
+
+			if resp.StatusCode != http.StatusOK || len(d.sent) != 2 {
+				t.Fatalf("got status %d after %d requests, want 200 after one retry", resp.StatusCode, len(d.sent))
+			}
+			if wait := d.sent[1].Sub(d.sent[0]); wait < tt.wait || wait > tt.wait+500*time.Millisecond {
+				t.Errorf("waited %v before retrying, want about %v", wait, tt.wait)
+			}
+			if d.bodies[1] != d.bodies[0] {
+				t.Errorf("retried body = %q, want the original %q", d.bodies[1], d.bodies[0])
+			}
+		})
+	}
+}
+
+func TestRetryAfterPastDeadlineIsNotWaited(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	d := &rateLimitedDoer{limited: 1, retryAfter: "10"}
+
+	if resp := doRequest(t, ctx, d, time.Minute); resp.StatusCode != http.StatusTooManyRequests || len(d.sent) != 1 {
+		t.Errorf("got status %d after %d requests, want the 429 returned at once", resp.StatusCode, len(d.sent))
+	}
+}
+
+func TestRetryAfterGivesUpAfterRetries(t *testing.T) {
+	d := &rateLimitedDoer{limited: 5, retryAfter: "0"}
+	if resp := doRequest(t, context.Background(), d, time.Second); resp.StatusCode != http.StatusTooManyRequests || len(d.sent) != 3 {
+		t.Errorf("got status %d after %d requests, want the 429 after 2 retries", resp.StatusCode, len(d.sent))
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		delay time.Duration
+		ok    bool
+	}{
+		{"3", 3 * time.Second, true},
+		{" 0 ", 0, true},
+		{now.Add(30 * time.Second).Format(http.TimeFormat), 30 * time.Second, true},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+		{"", 0, false},
+		{"-1", 0, false},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		delay, ok := parseRetryAfter(tt.value, now)
+		if delay != tt.delay || ok != tt.ok {
+			t.Errorf("parseRetryAfter(%q) = %v, %t, want %v, %t", tt.value, delay, ok, tt.delay, tt.ok)
+		}
+	}
+}
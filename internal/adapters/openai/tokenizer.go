@@ -0,0 +1,42 @@
+package openai
+
+import (
+	"sync"
+
+	"github.com/mikey/llm-spam-filter/internal/utils"
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+	"go.uber.org/zap"
+)
+
+// useOfflineBPE loads BPE ranks from the files embedded in the binary,
+// rather than downloading them on first use
+var useOfflineBPE sync.Once
+
+// bpeTokenizer counts tokens with a model's BPE encoding
+type bpeTokenizer struct {
+	encoding *tiktoken.Tiktoken
+}
+
+// CountTokens returns the number of tokens the model's encoding produces
+// for text. Special tokens appearing in text are counted as ordinary text.
+func (t bpeTokenizer) CountTokens(text string) int {
+	return len(t.encoding.Encode(text, nil, nil))
+}
+
+// newTokenizer returns a tokenizer for the model: its BPE encoding if the
+// model is known, or the heuristic estimate otherwise
+func newTokenizer(model string, logger *zap.Logger) utils.Tokenizer {
+	useOfflineBPE.Do(func() {
+		tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+	})
+
+	encoding, err := tiktoken.EncodingForModel(model)
+	if err != nil {
+		logger.Warn("No tokenizer for model, estimating token counts",
+			zap.String("model", model),
+			zap.Error(err))
+		return utils.HeuristicTokenizer{}
+	}
+	return bpeTokenizer{encoding: encoding}
+}
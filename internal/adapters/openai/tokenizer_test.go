@@ -0,0 +1,49 @@
+package openai
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mikey/llm-spam-filter/internal/utils"
+	"go.uber.org/zap"
+)
+
+func TestTokenizerTruncatesCJKByTokenCount(t *testing.T) {
+	tokenizer := newTokenizer("gpt-4", zap.NewNop())
+	if _, ok := tokenizer.(bpeTokenizer); !ok {
+		t.Fatalf("newTokenizer(gpt-4) = %T, want the BPE tokenizer", tokenizer)
+	}
+
+	body := strings.Repeat("恭喜您获得免费奖品，请立即点击链接领取。", 50)
+	const maxTokens = 100
+	if count := tokenizer.CountTokens(body); count <= maxTokens {
+		t.Fatalf("CountTokens(body) = %d, want more than %d for the test to truncate", count, maxTokens)
+	}
+
+	processor := utils.NewTextProcessor(zap.NewNop())
+	truncated := processor.TruncateTokens(body, maxTokens, tokenizer)
+	text, marked := strings.CutSuffix(truncated, "\n[... Content truncated due to size limits ...]")
+	if !marked {
+		t.Fatalf("TruncateTokens() = %q, want the truncation marker", truncated)
+	}
+	if !strings.HasPrefix(body, text) {
+		t.Fatal("truncated text is not a prefix of the body")
+	}
+	count := tokenizer.CountTokens(text)
+	if count > maxTokens {
+		t.Errorf("truncated text has %d tokens, want at most %d", count, maxTokens)
+	}
+	// The cut is the longest prefix within budget, so one more character
+	// must exceed it
+	next := body[:len(text)+len(string([]rune(body[len(text):])[0]))]
+	if tokenizer.CountTokens(next) <= maxTokens {
+		t.Errorf("truncated text has %d tokens, but a longer prefix fits in %d", count, maxTokens)
+	}
+}
+
+func TestTokenizerFallsBackToHeuristicForUnknownModels(t *testing.T) {
+	tokenizer := newTokenizer("not-a-real-model", zap.NewNop())
+	if _, ok := tokenizer.(utils.HeuristicTokenizer); !ok {
+		t.Errorf("newTokenizer(unknown) = %T, want the heuristic tokenizer", tokenizer)
+	}
+}
@@ -0,0 +1,134 @@
+package reputation
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// minWeight is the decayed weight below which a sender's history is discarded
+const minWeight = 0.01
+
+// senderHistory holds the exponentially decayed verdict weights for a sender
+type senderHistory struct {
+	spamWeight  float64
+	totalWeight float64
+	updatedAt   time.Time
+}
+
+// MemoryStore is an in-memory implementation of the ReputationStore interface.
+// Each verdict's weight halves every half-life, so recent verdicts dominate.
+type MemoryStore struct {
+	senders  map[string]*senderHistory
+	mu       sync.Mutex
+	logger   *zap.Logger
+	halfLife time.Duration
+	stopCh   chan struct{}
+}
+
+// NewMemoryStore creates a new in-memory reputation store
+func NewMemoryStore(logger *zap.Logger, halfLife time.Duration) *MemoryStore {
+	store := &MemoryStore{
+		senders:  make(map[string]*senderHistory),
+		logger:   logger,
+		halfLife: halfLife,
+		stopCh:   make(chan struct{}),
+	}
+
+	// Start background pruning
+	go store.startPruneTask()
+
+	return store
+}
+
+// Record adds a verdict to the sender's reputation
+func (s *MemoryStore) Record(sender string, isSpam bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	history, ok := s.senders[sender]
+	if !ok {
+		history = &senderHistory{}
+		s.senders[sender] = history
+	}
+	s.decay(history, now)
+
+	history.totalWeight++
+	if isSpam {
+		history.spamWeight++
+	}
+}
+
+// SpamRatio returns the decayed ratio of spam verdicts for a sender, and
+// whether the sender has any history
+func (s *MemoryStore) SpamRatio(sender string) (float64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	history, ok := s.senders[sender]
+	if !ok {
+		return 0, false
+	}
+	s.decay(history, time.Now())
+	if history.totalWeight < minWeight {
+		return 0, false
+	}
+
+	return history.spamWeight / history.totalWeight, true
+}
+
+// decay applies exponential decay to a sender's history up to now
+func (s *MemoryStore) decay(history *senderHistory, now time.Time) {
+	if !history.updatedAt.IsZero() && s.halfLife > 0 {
+		elapsed := now.Sub(history.updatedAt)
+		factor := math.Pow(0.5, float64(elapsed)/float64(s.halfLife))
+		history.spamWeight *= factor
+		history.totalWeight *= factor
+	}
+	history.updatedAt = now
+}
+
+// Prune removes senders whose history has decayed away
+func (s *MemoryStore) Prune() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	pruned := 0
+	for sender, history := range s.senders {
+		s.decay(history, now)
+		if history.totalWeight < minWeight {
+			delete(s.senders, sender)
+			pruned++
+		}
+	}
+
+	s.logger.Debug("Pruned decayed sender reputations", zap.Int("pruned_count", pruned))
+}
+
+// startPruneTask starts a background task to prune decayed senders
+func (s *MemoryStore) startPruneTask() {
+	if s.halfLife <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.halfLife)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.Prune()
+		case <-s.stopCh:
+			return
+		}
+	}
+}
+
+// Stop stops the background pruning task
+func (s *MemoryStore) Stop() {
+	close(s.stopCh)
+}
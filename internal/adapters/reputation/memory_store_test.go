@@ -0,0 +1,60 @@
+package reputation
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestSpamRatio(t *testing.T) {
+	store := NewMemoryStore(zap.NewNop(), time.Hour)
+	defer store.Stop()
+
+	if _, found := store.SpamRatio("sender@example.com"); found {
+		t.Error("unknown sender has a reputation")
+	}
+
+	store.Record("sender@example.com", true)
+	store.Record("sender@example.com", true)
+	store.Record("sender@example.com", true)
+	store.Record("sender@example.com", false)
+	ratio, found := store.SpamRatio("sender@example.com")
+	if !found || ratio < 0.74 || ratio > 0.76 {
+		t.Errorf("SpamRatio() = %v, %t, want about 0.75", ratio, found)
+	}
+}
+
+func TestRecentVerdictsDominate(t *testing.T) {
+	store := NewMemoryStore(zap.NewNop(), time.Hour)
+	defer store.Stop()
+
+	// Three spam verdicts two half-lives ago count as much as one today
+	for i := 0; i < 3; i++ {
+		store.Record("sender@example.com", true)
+	}
+	store.senders["sender@example.com"].updatedAt = time.Now().Add(-2 * time.Hour)
+	store.Record("sender@example.com", false)
+
+	ratio, _ := store.SpamRatio("sender@example.com")
+	if ratio < 0.42 || ratio > 0.44 {
+		t.Errorf("SpamRatio() = %v, want about 0.43", ratio)
+	}
+}
+
+func TestPruneForgetsDecayedSenders(t *testing.T) {
+	store := NewMemoryStore(zap.NewNop(), time.Hour)
+	defer store.Stop()
+
+	store.Record("old@example.com", true)
+	store.Record("new@example.com", true)
+	store.senders["old@example.com"].updatedAt = time.Now().Add(-10 * time.Hour)
+
+	store.Prune()
+	if _, found := store.SpamRatio("old@example.com"); found {
+		t.Error("decayed sender was not pruned")
+	}
+	if _, found := store.SpamRatio("new@example.com"); !found {
+		t.Error("recent sender was pruned")
+	}
+}
@@ -0,0 +1,115 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"go.uber.org/zap"
+)
+
+// Route sends mail from senders whose domain matches Pattern to Client.
+// Pattern is a domain, or a glob such as *.example.com.
+type Route struct {
+	Pattern string
+	Name    string
+	Client  core.LLMClient
+}
+
+// Client is an implementation of the LLMClient interface that dispatches
+// each analysis to a client chosen by the sender's domain, so that mail
+// from some senders can go to a cheaper or more accurate provider
+type Client struct {
+	routes       []Route
+	fallback     core.LLMClient
+	fallbackName string
+	logger       *zap.Logger
+}
+
+// NewClient creates a new routing client. Routes are tried in order, and
+// mail matching none of them goes to the fallback client.
+func NewClient(routes []Route, fallback core.LLMClient, fallbackName string, logger *zap.Logger) (*Client, error) {
+	if fallback == nil {
+		return nil, errors.New("routing requires a fallback client")
+	}
+
+	normalized := make([]Route, len(routes))
+	for i, route := range routes {
+		route.Pattern = strings.ToLower(strings.TrimSpace(route.Pattern))
+		if route.Pattern == "" || route.Client == nil {
+			return nil, fmt.Errorf("route %d needs a domain pattern and a client", i+1)
+		}
+		if _, err := path.Match(route.Pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid route pattern %q: %w", route.Pattern, err)
+		}
+		normalized[i] = route
+	}
+
+	return &Client{
+		routes:       normalized,
+		fallback:     fallback,
+		fallbackName: fallbackName,
+		logger:       logger,
+	}, nil
+}
+
+// AnalyzeEmail analyzes an email with the client routed for its sender
+func (c *Client) AnalyzeEmail(ctx context.Context, email *core.Email) (*core.SpamAnalysisResult, error) {
+	client, name := c.route(senderDomain(email.From))
+	core.ContextLogger(ctx, c.logger).Debug("Routed analysis",
+		zap.String("from", email.From),
+		zap.String("route", name))
+
+	return client.AnalyzeEmail(ctx, email)
+}
+
+// route returns the client for a sender domain and the name of its route
+func (c *Client) route(domain string) (core.LLMClient, string) {
+	if domain != "" {
+		for _, route := range c.routes {
+			if matched, _ := path.Match(route.Pattern, domain); matched {
+				return route.Client, route.Name
+			}
+		}
+	}
+	return c.fallback, c.fallbackName
+}
+
+// senderDomain returns the lowercased domain of a sender address
+func senderDomain(from string) string {
+	at := strings.LastIndex(from, "@")
+	if at < 0 {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(strings.TrimSuffix(from[at+1:], ">")))
+}
+
+// Close closes the routed clients that hold resources, closing a client
+// shared by several routes only once
+func (c *Client) Close() error {
+	closed := make(map[core.LLMClient]bool)
+	var errs []error
+	for _, client := range append([]core.LLMClient{c.fallback}, c.clients()...) {
+		if closed[client] {
+			continue
+		}
+		closed[client] = true
+		if closer, ok := client.(interface{ Close() error }); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *Client) clients() []core.LLMClient {
+	clients := make([]core.LLMClient, len(c.routes))
+	for i, route := range c.routes {
+		clients[i] = route.Client
+	}
+	return clients
+}
@@ -0,0 +1,93 @@
+package router
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"go.uber.org/zap"
+)
+
+// namedClient is an LLMClient answering with its name as the provider
+type namedClient struct {
+	name   string
+	closed int
+}
+
+func (c *namedClient) AnalyzeEmail(ctx context.Context, email *core.Email) (*core.SpamAnalysisResult, error) {
+	return &core.SpamAnalysisResult{Provider: c.name}, nil
+}
+
+func (c *namedClient) Close() error {
+	c.closed++
+	return nil
+}
+
+func TestRoutedDomainUsesMappedProvider(t *testing.T) {
+	gemini := &namedClient{name: "gemini"}
+	bedrock := &namedClient{name: "bedrock"}
+	openai := &namedClient{name: "openai"}
+	client, err := NewClient([]Route{
+		{Pattern: "Example.COM", Name: "gemini", Client: gemini},
+		{Pattern: "*.example.net", Name: "bedrock", Client: bedrock},
+	}, openai, "openai", zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	tests := []struct {
+		from     string
+		provider string
+	}{
+		{"sender@example.com", "gemini"},
+		{"Sender <sender@EXAMPLE.com>", "gemini"},
+		{"sender@mail.example.net", "bedrock"},
+		{"sender@example.net", "openai"},
+		{"sender@example.org", "openai"},
+		{"no address", "openai"},
+	}
+	for _, tt := range tests {
+		result, err := client.AnalyzeEmail(context.Background(), &core.Email{From: tt.from})
+		if err != nil {
+			t.Fatalf("AnalyzeEmail() error = %v", err)
+		}
+		if result.Provider != tt.provider {
+			t.Errorf("AnalyzeEmail(%q) used %s, want %s", tt.from, result.Provider, tt.provider)
+		}
+	}
+}
+
+func TestCloseClosesSharedClientOnce(t *testing.T) {
+	shared := &namedClient{name: "openai"}
+	client, err := NewClient([]Route{
+		{Pattern: "example.com", Name: "openai", Client: shared},
+		{Pattern: "example.net", Name: "openai", Client: shared},
+	}, shared, "openai", zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	if err := client.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if shared.closed != 1 {
+		t.Errorf("shared client closed %d times, want 1", shared.closed)
+	}
+}
+
+func TestNewClientValidatesRoutes(t *testing.T) {
+	fallback := &namedClient{name: "openai"}
+	invalid := [][]Route{
+		{{Pattern: "", Client: fallback}},
+		{{Pattern: "example.com"}},
+		{{Pattern: "[example.com", Client: fallback}},
+	}
+	for _, routes := range invalid {
+		if _, err := NewClient(routes, fallback, "openai", zap.NewNop()); err == nil {
+			t.Errorf("NewClient(%+v) succeeded, want an error", routes)
+		}
+	}
+	if _, err := NewClient(nil, nil, "", zap.NewNop()); err == nil {
+		t.Error("NewClient() without a fallback succeeded, want an error")
+	}
+}
@@ -2,26 +2,69 @@ package config
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/spf13/viper"
 )
 
+// configFormats are the supported config file formats
+var configFormats = map[string]bool{
+	"yaml": true,
+	"yml":  true,
+	"toml": true,
+	"json": true,
+}
+
 // Config represents the application configuration
 type Config struct {
 	v *viper.Viper
 }
 
-// New creates a new configuration instance
+// New creates a new configuration instance, loading the file named by the
+// SPAM_FILTER_CONFIG environment variable if set, or searching the default
+// config paths otherwise
 func New() (*Config, error) {
+	return NewWithPath(os.Getenv("SPAM_FILTER_CONFIG"))
+}
+
+// NewWithPath creates a new configuration instance from an explicit config
+// file path. An empty path falls back to searching the default config paths.
+// The format is taken from SPAM_FILTER_CONFIG_FORMAT if set, or from the
+// file's extension otherwise, defaulting to YAML.
+func NewWithPath(path string) (*Config, error) {
+	format := strings.ToLower(strings.TrimSpace(os.Getenv("SPAM_FILTER_CONFIG_FORMAT")))
+	if format != "" && !configFormats[format] {
+		return nil, fmt.Errorf("unsupported config format %q, expected yaml, toml or json", format)
+	}
+
 	v := viper.New()
-	v.SetConfigName("config")
-	v.SetConfigType("yaml")
-	v.AddConfigPath("/etc/llm-spam-filter/")
-	v.AddConfigPath("$HOME/.llm-spam-filter")
-	v.AddConfigPath("./configs")
-	v.AddConfigPath(".")
+	if path != "" {
+		if _, err := os.Stat(path); err != nil {
+			return nil, fmt.Errorf("config file %s does not exist: %w", path, err)
+		}
+		if format == "" {
+			format = "yaml"
+			if ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), ".")); configFormats[ext] {
+				format = ext
+			}
+		}
+		v.SetConfigType(format)
+		v.SetConfigFile(path)
+	} else {
+		// The search finds config.yaml, config.toml or config.json, and
+		// reads each by its extension unless a format is set
+		if format != "" {
+			v.SetConfigType(format)
+		}
+		v.SetConfigName("config")
+		v.AddConfigPath("/etc/llm-spam-filter/")
+		v.AddConfigPath("$HOME/.llm-spam-filter")
+		v.AddConfigPath("./configs")
+		v.AddConfigPath(".")
+	}
 
 	// Set defaults
 	setDefaults(v)
@@ -58,62 +101,234 @@ func NewEmptyViper() *viper.Viper {
 func setDefaults(v *viper.Viper) {
 	// LLM provider defaults
 	v.SetDefault("llm.provider", "bedrock")
+	v.SetDefault("llm.reformat_on_parse_error", false)
+	v.SetDefault("llm.retry_on_empty", 0)
+	v.SetDefault("llm.rate_limit_retries", 0)
+	v.SetDefault("llm.max_retry_after", "10s")
+	v.SetDefault("llm.batch_max", 0)
+	v.SetDefault("llm.batch_window", "200ms")
+	v.SetDefault("llm.error_samples", 0)
+	v.SetDefault("llm.validate_on_start", "off")
+	v.SetDefault("llm.max_prompt_tokens", 0)
+	v.SetDefault("llm.request_timeout", "0s")
+	v.SetDefault("llm.model_strategy", "primary")
+	v.SetDefault("llm.concurrency_mode", "wait")
+	v.SetDefault("llm.routes", []map[string]string{})
+	v.SetDefault("llm.consensus", []map[string]interface{}{})
+	v.SetDefault("llm.response_fields", map[string][]string{})
+	v.SetDefault("llm.score_calibration", map[string]interface{}{})
 	
 	// Server defaults
 	v.SetDefault("server.filter_type", "postfix")
+	v.SetDefault("server.filter_types", []string{})
 	v.SetDefault("server.listen_address", "0.0.0.0:10025")
 	v.SetDefault("server.block_spam", false)
+	v.SetDefault("server.block_schedule", []string{})
+	v.SetDefault("server.block_schedule_timezone", "Local")
 	v.SetDefault("server.headers.spam", "X-Spam-Status")
 	v.SetDefault("server.headers.score", "X-Spam-Score")
 	v.SetDefault("server.headers.reason", "X-Spam-Reason")
+	v.SetDefault("server.headers.skipped", "X-Spam-Skipped")
+	v.SetDefault("server.headers.bulk", "X-Spam-Bulk")
+	v.SetDefault("server.headers.id", "X-Spam-ID")
+	v.SetDefault("server.headers.trace", "X-Spam-Trace")
 	v.SetDefault("server.postfix.enabled", true)
 	v.SetDefault("server.postfix.address", "127.0.0.1")
 	v.SetDefault("server.postfix.port", 10026)
+	v.SetDefault("server.next_hop.host", "")
+	v.SetDefault("server.next_hop.port", 0)
+	v.SetDefault("server.next_hop.starttls", false)
+	v.SetDefault("server.next_hop.tls_skip_verify", false)
+	v.SetDefault("server.next_hop.username", "")
+	v.SetDefault("server.next_hop.password", "")
+	v.SetDefault("server.postfix_retries", 3)
+	v.SetDefault("server.postfix_retry_delay", "1s")
+	v.SetDefault("server.spamassassin_compat", false)
 	v.SetDefault("server.modify_subject", true)
 	v.SetDefault("server.subject_prefix", "[**SPAM**] ")
+	v.SetDefault("server.subject_prefix_min_score", 0.0)
+	v.SetDefault("server.fold_headers", false)
+	v.SetDefault("server.headers_on_error", "all")
+	v.SetDefault("server.helo_hostname", "")
+	v.SetDefault("server.require_auth", false)
+	v.SetDefault("server.auth.username", "")
+	v.SetDefault("server.auth.password", "")
+	v.SetDefault("server.auth.htpasswd_file", "")
 	
 	// CLI defaults
 	v.SetDefault("cli.verbose", false)
+	v.SetDefault("cli.timeout", "60s")
 	
 	// Bedrock defaults
 	v.SetDefault("bedrock.region", "us-east-1")
 	v.SetDefault("bedrock.model_id", "anthropic.claude-v2")
-	v.SetDefault("bedrock.max_tokens", 1000)
+	v.SetDefault("bedrock.models", []string{})
+	v.SetDefault("bedrock.max_tokens", 0)
 	v.SetDefault("bedrock.temperature", 0.1)
 	v.SetDefault("bedrock.top_p", 0.9)
 	v.SetDefault("bedrock.max_body_size", 4096)
+	v.SetDefault("bedrock.max_concurrent", 0)
 	
 	// Gemini defaults
 	v.SetDefault("gemini.api_key", "")
 	v.SetDefault("gemini.model_name", "gemini-pro")
-	v.SetDefault("gemini.max_tokens", 1000)
+	v.SetDefault("gemini.models", []string{})
+	v.SetDefault("gemini.max_tokens", 0)
 	v.SetDefault("gemini.temperature", 0.1)
 	v.SetDefault("gemini.top_p", 0.9)
 	v.SetDefault("gemini.max_body_size", 4096)
+	v.SetDefault("gemini.max_concurrent", 0)
+	v.SetDefault("gemini.safety_block_threshold", "none")
 	
 	// OpenAI defaults
 	v.SetDefault("openai.api_key", "")
 	v.SetDefault("openai.model_name", "gpt-4")
-	v.SetDefault("openai.max_tokens", 1000)
+	v.SetDefault("openai.models", []string{})
+	v.SetDefault("openai.max_tokens", 0)
 	v.SetDefault("openai.temperature", 0.1)
 	v.SetDefault("openai.top_p", 0.9)
 	v.SetDefault("openai.max_body_size", 4096)
+	v.SetDefault("openai.max_concurrent", 0)
+	v.SetDefault("openai.tokenizer_truncation", false)
+	v.SetDefault("openai.max_body_tokens", 1024)
+	
+	// External gRPC classifier defaults
+	v.SetDefault("grpc.address", "")
+	v.SetDefault("grpc.tls", false)
+	v.SetDefault("grpc.max_concurrent", 0)
 	
 	// Spam defaults
 	v.SetDefault("spam.threshold", 0.7)
 	v.SetDefault("spam.whitelisted_domains", []string{})
+	v.SetDefault("spam.skip_content_types", []string{})
+	v.SetDefault("spam.dangerous_extensions", []string{})
+	v.SetDefault("spam.trusted_networks", []string{})
+	v.SetDefault("spam.evaluation_order", []string{"whitelist", "heuristics", "cache", "llm"})
+	v.SetDefault("spam.few_shot_examples", []map[string]string{})
+	v.SetDefault("spam.few_shot_max_size", 2048)
+	v.SetDefault("spam.subject_only_mode", "off")
+	v.SetDefault("spam.subject_only_ham_below", 0.2)
+	v.SetDefault("spam.subject_only_spam_above", 0.9)
+	v.SetDefault("spam.require_valid_from", false)
+	v.SetDefault("spam.invalid_from_score", 0.2)
+	v.SetDefault("spam.check_envelope_mismatch", false)
+	v.SetDefault("spam.include_time_signal", false)
+	v.SetDefault("spam.unwrap_forwarded", false)
+	v.SetDefault("spam.normalize_idn", false)
+	v.SetDefault("spam.flag_homograph_domains", false)
+	v.SetDefault("spam.defer_to_upstream", "")
+	v.SetDefault("spam.monitor_senders", []string{})
+	v.SetDefault("spam.monitor_recipients", []string{})
+	v.SetDefault("spam.defer_upstream_ham", false)
+	v.SetDefault("spam.envelope_mismatch_score", 0.1)
+	v.SetDefault("spam.use_public_suffix", false)
+	v.SetDefault("spam.enforce_dmarc", false)
+	v.SetDefault("spam.dmarc_authserv_id", "")
+	v.SetDefault("spam.dmarc_cache_ttl", "1h")
+	v.SetDefault("spam.include_received", false)
+	v.SetDefault("spam.include_recipient_stats", false)
+	v.SetDefault("spam.prompt_recipients_max", 1)
+	v.SetDefault("spam.explanation_language", "English")
+	v.SetDefault("spam.label_only", false)
+	v.SetDefault("spam.score_newest_only", false)
+	v.SetDefault("spam.use_stale_on_error", false)
+	v.SetDefault("spam.skip_encrypted", false)
+	v.SetDefault("spam.verify_before_reject", false)
+	v.SetDefault("spam.verify_provider", "")
+	v.SetDefault("spam.domain_thresholds", []map[string]interface{}{})
+	v.SetDefault("spam.decision_trace", false)
+	v.SetDefault("spam.label_only_confidence", 0.8)
+	v.SetDefault("spam.injection_guard", "off")
+	v.SetDefault("spam.min_body_length", 0)
+	v.SetDefault("spam.short_body_verdict", "ham")
+	v.SetDefault("spam.bulk_policy", "ignore")
+	v.SetDefault("spam.bulk_downweight", 0.2)
+	v.SetDefault("spam.kill_switch", false)
+	v.SetDefault("spam.kill_switch_verdict", "ham")
+	v.SetDefault("spam.strip_inline_images", false)
+	v.SetDefault("spam.preprocess_steps", []string{})
+	v.SetDefault("spam.decode_qr", false)
+	v.SetDefault("spam.max_analyze_bytes", 0)
+	v.SetDefault("spam.oversize_mode", "skip")
+	v.SetDefault("spam.extraction_max_bytes", 52428800)
+	v.SetDefault("spam.extraction_max_parts", 500)
+	v.SetDefault("spam.extraction_max_depth", 20)
+	v.SetDefault("spam.extraction_timeout", "10s")
+	v.SetDefault("spam.scan_attachment_text", false)
+	v.SetDefault("spam.attachment_text_kb", 4)
 	
 	// Cache defaults
 	v.SetDefault("cache.type", "memory")
 	v.SetDefault("cache.enabled", true)
 	v.SetDefault("cache.ttl", "24h")
+	v.SetDefault("cache.min_ttl", "1m")
+	v.SetDefault("cache.max_ttl", "720h")
+	v.SetDefault("cache.l2_type", "sqlite")
+	v.SetDefault("cache.l1_ttl", "5m")
 	v.SetDefault("cache.cleanup_frequency", "1h")
+	v.SetDefault("cache.cleanup_jitter", "5m")
+	v.SetDefault("cache.policy", "both")
+	v.SetDefault("cache.min_confidence", 0.0)
+	v.SetDefault("cache.error_ttl", "0s")
+	v.SetDefault("cache.op_timeout", "0s")
+	v.SetDefault("cache.circuit_threshold", 0)
+	v.SetDefault("cache.circuit_cooldown", "30s")
+	v.SetDefault("cache.encryption_key", "")
+	v.SetDefault("cache.run_migrations", true)
+	v.SetDefault("cache.strip_subaddress", false)
+	v.SetDefault("cache.include_recipient", false)
+	v.SetDefault("cache.lookup_variants", false)
+	v.SetDefault("cache.skip_domains", []string{})
+	v.SetDefault("cache.deduplicate", true)
 	v.SetDefault("cache.sqlite_path", "/data/spam_cache.db")
 	v.SetDefault("cache.mysql_dsn", "user:password@tcp(localhost:3306)/spam_filter")
 	
+	// Feedback defaults
+	v.SetDefault("feedback.enabled", false)
+	v.SetDefault("feedback.path", "/data/feedback.jsonl")
+	v.SetDefault("feedback.update_cache", true)
+	
+	// Learning defaults
+	v.SetDefault("learning.enabled", false)
+	v.SetDefault("learning.output_path", "/data/features.jsonl")
+	
+	// Digest defaults
+	v.SetDefault("digest.enabled", false)
+	v.SetDefault("digest.sqlite_path", "")
+	v.SetDefault("digest.retention", "720h")
+	v.SetDefault("digest.dedupe_window", "0s")
+	
+	// Bayesian classifier defaults
+	v.SetDefault("bayes.enabled", false)
+	v.SetDefault("bayes.sqlite_path", "")
+	v.SetDefault("bayes.weight", 0.3)
+	v.SetDefault("bayes.min_messages", 20)
+	
+	// Reputation defaults
+	v.SetDefault("reputation.enabled", false)
+	v.SetDefault("reputation.weight", 0.1)
+	v.SetDefault("reputation.half_life", "168h")
+	
+	// Stats defaults
+	v.SetDefault("stats.log_interval", "0s")
+	v.SetDefault("stats.latency_window", "0s")
+	
+	// Metrics defaults
+	v.SetDefault("metrics.backend", "log")
+	v.SetDefault("metrics.statsd_address", "127.0.0.1:8125")
+	v.SetDefault("metrics.statsd_prefix", "llm_spam_filter")
+	
 	// Logging defaults
 	v.SetDefault("logging.level", "info")
 	v.SetDefault("logging.format", "json")
+	v.SetDefault("logging.hash_pii", false)
+	v.SetDefault("logging.hash_salt", "")
+	v.SetDefault("logging.syslog.enabled", false)
+	v.SetDefault("logging.syslog.network", "")
+	v.SetDefault("logging.syslog.address", "")
+	v.SetDefault("logging.syslog.facility", "mail")
+	v.SetDefault("logging.syslog.tag", "llm-spam-filter")
+	v.SetDefault("logging.syslog.keep_console", true)
 }
 
 // GetString gets a string value from the configuration
@@ -141,6 +356,16 @@ func (c *Config) GetStringSlice(key string) []string {
 	return c.v.GetStringSlice(key)
 }
 
+// GetStringMapStringSlice gets a map of string slices from the configuration
+func (c *Config) GetStringMapStringSlice(key string) map[string][]string {
+	return c.v.GetStringMapStringSlice(key)
+}
+
+// IsSet returns whether a key has a value in the configuration
+func (c *Config) IsSet(key string) bool {
+	return c.v.IsSet(key)
+}
+
 // GetDuration gets a duration value from the configuration
 func (c *Config) GetDuration(key string) (time.Duration, error) {
 	return time.ParseDuration(c.GetString(key))
@@ -0,0 +1,159 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// writeFile writes content to name in dir and returns its path
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+	return path
+}
+
+// chdir changes into dir for the rest of the test
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("failed to get working directory: %v", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("failed to change directory: %v", err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestExplicitPathOverridesSearchPaths(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+	writeFile(t, dir, "config.yaml", "server:\n  listen_address: \"127.0.0.1:1025\"\n")
+	explicit := writeFile(t, t.TempDir(), "filter.yaml", "server:\n  listen_address: \"127.0.0.1:2025\"\n")
+
+	searched, err := NewWithPath("")
+	if err != nil {
+		t.Fatalf("NewWithPath(\"\") error = %v", err)
+	}
+	if got := searched.GetString("server.listen_address"); got != "127.0.0.1:1025" {
+		t.Errorf("searched listen_address = %q, want the config from the search path", got)
+	}
+
+	t.Setenv("SPAM_FILTER_CONFIG", explicit)
+	cfg, err := New()
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if got := cfg.GetString("server.listen_address"); got != "127.0.0.1:2025" {
+		t.Errorf("listen_address = %q, want the config from SPAM_FILTER_CONFIG", got)
+	}
+}
+
+func TestExplicitPathMustExist(t *testing.T) {
+	if _, err := NewWithPath(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("NewWithPath() with a missing file succeeded, want an error")
+	}
+}
+
+// equivalentConfigs are the same settings written in each supported format
+var equivalentConfigs = map[string]string{
+	"config.yaml": `server:
+  listen_address: "127.0.0.1:2525"
+spam:
+  threshold: 0.85
+  whitelisted_domains:
+    - example.com
+    - example.org
+cache:
+  enabled: false
+  ttl: 12h
+`,
+	"config.toml": `[server]
+listen_address = "127.0.0.1:2525"
+
+[spam]
+threshold = 0.85
+whitelisted_domains = ["example.com", "example.org"]
+
+[cache]
+enabled = false
+ttl = "12h"
+`,
+	"config.json": `{
+  "server": {"listen_address": "127.0.0.1:2525"},
+  "spam": {"threshold": 0.85, "whitelisted_domains": ["example.com", "example.org"]},
+  "cache": {"enabled": false, "ttl": "12h"}
+}
+`,
+}
+
+// checkEquivalentSettings fails unless cfg has the settings of
+// equivalentConfigs
+func checkEquivalentSettings(t *testing.T, cfg *Config) {
+	t.Helper()
+	if got := cfg.GetString("server.listen_address"); got != "127.0.0.1:2525" {
+		t.Errorf("listen_address = %q, want 127.0.0.1:2525", got)
+	}
+	if got := cfg.GetFloat64("spam.threshold"); got != 0.85 {
+		t.Errorf("threshold = %v, want 0.85", got)
+	}
+	if got := cfg.GetStringSlice("spam.whitelisted_domains"); !reflect.DeepEqual(got, []string{"example.com", "example.org"}) {
+		t.Errorf("whitelisted_domains = %v, want [example.com example.org]", got)
+	}
+	if cfg.GetBool("cache.enabled") {
+		t.Error("cache.enabled = true, want false")
+	}
+	if ttl, err := cfg.GetDuration("cache.ttl"); err != nil || ttl != 12*time.Hour {
+		t.Errorf("cache.ttl = %v, %v, want 12h", ttl, err)
+	}
+}
+
+func TestEquivalentConfigFormatsLoadSameSettings(t *testing.T) {
+	for name, content := range equivalentConfigs {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := NewWithPath(writeFile(t, t.TempDir(), name, content))
+			if err != nil {
+				t.Fatalf("NewWithPath() error = %v", err)
+			}
+			checkEquivalentSettings(t, cfg)
+		})
+	}
+}
+
+func TestSearchPathFindsOtherFormats(t *testing.T) {
+	for _, name := range []string{"config.toml", "config.json"} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			chdir(t, dir)
+			writeFile(t, dir, name, equivalentConfigs[name])
+
+			cfg, err := NewWithPath("")
+			if err != nil {
+				t.Fatalf("NewWithPath(\"\") error = %v", err)
+			}
+			checkEquivalentSettings(t, cfg)
+		})
+	}
+}
+
+func TestConfigFormatOverridesExtension(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "filter.conf", equivalentConfigs["config.toml"])
+
+	t.Setenv("SPAM_FILTER_CONFIG_FORMAT", "toml")
+	cfg, err := NewWithPath(path)
+	if err != nil {
+		t.Fatalf("NewWithPath() error = %v", err)
+	}
+	checkEquivalentSettings(t, cfg)
+
+	t.Setenv("SPAM_FILTER_CONFIG_FORMAT", "ini")
+	if _, err := NewWithPath(path); err == nil {
+		t.Error("NewWithPath() with an unsupported format succeeded, want an error")
+	}
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MinMaxTokens is the smallest output token limit that reliably fits the
+// JSON verdict with a short explanation
+const MinMaxTokens = 64
+
+// defaultMaxTokens is the output token limit for models that answer
+// directly, enough for the verdict with room for models that pad it
+const defaultMaxTokens = 512
+
+// defaultReasoningMaxTokens is the output token limit for models whose
+// reasoning or thinking tokens count against it
+const defaultReasoningMaxTokens = 4096
+
+// reasoningModelPrefixes are model name prefixes, per provider, of models
+// that spend output tokens on reasoning before answering
+var reasoningModelPrefixes = map[string][]string{
+	"openai": {"o1", "o3", "o4", "gpt-5"},
+	"gemini": {"gemini-2.5"},
+}
+
+// DefaultMaxTokens returns the output token limit used for a provider's
+// model when none is configured
+func DefaultMaxTokens(provider, model string) int {
+	model = strings.ToLower(model)
+	for _, prefix := range reasoningModelPrefixes[provider] {
+		if strings.HasPrefix(model, prefix) {
+			return defaultReasoningMaxTokens
+		}
+	}
+	return defaultMaxTokens
+}
+
+// ResolveMaxTokens returns the configured output token limit for a model,
+// or the model's default if it is 0. Limits below MinMaxTokens are rejected,
+// since the verdict would be cut off.
+func ResolveMaxTokens(configured int, provider, model string) (int, error) {
+	if configured == 0 {
+		return DefaultMaxTokens(provider, model), nil
+	}
+	if configured < MinMaxTokens {
+		return 0, fmt.Errorf("%s max tokens %d is below the minimum of %d", provider, configured, MinMaxTokens)
+	}
+	return configured, nil
+}
@@ -0,0 +1,34 @@
+package config
+
+import "testing"
+
+func TestResolveMaxTokens(t *testing.T) {
+	tests := []struct {
+		configured int
+		provider   string
+		model      string
+		want       int
+	}{
+		{0, "openai", "gpt-4o-mini", defaultMaxTokens},
+		{0, "openai", "o3-mini", defaultReasoningMaxTokens},
+		{0, "gemini", "gemini-2.5-flash", defaultReasoningMaxTokens},
+		{0, "gemini", "gemini-1.5-pro", defaultMaxTokens},
+		{0, "bedrock", "anthropic.claude-v2", defaultMaxTokens},
+		{256, "openai", "o3-mini", 256},
+		{MinMaxTokens, "gemini", "gemini-1.5-pro", MinMaxTokens},
+	}
+	for _, tt := range tests {
+		got, err := ResolveMaxTokens(tt.configured, tt.provider, tt.model)
+		if err != nil {
+			t.Errorf("ResolveMaxTokens(%d, %s, %s) error = %v", tt.configured, tt.provider, tt.model, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ResolveMaxTokens(%d, %s, %s) = %d, want %d", tt.configured, tt.provider, tt.model, got, tt.want)
+		}
+	}
+
+	if _, err := ResolveMaxTokens(MinMaxTokens-1, "openai", "gpt-4o-mini"); err == nil {
+		t.Error("ResolveMaxTokens() below the minimum succeeded, want an error")
+	}
+}
@@ -2,13 +2,18 @@ package config
 
 // LLMConfig represents the configuration for the LLM provider
 type LLMConfig struct {
-	Provider string
+	Provider             string
+	ReformatOnParseError bool
+	ModelStrategy        string
+	RetryOnEmpty         int
+	RateLimitRetries     int
 }
 
 // BedrockConfig represents the configuration for Amazon Bedrock
 type BedrockConfig struct {
 	Region      string
 	ModelID     string
+	Models      []string
 	MaxTokens   int
 	Temperature float32
 	TopP        float32
@@ -17,28 +22,43 @@ type BedrockConfig struct {
 
 // GeminiConfig represents the configuration for Google Gemini
 type GeminiConfig struct {
-	APIKey      string
-	ModelName   string
-	MaxTokens   int
-	Temperature float32
-	TopP        float32
-	MaxBodySize int
+	APIKey               string
+	ModelName            string
+	Models               []string
+	MaxTokens            int
+	Temperature          float32
+	TopP                 float32
+	MaxBodySize          int
+	SafetyBlockThreshold string
 }
 
 // OpenAIConfig represents the configuration for OpenAI
 type OpenAIConfig struct {
-	APIKey      string
-	ModelName   string
-	MaxTokens   int
-	Temperature float32
-	TopP        float32
-	MaxBodySize int
+	APIKey              string
+	ModelName           string
+	Models              []string
+	MaxTokens           int
+	Temperature         float32
+	TopP                float32
+	MaxBodySize         int
+	TokenizerTruncation bool
+	MaxBodyTokens       int
+}
+
+// GRPCConfig represents the configuration for an external gRPC classifier
+type GRPCConfig struct {
+	Address string
+	TLS     bool
 }
 
 // GetLLM returns the LLM configuration
 func (c *Config) GetLLM() LLMConfig {
 	return LLMConfig{
-		Provider: c.GetString("llm.provider"),
+		Provider:             c.GetString("llm.provider"),
+		ReformatOnParseError: c.GetBool("llm.reformat_on_parse_error"),
+		ModelStrategy:        c.GetString("llm.model_strategy"),
+		RetryOnEmpty:         c.GetInt("llm.retry_on_empty"),
+		RateLimitRetries:     c.GetInt("llm.rate_limit_retries"),
 	}
 }
 
@@ -47,6 +67,7 @@ func (c *Config) GetBedrock() BedrockConfig {
 	return BedrockConfig{
 		Region:      c.GetString("bedrock.region"),
 		ModelID:     c.GetString("bedrock.model_id"),
+		Models:      c.GetStringSlice("bedrock.models"),
 		MaxTokens:   c.GetInt("bedrock.max_tokens"),
 		Temperature: float32(c.GetFloat64("bedrock.temperature")),
 		TopP:        float32(c.GetFloat64("bedrock.top_p")),
@@ -59,10 +80,12 @@ func (c *Config) GetGemini() GeminiConfig {
 	return GeminiConfig{
 		APIKey:      c.GetString("gemini.api_key"),
 		ModelName:   c.GetString("gemini.model_name"),
+		Models:      c.GetStringSlice("gemini.models"),
 		MaxTokens:   c.GetInt("gemini.max_tokens"),
 		Temperature: float32(c.GetFloat64("gemini.temperature")),
 		TopP:        float32(c.GetFloat64("gemini.top_p")),
 		MaxBodySize: c.GetInt("gemini.max_body_size"),
+		SafetyBlockThreshold: c.GetString("gemini.safety_block_threshold"),
 	}
 }
 
@@ -71,9 +94,20 @@ func (c *Config) GetOpenAI() OpenAIConfig {
 	return OpenAIConfig{
 		APIKey:      c.GetString("openai.api_key"),
 		ModelName:   c.GetString("openai.model_name"),
+		Models:      c.GetStringSlice("openai.models"),
 		MaxTokens:   c.GetInt("openai.max_tokens"),
 		Temperature: float32(c.GetFloat64("openai.temperature")),
 		TopP:        float32(c.GetFloat64("openai.top_p")),
 		MaxBodySize: c.GetInt("openai.max_body_size"),
+		TokenizerTruncation: c.GetBool("openai.tokenizer_truncation"),
+		MaxBodyTokens: c.GetInt("openai.max_body_tokens"),
+	}
+}
+
+// GetGRPC returns the external gRPC classifier configuration
+func (c *Config) GetGRPC() GRPCConfig {
+	return GRPCConfig{
+		Address: c.GetString("grpc.address"),
+		TLS:     c.GetBool("grpc.tls"),
 	}
 }
@@ -0,0 +1,34 @@
+package core
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// blendBayes mixes the local classifier's score into the LLM's by the
+// configured weight. The LLM's score stands if the classifier fails or
+// hasn't been trained enough.
+func (s *SpamFilterService) blendBayes(ctx context.Context, email *Email, result *SpamAnalysisResult) {
+	score, ok, err := s.opts.BayesClassifier.Score(ctx, email)
+	if err != nil {
+		s.log(ctx).Warn("Failed to score email with the Bayesian classifier",
+			zap.String("from", email.From),
+			zap.Error(err))
+		return
+	}
+	if !ok {
+		s.log(ctx).Debug("Bayesian classifier is not trained enough to score",
+			zap.String("from", email.From))
+		return
+	}
+
+	llmScore := result.Score
+	result.Score = clampScore((1-s.opts.BayesWeight)*llmScore + s.opts.BayesWeight*score)
+	s.traceScore(result, "bayes", result.Score)
+	s.log(ctx).Debug("Blended Bayesian score",
+		zap.String("from", email.From),
+		zap.Float64("llm_score", llmScore),
+		zap.Float64("bayes_score", score),
+		zap.Float64("score", result.Score))
+}
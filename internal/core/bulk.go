@@ -0,0 +1,53 @@
+package core
+
+import (
+	"strings"
+	"time"
+)
+
+// Bulk policies control how mail with bulk headers, such as subscribed
+// newsletters, is handled
+const (
+	BulkPolicyIgnore     = "ignore"
+	BulkPolicyDownweight = "downweight"
+	BulkPolicyTag        = "tag_bulk"
+)
+
+// bulkExplanation is added to the explanation of down-weighted bulk mail
+const bulkExplanation = "Carries bulk mail headers (List-Unsubscribe or Precedence)"
+
+// isBulk returns whether an email carries the headers of legitimate bulk
+// mail: a List-Unsubscribe header, or Precedence: bulk or list
+func isBulk(email *Email) bool {
+	for key, values := range email.Headers {
+		switch {
+		case strings.EqualFold(key, "List-Unsubscribe"):
+			for _, value := range values {
+				if strings.TrimSpace(value) != "" {
+					return true
+				}
+			}
+		case strings.EqualFold(key, "Precedence"):
+			for _, value := range values {
+				if precedence := strings.ToLower(strings.TrimSpace(value)); precedence == "bulk" || precedence == "list" {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// bulkResult is returned for bulk mail under the tag_bulk policy
+func bulkResult() *SpamAnalysisResult {
+	return &SpamAnalysisResult{
+		IsSpam:      false,
+		Score:       0.0,
+		Confidence:  0.0,
+		Explanation: "Bulk mail is tagged without analysis",
+		AnalyzedAt:  time.Now(),
+		ModelUsed:   "skipped",
+		SkipReason:  "bulk mail",
+		Bulk:        true,
+	}
+}
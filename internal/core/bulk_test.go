@@ -0,0 +1,65 @@
+package core
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+// newsletter returns an email carrying a List-Unsubscribe header
+func newsletter() *Email {
+	email := testEmail("news@shop.example")
+	email.Headers["List-Unsubscribe"] = []string{"<https://shop.example/unsubscribe>"}
+	return email
+}
+
+func TestNewsletterUnderEachBulkPolicy(t *testing.T) {
+	tests := []struct {
+		policy string
+		calls  int
+		score  float64
+		isSpam bool
+		bulk   bool
+	}{
+		{BulkPolicyIgnore, 1, 0.75, true, false},
+		{"", 1, 0.75, true, false},
+		{BulkPolicyDownweight, 1, 0.45, false, false},
+		{BulkPolicyTag, 0, 0, false, true},
+	}
+	for _, tt := range tests {
+		t.Run("policy="+tt.policy, func(t *testing.T) {
+			llm := &fakeLLM{result: SpamAnalysisResult{Score: 0.75}}
+			service := newTestService(llm, nil, ServiceOptions{BulkPolicy: tt.policy, BulkDownweight: 0.3})
+
+			result, err := service.AnalyzeEmail(context.Background(), newsletter())
+			if err != nil {
+				t.Fatalf("AnalyzeEmail() error = %v", err)
+			}
+			if llm.callCount() != tt.calls {
+				t.Errorf("LLM calls = %d, want %d", llm.callCount(), tt.calls)
+			}
+			if math.Abs(result.Score-tt.score) > 1e-9 || result.IsSpam != tt.isSpam || result.Bulk != tt.bulk {
+				t.Errorf("got score=%v is_spam=%t bulk=%t, want %v %t %t", result.Score, result.IsSpam, result.Bulk, tt.score, tt.isSpam, tt.bulk)
+			}
+		})
+	}
+}
+
+func TestIsBulk(t *testing.T) {
+	tests := []struct {
+		headers map[string][]string
+		bulk    bool
+	}{
+		{map[string][]string{"List-Unsubscribe": {"<mailto:leave@list.example>"}}, true},
+		{map[string][]string{"list-unsubscribe": {" "}}, false},
+		{map[string][]string{"Precedence": {"Bulk"}}, true},
+		{map[string][]string{"Precedence": {"list"}}, true},
+		{map[string][]string{"Precedence": {"junk"}}, false},
+		{map[string][]string{}, false},
+	}
+	for _, tt := range tests {
+		if got := isBulk(&Email{Headers: tt.headers}); got != tt.bulk {
+			t.Errorf("isBulk(%v) = %t, want %t", tt.headers, got, tt.bulk)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package core
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSkipDomainSenderBypassesCache(t *testing.T) {
+	tests := []struct {
+		name   string
+		sender string
+		cached bool
+	}{
+		{"skip domain", "qa@test.example.org", false},
+		{"skip subdomain", "qa@staging.test.example.org", false},
+		{"other domain", "qa@example.org", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := newFakeCache()
+			llm := &fakeLLM{result: SpamAnalysisResult{Score: 0.1}}
+			service := newTestService(llm, cache, ServiceOptions{CacheSkipDomains: []string{"test.example.org"}})
+
+			// A stale verdict cached before the domain was skipped
+			cache.Set(context.Background(), tt.sender, &SpamAnalysisResult{IsSpam: true, Score: 0.95}, 0)
+
+			result, err := service.AnalyzeEmail(context.Background(), testEmail(tt.sender))
+			if err != nil {
+				t.Fatalf("AnalyzeEmail() error = %v", err)
+			}
+			if read := llm.callCount() == 0; read != tt.cached {
+				t.Errorf("LLM calls = %d, want the cache read %t", llm.callCount(), tt.cached)
+			}
+			if tt.cached {
+				return
+			}
+			if result.IsSpam {
+				t.Errorf("result = %+v, want a fresh verdict", result)
+			}
+
+			cache.Delete(context.Background(), tt.sender)
+			service.AnalyzeEmail(context.Background(), testEmail(tt.sender))
+			if len(cache.entries) != 0 {
+				t.Errorf("cache entries = %v, want nothing written for the sender", cache.entries)
+			}
+			if llm.callCount() != 2 {
+				t.Errorf("LLM calls = %d, want every message analyzed", llm.callCount())
+			}
+		})
+	}
+}
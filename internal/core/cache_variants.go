@@ -0,0 +1,60 @@
+package core
+
+import (
+	"context"
+	"net/mail"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// cacheGet looks up a cache key. With variant lookups enabled, the keys
+// other keying strategies would have produced for the sender are tried
+// too, in one pass that stops at the first hit or when the lookup's
+// deadline passes.
+func (s *SpamFilterService) cacheGet(ctx context.Context, email *Email, cacheKey, key string) (*SpamAnalysisResult, bool) {
+	if !s.opts.CacheLookupVariants {
+		return s.cacheRepo.Get(ctx, key)
+	}
+
+	// Per-recipient keys keep their recipient suffix on every variant
+	suffix := strings.TrimPrefix(key, cacheKey)
+	for _, variant := range s.senderKeyVariants(email.From) {
+		if ctx.Err() != nil {
+			return nil, false
+		}
+		if cached, found := s.cacheRepo.Get(ctx, variant+suffix); found {
+			if variant != cacheKey {
+				s.log(ctx).Debug("Found cached result under address variant",
+					zap.String("from", email.From),
+					zap.String("cache_key", variant+suffix))
+			}
+			return cached, true
+		}
+	}
+	return nil, false
+}
+
+// senderKeyVariants returns the distinct cache keys a sender may have been
+// cached under, starting with the current normalized key: the address with
+// and without its +tag, and the address and header as written
+func (s *SpamFilterService) senderKeyVariants(from string) []string {
+	variants := []string{
+		s.normalizeSender(from),
+		normalizeAddress(from, !s.opts.StripSubaddress),
+	}
+	if parsed, err := mail.ParseAddress(strings.TrimSpace(from)); err == nil {
+		variants = append(variants, parsed.Address)
+	}
+	variants = append(variants, strings.TrimSpace(from))
+
+	distinct := variants[:0]
+	seen := make(map[string]bool, len(variants))
+	for _, variant := range variants {
+		if variant != "" && !seen[variant] {
+			seen[variant] = true
+			distinct = append(distinct, variant)
+		}
+	}
+	return distinct
+}
@@ -0,0 +1,54 @@
+package core
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCacheLookupFindsAddressVariants(t *testing.T) {
+	const from = "Jane Doe <Jane+news@Example.com>"
+	tests := []struct {
+		name     string
+		stored   string
+		variants bool
+		hit      bool
+	}{
+		{"normalized key", "jane@example.com", true, true},
+		{"address with +tag", "jane+news@example.com", true, true},
+		{"address as written", "Jane+news@Example.com", true, true},
+		{"header as written", from, true, true},
+		{"other sender", "john@example.com", true, false},
+		{"variants disabled", "jane+news@example.com", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := newFakeCache()
+			cache.Set(context.Background(), tt.stored, &SpamAnalysisResult{IsSpam: true, Score: 0.95}, 0)
+			llm := &fakeLLM{result: SpamAnalysisResult{Score: 0.1}}
+			service := newTestService(llm, cache, ServiceOptions{StripSubaddress: true, CacheLookupVariants: tt.variants})
+
+			result, err := service.AnalyzeEmail(context.Background(), testEmail(from))
+			if err != nil {
+				t.Fatalf("AnalyzeEmail() error = %v", err)
+			}
+			if hit := llm.callCount() == 0; hit != tt.hit {
+				t.Fatalf("LLM calls = %d, want cache hit %t", llm.callCount(), tt.hit)
+			}
+			if tt.hit && !result.IsSpam {
+				t.Errorf("result = %+v, want the cached verdict", result)
+			}
+		})
+	}
+}
+
+func TestCacheLookupStopsAtDeadline(t *testing.T) {
+	cache := newFakeCache()
+	cache.Set(context.Background(), "jane+news@example.com", &SpamAnalysisResult{IsSpam: true}, 0)
+	service := newTestService(&fakeLLM{}, cache, ServiceOptions{StripSubaddress: true, CacheLookupVariants: true})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, found := service.cacheGet(ctx, testEmail("jane+news@example.com"), "jane@example.com", "jane@example.com"); found {
+		t.Error("cacheGet() found a variant after the deadline, want the lookup abandoned")
+	}
+}
@@ -0,0 +1,103 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// CalibrationPoint maps a raw model score to a calibrated score
+type CalibrationPoint struct {
+	Raw        float64
+	Calibrated float64
+}
+
+// ScoreCalibration maps raw model scores onto a common scale before the
+// threshold is applied, either linearly (Scale*score + Offset) or by
+// interpolating between points
+type ScoreCalibration struct {
+	Scale  float64
+	Offset float64
+	Points []CalibrationPoint
+}
+
+// NewLinearCalibration creates a calibration of the form scale*score + offset
+func NewLinearCalibration(scale, offset float64) *ScoreCalibration {
+	return &ScoreCalibration{Scale: scale, Offset: offset}
+}
+
+// NewPiecewiseCalibration creates a calibration that interpolates linearly
+// between points. Scores outside the points take the nearest point's value.
+func NewPiecewiseCalibration(points []CalibrationPoint) (*ScoreCalibration, error) {
+	if len(points) < 2 {
+		return nil, fmt.Errorf("piecewise calibration needs at least 2 points, got %d", len(points))
+	}
+
+	sorted := make([]CalibrationPoint, len(points))
+	copy(sorted, points)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Raw < sorted[j].Raw })
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].Raw == sorted[i-1].Raw {
+			return nil, fmt.Errorf("duplicate calibration point for raw score %g", sorted[i].Raw)
+		}
+	}
+
+	return &ScoreCalibration{Points: sorted}, nil
+}
+
+// Apply returns the calibrated score, clamped to [0, 1]
+func (c *ScoreCalibration) Apply(score float64) float64 {
+	if len(c.Points) == 0 {
+		return clampScore(c.Scale*score + c.Offset)
+	}
+
+	if score <= c.Points[0].Raw {
+		return clampScore(c.Points[0].Calibrated)
+	}
+	for i := 1; i < len(c.Points); i++ {
+		lo, hi := c.Points[i-1], c.Points[i]
+		if score <= hi.Raw {
+			fraction := (score - lo.Raw) / (hi.Raw - lo.Raw)
+			return clampScore(lo.Calibrated + fraction*(hi.Calibrated-lo.Calibrated))
+		}
+	}
+	return clampScore(c.Points[len(c.Points)-1].Calibrated)
+}
+
+// clampScore limits a score to [0, 1]
+func clampScore(score float64) float64 {
+	return math.Min(math.Max(score, 0.0), 1.0)
+}
+
+// calibrate returns a result's score calibrated for the provider that
+// scored it, and whether a calibration applied. A consensus is combined
+// again from its providers' calibrated scores, since each provider has its
+// own scale.
+func (s *SpamFilterService) calibrate(result *SpamAnalysisResult) (float64, bool) {
+	if len(result.ProviderVerdicts) == 0 {
+		calibration := s.opts.ScoreCalibrations[result.Provider]
+		if calibration == nil {
+			return result.Score, false
+		}
+		return calibration.Apply(result.Score), true
+	}
+
+	var score, totalWeight float64
+	calibrated := false
+	for _, verdict := range result.ProviderVerdicts {
+		if !verdict.Responded || verdict.Weight == 0 {
+			continue
+		}
+		providerScore := verdict.Score
+		if calibration := s.opts.ScoreCalibrations[verdict.Provider]; calibration != nil {
+			providerScore = calibration.Apply(providerScore)
+			calibrated = true
+		}
+		score += verdict.Weight * providerScore
+		totalWeight += verdict.Weight
+	}
+	if !calibrated || totalWeight == 0 {
+		return result.Score, false
+	}
+	return score / totalWeight, true
+}
@@ -0,0 +1,134 @@
+package core
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func TestLinearCalibrationClamps(t *testing.T) {
+	calibration := NewLinearCalibration(1.25, -0.1)
+	tests := []struct{ raw, want float64 }{
+		{0, 0},
+		{0.5, 0.525},
+		{1, 1},
+	}
+	for _, tt := range tests {
+		if got := calibration.Apply(tt.raw); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Apply(%v) = %v, want %v", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestPiecewiseCalibrationInterpolates(t *testing.T) {
+	calibration, err := NewPiecewiseCalibration([]CalibrationPoint{{1, 1}, {0, 0}, {0.6, 0.4}})
+	if err != nil {
+		t.Fatalf("NewPiecewiseCalibration() error = %v", err)
+	}
+	tests := []struct{ raw, want float64 }{
+		{0.3, 0.2},
+		{0.6, 0.4},
+		{0.8, 0.7},
+		{1.2, 1},
+	}
+	for _, tt := range tests {
+		if got := calibration.Apply(tt.raw); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Apply(%v) = %v, want %v", tt.raw, got, tt.want)
+		}
+	}
+
+	if _, err := NewPiecewiseCalibration([]CalibrationPoint{{0.5, 0.5}}); err == nil {
+		t.Error("NewPiecewiseCalibration() with one point succeeded, want an error")
+	}
+	if _, err := NewPiecewiseCalibration([]CalibrationPoint{{0.5, 0.5}, {0.5, 0.6}}); err == nil {
+		t.Error("NewPiecewiseCalibration() with duplicate points succeeded, want an error")
+	}
+}
+
+func TestCalibrationFollowsRespondingProvider(t *testing.T) {
+	calibrations := map[string]*ScoreCalibration{
+		"openai": NewLinearCalibration(1, 0.2),
+		"gemini": NewLinearCalibration(0.5, 0),
+	}
+	tests := []struct {
+		provider string
+		want     float64
+	}{
+		{"openai", 0.8},
+		{"gemini", 0.3},
+		{"bedrock", 0.6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.provider, func(t *testing.T) {
+			llm := &fakeLLM{result: SpamAnalysisResult{Score: 0.6, Provider: tt.provider}}
+			service := newTestService(llm, nil, ServiceOptions{ScoreCalibrations: calibrations})
+
+			result, err := service.AnalyzeEmail(context.Background(), testEmail("sender@example.com"))
+			if err != nil {
+				t.Fatalf("AnalyzeEmail() error = %v", err)
+			}
+			if math.Abs(result.Score-tt.want) > 1e-9 {
+				t.Errorf("Score = %v, want %v", result.Score, tt.want)
+			}
+			if result.RawScore != 0.6 {
+				t.Errorf("RawScore = %v, want 0.6", result.RawScore)
+			}
+		})
+	}
+}
+
+func TestCalibrationRecombinesConsensus(t *testing.T) {
+	llm := &fakeLLM{result: SpamAnalysisResult{
+		Score:    0.5,
+		Provider: "consensus",
+		ProviderVerdicts: []ProviderVerdict{
+			{Provider: "openai", Weight: 1, Responded: true, Score: 0.4},
+			{Provider: "gemini", Weight: 1, Responded: true, Score: 0.6},
+			{Provider: "bedrock", Weight: 1, Error: "unavailable"},
+		},
+	}}
+	service := newTestService(llm, nil, ServiceOptions{ScoreCalibrations: map[string]*ScoreCalibration{
+		"openai": NewLinearCalibration(2, 0),
+	}})
+
+	result, err := service.AnalyzeEmail(context.Background(), testEmail("sender@example.com"))
+	if err != nil {
+		t.Fatalf("AnalyzeEmail() error = %v", err)
+	}
+	// (0.8 + 0.6) / 2, leaving out the provider that failed
+	if math.Abs(result.Score-0.7) > 1e-9 {
+		t.Errorf("Score = %v, want 0.7", result.Score)
+	}
+}
+
+func TestLinearCalibrationAppliesBeforeThreshold(t *testing.T) {
+	tests := []struct {
+		name        string
+		calibration *ScoreCalibration
+		raw         float64
+		score       float64
+		isSpam      bool
+	}{
+		{"raises a lenient model", NewLinearCalibration(1.25, 0), 0.6, 0.75, true},
+		{"lowers a harsh model", NewLinearCalibration(1, -0.2), 0.8, 0.6, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			llm := &fakeLLM{result: SpamAnalysisResult{Score: tt.raw, Provider: "openai"}}
+			service := newTestService(llm, nil, ServiceOptions{ScoreCalibrations: map[string]*ScoreCalibration{
+				"openai": tt.calibration,
+			}})
+
+			result, err := service.AnalyzeEmail(context.Background(), testEmail("sender@example.com"))
+			if err != nil {
+				t.Fatalf("AnalyzeEmail() error = %v", err)
+			}
+			if math.Abs(result.Score-tt.score) > 1e-9 || result.IsSpam != tt.isSpam {
+				t.Errorf("got score=%v is_spam=%t, want %v %t", result.Score, result.IsSpam, tt.score, tt.isSpam)
+			}
+			if result.RawScore != tt.raw {
+				t.Errorf("RawScore = %v, want %v", result.RawScore, tt.raw)
+			}
+		})
+	}
+}
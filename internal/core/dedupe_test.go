@@ -0,0 +1,100 @@
+package core
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// gatedLLM is a fakeLLM that holds each analysis until released
+type gatedLLM struct {
+	fakeLLM
+	release chan struct{}
+}
+
+func (g *gatedLLM) AnalyzeEmail(ctx context.Context, email *Email) (*SpamAnalysisResult, error) {
+	<-g.release
+	return g.fakeLLM.AnalyzeEmail(ctx, email)
+}
+
+// countingCache is a fakeCache that counts its writes
+type countingCache struct {
+	*fakeCache
+	mu   sync.Mutex
+	sets int
+}
+
+func (c *countingCache) Set(ctx context.Context, key string, result *SpamAnalysisResult, ttl time.Duration) {
+	c.mu.Lock()
+	c.sets++
+	c.mu.Unlock()
+	c.fakeCache.Set(ctx, key, result, ttl)
+}
+
+func TestConcurrentAnalysesShareOneLLMCall(t *testing.T) {
+	llm := &gatedLLM{fakeLLM: fakeLLM{result: SpamAnalysisResult{IsSpam: true, Score: 0.9, Confidence: 0.9}}, release: make(chan struct{})}
+	cache := &countingCache{fakeCache: newFakeCache()}
+	service := newTestService(llm, cache, ServiceOptions{DeduplicateAnalyses: true})
+
+	const analyses = 10
+	results := make(chan *SpamAnalysisResult, analyses)
+	var wg sync.WaitGroup
+	for i := 0; i < analyses; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := service.AnalyzeEmail(context.Background(), testEmail("sender@example.com"))
+			if err != nil {
+				t.Errorf("AnalyzeEmail() error = %v", err)
+				return
+			}
+			results <- result
+		}()
+	}
+
+	// Give every analysis time to join the one in flight
+	time.Sleep(100 * time.Millisecond)
+	close(llm.release)
+	wg.Wait()
+	close(results)
+
+	if calls := llm.callCount(); calls != 1 {
+		t.Errorf("LLM calls = %d, want 1", calls)
+	}
+	if cache.sets != 1 {
+		t.Errorf("cache writes = %d, want 1", cache.sets)
+	}
+	count := 0
+	for result := range results {
+		count++
+		if !result.IsSpam {
+			t.Errorf("result = %+v, want the shared spam verdict", result)
+		}
+	}
+	if count != analyses {
+		t.Errorf("got %d results, want %d", count, analyses)
+	}
+}
+
+func TestAnalysesForDifferentSendersAreNotShared(t *testing.T) {
+	llm := &gatedLLM{fakeLLM: fakeLLM{result: SpamAnalysisResult{Score: 0.1}}, release: make(chan struct{})}
+	close(llm.release)
+	service := newTestService(llm, newFakeCache(), ServiceOptions{DeduplicateAnalyses: true})
+
+	var wg sync.WaitGroup
+	for _, sender := range []string{"one@example.com", "two@example.com"} {
+		wg.Add(1)
+		go func(sender string) {
+			defer wg.Done()
+			if _, err := service.AnalyzeEmail(context.Background(), testEmail(sender)); err != nil {
+				t.Errorf("AnalyzeEmail() error = %v", err)
+			}
+		}(sender)
+	}
+	wg.Wait()
+
+	if calls := llm.callCount(); calls != 2 {
+		t.Errorf("LLM calls = %d, want 2", calls)
+	}
+}
@@ -0,0 +1,49 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DigestEntry records a message that was rejected as spam
+type DigestEntry struct {
+	Sender     string
+	Subject    string
+	Score      float64
+	Reason     string
+	RejectedAt time.Time
+
+	// ContentHash identifies the message's content, so that identical
+	// messages can be collapsed into one entry
+	ContentHash string
+
+	// Count is the number of identical messages the entry stands for
+	// (0 for one)
+	Count int
+}
+
+// FormatDigest renders a plain text summary of the messages rejected since
+// the given time, oldest first. Collapsed entries count once per message.
+func FormatDigest(entries []DigestEntry, since time.Time) string {
+	messages := 0
+	for _, entry := range entries {
+		messages += max(entry.Count, 1)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Rejected spam since %s: %d messages\n", since.Format(time.RFC1123), messages)
+	for _, entry := range entries {
+		fmt.Fprintf(&sb, "\n%s  score %.2f", entry.RejectedAt.Local().Format("2006-01-02 15:04"), entry.Score)
+		if entry.Count > 1 {
+			fmt.Fprintf(&sb, "  (%d identical messages)", entry.Count)
+		}
+		sb.WriteString("\n")
+		fmt.Fprintf(&sb, "  From:    %s\n", entry.Sender)
+		fmt.Fprintf(&sb, "  Subject: %s\n", entry.Subject)
+		if entry.Reason != "" {
+			fmt.Fprintf(&sb, "  Reason:  %s\n", entry.Reason)
+		}
+	}
+	return sb.String()
+}
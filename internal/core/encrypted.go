@@ -0,0 +1,56 @@
+package core
+
+import (
+	"mime"
+	"strings"
+)
+
+// pgpArmorHeader starts an ASCII-armored PGP message
+const pgpArmorHeader = "-----BEGIN PGP MESSAGE-----"
+
+// encryptedBody returns the kind of encryption of an email's body, PGP or
+// S/MIME, and whether it is encrypted. PGP/MIME and S/MIME messages are
+// found by their content types, at the top level or on a part, and inline
+// PGP by its armor.
+func encryptedBody(email *Email) (string, bool) {
+	for key, values := range email.Headers {
+		if strings.EqualFold(key, "Content-Type") && len(values) > 0 {
+			if kind, ok := encryptedContentType(values[0]); ok {
+				return kind, true
+			}
+			break
+		}
+	}
+
+	for _, attachment := range email.Attachments {
+		if kind, ok := encryptedContentType(attachment.ContentType); ok {
+			return kind, true
+		}
+	}
+
+	if strings.Contains(email.Body, pgpArmorHeader) {
+		return "PGP", true
+	}
+	return "", false
+}
+
+// encryptedContentType returns the kind of encryption a content type
+// denotes, if any. S/MIME signed data shares the pkcs7-mime type, so it is
+// told apart by its smime-type parameter.
+func encryptedContentType(contentType string) (string, bool) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = contentType
+	}
+
+	switch strings.ToLower(mediaType) {
+	case "multipart/encrypted", "application/pgp-encrypted":
+		return "PGP", true
+	case "application/pkcs7-mime", "application/x-pkcs7-mime":
+		if strings.EqualFold(params["smime-type"], "signed-data") {
+			return "", false
+		}
+		return "S/MIME", true
+	}
+	return "", false
+}
@@ -0,0 +1,69 @@
+package core
+
+import (
+	"context"
+	"testing"
+)
+
+// armoredBody is an inline PGP message
+const armoredBody = "-----BEGIN PGP MESSAGE-----\n\nhQEMA8Xk2mBr7GJzAQf/Z3kq\n=Qx5T\n-----END PGP MESSAGE-----"
+
+func TestEncryptedMessagesSkipAnalysis(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		attachment  string
+		body        string
+		skipReason  string
+	}{
+		{"PGP/MIME", `multipart/encrypted; protocol="application/pgp-encrypted"; boundary=x`, "", "", "encrypted (PGP)"},
+		{"inline PGP", "text/plain", "", armoredBody, "encrypted (PGP)"},
+		{"S/MIME", "multipart/mixed; boundary=x", "application/pkcs7-mime; smime-type=enveloped-data; name=smime.p7m", "", "encrypted (S/MIME)"},
+		{"S/MIME signed", "multipart/mixed; boundary=x", "application/pkcs7-mime; smime-type=signed-data; name=smime.p7m", "", ""},
+		{"plain", "text/plain", "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			llm := &fakeLLM{result: SpamAnalysisResult{Score: 0.1}}
+			service := newTestService(llm, nil, ServiceOptions{SkipEncrypted: true})
+
+			email := testEmail("sender@example.com")
+			email.Headers["Content-Type"] = []string{tt.contentType}
+			if tt.attachment != "" {
+				email.Attachments = []Attachment{{Filename: "smime.p7m", ContentType: tt.attachment}}
+			}
+			if tt.body != "" {
+				email.Body = tt.body
+			}
+
+			result, err := service.AnalyzeEmail(context.Background(), email)
+			if err != nil {
+				t.Fatalf("AnalyzeEmail() error = %v", err)
+			}
+			if result.SkipReason != tt.skipReason {
+				t.Errorf("SkipReason = %q, want %q", result.SkipReason, tt.skipReason)
+			}
+			wantCalls := 1
+			if tt.skipReason != "" {
+				wantCalls = 0
+			}
+			if llm.callCount() != wantCalls {
+				t.Errorf("LLM calls = %d, want %d", llm.callCount(), wantCalls)
+			}
+		})
+	}
+}
+
+func TestEncryptedMessagesAnalyzedWhenNotSkipped(t *testing.T) {
+	llm := &fakeLLM{result: SpamAnalysisResult{Score: 0.1}}
+	service := newTestService(llm, nil, ServiceOptions{})
+
+	email := testEmail("sender@example.com")
+	email.Body = armoredBody
+	if _, err := service.AnalyzeEmail(context.Background(), email); err != nil {
+		t.Fatalf("AnalyzeEmail() error = %v", err)
+	}
+	if llm.callCount() != 1 {
+		t.Errorf("LLM calls = %d, want the message analyzed without skip_encrypted", llm.callCount())
+	}
+}
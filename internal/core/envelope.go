@@ -0,0 +1,43 @@
+package core
+
+import (
+	"net/mail"
+	"strings"
+
+	"github.com/mikey/llm-spam-filter/internal/utils"
+)
+
+// envelopeMismatchExplanation is added to the explanation of emails whose
+// envelope sender doesn't match their From header
+const envelopeMismatchExplanation = "Envelope sender domain differs from the From header"
+
+// envelopeMismatch compares the envelope sender of an email with the
+// address in its From header, returning the header address and whether
+// their registrable domains differ, so that bounce addresses on a
+// subdomain of the sender still match. It returns false for ok if either
+// has no address, as for bounces with an empty envelope sender.
+func envelopeMismatch(email *Email) (headerFrom string, mismatch bool, ok bool) {
+	envelope := normalizeAddress(email.From, false)
+	envelopeAt := strings.LastIndex(envelope, "@")
+
+	var header string
+	for key, values := range email.Headers {
+		if strings.EqualFold(key, "From") && len(values) > 0 {
+			header = values[0]
+			break
+		}
+	}
+	parsed, err := mail.ParseAddress(strings.TrimSpace(header))
+	if envelopeAt < 0 || err != nil {
+		return "", false, false
+	}
+	headerFrom = strings.ToLower(parsed.Address)
+	headerAt := strings.LastIndex(headerFrom, "@")
+	if headerAt < 0 {
+		return "", false, false
+	}
+
+	envelopeDomain := utils.RegistrableDomain(envelope[envelopeAt+1:])
+	headerDomain := utils.RegistrableDomain(headerFrom[headerAt+1:])
+	return headerFrom, envelopeDomain != headerDomain, true
+}
@@ -0,0 +1,73 @@
+package core
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestEnvelopeMismatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		envelope string
+		from     string
+		mismatch bool
+		ok       bool
+	}{
+		{"same address", "alerts@bank.example", "Bank <alerts@bank.example>", false, true},
+		{"bounce subdomain", "bounce-123@mail.bank.example", "alerts@bank.example", false, true},
+		{"different domain", "bounce@mailer.example.net", "Bank <alerts@bank.example>", true, true},
+		{"null sender", "", "alerts@bank.example", false, false},
+		{"no header address", "alerts@bank.example", "Bank", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			email := testEmail(tt.envelope)
+			email.Headers["From"] = []string{tt.from}
+			if _, mismatch, ok := envelopeMismatch(email); mismatch != tt.mismatch || ok != tt.ok {
+				t.Errorf("envelopeMismatch() = %t, %t, want %t, %t", mismatch, ok, tt.mismatch, tt.ok)
+			}
+		})
+	}
+}
+
+func TestEnvelopeMismatchNudgesScore(t *testing.T) {
+	tests := []struct {
+		name     string
+		envelope string
+		opts     ServiceOptions
+		score    float64
+		signal   string
+	}{
+		{"mismatch", "bounce@mailer.example.net", ServiceOptions{CheckEnvelopeMismatch: true, EnvelopeMismatchScore: 0.2}, 0.8, "EnvelopeFrom/HeaderFrom mismatch: true"},
+		{"match", "alerts@bank.example", ServiceOptions{CheckEnvelopeMismatch: true, EnvelopeMismatchScore: 0.2}, 0.6, "EnvelopeFrom/HeaderFrom mismatch: false"},
+		{"disabled", "bounce@mailer.example.net", ServiceOptions{EnvelopeMismatchScore: 0.2}, 0.6, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			llm := &fakeLLM{result: SpamAnalysisResult{Score: 0.6}}
+			service := newTestService(llm, nil, tt.opts)
+
+			email := testEmail(tt.envelope)
+			email.Headers["From"] = []string{"Bank <alerts@bank.example>"}
+			result, err := service.AnalyzeEmail(context.Background(), email)
+			if err != nil {
+				t.Fatalf("AnalyzeEmail() error = %v", err)
+			}
+			if math.Abs(result.Score-tt.score) > 1e-9 {
+				t.Errorf("score = %v, want %v", result.Score, tt.score)
+			}
+
+			signal := ""
+			for _, s := range llm.emails[0].Signals {
+				if strings.HasPrefix(s, "EnvelopeFrom/HeaderFrom") {
+					signal = s
+				}
+			}
+			if !strings.HasPrefix(signal, tt.signal) || (tt.signal == "") != (signal == "") {
+				t.Errorf("model signal = %q, want %q", signal, tt.signal)
+			}
+		})
+	}
+}
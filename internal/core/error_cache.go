@@ -0,0 +1,69 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// errorEntry holds a recent analysis failure for a sender
+type errorEntry struct {
+	err       error
+	expiresAt time.Time
+}
+
+// errorCache remembers recent analysis failures by sender for a short time,
+// so that a failing provider is not called for every message from the same
+// sender. It is kept separate from the verdict cache.
+type errorCache struct {
+	entries map[string]errorEntry
+	ttl     time.Duration
+	mu      sync.Mutex
+}
+
+// newErrorCache creates a new error cache
+func newErrorCache(ttl time.Duration) *errorCache {
+	return &errorCache{
+		entries: make(map[string]errorEntry),
+		ttl:     ttl,
+	}
+}
+
+// Get returns the recent failure for a sender, if any
+func (c *errorCache) Get(key string) (error, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil, false
+	}
+	return entry.err, true
+}
+
+// Set records a failure for a sender, removing any expired failures
+func (c *errorCache) Set(key string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for k, entry := range c.entries {
+		if now.After(entry.expiresAt) {
+			delete(c.entries, k)
+		}
+	}
+
+	c.entries[key] = errorEntry{
+		err:       err,
+		expiresAt: now.Add(c.ttl),
+	}
+}
+
+// providerFailure returns whether an analysis failure is the provider's
+// rather than the caller's, which gave up or ran out of time. Only
+// provider failures are remembered, so that one aborted session doesn't
+// hold up the sender's later mail.
+func providerFailure(ctx context.Context, err error) bool {
+	return ctx.Err() == nil && !errors.Is(err, context.Canceled)
+}
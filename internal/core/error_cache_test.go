@@ -0,0 +1,84 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestErrorCacheCallsLLMOnceWithinWindow(t *testing.T) {
+	llm := &fakeLLM{err: errors.New("provider unavailable")}
+	service := newTestService(llm, nil, ServiceOptions{ErrorTTL: time.Minute})
+
+	for i := 0; i < 2; i++ {
+		if _, err := service.AnalyzeEmail(context.Background(), testEmail("sender@example.com")); err == nil {
+			t.Fatalf("AnalyzeEmail() #%d succeeded, want an error", i+1)
+		}
+	}
+	if llm.callCount() != 1 {
+		t.Errorf("LLM called %d times, want 1", llm.callCount())
+	}
+
+	// Other senders are still analyzed
+	if _, err := service.AnalyzeEmail(context.Background(), testEmail("other@example.com")); err == nil {
+		t.Fatal("AnalyzeEmail() for another sender succeeded, want an error")
+	}
+	if llm.callCount() != 2 {
+		t.Errorf("LLM called %d times, want 2", llm.callCount())
+	}
+}
+
+func TestErrorCacheExpires(t *testing.T) {
+	llm := &fakeLLM{err: errors.New("provider unavailable")}
+	service := newTestService(llm, nil, ServiceOptions{ErrorTTL: time.Millisecond})
+
+	service.AnalyzeEmail(context.Background(), testEmail("sender@example.com"))
+	time.Sleep(5 * time.Millisecond)
+	service.AnalyzeEmail(context.Background(), testEmail("sender@example.com"))
+	if llm.callCount() != 2 {
+		t.Errorf("LLM called %d times, want 2 after the window", llm.callCount())
+	}
+}
+
+func TestErrorCacheSkipsCallerCancellation(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"cancelled", context.Canceled},
+		{"wrapped cancellation", errors.Join(errors.New("request failed"), context.Canceled)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			llm := &fakeLLM{err: tt.err}
+			service := newTestService(llm, nil, ServiceOptions{ErrorTTL: time.Minute})
+
+			service.AnalyzeEmail(context.Background(), testEmail("sender@example.com"))
+			llm.err = nil
+			if _, err := service.AnalyzeEmail(context.Background(), testEmail("sender@example.com")); err != nil {
+				t.Fatalf("AnalyzeEmail() error = %v, want a fresh analysis", err)
+			}
+			if llm.callCount() != 2 {
+				t.Errorf("LLM called %d times, want 2", llm.callCount())
+			}
+		})
+	}
+}
+
+func TestErrorCacheSkipsExpiredDeadline(t *testing.T) {
+	llm := &fakeLLM{err: context.DeadlineExceeded}
+	service := newTestService(llm, nil, ServiceOptions{ErrorTTL: time.Minute})
+
+	ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	service.AnalyzeEmail(ctx, testEmail("sender@example.com"))
+
+	llm.err = nil
+	if _, err := service.AnalyzeEmail(context.Background(), testEmail("sender@example.com")); err != nil {
+		t.Fatalf("AnalyzeEmail() error = %v, want a fresh analysis", err)
+	}
+	if llm.callCount() != 2 {
+		t.Errorf("LLM called %d times, want 2", llm.callCount())
+	}
+}
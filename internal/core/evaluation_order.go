@@ -0,0 +1,55 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Evaluation stages, each of which may decide an email's verdict before the
+// stages after it run
+const (
+	// StageWhitelist passes emails from whitelisted sender domains
+	StageWhitelist = "whitelist"
+
+	// StageHeuristics applies the attachment, content type and short body
+	// rules
+	StageHeuristics = "heuristics"
+
+	// StageCache reuses a cached verdict for the sender
+	StageCache = "cache"
+
+	// StageLLM analyzes the email with the LLM
+	StageLLM = "llm"
+)
+
+// DefaultEvaluationOrder is the order stages run in if none is configured
+var DefaultEvaluationOrder = []string{StageWhitelist, StageHeuristics, StageCache, StageLLM}
+
+// ValidateEvaluationOrder checks that an evaluation order names only known
+// stages, each at most once, and that the LLM, if listed, is last. Stages
+// that are left out are skipped, except the LLM, which always runs if no
+// earlier stage decides.
+func ValidateEvaluationOrder(order []string) error {
+	if len(order) == 0 {
+		return fmt.Errorf("evaluation order is empty")
+	}
+
+	seen := make(map[string]bool)
+	for i, stage := range order {
+		switch stage {
+		case StageWhitelist, StageHeuristics, StageCache:
+		case StageLLM:
+			if i != len(order)-1 {
+				return fmt.Errorf("stage %s must be last in the evaluation order", StageLLM)
+			}
+		default:
+			return fmt.Errorf("unknown evaluation stage %q, expected one of %s", stage,
+				strings.Join(DefaultEvaluationOrder, ", "))
+		}
+		if seen[stage] {
+			return fmt.Errorf("evaluation stage %s is listed more than once", stage)
+		}
+		seen[stage] = true
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestEvaluationOrderDecidesStage(t *testing.T) {
+	tests := []struct {
+		name   string
+		order  []string
+		isSpam bool
+		model  string
+	}{
+		{"whitelist first", []string{StageWhitelist, StageCache, StageLLM}, false, "whitelist"},
+		{"cache first", []string{StageCache, StageWhitelist, StageLLM}, true, "cached-model"},
+		{"llm only", []string{StageLLM}, false, "llm-model"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A sender that was cached as spam and has since been whitelisted
+			cache := newFakeCache()
+			cache.Set(context.Background(), "sender@example.com", &SpamAnalysisResult{IsSpam: true, Score: 0.9, ModelUsed: "cached-model"}, time.Hour)
+			llm := &fakeLLM{result: SpamAnalysisResult{Score: 0.1, ModelUsed: "llm-model"}}
+			service := NewSpamFilterService(llm, cache, zap.NewNop(), true, time.Hour, 0.7, []string{"example.com"}, nil, nil,
+				ServiceOptions{EvaluationOrder: tt.order})
+
+			result, err := service.AnalyzeEmail(context.Background(), testEmail("sender@example.com"))
+			if err != nil {
+				t.Fatalf("AnalyzeEmail() error = %v", err)
+			}
+			if result.IsSpam != tt.isSpam || result.ModelUsed != tt.model {
+				t.Errorf("got is_spam=%t model=%q, want %t %q", result.IsSpam, result.ModelUsed, tt.isSpam, tt.model)
+			}
+		})
+	}
+}
+
+func TestValidateEvaluationOrder(t *testing.T) {
+	valid := [][]string{
+		DefaultEvaluationOrder,
+		{StageCache, StageWhitelist, StageHeuristics, StageLLM},
+		{StageWhitelist},
+	}
+	for _, order := range valid {
+		if err := ValidateEvaluationOrder(order); err != nil {
+			t.Errorf("ValidateEvaluationOrder(%q) error = %v", order, err)
+		}
+	}
+
+	invalid := [][]string{
+		nil,
+		{StageLLM, StageCache},
+		{StageCache, StageCache, StageLLM},
+		{"blacklist", StageLLM},
+	}
+	for _, order := range invalid {
+		if err := ValidateEvaluationOrder(order); err == nil {
+			t.Errorf("ValidateEvaluationOrder(%q) succeeded, want an error", order)
+		}
+	}
+}
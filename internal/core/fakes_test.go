@@ -0,0 +1,112 @@
+package core
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// fakeLLM is an LLMClient returning a fixed result or error, counting its
+// calls
+type fakeLLM struct {
+	mu     sync.Mutex
+	result SpamAnalysisResult
+	err    error
+	calls  int
+	emails []*Email
+}
+
+func (f *fakeLLM) AnalyzeEmail(ctx context.Context, email *Email) (*SpamAnalysisResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	f.emails = append(f.emails, email)
+	if f.err != nil {
+		return nil, f.err
+	}
+	result := f.result
+	return &result, nil
+}
+
+func (f *fakeLLM) callCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+// fakeCacheEntry is a result cached by fakeCache
+type fakeCacheEntry struct {
+	result  SpamAnalysisResult
+	expired bool
+}
+
+// fakeCache is an in-memory CacheRepository and StaleCacheReader whose
+// entries expire only when marked so
+type fakeCache struct {
+	mu      sync.Mutex
+	entries map[string]fakeCacheEntry
+}
+
+func newFakeCache() *fakeCache {
+	return &fakeCache{entries: make(map[string]fakeCacheEntry)}
+}
+
+func (c *fakeCache) Get(ctx context.Context, key string) (*SpamAnalysisResult, bool) {
+	return c.get(key, false)
+}
+
+func (c *fakeCache) GetAllowExpired(ctx context.Context, key string) (*SpamAnalysisResult, bool) {
+	return c.get(key, true)
+}
+
+func (c *fakeCache) get(key string, allowExpired bool) (*SpamAnalysisResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || (entry.expired && !allowExpired) {
+		return nil, false
+	}
+	result := entry.result
+	return &result, true
+}
+
+func (c *fakeCache) Set(ctx context.Context, key string, result *SpamAnalysisResult, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = fakeCacheEntry{result: *result}
+}
+
+func (c *fakeCache) Delete(ctx context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+	return nil
+}
+
+// expire marks the entry for key as expired
+func (c *fakeCache) expire(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := c.entries[key]
+	entry.expired = true
+	c.entries[key] = entry
+}
+
+// newTestService creates a service with caching enabled, a 0.7 threshold
+// and the given options
+func newTestService(llm LLMClient, cache CacheRepository, opts ServiceOptions) *SpamFilterService {
+	return NewSpamFilterService(llm, cache, zap.NewNop(), cache != nil, time.Hour, 0.7, nil, nil, nil, opts)
+}
+
+// testEmail returns a plain email from sender
+func testEmail(sender string) *Email {
+	return &Email{
+		From:    sender,
+		To:      []string{"user@example.org"},
+		Subject: "Hello",
+		Body:    "Just checking in about the meeting next week.",
+		Headers: map[string][]string{},
+	}
+}
@@ -0,0 +1,88 @@
+package core
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// authResultPattern matches a method result in an Authentication-Results
+// header, e.g. "spf=pass"
+var authResultPattern = regexp.MustCompile(`(?i)\b(spf|dkim|dmarc)\s*=\s*([a-z]+)`)
+
+// Features describes a message for training a local model offline
+type Features struct {
+	BodyLength       int    `json:"body_length"`
+	SubjectLength    int    `json:"subject_length"`
+	LinkCount        int    `json:"link_count"`
+	AttachmentCount  int    `json:"attachment_count"`
+	RecipientCount   int    `json:"recipient_count"`
+	RecipientDomains int    `json:"recipient_domains"`
+	SignalCount      int    `json:"signal_count"`
+	Bulk             bool   `json:"bulk"`
+	ValidFrom        bool   `json:"valid_from"`
+	SPF              string `json:"spf"`
+	DKIM             string `json:"dkim"`
+	DMARC            string `json:"dmarc"`
+}
+
+// FeatureRecord is a message's features alongside its LLM verdict
+type FeatureRecord struct {
+	ProcessingID string    `json:"processing_id,omitempty"`
+	Sender       string    `json:"sender"`
+	RecordedAt   time.Time `json:"recorded_at"`
+	Features     Features  `json:"features"`
+	IsSpam       bool      `json:"is_spam"`
+	Score        float64   `json:"score"`
+	Confidence   float64   `json:"confidence"`
+	Model        string    `json:"model"`
+}
+
+// ExtractFeatures computes the features of an email. Authentication
+// results come from the topmost Authentication-Results header, and are
+// empty if it has no result for a method.
+func ExtractFeatures(email *Email) Features {
+	features := Features{
+		BodyLength:      len(email.Body),
+		SubjectLength:   len(email.Subject),
+		LinkCount:       len(linkPattern.FindAllStringIndex(email.Body, -1)),
+		AttachmentCount: len(email.Attachments),
+		RecipientCount:  len(email.To),
+		SignalCount:     len(email.Signals),
+		Bulk:            isBulk(email),
+		ValidFrom:       hasValidAddress(email.From),
+	}
+
+	domains := make(map[string]bool)
+	for _, to := range email.To {
+		if at := strings.LastIndex(to, "@"); at >= 0 {
+			domains[strings.ToLower(strings.Trim(to[at+1:], "> "))] = true
+		}
+	}
+	features.RecipientDomains = len(domains)
+
+	for key, values := range email.Headers {
+		if !strings.EqualFold(key, "Authentication-Results") || len(values) == 0 {
+			continue
+		}
+		for _, match := range authResultPattern.FindAllStringSubmatch(values[0], -1) {
+			result := strings.ToLower(match[2])
+			switch strings.ToLower(match[1]) {
+			case "spf":
+				if features.SPF == "" {
+					features.SPF = result
+				}
+			case "dkim":
+				if features.DKIM == "" {
+					features.DKIM = result
+				}
+			case "dmarc":
+				if features.DMARC == "" {
+					features.DMARC = result
+				}
+			}
+		}
+	}
+
+	return features
+}
@@ -0,0 +1,105 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// FeedbackService records verdict corrections and optionally applies them to the cache
+type FeedbackService struct {
+	store       FeedbackStore
+	cacheRepo   CacheRepository
+	logger      *zap.Logger
+	updateCache bool
+	cacheTTL    time.Duration
+
+	stripSubaddress  bool
+	includeRecipient bool
+}
+
+// NewFeedbackService creates a new feedback service
+func NewFeedbackService(
+	store FeedbackStore,
+	cacheRepo CacheRepository,
+	logger *zap.Logger,
+	updateCache bool,
+	cacheTTL time.Duration,
+	stripSubaddress bool,
+	includeRecipient bool,
+) *FeedbackService {
+	return &FeedbackService{
+		store:       store,
+		cacheRepo:   cacheRepo,
+		logger:      logger,
+		updateCache: updateCache,
+		cacheTTL:    cacheTTL,
+
+		stripSubaddress:  stripSubaddress,
+		includeRecipient: includeRecipient,
+	}
+}
+
+// Submit records the correct label for a message or sender. When the id is a
+// sender address and cache updates are enabled, the cached verdict for that
+// sender is overridden with the corrected label. If verdicts are cached per
+// recipient, the verdicts for each of the given recipients are overridden
+// instead, and at least one recipient is required.
+func (s *FeedbackService) Submit(ctx context.Context, id string, recipients []string, isSpam bool) error {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return fmt.Errorf("feedback id is required")
+	}
+	overrideCache := s.updateCache && s.cacheRepo != nil && strings.Contains(id, "@")
+	if overrideCache && s.includeRecipient && len(recipients) == 0 {
+		return fmt.Errorf("verdicts are cached per recipient, so feedback for a sender needs the recipients to correct")
+	}
+
+	if err := s.store.Record(ctx, id, isSpam); err != nil {
+		return fmt.Errorf("failed to record feedback: %w", err)
+	}
+
+	s.logger.Info("Recorded feedback",
+		zap.String("id", id),
+		zap.Bool("is_spam", isSpam))
+
+	// Processing IDs can't be mapped back to a sender, so only addresses
+	// can be used to override the cache
+	if !overrideCache {
+		return nil
+	}
+
+	score := 0.0
+	if isSpam {
+		score = 1.0
+	}
+	cacheKey := normalizeAddress(id, s.stripSubaddress)
+	keys := []string{cacheKey}
+	if s.includeRecipient {
+		keys = keys[:0]
+		for _, recipient := range recipients {
+			keys = append(keys, recipientCacheKey(cacheKey, recipient, s.stripSubaddress))
+		}
+	}
+	for _, key := range keys {
+		s.cacheRepo.Set(ctx, key, &SpamAnalysisResult{
+			IsSpam:      isSpam,
+			Score:       score,
+			Confidence:  1.0,
+			Explanation: "Verdict corrected by feedback",
+			AnalyzedAt:  time.Now(),
+			ModelUsed:   "feedback",
+		}, s.cacheTTL)
+
+		s.logger.Info("Overrode cached verdict from feedback",
+			zap.String("sender", id),
+			zap.String("cache_key", key),
+			zap.Bool("is_spam", isSpam),
+			zap.Duration("ttl", s.cacheTTL))
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// fakeFeedbackStore is a FeedbackStore remembering the labels it records
+type fakeFeedbackStore struct {
+	labels map[string]bool
+}
+
+func (s *fakeFeedbackStore) Record(ctx context.Context, id string, isSpam bool) error {
+	if s.labels == nil {
+		s.labels = make(map[string]bool)
+	}
+	s.labels[id] = isSpam
+	return nil
+}
+
+func TestFeedbackOverridesSenderVerdict(t *testing.T) {
+	store := &fakeFeedbackStore{}
+	cache := newFakeCache()
+	feedback := NewFeedbackService(store, cache, zap.NewNop(), true, time.Hour, false, false)
+
+	if err := feedback.Submit(context.Background(), "Sender@Example.com", nil, false); err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	if isSpam, ok := store.labels["Sender@Example.com"]; !ok || isSpam {
+		t.Errorf("store labels = %v, want the sender recorded as ham", store.labels)
+	}
+	cached, found := cache.Get(context.Background(), "sender@example.com")
+	if !found || cached.IsSpam || cached.ModelUsed != "feedback" {
+		t.Errorf("cached = %+v, %t, want the corrected ham verdict", cached, found)
+	}
+}
+
+func TestFeedbackUpdatesCachedVerdict(t *testing.T) {
+	cache := newFakeCache()
+	llm := &fakeLLM{result: SpamAnalysisResult{IsSpam: true, Score: 0.9}}
+	service := newTestService(llm, cache, ServiceOptions{})
+
+	email := testEmail("sender@example.com")
+	if _, err := service.AnalyzeEmail(context.Background(), email); err != nil {
+		t.Fatalf("AnalyzeEmail() error = %v", err)
+	}
+
+	feedback := NewFeedbackService(&fakeFeedbackStore{}, cache, zap.NewNop(), true, time.Hour, false, false)
+	if err := feedback.Submit(context.Background(), "sender@example.com", nil, false); err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+
+	result, err := service.AnalyzeEmail(context.Background(), email)
+	if err != nil {
+		t.Fatalf("AnalyzeEmail() error = %v", err)
+	}
+	if result.IsSpam || result.ModelUsed != "feedback" {
+		t.Errorf("got is_spam=%t model=%s, want the corrected verdict from the cache", result.IsSpam, result.ModelUsed)
+	}
+	if llm.callCount() != 1 {
+		t.Errorf("LLM called %d times, want 1", llm.callCount())
+	}
+}
+
+func TestFeedbackLeavesCacheWhenDisabled(t *testing.T) {
+	cache := newFakeCache()
+	feedback := NewFeedbackService(&fakeFeedbackStore{}, cache, zap.NewNop(), false, time.Hour, false, false)
+
+	if err := feedback.Submit(context.Background(), "sender@example.com", nil, false); err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	if _, found := cache.Get(context.Background(), "sender@example.com"); found {
+		t.Error("feedback was cached with cache updates disabled")
+	}
+}
+
+func TestFeedbackOverridesPerRecipientVerdicts(t *testing.T) {
+	cache := newFakeCache()
+	llm := &fakeLLM{result: SpamAnalysisResult{IsSpam: true, Score: 0.9}}
+	service := newTestService(llm, cache, ServiceOptions{CacheIncludeRecipient: true})
+
+	email := testEmail("sender@example.com")
+	email.To = []string{"alice@example.org", "bob@example.org"}
+	if _, err := service.AnalyzeEmail(context.Background(), email); err != nil {
+		t.Fatalf("AnalyzeEmail() error = %v", err)
+	}
+
+	feedback := NewFeedbackService(&fakeFeedbackStore{}, cache, zap.NewNop(), true, time.Hour, false, true)
+	if err := feedback.Submit(context.Background(), "sender@example.com", []string{"alice@example.org", "Bob@example.org"}, false); err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+
+	result, err := service.AnalyzeEmail(context.Background(), email)
+	if err != nil {
+		t.Fatalf("AnalyzeEmail() error = %v", err)
+	}
+	if result.IsSpam || result.ModelUsed != "feedback" {
+		t.Errorf("got is_spam=%t model=%s, want the corrected verdict from the cache", result.IsSpam, result.ModelUsed)
+	}
+	if llm.callCount() != 1 {
+		t.Errorf("LLM called %d times, want 1", llm.callCount())
+	}
+}
+
+func TestFeedbackForSenderNeedsRecipientsWithPerRecipientKeys(t *testing.T) {
+	store := &fakeFeedbackStore{}
+	feedback := NewFeedbackService(store, newFakeCache(), zap.NewNop(), true, time.Hour, false, true)
+
+	if err := feedback.Submit(context.Background(), "sender@example.com", nil, false); err == nil {
+		t.Fatal("Submit() without recipients succeeded, want an error")
+	}
+	if len(store.labels) != 0 {
+		t.Errorf("store labels = %v, want nothing recorded", store.labels)
+	}
+
+	// Processing IDs don't touch the cache, so need no recipients
+	if err := feedback.Submit(context.Background(), "3f2c1a9e-processing-id", nil, true); err != nil {
+		t.Errorf("Submit() for a processing ID error = %v", err)
+	}
+}
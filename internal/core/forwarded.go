@@ -0,0 +1,114 @@
+package core
+
+import (
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+)
+
+// forwardedMarker matches the line introducing an inline forward, as
+// written by Gmail ("---------- Forwarded message ---------") and Apple
+// Mail ("Begin forwarded message:")
+var forwardedMarker = regexp.MustCompile(`(?im)^[ \t>]*(?:-{3,}[ \t]*forwarded message[ \t]*-{3,}|begin forwarded message:)[ \t]*\r?$`)
+
+// forwardedHeaderLines bounds the lines after the marker searched for the
+// original message's headers
+const forwardedHeaderLines = 10
+
+// unwrapForwarded returns a copy of an email that was forwarded, with the
+// sender and subject of the original message, so that the original sender
+// is classified rather than whoever forwarded it. Messages attached as
+// message/rfc822 parts are used first, then inline forwards in the body.
+// Messages forwarded automatically, with X-Forwarded-For or X-Forwarded-To
+// headers, keep the original From header while the envelope sender is the
+// forwarder, so the From header's address is used.
+func unwrapForwarded(email *Email) (*Email, bool) {
+	var from, subject string
+	switch {
+	case email.Embedded != nil && originalAddress(email.Embedded.From) != "":
+		from, subject = originalAddress(email.Embedded.From), email.Embedded.Subject
+	case forwardedMarker.MatchString(email.Body):
+		from, subject = inlineForwardHeaders(email.Body)
+	case hasHeader(email, "X-Forwarded-For") || hasHeader(email, "X-Forwarded-To"):
+		from = originalAddress(headerValue(email, "From"))
+	}
+	if from == "" || strings.EqualFold(from, normalizeAddress(email.From, false)) {
+		return nil, false
+	}
+
+	unwrapped := *email
+	unwrapped.From = from
+	if subject != "" {
+		unwrapped.Subject = subject
+	}
+	unwrapped.Signals = append(email.Signals[:len(email.Signals):len(email.Signals)],
+		fmt.Sprintf("Forwarded by %s; classifying the original sender", normalizeAddress(email.From, false)))
+	return &unwrapped, true
+}
+
+// inlineForwardHeaders returns the sender and subject from the header block
+// following the first forwarded message marker in a body
+func inlineForwardHeaders(body string) (from, subject string) {
+	loc := forwardedMarker.FindStringIndex(body)
+	if loc == nil {
+		return "", ""
+	}
+	lines := strings.Split(body[loc[1]:], "\n")
+	for i := 0; i < len(lines) && i < forwardedHeaderLines; i++ {
+		line := strings.TrimSpace(strings.TrimLeft(lines[i], "> \t"))
+		if line == "" {
+			if from != "" {
+				break
+			}
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "from":
+			from = originalAddress(value)
+		case "subject":
+			subject = strings.TrimSpace(value)
+		}
+	}
+	return from, subject
+}
+
+// originalAddress returns the lowercased address in a From value, such as
+// "Name <a@example.com>" or "Name a@example.com", or an empty string
+func originalAddress(value string) string {
+	value = strings.TrimSpace(value)
+	if parsed, err := mail.ParseAddress(value); err == nil {
+		return strings.ToLower(parsed.Address)
+	}
+	for _, field := range strings.Fields(value) {
+		field = strings.Trim(field, "<>[]()\"'")
+		if at := strings.LastIndex(field, "@"); at > 0 && at < len(field)-1 {
+			return strings.ToLower(field)
+		}
+	}
+	return ""
+}
+
+// hasHeader returns whether an email has a header, ignoring case
+func hasHeader(email *Email, name string) bool {
+	for key := range email.Headers {
+		if strings.EqualFold(key, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// headerValue returns the first value of a header, ignoring case
+func headerValue(email *Email, name string) string {
+	for key, values := range email.Headers {
+		if strings.EqualFold(key, name) && len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,106 @@
+package core
+
+import (
+	"context"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// gmailForward is the body of a message forwarded from Gmail
+const gmailForward = "Is this a scam?\r\n\r\n" +
+	"---------- Forwarded message ---------\r\n" +
+	"From: Prize Department <claims@lottery.example>\r\n" +
+	"Date: Mon, 1 Jan 2024 at 09:00\r\n" +
+	"Subject: You have won $1,000,000\r\n" +
+	"To: <jane@example.org>\r\n" +
+	"\r\n" +
+	"Send your bank details to claim your prize.\r\n"
+
+func TestUnwrapForwarded(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		headers  map[string][]string
+		embedded *EmbeddedMessage
+		from     string
+		subject  string
+	}{
+		{
+			name:    "gmail inline",
+			body:    gmailForward,
+			from:    "claims@lottery.example",
+			subject: "You have won $1,000,000",
+		},
+		{
+			name:    "apple mail quoted",
+			body:    "FYI\n\nBegin forwarded message:\n\n> From: Prize Department claims@lottery.example\n> Subject: Claim now\n",
+			from:    "claims@lottery.example",
+			subject: "Claim now",
+		},
+		{
+			name:     "attached message",
+			body:     "See attached",
+			embedded: &EmbeddedMessage{From: "Prize <claims@lottery.example>", Subject: "Claim now"},
+			from:     "claims@lottery.example",
+			subject:  "Claim now",
+		},
+		{
+			name:    "automatic forward",
+			body:    "Claim your prize.",
+			headers: map[string][]string{"X-Forwarded-For": {"jane@example.org"}, "From": {"claims@lottery.example"}},
+			from:    "claims@lottery.example",
+			subject: "Hello",
+		},
+		{
+			name: "not forwarded",
+			body: "Just checking in.",
+		},
+		{
+			name: "forwarded by the sender",
+			body: "---------- Forwarded message ---------\nFrom: jane@example.org\nSubject: Notes\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			email := testEmail("Jane <jane@example.org>")
+			email.Body = tt.body
+			email.Embedded = tt.embedded
+			if tt.headers != nil {
+				email.Headers = tt.headers
+			}
+
+			unwrapped, ok := unwrapForwarded(email)
+			if ok != (tt.from != "") {
+				t.Fatalf("unwrapForwarded() ok = %t, want %t", ok, tt.from != "")
+			}
+			if !ok {
+				return
+			}
+			if unwrapped.From != tt.from || unwrapped.Subject != tt.subject {
+				t.Errorf("unwrapped from %q subject %q, want %q %q", unwrapped.From, unwrapped.Subject, tt.from, tt.subject)
+			}
+			if email.From != "Jane <jane@example.org>" || len(email.Signals) != 0 {
+				t.Errorf("caller's email = %+v, want it unchanged", email)
+			}
+		})
+	}
+}
+
+func TestForwardedMessageClassifiesOriginalSender(t *testing.T) {
+	llm := &fakeLLM{result: SpamAnalysisResult{Score: 0.95}}
+	service := NewSpamFilterService(llm, nil, zap.NewNop(), false, 0, 0.7, []string{"example.org"}, nil, nil, ServiceOptions{UnwrapForwarded: true})
+
+	email := testEmail("jane@example.org")
+	email.Body = gmailForward
+	result, err := service.AnalyzeEmail(context.Background(), email)
+	if err != nil {
+		t.Fatalf("AnalyzeEmail() error = %v", err)
+	}
+	if llm.callCount() != 1 || !result.IsSpam {
+		t.Fatalf("result = %+v, want the forwarder's whitelisting ignored", result)
+	}
+	if analyzed := llm.emails[0]; analyzed.From != "claims@lottery.example" || analyzed.Subject != "You have won $1,000,000" {
+		t.Errorf("model saw from %q subject %q, want the original message's", analyzed.From, analyzed.Subject)
+	}
+}
@@ -0,0 +1,25 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mikey/llm-spam-filter/internal/utils"
+)
+
+// homographSignal returns a signal for an email whose sender domain is an
+// internationalized domain imitating a Latin one, as in a Cyrillic
+// аррӏе.com, and false otherwise
+func homographSignal(email *Email) (string, bool) {
+	sender := normalizeAddress(email.From, false)
+	at := strings.LastIndex(sender, "@")
+	if at < 0 {
+		return "", false
+	}
+	domain := sender[at+1:]
+	unicodeDomain, suspicious := utils.HomographDomain(domain)
+	if !suspicious {
+		return "", false
+	}
+	return fmt.Sprintf("Sender domain %s (%s) mixes scripts or imitates Latin letters", utils.NormalizeDomain(domain), unicodeDomain), true
+}
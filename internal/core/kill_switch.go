@@ -0,0 +1,37 @@
+package core
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// SetLLMDisabled turns the kill switch on or off. While it is on, emails
+// that reach the LLM stage are given the kill switch verdict instead.
+func (s *SpamFilterService) SetLLMDisabled(disabled bool) {
+	if s.llmDisabled.Swap(disabled) != disabled {
+		s.logger.Warn("LLM kill switch changed", zap.Bool("llm_disabled", disabled))
+	}
+}
+
+// LLMDisabled returns whether the kill switch is on
+func (s *SpamFilterService) LLMDisabled() bool {
+	return s.llmDisabled.Load()
+}
+
+// killSwitchResult returns the verdict given while the kill switch is on
+func (s *SpamFilterService) killSwitchResult() *SpamAnalysisResult {
+	score := 0.0
+	if s.opts.KillSwitchIsSpam {
+		score = 1.0
+	}
+	return &SpamAnalysisResult{
+		IsSpam:      s.opts.KillSwitchIsSpam,
+		Score:       score,
+		Confidence:  0.0,
+		Explanation: "LLM analysis is disabled by the kill switch",
+		AnalyzedAt:  time.Now(),
+		ModelUsed:   "kill-switch",
+		SkipReason:  "kill switch",
+	}
+}
@@ -0,0 +1,57 @@
+package core
+
+import (
+	"context"
+	"testing"
+)
+
+func TestKillSwitchStopsLLMCalls(t *testing.T) {
+	llm := &fakeLLM{result: SpamAnalysisResult{IsSpam: true, Score: 0.9}}
+	cache := newFakeCache()
+	service := newTestService(llm, cache, ServiceOptions{})
+
+	service.SetLLMDisabled(true)
+	for i := 0; i < 3; i++ {
+		result, err := service.AnalyzeEmail(context.Background(), testEmail("sender@example.com"))
+		if err != nil {
+			t.Fatalf("AnalyzeEmail() error = %v", err)
+		}
+		if result.IsSpam || result.ModelUsed != "kill-switch" {
+			t.Errorf("result = %+v, want the kill switch's ham verdict", result)
+		}
+	}
+	if calls := llm.callCount(); calls != 0 {
+		t.Errorf("LLM calls with the kill switch on = %d, want 0", calls)
+	}
+	if _, found := cache.Get(context.Background(), "sender@example.com"); found {
+		t.Error("kill switch verdict was cached")
+	}
+
+	service.SetLLMDisabled(false)
+	result, err := service.AnalyzeEmail(context.Background(), testEmail("sender@example.com"))
+	if err != nil {
+		t.Fatalf("AnalyzeEmail() error = %v", err)
+	}
+	if !result.IsSpam || llm.callCount() != 1 {
+		t.Errorf("after turning the kill switch off got %+v with %d LLM calls, want the LLM's verdict", result, llm.callCount())
+	}
+}
+
+func TestKillSwitchVerdictIsConfigurable(t *testing.T) {
+	llm := &fakeLLM{}
+	service := newTestService(llm, nil, ServiceOptions{LLMDisabled: true, KillSwitchIsSpam: true})
+	if !service.LLMDisabled() {
+		t.Fatal("LLMDisabled() = false, want the service to start with the kill switch on")
+	}
+
+	result, err := service.AnalyzeEmail(context.Background(), testEmail("sender@example.com"))
+	if err != nil {
+		t.Fatalf("AnalyzeEmail() error = %v", err)
+	}
+	if !result.IsSpam || result.Score != 1.0 || result.SkipReason != "kill switch" {
+		t.Errorf("result = %+v, want the configured spam verdict", result)
+	}
+	if llm.callCount() != 0 {
+		t.Errorf("LLM calls = %d, want 0", llm.callCount())
+	}
+}
@@ -6,28 +6,87 @@ import (
 
 // Email represents an email message
 type Email struct {
+	From        string
+	To          []string
+	Subject     string
+	Body        string
+	Headers     map[string][]string
+	Attachments []Attachment
+	// AttachmentText holds text extracted from attachments, if enabled
+	AttachmentText string
+	// Signals lists notable findings about the message to show the model
+	Signals []string
+	// SubjectOnly asks for a classification from the sender and subject
+	// alone, leaving the body out of the prompt
+	SubjectOnly bool
+	// Embedded holds the sender and subject of the first message attached
+	// as a message/rfc822 part, such as a forward as attachment
+	Embedded *EmbeddedMessage
+}
+
+// EmbeddedMessage describes a message carried inside another
+type EmbeddedMessage struct {
 	From    string
-	To      []string
 	Subject string
-	Body    string
-	Headers map[string][]string
+}
+
+// Attachment describes a non-text part of an email message
+type Attachment struct {
+	Filename    string
+	ContentType string
 }
 
 // SpamAnalysisResult represents the result of spam analysis
 type SpamAnalysisResult struct {
 	IsSpam       bool
 	Score        float64
+	RawScore     float64
 	Confidence   float64
 	Explanation  string
 	AnalyzedAt   time.Time
 	ModelUsed    string
 	ProcessingID string
+	SkipReason   string
+	Bulk         bool
+	Trace        *DecisionTrace
+	// Provider is the LLM provider that scored the email, whose score
+	// calibration applies
+	Provider string
+	// Threshold is the spam threshold the score was compared to, after
+	// domain thresholds and reputation (0 if no threshold decided)
+	Threshold float64
+	// ProviderVerdicts lists each provider's verdict when several were
+	// combined into a consensus
+	ProviderVerdicts []ProviderVerdict
+}
+
+// ProviderVerdict is one provider's part in a consensus verdict
+type ProviderVerdict struct {
+	Provider  string
+	Weight    float64
+	Responded bool
+	IsSpam    bool
+	Score     float64
+	// Error holds why the provider failed, if it did
+	Error string
+}
+
+// ProbeEmail returns a tiny email for validating providers that have no
+// lighter call than an analysis
+func ProbeEmail() *Email {
+	return &Email{
+		From:    "probe@example.com",
+		To:      []string{"probe@example.com"},
+		Subject: "Startup check",
+		Body:    "This message checks that the spam filter can reach its provider.",
+	}
 }
 
 type CacheEntry struct {
 	SenderEmail string
 	IsSpam      bool
 	Score       float32
+	Confidence  float32
 	LastSeen    time.Time
 	ExpiresAt   time.Time
 }
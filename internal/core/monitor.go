@@ -0,0 +1,45 @@
+package core
+
+import "strings"
+
+// Monitored returns whether an email's sender or any of its recipients is
+// on a monitor list, whose spam is tagged but never rejected
+func (s *SpamFilterService) Monitored(email *Email) bool {
+	if matchesAddressList(s.opts.MonitorSenders, email.From) {
+		return true
+	}
+	for _, recipient := range email.To {
+		if matchesAddressList(s.opts.MonitorRecipients, recipient) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAddressList returns whether an address is on a list of lowercase
+// addresses and domains. Domains also cover their subdomains.
+func matchesAddressList(list []string, address string) bool {
+	if len(list) == 0 {
+		return false
+	}
+	address = normalizeAddress(address, false)
+	at := strings.LastIndex(address, "@")
+	if at < 0 {
+		return false
+	}
+
+	for _, entry := range list {
+		if entry == address {
+			return true
+		}
+	}
+	for domain := address[at+1:]; domain != ""; {
+		for _, entry := range list {
+			if entry == domain {
+				return true
+			}
+		}
+		_, domain, _ = strings.Cut(domain, ".")
+	}
+	return false
+}
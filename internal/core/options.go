@@ -0,0 +1,194 @@
+package core
+
+import (
+	"time"
+)
+
+// Cache policies control which verdicts are cached by sender
+const (
+	CachePolicyBoth     = "both"
+	CachePolicyHamOnly  = "ham_only"
+	CachePolicySpamOnly = "spam_only"
+)
+
+// ServiceOptions holds optional settings for the spam filter service
+type ServiceOptions struct {
+	// SkipContentTypes lists top-level content types that bypass analysis
+	SkipContentTypes []string
+
+	// StripSubaddress removes +tags from the sender's local part when
+	// computing cache keys
+	StripSubaddress bool
+
+	// DangerousExtensions lists attachment extensions (without the leading
+	// dot) that force a spam verdict
+	DangerousExtensions []string
+
+	// DecisionTrace records how each verdict was reached on the result
+	DecisionTrace bool
+
+	// DomainThresholds maps lowercase sender domains to spam thresholds
+	// used instead of the global one, also covering their subdomains
+	DomainThresholds map[string]float64
+
+	// BayesClassifier scores emails with a locally trained classifier,
+	// blended with the LLM's score (nil to disable)
+	BayesClassifier BayesClassifier
+
+	// BayesWeight is the share of the blended score taken from the
+	// BayesClassifier, between 0 and 1
+	BayesWeight float64
+
+	// ReputationWeight is the maximum amount a sender's reputation can move
+	// the spam threshold in either direction
+	ReputationWeight float64
+
+	// CacheIncludeRecipient caches verdicts per sender and recipient, for
+	// shared mailboxes where recipients trust senders differently
+	CacheIncludeRecipient bool
+
+	// CacheLookupVariants also looks up the keys other keying strategies
+	// would have produced for the sender, such as with or without a +tag,
+	// using the first hit
+	CacheLookupVariants bool
+
+	// CacheSkipDomains lists lowercase sender domains, also covering their
+	// subdomains, whose verdicts are never read from or written to the cache
+	CacheSkipDomains []string
+
+	// CachePolicy selects which verdicts are cached, one of the CachePolicy
+	// constants (empty caches both)
+	CachePolicy string
+
+	// MinCacheConfidence is the confidence a verdict needs to be cached, so
+	// that uncertain verdicts are not reused (0 to cache any verdict)
+	MinCacheConfidence float64
+
+	// MinBodyLength is the body length in characters below which the LLM is
+	// skipped, unless the email has links or attachments (0 to disable)
+	MinBodyLength int
+
+	// ShortBodyIsSpam is the verdict returned for bodies below MinBodyLength
+	ShortBodyIsSpam bool
+
+	// VerifyBeforeReject runs a second analysis of a spam verdict before
+	// it is rejected, only rejecting if both agree
+	VerifyBeforeReject bool
+
+	// VerifyClient runs the verification analysis (nil to use the service's
+	// LLM client)
+	VerifyClient LLMClient
+
+	// SkipEncrypted passes PGP and S/MIME encrypted messages through
+	// without analysis
+	SkipEncrypted bool
+
+	// DMARCChecker marks emails failing their From domain's DMARC reject
+	// policy as spam (nil to disable)
+	DMARCChecker DMARCChecker
+
+	// FeatureRecorder logs the features and verdict of every message
+	// analyzed by the LLM, for training a local model (nil to disable)
+	FeatureRecorder FeatureRecorder
+
+	// BulkPolicy is how mail with bulk headers is handled, one of the
+	// BulkPolicy constants (empty to ignore them)
+	BulkPolicy string
+
+	// BulkDownweight is subtracted from the score of bulk mail under the
+	// downweight policy
+	BulkDownweight float64
+
+	// UsePublicSuffix compares whitelisted domains and keys sender
+	// reputation by registrable domain using the public suffix list
+	UsePublicSuffix bool
+
+	// CacheOpTimeout bounds each cache lookup, after which the lookup is
+	// treated as a miss (0 for no limit beyond the caller's deadline)
+	CacheOpTimeout time.Duration
+
+	// LLMRequestTimeout bounds the LLM analysis of an email, separately
+	// from the cache lookup (0 for no limit beyond the caller's deadline)
+	LLMRequestTimeout time.Duration
+
+	// ErrorTTL is how long an analysis failure for a sender is reused
+	// before the LLM is tried again (0 to disable)
+	ErrorTTL time.Duration
+
+	// UseStaleOnError falls back to an expired cached verdict for the
+	// sender, with its confidence halved, when the analysis fails
+	UseStaleOnError bool
+
+	// ScoreCalibrations maps each provider's raw scores before the
+	// threshold is applied, keyed by provider. Providers without one use
+	// the raw score.
+	ScoreCalibrations map[string]*ScoreCalibration
+
+	// DeduplicateAnalyses shares one LLM analysis between concurrent
+	// messages with the same cache key
+	DeduplicateAnalyses bool
+
+	// EvaluationOrder lists the stages that may decide a verdict, in the
+	// order they run (nil for DefaultEvaluationOrder)
+	EvaluationOrder []string
+
+	// RequireValidFrom treats a From header without a parseable address,
+	// such as a bare display name, as a spam signal
+	RequireValidFrom bool
+
+	// InvalidFromScore is added to the score of emails whose From has no
+	// valid address when RequireValidFrom is set
+	InvalidFromScore float64
+
+	// MonitorSenders and MonitorRecipients list lowercase addresses and
+	// domains whose spam is tagged but never rejected
+	MonitorSenders    []string
+	MonitorRecipients []string
+
+	// DeferToUpstream names a header, such as X-Spam-Flag, carrying an
+	// upstream filter's verdict to use instead of analyzing (empty for off)
+	DeferToUpstream string
+
+	// DeferUpstreamHam also defers to upstream verdicts that the message
+	// is not spam, which senders could forge
+	DeferUpstreamHam bool
+
+	// UnwrapForwarded classifies forwarded messages by the sender and
+	// subject of the original message rather than the forwarder's
+	UnwrapForwarded bool
+
+	// IncludeTimeSignal tells the model the hour the email claims it was
+	// sent, in the timezone of its Date header
+	IncludeTimeSignal bool
+
+	// NormalizeIDN compares whitelisted domains with the sender's in
+	// punycode, so Unicode and xn-- spellings of a domain match
+	NormalizeIDN bool
+
+	// FlagHomographDomains tells the model when the sender's domain is an
+	// internationalized domain imitating a Latin one
+	FlagHomographDomains bool
+
+	// CheckEnvelopeMismatch tells the model whether the envelope sender's
+	// domain matches the From header's
+	CheckEnvelopeMismatch bool
+
+	// EnvelopeMismatchScore is added to the score of emails whose envelope
+	// sender doesn't match the From header when CheckEnvelopeMismatch is set
+	EnvelopeMismatchScore float64
+
+	// SubjectOnlyMode controls when the body is left out of the prompt, one
+	// of the SubjectOnly constants (empty for off)
+	SubjectOnlyMode string
+
+	// SubjectOnlyHamBelow and SubjectOnlySpamAbove bound the borderline
+	// subject-only scores for which the prefilter mode analyzes the body
+	SubjectOnlyHamBelow  float64
+	SubjectOnlySpamAbove float64
+
+	// LLMDisabled starts the service with the kill switch on
+	LLMDisabled bool
+
+	// KillSwitchIsSpam is the verdict returned while the kill switch is on
+	KillSwitchIsSpam bool
+}
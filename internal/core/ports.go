@@ -11,8 +11,99 @@ type LLMClient interface {
 	AnalyzeEmail(ctx context.Context, email *Email) (*SpamAnalysisResult, error)
 }
 
+// BatchLLMClient is implemented by LLM clients that can analyze several
+// emails in one call to their provider
+type BatchLLMClient interface {
+	// AnalyzeEmails analyzes emails together, returning a result per email
+	// in order. Emails the provider gave no usable verdict for have a nil
+	// result.
+	AnalyzeEmails(ctx context.Context, emails []*Email) ([]*SpamAnalysisResult, error)
+}
+
+// Validator is implemented by LLM clients that can check at startup that
+// their provider accepts the configured credentials
+type Validator interface {
+	// Validate makes a lightweight call to the provider, returning an error
+	// if it is unreachable or rejects the credentials
+	Validate(ctx context.Context) error
+}
+
 // CacheRepository defines the interface for caching spam analysis results
 type CacheRepository interface {
-	Get(key string) (*SpamAnalysisResult, bool)
-	Set(key string, result *SpamAnalysisResult, ttl time.Duration)
+	Get(ctx context.Context, key string) (*SpamAnalysisResult, bool)
+	Set(ctx context.Context, key string, result *SpamAnalysisResult, ttl time.Duration)
+}
+
+// StaleCacheReader is implemented by caches that can return entries past
+// their expiry, until they are cleaned up
+type StaleCacheReader interface {
+	GetAllowExpired(ctx context.Context, key string) (*SpamAnalysisResult, bool)
+}
+
+// FeedbackStore defines the interface for persisting verdict corrections
+type FeedbackStore interface {
+	// Record stores the correct label for a message, identified by its
+	// processing ID or sender address
+	Record(ctx context.Context, id string, isSpam bool) error
+}
+
+// DigestStore defines the interface for recording rejected messages for
+// later review
+type DigestStore interface {
+	// Record adds a rejected message to the digest
+	Record(ctx context.Context, entry DigestEntry) error
+
+	// List returns the messages rejected since the given time, oldest first
+	List(ctx context.Context, since time.Time) ([]DigestEntry, error)
+
+	// Prune removes messages rejected before the given time
+	Prune(ctx context.Context, before time.Time) error
+}
+
+// DMARCChecker defines the interface for enforcing the From domain's DMARC
+// policy
+type DMARCChecker interface {
+	// Reject returns whether the email fails a DMARC reject policy, and
+	// why
+	Reject(ctx context.Context, email *Email) (bool, string, error)
+}
+
+// ScoreRecorder defines the interface for aggregating spam scores
+type ScoreRecorder interface {
+	// Record adds an analyzed score to the aggregate
+	Record(score float64)
+}
+
+// FeatureRecorder defines the interface for logging message features
+// alongside their verdicts, for training a local model offline
+type FeatureRecorder interface {
+	// Record stores the features and verdict of an analyzed message
+	Record(ctx context.Context, record FeatureRecord) error
+}
+
+// LatencyRecorder defines the interface for aggregating provider latencies
+type LatencyRecorder interface {
+	// Record adds the latency of a call to a provider
+	Record(provider string, latency time.Duration)
+}
+
+// BayesClassifier defines the interface for a locally trained token
+// classifier whose score is blended with the LLM's
+type BayesClassifier interface {
+	// Train adds an email to the spam or ham corpus
+	Train(ctx context.Context, email *Email, isSpam bool) error
+
+	// Score returns the probability that an email is spam, and false if too
+	// little has been trained to score it
+	Score(ctx context.Context, email *Email) (float64, bool, error)
+}
+
+// ReputationStore defines the interface for tracking sender reputation
+type ReputationStore interface {
+	// Record adds a verdict to the sender's reputation
+	Record(sender string, isSpam bool)
+
+	// SpamRatio returns the decayed ratio of spam verdicts for a sender, and
+	// whether the sender has any history
+	SpamRatio(sender string) (float64, bool)
 }
@@ -0,0 +1,32 @@
+package core
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// processingIDKey is the context key for a message's processing ID
+type processingIDKey struct{}
+
+// WithProcessingID returns a context carrying the processing ID of the
+// message being analyzed
+func WithProcessingID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, processingIDKey{}, id)
+}
+
+// ProcessingIDFromContext returns the processing ID carried by ctx, or an
+// empty string if there is none
+func ProcessingIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(processingIDKey{}).(string)
+	return id
+}
+
+// ContextLogger returns logger with the processing ID carried by ctx added
+// to its fields, so that a message can be followed across stages
+func ContextLogger(ctx context.Context, logger *zap.Logger) *zap.Logger {
+	if id := ProcessingIDFromContext(ctx); id != "" {
+		return logger.With(zap.String("processing_id", id))
+	}
+	return logger
+}
@@ -2,12 +2,37 @@ package core
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"math"
+	"mime"
+	"net/mail"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
+	"github.com/mikey/llm-spam-filter/internal/utils"
 	"github.com/mikey/llm-spam-filter/internal/whitelist"
 	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
 )
 
+// linkPattern matches URLs and bare www. hostnames in a body
+var linkPattern = regexp.MustCompile(`(?i)\bhttps?://|\bwww\.`)
+
+// invalidFromSignal tells the model the From header has no valid address
+const invalidFromSignal = "From header has no valid address"
+
+// cacheWriteTimeout bounds how long storing an analyzed result may take
+const cacheWriteTimeout = 5 * time.Second
+
+// staleLookupTimeout bounds the stale cache lookup after a failed analysis
+// when cache.op_timeout is not set
+const staleLookupTimeout = 2 * time.Second
+
 // SpamFilterService is the core service for spam detection
 type SpamFilterService struct {
 	llmClient      LLMClient
@@ -17,6 +42,12 @@ type SpamFilterService struct {
 	cacheTTL       time.Duration
 	spamThreshold  float64
 	whitelistChecker *whitelist.Checker
+	scoreRecorder  ScoreRecorder
+	reputationStore ReputationStore
+	errorCache     *errorCache
+	inflight       singleflight.Group
+	llmDisabled    atomic.Bool
+	opts           ServiceOptions
 }
 
 // NewSpamFilterService creates a new spam filter service
@@ -28,61 +59,774 @@ func NewSpamFilterService(
 	cacheTTL time.Duration,
 	spamThreshold float64,
 	whitelistedDomains []string,
+	scoreRecorder ScoreRecorder,
+	reputationStore ReputationStore,
+	opts ServiceOptions,
 ) *SpamFilterService {
-	return &SpamFilterService{
+	// Only remember analysis failures if enabled
+	var errCache *errorCache
+	if opts.ErrorTTL > 0 {
+		errCache = newErrorCache(opts.ErrorTTL)
+	}
+
+	service := &SpamFilterService{
 		llmClient:      llmClient,
 		cacheRepo:      cacheRepo,
 		logger:         logger,
 		cacheEnabled:   cacheEnabled,
 		cacheTTL:       cacheTTL,
 		spamThreshold:  spamThreshold,
-		whitelistChecker: whitelist.NewChecker(whitelistedDomains, logger),
+		whitelistChecker: whitelist.NewChecker(whitelistedDomains, opts.UsePublicSuffix, opts.NormalizeIDN, logger),
+		scoreRecorder:  scoreRecorder,
+		reputationStore: reputationStore,
+		errorCache:     errCache,
+		opts:           opts,
 	}
+	service.llmDisabled.Store(opts.LLMDisabled)
+	return service
 }
 
 // AnalyzeEmail analyzes an email to determine if it's spam
 func (s *SpamFilterService) AnalyzeEmail(ctx context.Context, email *Email) (*SpamAnalysisResult, error) {
-	// Check if sender domain is whitelisted
-	if s.whitelistChecker.IsWhitelisted(email.From) {
-		s.logger.Info("Email from whitelisted domain, skipping spam check",
+	// Classify the original sender of a forwarded message if configured
+	if s.opts.UnwrapForwarded {
+		if unwrapped, ok := unwrapForwarded(email); ok {
+			s.log(ctx).Info("Classifying the original sender of forwarded message",
+				zap.String("from", email.From),
+				zap.String("original_from", unwrapped.From))
+			email = unwrapped
+		}
+	}
+
+	cacheKey := s.normalizeSender(email.From)
+
+	// Run the stages in order until one decides
+	order := s.opts.EvaluationOrder
+	if order == nil {
+		order = DefaultEvaluationOrder
+	}
+	var evaluated []string
+	for _, stage := range order {
+		var result *SpamAnalysisResult
+		switch stage {
+		case StageWhitelist:
+			result = s.checkWhitelist(ctx, email)
+		case StageHeuristics:
+			result = s.checkHeuristics(ctx, email)
+		case StageCache:
+			result = s.checkCache(ctx, email, cacheKey)
+		}
+		if stage == StageLLM {
+			break
+		}
+		evaluated = append(evaluated, stage)
+		if result != nil {
+			return s.withTrace(result, stage, evaluated), nil
+		}
+	}
+
+	// The LLM decides if no earlier stage did
+	result, err := s.analyzeOrStale(ctx, email, cacheKey)
+	if err != nil {
+		return nil, err
+	}
+	return s.withTrace(result, StageLLM, append(evaluated, StageLLM)), nil
+}
+
+// checkWhitelist returns a clean result if the sender domain is
+// whitelisted, or nil
+func (s *SpamFilterService) checkWhitelist(ctx context.Context, email *Email) *SpamAnalysisResult {
+	if !s.whitelistChecker.IsWhitelisted(email.From) {
+		return nil
+	}
+	s.log(ctx).Info("Email from whitelisted domain, skipping spam check",
+		zap.String("from", email.From))
+	return &SpamAnalysisResult{
+		IsSpam:      false,
+		Score:       0.0,
+		Confidence:  1.0,
+		Explanation: "Sender domain is whitelisted",
+		AnalyzedAt:  time.Now(),
+		ModelUsed:   "whitelist",
+	}
+}
+
+// checkHeuristics returns a result if the attachment, DMARC, upstream
+// verdict, bulk mail, content type, encryption or short body rules decide
+// the verdict, or nil
+func (s *SpamFilterService) checkHeuristics(ctx context.Context, email *Email) *SpamAnalysisResult {
+	// Messages carrying dangerous attachments are spam regardless of the LLM
+	if attachment, ext, found := s.dangerousAttachment(email); found {
+		s.log(ctx).Info("Email has dangerous attachment, marking as spam",
+			zap.String("from", email.From),
+			zap.String("filename", attachment.Filename),
+			zap.String("extension", ext))
+		return &SpamAnalysisResult{
+			IsSpam:      true,
+			Score:       1.0,
+			Confidence:  1.0,
+			Explanation: fmt.Sprintf("Attachment %q has a dangerous extension (.%s)", attachment.Filename, ext),
+			AnalyzedAt:  time.Now(),
+			ModelUsed:   "attachment-policy",
+		}
+	}
+
+	// Messages failing their From domain's DMARC reject policy are spam
+	if result := s.checkDMARC(ctx, email); result != nil {
+		return result
+	}
+
+	// Defer to a verdict left by an upstream filter if configured
+	if result := s.checkUpstream(ctx, email); result != nil {
+		return result
+	}
+
+	// Tag legitimate bulk mail without analysis if configured
+	if s.opts.BulkPolicy == BulkPolicyTag && isBulk(email) {
+		s.log(ctx).Info("Tagging bulk mail, skipping spam check",
 			zap.String("from", email.From))
+		return bulkResult()
+	}
+
+	// Skip analysis for content types that are rarely spam
+	if contentType, skip := s.skippedContentType(email); skip {
+		s.log(ctx).Info("Skipping analysis for content type",
+			zap.String("from", email.From),
+			zap.String("content_type", contentType))
 		return &SpamAnalysisResult{
 			IsSpam:      false,
 			Score:       0.0,
-			Confidence:  1.0,
-			Explanation: "Sender domain is whitelisted",
+			Confidence:  0.0,
+			Explanation: fmt.Sprintf("Content type %s is not analyzed", contentType),
 			AnalyzedAt:  time.Now(),
-			ModelUsed:   "whitelist",
-		}, nil
+			ModelUsed:   "skipped",
+			SkipReason:  "content-type " + contentType,
+		}
 	}
 
-	// Check cache if enabled
-	if s.cacheEnabled && s.cacheRepo != nil {
-		if result, found := s.cacheRepo.Get(email.From); found {
-			s.logger.Info("Using cached result for sender",
+	// Encrypted bodies can't be analyzed, only their armor
+	if s.opts.SkipEncrypted {
+		if kind, encrypted := encryptedBody(email); encrypted {
+			s.log(ctx).Info("Skipping analysis for encrypted body",
 				zap.String("from", email.From),
-				zap.Bool("is_spam", result.IsSpam),
-				zap.Float64("score", result.Score))
-			return result, nil
+				zap.String("encryption", kind))
+			return &SpamAnalysisResult{
+				IsSpam:      false,
+				Score:       0.0,
+				Confidence:  0.0,
+				Explanation: fmt.Sprintf("Body is %s encrypted and can't be analyzed", kind),
+				AnalyzedAt:  time.Now(),
+				ModelUsed:   "skipped",
+				SkipReason:  "encrypted (" + kind + ")",
+			}
 		}
 	}
 
-	// Analyze with LLM
-	result, err := s.llmClient.AnalyzeEmail(ctx, email)
+	// Skip analysis for very short bodies without links or attachments
+	if length, short := s.shortBody(email); short {
+		s.log(ctx).Info("Skipping analysis for short body",
+			zap.String("from", email.From),
+			zap.Int("body_length", length))
+		score := 0.0
+		if s.opts.ShortBodyIsSpam {
+			score = 1.0
+		}
+		return &SpamAnalysisResult{
+			IsSpam:      s.opts.ShortBodyIsSpam,
+			Score:       score,
+			Confidence:  0.0,
+			Explanation: fmt.Sprintf("Body is too short to analyze (%d characters)", length),
+			AnalyzedAt:  time.Now(),
+			ModelUsed:   "skipped",
+			SkipReason:  "short body",
+		}
+	}
+
+	return nil
+}
+
+// checkDMARC returns a spam result if DMARC is enforced and the email fails
+// a reject policy, or nil. Lookup failures are logged and not enforced.
+func (s *SpamFilterService) checkDMARC(ctx context.Context, email *Email) *SpamAnalysisResult {
+	if s.opts.DMARCChecker == nil {
+		return nil
+	}
+
+	reject, reason, err := s.opts.DMARCChecker.Reject(ctx, email)
 	if err != nil {
+		s.log(ctx).Warn("Failed to check DMARC policy, not enforcing it",
+			zap.String("from", email.From),
+			zap.Error(err))
+		return nil
+	}
+	if !reject {
+		return nil
+	}
+
+	s.log(ctx).Info("Email fails DMARC reject policy, marking as spam",
+		zap.String("from", email.From),
+		zap.String("reason", reason))
+	return &SpamAnalysisResult{
+		IsSpam:      true,
+		Score:       1.0,
+		Confidence:  1.0,
+		Explanation: reason,
+		AnalyzedAt:  time.Now(),
+		ModelUsed:   "dmarc-policy",
+	}
+}
+
+// checkCache returns the cached result for the sender if caching is
+// enabled, or nil. A lookup that times out is treated as a miss. With
+// per-recipient keys, every recipient needs a cached verdict, and the most
+// spam-like one is used.
+func (s *SpamFilterService) checkCache(ctx context.Context, email *Email, cacheKey string) *SpamAnalysisResult {
+	if !s.usesCache(email) {
+		return nil
+	}
+
+	// Bound the lookup so a slow cache leaves time for the LLM
+	if s.opts.CacheOpTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.opts.CacheOpTimeout)
+		defer cancel()
+	}
+
+	var result *SpamAnalysisResult
+	for _, key := range s.cacheKeys(email, cacheKey) {
+		cached, found := s.cacheGet(ctx, email, cacheKey, key)
+		if !found {
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				s.log(ctx).Warn("Cache lookup timed out, analyzing sender",
+					zap.String("from", email.From),
+					zap.Duration("timeout", s.opts.CacheOpTimeout))
+			}
+			return nil
+		}
+		if result == nil || cached.Score > result.Score {
+			result = cached
+		}
+	}
+	s.log(ctx).Info("Using cached result for sender",
+		zap.String("from", email.From),
+		zap.Bool("is_spam", result.IsSpam),
+		zap.Float64("score", result.Score))
+	return result
+}
+
+// analyzeOrStale analyzes an email, falling back to an expired cached
+// verdict for the sender if the analysis fails and stale fallback is enabled
+func (s *SpamFilterService) analyzeOrStale(ctx context.Context, email *Email, cacheKey string) (*SpamAnalysisResult, error) {
+	result, err := s.analyze(ctx, email, cacheKey)
+	if err == nil || !s.opts.UseStaleOnError {
+		return result, err
+	}
+	if stale := s.checkStaleCache(ctx, email, cacheKey, err); stale != nil {
+		return stale, nil
+	}
+	return nil, err
+}
+
+// checkStaleCache returns the cached verdict for the sender, even if it has
+// expired, with its confidence halved, or nil if there is none. Like
+// checkCache, every per-recipient key needs a verdict.
+func (s *SpamFilterService) checkStaleCache(ctx context.Context, email *Email, cacheKey string, analysisErr error) *SpamAnalysisResult {
+	if !s.usesCache(email) {
+		return nil
+	}
+	stale, ok := s.cacheRepo.(StaleCacheReader)
+	if !ok {
+		return nil
+	}
+
+	// The analysis may have failed because the deadline passed, so the
+	// lookup gets its own
+	timeout := s.opts.CacheOpTimeout
+	if timeout <= 0 {
+		timeout = staleLookupTimeout
+	}
+	lookupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	var result *SpamAnalysisResult
+	for _, key := range s.cacheKeys(email, cacheKey) {
+		cached, found := stale.GetAllowExpired(lookupCtx, key)
+		if !found {
+			return nil
+		}
+		if result == nil || cached.Score > result.Score {
+			result = cached
+		}
+	}
+
+	result.Confidence /= 2
+	result.Explanation = fmt.Sprintf("Using stale cached verdict after analysis failure: %v", analysisErr)
+	result.ModelUsed = "stale-cache"
+	s.log(ctx).Warn("Using stale cached result after analysis failure",
+		zap.String("from", email.From),
+		zap.Bool("is_spam", result.IsSpam),
+		zap.Float64("score", result.Score),
+		zap.Time("analyzed_at", result.AnalyzedAt),
+		zap.Error(analysisErr))
+	return result
+}
+
+// analyze analyzes an email with the LLM, reusing recent failures and
+// sharing concurrent analyses for the sender if enabled
+func (s *SpamFilterService) analyze(ctx context.Context, email *Email, cacheKey string) (*SpamAnalysisResult, error) {
+	// Pass mail through without calling the LLM while the kill switch is on
+	if s.llmDisabled.Load() {
+		s.log(ctx).Info("Skipping LLM analysis, kill switch is on",
+			zap.String("from", email.From))
+		return s.killSwitchResult(), nil
+	}
+
+	// Reuse a recent failure for this sender rather than calling the LLM again
+	if s.errorCache != nil {
+		if err, found := s.errorCache.Get(cacheKey); found {
+			s.log(ctx).Info("Skipping analysis after recent failure for sender",
+				zap.String("from", email.From),
+				zap.Error(err))
+			return nil, fmt.Errorf("recent analysis failure for sender: %w", err)
+		}
+	}
+
+	// Share one analysis between concurrent messages from the same sender,
+	// and to the same recipients if verdicts are cached per recipient
+	if s.opts.DeduplicateAnalyses {
+		flightKey := strings.Join(s.cacheKeys(email, cacheKey), ",")
+		ch := s.inflight.DoChan(flightKey, func() (interface{}, error) {
+			// Other callers may be waiting, so the analysis keeps the first
+			// caller's deadline but isn't cancelled if that caller goes away
+			flightCtx := context.WithoutCancel(ctx)
+			if deadline, ok := ctx.Deadline(); ok {
+				var cancel context.CancelFunc
+				flightCtx, cancel = context.WithDeadline(flightCtx, deadline)
+				defer cancel()
+			}
+			return s.analyzeWithLLM(flightCtx, email, cacheKey)
+		})
+		select {
+		case res := <-ch:
+			if res.Err != nil {
+				return nil, res.Err
+			}
+			if res.Shared {
+				s.log(ctx).Debug("Shared concurrent analysis for sender",
+					zap.String("from", email.From),
+					zap.String("cache_key", cacheKey))
+			}
+			// Each caller gets its own copy of the shared result
+			result := *res.Val.(*SpamAnalysisResult)
+			return &result, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	return s.analyzeWithLLM(ctx, email, cacheKey)
+}
+
+// analyzeWithLLM analyzes an email with the LLM, applies the threshold and
+// records the result
+func (s *SpamFilterService) analyzeWithLLM(ctx context.Context, email *Email, cacheKey string) (*SpamAnalysisResult, error) {
+	// Tell the model about a From without an address, without changing the
+	// caller's signals
+	invalidFrom := s.opts.RequireValidFrom && !hasValidAddress(email.From)
+	if invalidFrom {
+		signalled := *email
+		signalled.Signals = append(email.Signals[:len(email.Signals):len(email.Signals)], invalidFromSignal)
+		email = &signalled
+	}
+
+	// Tell the model whether the envelope sender matches the From header
+	envelopeMismatched := false
+	if s.opts.CheckEnvelopeMismatch {
+		if headerFrom, mismatch, ok := envelopeMismatch(email); ok {
+			envelopeMismatched = mismatch
+			signalled := *email
+			signalled.Signals = append(email.Signals[:len(email.Signals):len(email.Signals)],
+				fmt.Sprintf("EnvelopeFrom/HeaderFrom mismatch: %t (envelope %s, header %s)", mismatch, normalizeAddress(email.From, false), headerFrom))
+			email = &signalled
+		}
+	}
+
+	// Tell the model the hour the email claims it was sent
+	if s.opts.IncludeTimeSignal {
+		if signal, ok := sentHourSignal(email); ok {
+			signalled := *email
+			signalled.Signals = append(email.Signals[:len(email.Signals):len(email.Signals)], signal)
+			email = &signalled
+		}
+	}
+
+	// Tell the model about a sender domain that imitates a Latin one
+	if s.opts.FlagHomographDomains {
+		if signal, ok := homographSignal(email); ok {
+			signalled := *email
+			signalled.Signals = append(email.Signals[:len(email.Signals):len(email.Signals)], signal)
+			email = &signalled
+		}
+	}
+
+	// Analyze with LLM, within its own timeout if configured
+	llmCtx := ctx
+	if s.opts.LLMRequestTimeout > 0 {
+		var cancel context.CancelFunc
+		llmCtx, cancel = context.WithTimeout(ctx, s.opts.LLMRequestTimeout)
+		defer cancel()
+	}
+	result, err := s.classify(llmCtx, email)
+	if err != nil {
+		if s.errorCache != nil && providerFailure(llmCtx, err) {
+			s.errorCache.Set(cacheKey, err)
+		}
 		return nil, err
 	}
 
-	// Apply threshold
-	result.IsSpam = result.Score >= s.spamThreshold
+	// Calibrate the model's score if configured
+	result.RawScore = result.Score
+	s.traceScore(result, "raw", result.RawScore)
+	if score, calibrated := s.calibrate(result); calibrated {
+		result.Score = score
+		s.traceScore(result, "calibrated", result.Score)
+		s.log(ctx).Debug("Calibrated score",
+			zap.String("from", email.From),
+			zap.Float64("raw_score", result.RawScore),
+			zap.Float64("score", result.Score))
+	}
+
+	// Blend in the local classifier's score if configured
+	if s.opts.BayesClassifier != nil && s.opts.BayesWeight > 0 {
+		s.blendBayes(ctx, email, result)
+	}
+
+	// Nudge the score of emails whose From has no valid address
+	if invalidFrom && s.opts.InvalidFromScore != 0 {
+		result.Score = clampScore(result.Score + s.opts.InvalidFromScore)
+		s.traceScore(result, "invalid-from", result.Score)
+		result.Explanation = strings.TrimSpace(result.Explanation + " " + invalidFromSignal + ".")
+		s.log(ctx).Info("Raised score for From without a valid address",
+			zap.String("from", email.From),
+			zap.Float64("score", result.Score))
+	}
 
-	// Cache result if enabled
-	if s.cacheEnabled && s.cacheRepo != nil {
-		s.cacheRepo.Set(email.From, result, s.cacheTTL)
-		s.logger.Debug("Cached result for sender",
+	// Nudge the score of emails whose envelope sender doesn't match the From
+	if envelopeMismatched && s.opts.EnvelopeMismatchScore != 0 {
+		result.Score = clampScore(result.Score + s.opts.EnvelopeMismatchScore)
+		s.traceScore(result, "envelope-mismatch", result.Score)
+		result.Explanation = strings.TrimSpace(result.Explanation + " " + envelopeMismatchExplanation + ".")
+		s.log(ctx).Info("Raised score for envelope sender mismatch",
 			zap.String("from", email.From),
-			zap.Duration("ttl", s.cacheTTL))
+			zap.Float64("score", result.Score))
+	}
+
+	// Lower the score of bulk mail if configured
+	if s.opts.BulkPolicy == BulkPolicyDownweight && s.opts.BulkDownweight != 0 && isBulk(email) {
+		result.Score = clampScore(result.Score - s.opts.BulkDownweight)
+		s.traceScore(result, "bulk", result.Score)
+		result.Explanation = strings.TrimSpace(result.Explanation + " " + bulkExplanation + ".")
+		s.log(ctx).Info("Lowered score for bulk mail",
+			zap.String("from", email.From),
+			zap.Float64("score", result.Score))
+	}
+
+	// Apply threshold, biased by the sender's reputation if enabled
+	reputationKey := s.reputationKey(cacheKey)
+	threshold := s.effectiveThreshold(ctx, cacheKey, reputationKey)
+	result.IsSpam = result.Score >= threshold
+	result.Threshold = threshold
+	if result.Trace != nil {
+		result.Trace.Threshold = threshold
+	}
+
+	// Update the sender's reputation if enabled
+	if s.reputationStore != nil {
+		s.reputationStore.Record(reputationKey, result.IsSpam)
+	}
+
+	// Aggregate score statistics if enabled
+	if s.scoreRecorder != nil {
+		s.scoreRecorder.Record(result.Score)
+	}
+
+	// Log the message's features with the verdict in learning mode
+	if s.opts.FeatureRecorder != nil {
+		s.recordFeatures(ctx, email, result)
+	}
+
+	// Cache result if enabled and allowed by the cache policy
+	if s.usesCache(email) && s.shouldCache(ctx, result) {
+		// The result is stored even if the caller has gone away, since the
+		// analysis has already been paid for
+		cacheCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cacheWriteTimeout)
+		for _, key := range s.cacheKeys(email, cacheKey) {
+			s.cacheRepo.Set(cacheCtx, key, result, s.cacheTTL)
+			s.log(ctx).Debug("Cached result for sender",
+				zap.String("from", email.From),
+				zap.String("cache_key", key),
+				zap.Duration("ttl", s.cacheTTL))
+		}
+		cancel()
 	}
 
 	return result, nil
 }
+
+// recordFeatures logs the features of an email with its verdict. Failures
+// are only logged, since the verdict stands either way.
+func (s *SpamFilterService) recordFeatures(ctx context.Context, email *Email, result *SpamAnalysisResult) {
+	err := s.opts.FeatureRecorder.Record(ctx, FeatureRecord{
+		ProcessingID: ProcessingIDFromContext(ctx),
+		Sender:       email.From,
+		RecordedAt:   time.Now(),
+		Features:     ExtractFeatures(email),
+		IsSpam:       result.IsSpam,
+		Score:        result.Score,
+		Confidence:   result.Confidence,
+		Model:        result.ModelUsed,
+	})
+	if err != nil {
+		s.log(ctx).Warn("Failed to record features", zap.Error(err), zap.String("from", email.From))
+	}
+}
+
+// usesCache returns whether verdicts for an email are read from and written
+// to the cache, which senders on the cache skip list bypass
+func (s *SpamFilterService) usesCache(email *Email) bool {
+	return s.cacheEnabled && s.cacheRepo != nil && !matchesAddressList(s.opts.CacheSkipDomains, email.From)
+}
+
+// shouldCache returns whether a verdict may be cached under the cache policy
+// and confidence floor
+func (s *SpamFilterService) shouldCache(ctx context.Context, result *SpamAnalysisResult) bool {
+	if result.Confidence < s.opts.MinCacheConfidence {
+		s.log(ctx).Debug("Not caching low-confidence result",
+			zap.Float64("confidence", result.Confidence),
+			zap.Float64("min_confidence", s.opts.MinCacheConfidence))
+		return false
+	}
+
+	switch s.opts.CachePolicy {
+	case CachePolicyHamOnly:
+		return !result.IsSpam
+	case CachePolicySpamOnly:
+		return result.IsSpam
+	default:
+		return true
+	}
+}
+
+// shortBody returns the trimmed body length and whether it is below the
+// minimum body length with no links or attachments that warrant analysis
+func (s *SpamFilterService) shortBody(email *Email) (int, bool) {
+	if s.opts.MinBodyLength <= 0 {
+		return 0, false
+	}
+
+	body := strings.TrimSpace(email.Body)
+	length := utf8.RuneCountInString(body)
+	if length >= s.opts.MinBodyLength {
+		return length, false
+	}
+
+	// Short messages with links or attachments are a common spam pattern
+	if len(email.Attachments) > 0 || linkPattern.MatchString(body) {
+		return length, false
+	}
+
+	return length, true
+}
+
+// skippedContentType returns the top-level content type of the email and
+// whether it matches one of the configured skip content types
+func (s *SpamFilterService) skippedContentType(email *Email) (string, bool) {
+	if len(s.opts.SkipContentTypes) == 0 {
+		return "", false
+	}
+
+	var header string
+	for key, values := range email.Headers {
+		if strings.EqualFold(key, "Content-Type") && len(values) > 0 {
+			header = values[0]
+			break
+		}
+	}
+	if header == "" {
+		return "", false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return "", false
+	}
+	mediaType = strings.ToLower(mediaType)
+
+	for _, skip := range s.opts.SkipContentTypes {
+		// Allow wildcard subtypes such as "text/*"
+		if prefix, ok := strings.CutSuffix(skip, "/*"); ok {
+			if strings.HasPrefix(mediaType, prefix+"/") {
+				return mediaType, true
+			}
+		} else if skip == mediaType {
+			return mediaType, true
+		}
+	}
+
+	return mediaType, false
+}
+
+// reputationKey returns the key under which a normalized sender's
+// reputation is tracked. With public suffix matching, subdomains of the
+// same registrable domain share a reputation, so bob@mail.example.co.uk is
+// tracked as bob@example.co.uk.
+func (s *SpamFilterService) reputationKey(sender string) string {
+	if !s.opts.UsePublicSuffix {
+		return sender
+	}
+	at := strings.LastIndex(sender, "@")
+	if at < 0 {
+		return sender
+	}
+	return sender[:at+1] + utils.RegistrableDomain(sender[at+1:])
+}
+
+// effectiveThreshold returns the spam threshold for a normalized sender,
+// starting from the threshold for its domain. A history of spam under the
+// sender's reputation key lowers the threshold and a history of ham raises
+// it, by at most the configured reputation weight, so reputation only tips
+// borderline scores.
+func (s *SpamFilterService) effectiveThreshold(ctx context.Context, sender, reputationKey string) float64 {
+	base := s.domainThreshold(sender)
+	if s.reputationStore == nil || s.opts.ReputationWeight <= 0 {
+		return base
+	}
+
+	ratio, found := s.reputationStore.SpamRatio(reputationKey)
+	if !found {
+		return base
+	}
+
+	threshold := base - s.opts.ReputationWeight*(2*ratio-1)
+	threshold = math.Min(math.Max(threshold, 0.0), 1.0)
+
+	s.log(ctx).Debug("Adjusted threshold for sender reputation",
+		zap.String("sender", reputationKey),
+		zap.Float64("spam_ratio", ratio),
+		zap.Float64("threshold", base),
+		zap.Float64("effective_threshold", threshold))
+
+	return threshold
+}
+
+// domainThreshold returns the threshold configured for the sender's domain
+// or its closest parent domain, falling back to the global threshold
+func (s *SpamFilterService) domainThreshold(sender string) float64 {
+	if len(s.opts.DomainThresholds) == 0 {
+		return s.spamThreshold
+	}
+	at := strings.LastIndex(sender, "@")
+	if at < 0 {
+		return s.spamThreshold
+	}
+
+	domain := strings.ToLower(sender[at+1:])
+	for domain != "" {
+		if threshold, ok := s.opts.DomainThresholds[domain]; ok {
+			return threshold
+		}
+		_, domain, _ = strings.Cut(domain, ".")
+	}
+	return s.spamThreshold
+}
+
+// dangerousAttachment returns the first attachment whose extension is in
+// the configured dangerous extensions, along with the matched extension
+func (s *SpamFilterService) dangerousAttachment(email *Email) (Attachment, string, bool) {
+	if len(s.opts.DangerousExtensions) == 0 {
+		return Attachment{}, "", false
+	}
+
+	for _, attachment := range email.Attachments {
+		ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(strings.TrimSpace(attachment.Filename))), ".")
+		if ext == "" {
+			continue
+		}
+		for _, dangerous := range s.opts.DangerousExtensions {
+			if ext == dangerous {
+				return attachment, ext, true
+			}
+		}
+	}
+
+	return Attachment{}, "", false
+}
+
+// log returns the service logger with the processing ID of the message
+// being analyzed, if any
+func (s *SpamFilterService) log(ctx context.Context) *zap.Logger {
+	return ContextLogger(ctx, s.logger)
+}
+
+// normalizeSender returns the cache key for a sender, so that variants of
+// the same address share a cache entry
+func (s *SpamFilterService) normalizeSender(from string) string {
+	return normalizeAddress(from, s.opts.StripSubaddress)
+}
+
+// cacheKeys returns the keys a verdict is cached under: the sender's key,
+// or one key per distinct recipient if verdicts are cached per recipient
+func (s *SpamFilterService) cacheKeys(email *Email, cacheKey string) []string {
+	if !s.opts.CacheIncludeRecipient || len(email.To) == 0 {
+		return []string{cacheKey}
+	}
+
+	keys := make([]string, 0, len(email.To))
+	seen := make(map[string]bool)
+	for _, recipient := range email.To {
+		key := recipientCacheKey(cacheKey, recipient, s.opts.StripSubaddress)
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// recipientCacheKey returns the key a verdict for the sender's cache key is
+// cached under for one recipient, when verdicts are cached per recipient
+func recipientCacheKey(cacheKey, recipient string, stripSubaddress bool) string {
+	return cacheKey + "|" + normalizeAddress(recipient, stripSubaddress)
+}
+
+// hasValidAddress returns whether a From header holds a parseable address
+// with both a local part and a domain
+func hasValidAddress(from string) bool {
+	parsed, err := mail.ParseAddress(strings.TrimSpace(from))
+	if err != nil {
+		return false
+	}
+	at := strings.LastIndex(parsed.Address, "@")
+	return at > 0 && at < len(parsed.Address)-1
+}
+
+// normalizeAddress strips any display name from an address and lowercases
+// it, optionally removing a +tag from the local part
+func normalizeAddress(from string, stripSubaddress bool) string {
+	address := strings.TrimSpace(from)
+	if parsed, err := mail.ParseAddress(address); err == nil {
+		address = parsed.Address
+	}
+	address = strings.ToLower(address)
+
+	if stripSubaddress {
+		if at := strings.LastIndex(address, "@"); at > 0 {
+			local, domain := address[:at], address[at:]
+			if plus := strings.Index(local, "+"); plus > 0 {
+				address = local[:plus] + domain
+			}
+		}
+	}
+
+	return address
+}
@@ -0,0 +1,399 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestStaleCacheFallbackHalvesConfidence(t *testing.T) {
+	llm := &fakeLLM{err: errors.New("provider unavailable")}
+	cache := newFakeCache()
+	service := newTestService(llm, cache, ServiceOptions{UseStaleOnError: true})
+
+	email := testEmail("sender@example.com")
+	key := service.normalizeSender(email.From)
+	cache.Set(context.Background(), key, &SpamAnalysisResult{
+		IsSpam:     true,
+		Score:      0.9,
+		Confidence: 0.8,
+		AnalyzedAt: time.Now().Add(-48 * time.Hour),
+	}, time.Hour)
+	cache.expire(key)
+
+	result, err := service.AnalyzeEmail(context.Background(), email)
+	if err != nil {
+		t.Fatalf("AnalyzeEmail() error = %v, want the stale verdict", err)
+	}
+	if !result.IsSpam || result.Score != 0.9 {
+		t.Errorf("got is_spam=%t score=%.2f, want the cached spam verdict", result.IsSpam, result.Score)
+	}
+	if result.Confidence != 0.4 {
+		t.Errorf("Confidence = %.2f, want 0.40", result.Confidence)
+	}
+	if result.ModelUsed != "stale-cache" {
+		t.Errorf("ModelUsed = %q, want stale-cache", result.ModelUsed)
+	}
+}
+
+func TestStaleCacheFallbackDisabled(t *testing.T) {
+	llm := &fakeLLM{err: errors.New("provider unavailable")}
+	cache := newFakeCache()
+	service := newTestService(llm, cache, ServiceOptions{})
+
+	email := testEmail("sender@example.com")
+	key := service.normalizeSender(email.From)
+	cache.Set(context.Background(), key, &SpamAnalysisResult{Score: 0.9, Confidence: 0.8}, time.Hour)
+	cache.expire(key)
+
+	if _, err := service.AnalyzeEmail(context.Background(), email); err == nil {
+		t.Fatal("AnalyzeEmail() succeeded, want the analysis error without stale fallback")
+	}
+}
+
+func TestStaleCacheFallbackWithoutEntry(t *testing.T) {
+	llm := &fakeLLM{err: errors.New("provider unavailable")}
+	service := newTestService(llm, newFakeCache(), ServiceOptions{UseStaleOnError: true})
+
+	if _, err := service.AnalyzeEmail(context.Background(), testEmail("sender@example.com")); err == nil {
+		t.Fatal("AnalyzeEmail() succeeded, want the analysis error with nothing cached")
+	}
+}
+
+func TestCacheIncludeRecipientKeepsVerdictsPerRecipient(t *testing.T) {
+	cache := newFakeCache()
+	llm := &fakeLLM{result: SpamAnalysisResult{IsSpam: true, Score: 0.9}}
+	service := newTestService(llm, cache, ServiceOptions{CacheIncludeRecipient: true})
+
+	toAlice := testEmail("sender@example.com")
+	toAlice.To = []string{"alice@example.org"}
+	if _, err := service.AnalyzeEmail(context.Background(), toAlice); err != nil {
+		t.Fatalf("AnalyzeEmail() error = %v", err)
+	}
+
+	// Bob has his own verdict for the sender
+	llm.result = SpamAnalysisResult{IsSpam: false, Score: 0.1}
+	toBob := testEmail("sender@example.com")
+	toBob.To = []string{"bob@example.org"}
+	result, err := service.AnalyzeEmail(context.Background(), toBob)
+	if err != nil {
+		t.Fatalf("AnalyzeEmail() error = %v", err)
+	}
+	if result.IsSpam {
+		t.Error("Bob got Alice's spam verdict, want a separate analysis")
+	}
+	if llm.callCount() != 2 {
+		t.Errorf("LLM called %d times, want 2", llm.callCount())
+	}
+
+	// Alice's verdict is still cached
+	result, err = service.AnalyzeEmail(context.Background(), toAlice)
+	if err != nil {
+		t.Fatalf("AnalyzeEmail() error = %v", err)
+	}
+	if !result.IsSpam || llm.callCount() != 2 {
+		t.Errorf("got is_spam=%t after %d calls, want Alice's cached spam verdict", result.IsSpam, llm.callCount())
+	}
+}
+
+func TestSkipContentTypes(t *testing.T) {
+	tests := []struct {
+		contentType string
+		skipped     bool
+	}{
+		{`multipart/report; report-type=delivery-status; boundary="b1"`, true},
+		{"message/disposition-notification", true},
+		{"text/plain; charset=utf-8", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			llm := &fakeLLM{result: SpamAnalysisResult{IsSpam: true, Score: 0.9}}
+			service := newTestService(llm, nil, ServiceOptions{
+				SkipContentTypes: []string{"multipart/report", "message/*"},
+			})
+
+			email := testEmail("mailer-daemon@example.com")
+			email.Headers["Content-Type"] = []string{tt.contentType}
+			result, err := service.AnalyzeEmail(context.Background(), email)
+			if err != nil {
+				t.Fatalf("AnalyzeEmail() error = %v", err)
+			}
+			if skipped := result.ModelUsed == "skipped"; skipped != tt.skipped {
+				t.Errorf("skipped = %t, want %t", skipped, tt.skipped)
+			}
+			if tt.skipped && (result.IsSpam || llm.callCount() != 0) {
+				t.Errorf("skipped message got is_spam=%t after %d LLM calls", result.IsSpam, llm.callCount())
+			}
+		})
+	}
+}
+
+func TestNormalizeAddress(t *testing.T) {
+	variants := []string{
+		"alice@example.com",
+		"Alice <alice@example.com>",
+		`"Smith, Alice" <Alice+News@Example.com>`,
+		"alice+receipts@example.com",
+	}
+	for _, from := range variants {
+		if got := normalizeAddress(from, true); got != "alice@example.com" {
+			t.Errorf("normalizeAddress(%q, true) = %q, want alice@example.com", from, got)
+		}
+	}
+
+	if got := normalizeAddress("Alice <alice+news@example.com>", false); got != "alice+news@example.com" {
+		t.Errorf("normalizeAddress() without stripping = %q, want the +tag kept", got)
+	}
+}
+
+func TestSubaddressVariantsShareCachedVerdict(t *testing.T) {
+	llm := &fakeLLM{result: SpamAnalysisResult{IsSpam: true, Score: 0.9}}
+	service := newTestService(llm, newFakeCache(), ServiceOptions{StripSubaddress: true})
+
+	for _, from := range []string{"Alice <alice+one@example.com>", "alice+two@example.com", "ALICE@example.com"} {
+		if _, err := service.AnalyzeEmail(context.Background(), testEmail(from)); err != nil {
+			t.Fatalf("AnalyzeEmail(%q) error = %v", from, err)
+		}
+	}
+	if llm.callCount() != 1 {
+		t.Errorf("LLM called %d times, want the variants to share one verdict", llm.callCount())
+	}
+}
+
+func TestDangerousAttachmentForcesSpam(t *testing.T) {
+	tests := []struct {
+		filename string
+		forced   bool
+	}{
+		{"invoice.EXE", true},
+		{"invoice.pdf.exe", true},
+		{"invoice.pdf", false},
+		{"README", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			llm := &fakeLLM{result: SpamAnalysisResult{Score: 0.1}}
+			service := newTestService(llm, nil, ServiceOptions{DangerousExtensions: []string{"exe", "scr"}})
+
+			email := testEmail("sender@example.com")
+			email.Attachments = []Attachment{{Filename: tt.filename, ContentType: "application/octet-stream"}}
+			result, err := service.AnalyzeEmail(context.Background(), email)
+			if err != nil {
+				t.Fatalf("AnalyzeEmail() error = %v", err)
+			}
+			if forced := result.ModelUsed == "attachment-policy"; forced != tt.forced {
+				t.Errorf("forced = %t, want %t", forced, tt.forced)
+			}
+			if result.IsSpam != tt.forced {
+				t.Errorf("is_spam = %t, want %t", result.IsSpam, tt.forced)
+			}
+			if tt.forced && llm.callCount() != 0 {
+				t.Errorf("LLM called %d times for a forced verdict", llm.callCount())
+			}
+		})
+	}
+}
+
+func TestCachePolicy(t *testing.T) {
+	tests := []struct {
+		policy     string
+		isSpam     bool
+		wantCached bool
+	}{
+		{CachePolicyHamOnly, true, false},
+		{CachePolicyHamOnly, false, true},
+		{CachePolicySpamOnly, true, true},
+		{CachePolicySpamOnly, false, false},
+		{CachePolicyBoth, true, true},
+		{"", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/spam=%t", tt.policy, tt.isSpam), func(t *testing.T) {
+			score := 0.1
+			if tt.isSpam {
+				score = 0.9
+			}
+			cache := newFakeCache()
+			service := newTestService(&fakeLLM{result: SpamAnalysisResult{IsSpam: tt.isSpam, Score: score}}, cache, ServiceOptions{CachePolicy: tt.policy})
+
+			if _, err := service.AnalyzeEmail(context.Background(), testEmail("sender@example.com")); err != nil {
+				t.Fatalf("AnalyzeEmail() error = %v", err)
+			}
+			if _, cached := cache.Get(context.Background(), "sender@example.com"); cached != tt.wantCached {
+				t.Errorf("cached = %t, want %t", cached, tt.wantCached)
+			}
+		})
+	}
+}
+
+func TestMinBodyLength(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		attachments []Attachment
+		skipped     bool
+	}{
+		{"three characters", " ok \n", nil, true},
+		{"short with link", "see https://example.net", nil, false},
+		{"short with www link", "www.example.net", nil, false},
+		{"short with attachment", "fyi", []Attachment{{Filename: "a.pdf"}}, false},
+		{"long enough", "This body is comfortably longer than the minimum.", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			llm := &fakeLLM{result: SpamAnalysisResult{Score: 0.1}}
+			service := newTestService(llm, nil, ServiceOptions{MinBodyLength: 30})
+
+			email := testEmail("sender@example.com")
+			email.Body = tt.body
+			email.Attachments = tt.attachments
+			result, err := service.AnalyzeEmail(context.Background(), email)
+			if err != nil {
+				t.Fatalf("AnalyzeEmail() error = %v", err)
+			}
+			if skipped := result.SkipReason == "short body"; skipped != tt.skipped {
+				t.Errorf("skipped = %t, want %t", skipped, tt.skipped)
+			}
+			if analyzed := llm.callCount() == 1; analyzed == tt.skipped {
+				t.Errorf("LLM called %d times", llm.callCount())
+			}
+		})
+	}
+}
+
+func TestShortBodyIsSpam(t *testing.T) {
+	service := newTestService(&fakeLLM{}, nil, ServiceOptions{MinBodyLength: 30, ShortBodyIsSpam: true})
+
+	email := testEmail("sender@example.com")
+	email.Body = "hi"
+	result, err := service.AnalyzeEmail(context.Background(), email)
+	if err != nil {
+		t.Fatalf("AnalyzeEmail() error = %v", err)
+	}
+	if !result.IsSpam || result.Score != 1.0 {
+		t.Errorf("got is_spam=%t score=%.2f, want the configured spam verdict", result.IsSpam, result.Score)
+	}
+}
+
+// cancellingLLM returns a result after cancelling the caller's context, as
+// if the caller went away just as the analysis finished
+type cancellingLLM struct {
+	cancel context.CancelFunc
+}
+
+func (c *cancellingLLM) AnalyzeEmail(ctx context.Context, email *Email) (*SpamAnalysisResult, error) {
+	c.cancel()
+	return &SpamAnalysisResult{IsSpam: true, Score: 0.9, Confidence: 0.9}, nil
+}
+
+// contextCache is a fakeCache that, like a database, fails writes whose
+// context is done
+type contextCache struct {
+	*fakeCache
+}
+
+func (c contextCache) Set(ctx context.Context, key string, result *SpamAnalysisResult, ttl time.Duration) {
+	if ctx.Err() == nil {
+		c.fakeCache.Set(ctx, key, result, ttl)
+	}
+}
+
+func TestCancelledCallerStillCachesResult(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cache := contextCache{newFakeCache()}
+	service := newTestService(&cancellingLLM{cancel: cancel}, cache, ServiceOptions{})
+
+	service.AnalyzeEmail(ctx, testEmail("sender@example.com"))
+
+	cached, found := cache.Get(context.Background(), "sender@example.com")
+	if !found || !cached.IsSpam {
+		t.Errorf("cached = %+v, %t, want the analysis cached after the caller went away", cached, found)
+	}
+}
+
+func TestMinCacheConfidence(t *testing.T) {
+	tests := []struct {
+		confidence float64
+		wantCached bool
+	}{
+		{0.4, false},
+		{0.6, true},
+		{0.9, true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("confidence=%v", tt.confidence), func(t *testing.T) {
+			cache := newFakeCache()
+			llm := &fakeLLM{result: SpamAnalysisResult{IsSpam: true, Score: 0.9, Confidence: tt.confidence}}
+			service := newTestService(llm, cache, ServiceOptions{MinCacheConfidence: 0.6})
+
+			if _, err := service.AnalyzeEmail(context.Background(), testEmail("sender@example.com")); err != nil {
+				t.Fatalf("AnalyzeEmail() error = %v", err)
+			}
+			if _, cached := cache.Get(context.Background(), "sender@example.com"); cached != tt.wantCached {
+				t.Errorf("cached = %t, want %t", cached, tt.wantCached)
+			}
+
+			// An uncached verdict is analyzed again
+			if _, err := service.AnalyzeEmail(context.Background(), testEmail("sender@example.com")); err != nil {
+				t.Fatalf("AnalyzeEmail() error = %v", err)
+			}
+			wantCalls := 2
+			if tt.wantCached {
+				wantCalls = 1
+			}
+			if calls := llm.callCount(); calls != wantCalls {
+				t.Errorf("LLM calls = %d, want %d", calls, wantCalls)
+			}
+		})
+	}
+}
+
+// slowCache is a fakeCache whose lookups hang until their context is done
+type slowCache struct {
+	*fakeCache
+}
+
+func (c slowCache) Get(ctx context.Context, key string) (*SpamAnalysisResult, bool) {
+	<-ctx.Done()
+	return nil, false
+}
+
+// budgetLLM is a fakeLLM recording the time left before the deadline of
+// the context it is called with
+type budgetLLM struct {
+	fakeLLM
+	budget time.Duration
+}
+
+func (c *budgetLLM) AnalyzeEmail(ctx context.Context, email *Email) (*SpamAnalysisResult, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		c.budget = time.Until(deadline)
+	}
+	return c.fakeLLM.AnalyzeEmail(ctx, email)
+}
+
+func TestSlowCacheLeavesLLMItsFullBudget(t *testing.T) {
+	llm := &budgetLLM{fakeLLM: fakeLLM{result: SpamAnalysisResult{IsSpam: true, Score: 0.9}}}
+	service := newTestService(llm, slowCache{newFakeCache()}, ServiceOptions{
+		CacheOpTimeout:    50 * time.Millisecond,
+		LLMRequestTimeout: 5 * time.Second,
+	})
+
+	start := time.Now()
+	result, err := service.AnalyzeEmail(context.Background(), testEmail("sender@example.com"))
+	if err != nil {
+		t.Fatalf("AnalyzeEmail() error = %v, want the cache timeout treated as a miss", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("AnalyzeEmail() took %v, want the cache lookup cut off after 50ms", elapsed)
+	}
+	if !result.IsSpam || llm.callCount() != 1 {
+		t.Errorf("got is_spam=%t after %d LLM calls, want the LLM verdict", result.IsSpam, llm.callCount())
+	}
+	if llm.budget < 4*time.Second {
+		t.Errorf("LLM budget = %v, want close to the full 5s", llm.budget)
+	}
+}
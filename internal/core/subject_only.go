@@ -0,0 +1,49 @@
+package core
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// Subject-only modes control when emails are classified from the sender and
+// subject alone
+const (
+	// SubjectOnlyOff always includes the body
+	SubjectOnlyOff = "off"
+
+	// SubjectOnlyAlways never includes the body
+	SubjectOnlyAlways = "always"
+
+	// SubjectOnlyPrefilter classifies from the subject first and only
+	// includes the body for borderline scores
+	SubjectOnlyPrefilter = "prefilter"
+)
+
+// classify asks the LLM for a verdict, leaving the body out if the
+// subject-only mode allows it
+func (s *SpamFilterService) classify(ctx context.Context, email *Email) (*SpamAnalysisResult, error) {
+	switch s.opts.SubjectOnlyMode {
+	case SubjectOnlyAlways:
+		subjectOnly := *email
+		subjectOnly.SubjectOnly = true
+		return s.llmClient.AnalyzeEmail(ctx, &subjectOnly)
+	case SubjectOnlyPrefilter:
+		subjectOnly := *email
+		subjectOnly.SubjectOnly = true
+		result, err := s.llmClient.AnalyzeEmail(ctx, &subjectOnly)
+		if err != nil {
+			return nil, err
+		}
+		// A clear verdict from the subject is final. The bounds are on the
+		// calibrated scale, like the threshold.
+		score, _ := s.calibrate(result)
+		if score < s.opts.SubjectOnlyHamBelow || score > s.opts.SubjectOnlySpamAbove {
+			return result, nil
+		}
+		s.log(ctx).Debug("Subject-only score is borderline, analyzing the body",
+			zap.String("from", email.From),
+			zap.Float64("score", score))
+	}
+	return s.llmClient.AnalyzeEmail(ctx, email)
+}
@@ -0,0 +1,75 @@
+package core
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSubjectOnlyAlwaysLeavesOutBody(t *testing.T) {
+	llm := &fakeLLM{result: SpamAnalysisResult{Score: 0.5}}
+	service := newTestService(llm, nil, ServiceOptions{SubjectOnlyMode: SubjectOnlyAlways})
+
+	if _, err := service.AnalyzeEmail(context.Background(), testEmail("sender@example.com")); err != nil {
+		t.Fatalf("AnalyzeEmail() error = %v", err)
+	}
+	if llm.callCount() != 1 || !llm.emails[0].SubjectOnly {
+		t.Errorf("got %d calls, want one subject-only analysis", llm.callCount())
+	}
+}
+
+func TestSubjectOnlyPrefilter(t *testing.T) {
+	tests := []struct {
+		name  string
+		score float64
+		calls int
+	}{
+		{"clear ham", 0.1, 1},
+		{"clear spam", 0.95, 1},
+		{"borderline", 0.5, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			llm := &fakeLLM{result: SpamAnalysisResult{Score: tt.score}}
+			service := newTestService(llm, nil, ServiceOptions{
+				SubjectOnlyMode:      SubjectOnlyPrefilter,
+				SubjectOnlyHamBelow:  0.2,
+				SubjectOnlySpamAbove: 0.9,
+			})
+
+			if _, err := service.AnalyzeEmail(context.Background(), testEmail("sender@example.com")); err != nil {
+				t.Fatalf("AnalyzeEmail() error = %v", err)
+			}
+			if llm.callCount() != tt.calls {
+				t.Fatalf("LLM called %d times, want %d", llm.callCount(), tt.calls)
+			}
+			if !llm.emails[0].SubjectOnly {
+				t.Error("first analysis included the body")
+			}
+			if tt.calls == 2 && llm.emails[1].SubjectOnly {
+				t.Error("borderline analysis left out the body")
+			}
+		})
+	}
+}
+
+func TestSubjectOnlyPrefilterUsesCalibratedScore(t *testing.T) {
+	// A raw 0.5 is borderline, but calibrates to a clear 0.95
+	llm := &fakeLLM{result: SpamAnalysisResult{Score: 0.5, Provider: "openai"}}
+	service := newTestService(llm, nil, ServiceOptions{
+		SubjectOnlyMode:      SubjectOnlyPrefilter,
+		SubjectOnlyHamBelow:  0.2,
+		SubjectOnlySpamAbove: 0.9,
+		ScoreCalibrations:    map[string]*ScoreCalibration{"openai": NewLinearCalibration(1, 0.45)},
+	})
+
+	result, err := service.AnalyzeEmail(context.Background(), testEmail("sender@example.com"))
+	if err != nil {
+		t.Fatalf("AnalyzeEmail() error = %v", err)
+	}
+	if llm.callCount() != 1 {
+		t.Errorf("LLM called %d times, want the calibrated subject-only score to be final", llm.callCount())
+	}
+	if !result.IsSpam {
+		t.Errorf("result = %+v, want spam", result)
+	}
+}
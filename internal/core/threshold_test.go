@@ -0,0 +1,124 @@
+package core
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestDomainThresholdsOverrideGlobal(t *testing.T) {
+	llm := &fakeLLM{result: SpamAnalysisResult{Score: 0.5}}
+	service := newTestService(llm, nil, ServiceOptions{DomainThresholds: map[string]float64{
+		"abuse.example": 0.4,
+	}})
+
+	tests := []struct {
+		sender    string
+		threshold float64
+		isSpam    bool
+	}{
+		{"sender@abuse.example", 0.4, true},
+		{"sender@mail.abuse.example", 0.4, true},
+		{"sender@example.com", 0.7, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sender, func(t *testing.T) {
+			result, err := service.AnalyzeEmail(context.Background(), testEmail(tt.sender))
+			if err != nil {
+				t.Fatalf("AnalyzeEmail() error = %v", err)
+			}
+			if result.IsSpam != tt.isSpam || result.Threshold != tt.threshold {
+				t.Errorf("got is_spam=%t threshold=%v, want %t %v", result.IsSpam, result.Threshold, tt.isSpam, tt.threshold)
+			}
+		})
+	}
+}
+
+func TestDomainThresholdsApplyToSubdomainsWithPublicSuffix(t *testing.T) {
+	store := &fakeReputationStore{ratios: map[string]float64{"bob@example.com": 1.0}}
+	llm := &fakeLLM{result: SpamAnalysisResult{Score: 0.5}}
+	service := NewSpamFilterService(llm, nil, zap.NewNop(), false, time.Hour, 0.7, nil, nil, store, ServiceOptions{
+		UsePublicSuffix:  true,
+		ReputationWeight: 0.1,
+		DomainThresholds: map[string]float64{"news.example.com": 0.9},
+	})
+
+	tests := []struct {
+		sender    string
+		threshold float64
+	}{
+		// The subdomain's threshold applies, less the reputation shared
+		// across example.com
+		{"bob@news.example.com", 0.8},
+		{"bob@eu.news.example.com", 0.8},
+		{"bob@example.com", 0.6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sender, func(t *testing.T) {
+			result, err := service.AnalyzeEmail(context.Background(), testEmail(tt.sender))
+			if err != nil {
+				t.Fatalf("AnalyzeEmail() error = %v", err)
+			}
+			if math.Abs(result.Threshold-tt.threshold) > 1e-9 {
+				t.Errorf("threshold = %v, want %v", result.Threshold, tt.threshold)
+			}
+		})
+	}
+}
+
+// fakeReputationStore is a ReputationStore with fixed spam ratios
+type fakeReputationStore struct {
+	ratios map[string]float64
+}
+
+func (s *fakeReputationStore) Record(sender string, isSpam bool) {}
+
+func (s *fakeReputationStore) SpamRatio(sender string) (float64, bool) {
+	ratio, ok := s.ratios[sender]
+	return ratio, ok
+}
+
+func TestReputationMovesThreshold(t *testing.T) {
+	store := &fakeReputationStore{ratios: map[string]float64{
+		"spammer@example.com": 1.0,
+		"friend@example.com":  0.0,
+	}}
+	llm := &fakeLLM{result: SpamAnalysisResult{Score: 0.6}}
+	service := NewSpamFilterService(llm, nil, zap.NewNop(), false, time.Hour, 0.7, nil, nil, store, ServiceOptions{ReputationWeight: 0.2})
+
+	tests := []struct {
+		sender    string
+		threshold float64
+		isSpam    bool
+	}{
+		{"spammer@example.com", 0.5, true},
+		{"friend@example.com", 0.9, false},
+		{"stranger@example.com", 0.7, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sender, func(t *testing.T) {
+			result, err := service.AnalyzeEmail(context.Background(), testEmail(tt.sender))
+			if err != nil {
+				t.Fatalf("AnalyzeEmail() error = %v", err)
+			}
+			if result.IsSpam != tt.isSpam || math.Abs(result.Threshold-tt.threshold) > 1e-9 {
+				t.Errorf("got is_spam=%t threshold=%v, want %t %v", result.IsSpam, result.Threshold, tt.isSpam, tt.threshold)
+			}
+		})
+	}
+}
+
+func TestReputationKeyByPublicSuffix(t *testing.T) {
+	service := newTestService(&fakeLLM{}, nil, ServiceOptions{UsePublicSuffix: true})
+	if got := service.reputationKey("bob@foo.bbc.co.uk"); got != "bob@bbc.co.uk" {
+		t.Errorf("reputationKey() = %q, want bob@bbc.co.uk", got)
+	}
+
+	service = newTestService(&fakeLLM{}, nil, ServiceOptions{})
+	if got := service.reputationKey("bob@foo.bbc.co.uk"); got != "bob@foo.bbc.co.uk" {
+		t.Errorf("reputationKey() without public suffix matching = %q, want the sender unchanged", got)
+	}
+}
@@ -0,0 +1,29 @@
+package core
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+)
+
+// sentHourSignal returns a signal giving the hour an email claims it was
+// sent, in the timezone of its Date header, since bulk spam often goes out
+// at odd hours for the sender. It returns false if the Date header is
+// missing or doesn't parse.
+func sentHourSignal(email *Email) (string, bool) {
+	var date string
+	for key, values := range email.Headers {
+		if strings.EqualFold(key, "Date") && len(values) > 0 {
+			date = values[0]
+			break
+		}
+	}
+	if strings.TrimSpace(date) == "" {
+		return "", false
+	}
+	sent, err := mail.ParseDate(strings.TrimSpace(date))
+	if err != nil {
+		return "", false
+	}
+	return fmt.Sprintf("SentHour: %d (claimed tz %s)", sent.Hour(), sent.Format("-0700")), true
+}
@@ -0,0 +1,55 @@
+package core
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSentHourSignal(t *testing.T) {
+	tests := []struct {
+		name   string
+		date   string
+		signal string
+		ok     bool
+	}{
+		{"offset", "Tue, 2 Jan 2024 03:17:00 +0800", "SentHour: 3 (claimed tz +0800)", true},
+		{"negative offset", "Mon, 1 Jan 2024 23:05:59 -0500", "SentHour: 23 (claimed tz -0500)", true},
+		{"zone name", "2 Jan 2024 14:00:00 GMT", "SentHour: 14 (claimed tz +0000)", true},
+		{"malformed", "yesterday at noon", "", false},
+		{"empty", "  ", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			email := testEmail("sender@example.com")
+			email.Headers["date"] = []string{tt.date}
+			if signal, ok := sentHourSignal(email); signal != tt.signal || ok != tt.ok {
+				t.Errorf("sentHourSignal() = %q, %t, want %q, %t", signal, ok, tt.signal, tt.ok)
+			}
+		})
+	}
+
+	if _, ok := sentHourSignal(testEmail("sender@example.com")); ok {
+		t.Error("sentHourSignal() ok = true without a Date header")
+	}
+}
+
+func TestTimeSignalReachesModel(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		llm := &fakeLLM{result: SpamAnalysisResult{Score: 0.1}}
+		service := newTestService(llm, nil, ServiceOptions{IncludeTimeSignal: enabled})
+
+		email := testEmail("sender@example.com")
+		email.Headers["Date"] = []string{"Tue, 2 Jan 2024 03:17:00 +0800"}
+		if _, err := service.AnalyzeEmail(context.Background(), email); err != nil {
+			t.Fatalf("AnalyzeEmail() error = %v", err)
+		}
+
+		signalled := false
+		for _, signal := range llm.emails[0].Signals {
+			signalled = signalled || signal == "SentHour: 3 (claimed tz +0800)"
+		}
+		if signalled != enabled {
+			t.Errorf("model signals = %q with the option %t, want the sent hour %t", llm.emails[0].Signals, enabled, enabled)
+		}
+	}
+}
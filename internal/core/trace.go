@@ -0,0 +1,78 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DecisionTrace records how an email's verdict was reached
+type DecisionTrace struct {
+	// Stage is the evaluation stage that decided the verdict
+	Stage string
+
+	// DecidedBy is the rule or model within the stage that decided
+	DecidedBy string
+
+	// Evaluated lists the stages that ran, in order, ending with Stage
+	Evaluated []string
+
+	// Scores lists the score after each step of the LLM stage
+	Scores []TraceScore
+
+	// Threshold is the threshold the LLM score was compared to
+	Threshold float64
+}
+
+// TraceScore is the score after one step of the LLM stage
+type TraceScore struct {
+	Step  string
+	Score float64
+}
+
+// String formats the trace for a header, e.g.
+// "stage=llm; by=gpt-4; evaluated=whitelist,heuristics,cache,llm;
+// raw=0.8200; calibrated=0.7500; threshold=0.7000"
+func (t *DecisionTrace) String() string {
+	parts := []string{
+		"stage=" + t.Stage,
+		"by=" + t.DecidedBy,
+		"evaluated=" + strings.Join(t.Evaluated, ","),
+	}
+	for _, score := range t.Scores {
+		parts = append(parts, fmt.Sprintf("%s=%.4f", score.Step, score.Score))
+	}
+	if t.Stage == StageLLM && len(t.Scores) > 0 {
+		parts = append(parts, fmt.Sprintf("threshold=%.4f", t.Threshold))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// traceScore records an intermediate score of the LLM stage on the result
+// if decision traces are enabled
+func (s *SpamFilterService) traceScore(result *SpamAnalysisResult, step string, score float64) {
+	if !s.opts.DecisionTrace {
+		return
+	}
+	if result.Trace == nil {
+		result.Trace = &DecisionTrace{}
+	}
+	result.Trace.Scores = append(result.Trace.Scores, TraceScore{Step: step, Score: score})
+}
+
+// withTrace sets the deciding stage on the result's trace if decision
+// traces are enabled. The trace is copied, since results of shared analyses
+// are shared with other callers.
+func (s *SpamFilterService) withTrace(result *SpamAnalysisResult, stage string, evaluated []string) *SpamAnalysisResult {
+	if !s.opts.DecisionTrace {
+		return result
+	}
+	var trace DecisionTrace
+	if result.Trace != nil {
+		trace = *result.Trace
+	}
+	trace.Stage = stage
+	trace.DecidedBy = result.ModelUsed
+	trace.Evaluated = evaluated
+	result.Trace = &trace
+	return result
+}
@@ -0,0 +1,66 @@
+package core
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestDecisionTraceShowsDecidingStage(t *testing.T) {
+	tests := []struct {
+		sender    string
+		stage     string
+		decidedBy string
+		evaluated []string
+	}{
+		{"friend@trusted.example", StageWhitelist, "whitelist", []string{StageWhitelist}},
+		{"stranger@example.com", StageLLM, "llm-model", DefaultEvaluationOrder},
+	}
+	for _, tt := range tests {
+		t.Run(tt.stage, func(t *testing.T) {
+			llm := &fakeLLM{result: SpamAnalysisResult{Score: 0.82, ModelUsed: "llm-model"}}
+			service := NewSpamFilterService(llm, nil, zap.NewNop(), false, time.Hour, 0.7, []string{"trusted.example"}, nil, nil,
+				ServiceOptions{DecisionTrace: true})
+
+			result, err := service.AnalyzeEmail(context.Background(), testEmail(tt.sender))
+			if err != nil {
+				t.Fatalf("AnalyzeEmail() error = %v", err)
+			}
+			trace := result.Trace
+			if trace == nil {
+				t.Fatal("Trace = nil, want the decision trace")
+			}
+			if trace.Stage != tt.stage || trace.DecidedBy != tt.decidedBy || !reflect.DeepEqual(trace.Evaluated, tt.evaluated) {
+				t.Errorf("trace = %+v, want stage %q by %q after %v", trace, tt.stage, tt.decidedBy, tt.evaluated)
+			}
+		})
+	}
+}
+
+func TestDecisionTraceRecordsLLMScores(t *testing.T) {
+	llm := &fakeLLM{result: SpamAnalysisResult{Score: 0.82, ModelUsed: "llm-model"}}
+	service := newTestService(llm, nil, ServiceOptions{DecisionTrace: true})
+
+	result, err := service.AnalyzeEmail(context.Background(), testEmail("stranger@example.com"))
+	if err != nil {
+		t.Fatalf("AnalyzeEmail() error = %v", err)
+	}
+	want := "stage=llm; by=llm-model; evaluated=whitelist,heuristics,cache,llm; raw=0.8200; threshold=0.7000"
+	if got := result.Trace.String(); got != want {
+		t.Errorf("Trace.String() = %q, want %q", got, want)
+	}
+}
+
+func TestDecisionTraceOffByDefault(t *testing.T) {
+	llm := &fakeLLM{result: SpamAnalysisResult{Score: 0.82}}
+	result, err := newTestService(llm, nil, ServiceOptions{}).AnalyzeEmail(context.Background(), testEmail("stranger@example.com"))
+	if err != nil {
+		t.Fatalf("AnalyzeEmail() error = %v", err)
+	}
+	if result.Trace != nil {
+		t.Errorf("Trace = %+v, want none unless enabled", result.Trace)
+	}
+}
@@ -0,0 +1,64 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// upstreamVerdict reads the verdict an upstream filter left in a header
+// such as X-Spam-Flag: YES or X-Spam-Status: No, score=1.2. It returns
+// false for found if the header is missing or its value isn't a yes or no.
+func upstreamVerdict(email *Email, header string) (isSpam bool, found bool) {
+	for key, values := range email.Headers {
+		if !strings.EqualFold(key, header) {
+			continue
+		}
+		for _, value := range values {
+			word, _, _ := strings.Cut(strings.TrimSpace(value), ",")
+			switch strings.ToLower(strings.TrimSpace(word)) {
+			case "yes", "true", "1":
+				// Any header marking the message as spam decides
+				return true, true
+			case "no", "false", "0":
+				found = true
+			}
+		}
+	}
+	return false, found
+}
+
+// checkUpstream returns a result deferring to an upstream filter's verdict
+// if enabled and the message carries one, or nil. Clean verdicts are only
+// trusted if configured, since senders can forge the header.
+func (s *SpamFilterService) checkUpstream(ctx context.Context, email *Email) *SpamAnalysisResult {
+	header := s.opts.DeferToUpstream
+	if header == "" {
+		return nil
+	}
+	isSpam, found := upstreamVerdict(email, header)
+	if !found || (!isSpam && !s.opts.DeferUpstreamHam) {
+		return nil
+	}
+
+	s.log(ctx).Info("Deferring to upstream verdict, skipping spam check",
+		zap.String("from", email.From),
+		zap.String("header", header),
+		zap.Bool("is_spam", isSpam))
+	score, verdict := 0.0, "not spam"
+	if isSpam {
+		score, verdict = 1.0, "spam"
+	}
+	return &SpamAnalysisResult{
+		IsSpam:      isSpam,
+		Score:       score,
+		Confidence:  0.0,
+		Explanation: fmt.Sprintf("Upstream filter marked the message as %s in %s", verdict, header),
+		AnalyzedAt:  time.Now(),
+		ModelUsed:   "upstream",
+		SkipReason:  "upstream verdict in " + header,
+	}
+}
@@ -0,0 +1,43 @@
+package core
+
+import (
+	"context"
+	"testing"
+)
+
+func TestUpstreamVerdictSkipsLLM(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		value   string
+		opts    ServiceOptions
+		skipped bool
+		isSpam  bool
+	}{
+		{"tagged spam", "X-Spam-Flag", "YES", ServiceOptions{DeferToUpstream: "X-Spam-Flag"}, true, true},
+		{"status with score", "x-spam-status", "Yes, score=7.1", ServiceOptions{DeferToUpstream: "X-Spam-Status"}, true, true},
+		{"clean not trusted", "X-Spam-Flag", "NO", ServiceOptions{DeferToUpstream: "X-Spam-Flag"}, false, false},
+		{"clean trusted", "X-Spam-Flag", "NO", ServiceOptions{DeferToUpstream: "X-Spam-Flag", DeferUpstreamHam: true}, true, false},
+		{"deferral disabled", "X-Spam-Flag", "YES", ServiceOptions{}, false, false},
+		{"unreadable value", "X-Spam-Flag", "maybe", ServiceOptions{DeferToUpstream: "X-Spam-Flag"}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			llm := &fakeLLM{result: SpamAnalysisResult{Score: 0.2}}
+			service := newTestService(llm, nil, tt.opts)
+
+			email := testEmail("sender@example.com")
+			email.Headers[tt.header] = []string{tt.value}
+			result, err := service.AnalyzeEmail(context.Background(), email)
+			if err != nil {
+				t.Fatalf("AnalyzeEmail() error = %v", err)
+			}
+			if skipped := llm.callCount() == 0; skipped != tt.skipped {
+				t.Fatalf("LLM calls = %d, want skipped %t", llm.callCount(), tt.skipped)
+			}
+			if tt.skipped && (result.ModelUsed != "upstream" || result.IsSpam != tt.isSpam) {
+				t.Errorf("result = %+v, want the upstream verdict is_spam=%t", result, tt.isSpam)
+			}
+		})
+	}
+}
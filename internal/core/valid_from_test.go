@@ -0,0 +1,69 @@
+package core
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func TestHasValidAddress(t *testing.T) {
+	tests := []struct {
+		from  string
+		valid bool
+	}{
+		{"sender@example.com", true},
+		{"Jane Doe <jane@example.com>", true},
+		{`"Doe, Jane" <jane@example.com>`, true},
+		{"Jane Doe", false},
+		{"Jane Doe <>", false},
+		{"<jane@>", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := hasValidAddress(tt.from); got != tt.valid {
+			t.Errorf("hasValidAddress(%q) = %t, want %t", tt.from, got, tt.valid)
+		}
+	}
+}
+
+func TestAddresslessFromNudgesScore(t *testing.T) {
+	tests := []struct {
+		name   string
+		from   string
+		opts   ServiceOptions
+		score  float64
+		isSpam bool
+		signal bool
+	}{
+		{"nudged", "PayPal Security", ServiceOptions{RequireValidFrom: true, InvalidFromScore: 0.2}, 0.8, true, true},
+		{"signal only", "PayPal Security", ServiceOptions{RequireValidFrom: true}, 0.6, false, true},
+		{"disabled", "PayPal Security", ServiceOptions{InvalidFromScore: 0.2}, 0.6, false, false},
+		{"valid address", "PayPal <service@paypal.example>", ServiceOptions{RequireValidFrom: true, InvalidFromScore: 0.2}, 0.6, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			llm := &fakeLLM{result: SpamAnalysisResult{Score: 0.6}}
+			service := newTestService(llm, nil, tt.opts)
+
+			email := testEmail(tt.from)
+			result, err := service.AnalyzeEmail(context.Background(), email)
+			if err != nil {
+				t.Fatalf("AnalyzeEmail() error = %v", err)
+			}
+			if math.Abs(result.Score-tt.score) > 1e-9 || result.IsSpam != tt.isSpam {
+				t.Errorf("got score=%v is_spam=%t, want %v %t", result.Score, result.IsSpam, tt.score, tt.isSpam)
+			}
+
+			signalled := false
+			for _, signal := range llm.emails[0].Signals {
+				signalled = signalled || signal == invalidFromSignal
+			}
+			if signalled != tt.signal {
+				t.Errorf("model signals = %q, want the invalid From signal %t", llm.emails[0].Signals, tt.signal)
+			}
+			if len(email.Signals) != 0 {
+				t.Errorf("caller's signals = %q, want them unchanged", email.Signals)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package core
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// unverifiedModels are the verdicts decided by policy or deferred to an
+// upstream filter rather than a model's judgement, which a verification
+// pass shouldn't overturn
+var unverifiedModels = map[string]bool{
+	"attachment-policy": true,
+	"dmarc-policy":      true,
+	"skipped":           true,
+	"upstream":          true,
+}
+
+// ConfirmReject runs a second, independent analysis of a spam verdict
+// before it is rejected, if enabled, and returns whether the rejection
+// should go ahead. The verification agrees if its score, calibrated for
+// the verifying provider, is at or above the sender's threshold. A failed
+// verification does not confirm the rejection, so the message is only
+// tagged.
+func (s *SpamFilterService) ConfirmReject(ctx context.Context, email *Email, result *SpamAnalysisResult) bool {
+	if !s.opts.VerifyBeforeReject || unverifiedModels[result.ModelUsed] || s.llmDisabled.Load() {
+		return true
+	}
+
+	client := s.opts.VerifyClient
+	if client == nil {
+		client = s.llmClient
+	}
+
+	verification, err := client.AnalyzeEmail(ctx, email)
+	if err != nil {
+		s.log(ctx).Warn("Verification of spam verdict failed, not rejecting",
+			zap.String("from", email.From),
+			zap.Error(err))
+		return false
+	}
+
+	score, _ := s.calibrate(verification)
+	sender := s.normalizeSender(email.From)
+	threshold := s.effectiveThreshold(ctx, sender, s.reputationKey(sender))
+	confirmed := score >= threshold
+
+	s.log(ctx).Info("Verified spam verdict before rejecting",
+		zap.String("from", email.From),
+		zap.Float64("score", result.Score),
+		zap.Float64("verification_score", score),
+		zap.String("verification_model", verification.ModelUsed),
+		zap.Float64("threshold", threshold),
+		zap.Bool("confirmed", confirmed))
+	return confirmed
+}
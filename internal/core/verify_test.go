@@ -0,0 +1,81 @@
+package core
+
+import (
+	"context"
+	"testing"
+)
+
+func TestConfirmRejectCalibratesForVerifyingProvider(t *testing.T) {
+	tests := []struct {
+		name        string
+		calibration *ScoreCalibration
+		want        bool
+	}{
+		{"raw score below threshold", nil, false},
+		{"calibrated above threshold", NewLinearCalibration(1.5, 0), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := &fakeLLM{result: SpamAnalysisResult{Score: 0.6, Provider: "gemini"}}
+			calibrations := map[string]*ScoreCalibration{
+				// The primary calibration would confirm any verdict
+				"openai": NewLinearCalibration(0, 1),
+			}
+			if tt.calibration != nil {
+				calibrations["gemini"] = tt.calibration
+			}
+			service := newTestService(&fakeLLM{}, nil, ServiceOptions{
+				VerifyBeforeReject: true,
+				VerifyClient:       verifier,
+				ScoreCalibrations:  calibrations,
+			})
+
+			result := &SpamAnalysisResult{IsSpam: true, Score: 0.9, ModelUsed: "gpt-4", Provider: "openai"}
+			if got := service.ConfirmReject(context.Background(), testEmail("sender@example.com"), result); got != tt.want {
+				t.Errorf("ConfirmReject() = %t, want %t", got, tt.want)
+			}
+			if verifier.callCount() != 1 {
+				t.Errorf("verifier called %d times, want 1", verifier.callCount())
+			}
+		})
+	}
+}
+
+func TestConfirmRejectSkipsPolicyVerdicts(t *testing.T) {
+	verifier := &fakeLLM{result: SpamAnalysisResult{Score: 0}}
+	service := newTestService(&fakeLLM{}, nil, ServiceOptions{VerifyBeforeReject: true, VerifyClient: verifier})
+
+	result := &SpamAnalysisResult{IsSpam: true, Score: 1, ModelUsed: "dmarc-policy"}
+	if !service.ConfirmReject(context.Background(), testEmail("sender@example.com"), result) {
+		t.Error("ConfirmReject() = false, want policy verdicts rejected without verification")
+	}
+	if verifier.callCount() != 0 {
+		t.Errorf("verifier called %d times, want 0", verifier.callCount())
+	}
+}
+
+func TestConfirmRejectSkipsShortBodyPolicy(t *testing.T) {
+	verifier := &fakeLLM{result: SpamAnalysisResult{Score: 0}}
+	service := newTestService(&fakeLLM{}, nil, ServiceOptions{
+		MinBodyLength:      20,
+		ShortBodyIsSpam:    true,
+		VerifyBeforeReject: true,
+		VerifyClient:       verifier,
+	})
+
+	email := testEmail("sender@example.com")
+	email.Body = "Hi"
+	result, err := service.AnalyzeEmail(context.Background(), email)
+	if err != nil {
+		t.Fatalf("AnalyzeEmail() error = %v", err)
+	}
+	if !result.IsSpam || result.ModelUsed != "skipped" {
+		t.Fatalf("result = %+v, want a short body spam verdict", result)
+	}
+	if !service.ConfirmReject(context.Background(), email, result) {
+		t.Error("ConfirmReject() = false, want short body verdicts rejected without verification")
+	}
+	if verifier.callCount() != 0 {
+		t.Errorf("verifier called %d times, want 0", verifier.callCount())
+	}
+}
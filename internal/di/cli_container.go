@@ -12,6 +12,8 @@ import (
 	"github.com/mikey/llm-spam-filter/internal/factory"
 	"github.com/mikey/llm-spam-filter/internal/logging"
 	"github.com/mikey/llm-spam-filter/internal/ports"
+	"github.com/mikey/llm-spam-filter/internal/prompt"
+	"github.com/mikey/llm-spam-filter/internal/utils"
 )
 
 // CLIFlags contains all command line flags for the CLI application
@@ -35,6 +37,10 @@ type CLIFlags struct {
 	OpenAIAPIKey    string
 	OpenAIModelName string
 
+	// External classifier flags
+	GRPCAddress string
+	GRPCTLS     bool
+
 	// Spam detection flags
 	SpamThreshold float64
 
@@ -43,6 +49,26 @@ type CLIFlags struct {
 	Verbose    bool
 	JSONLog    bool
 	ConfigFile string
+	Timeout    time.Duration
+
+	// Feedback flags
+	Feedback           string
+	FeedbackID         string
+	FeedbackRecipients string
+
+	// Digest flags
+	Digest      bool
+	DigestSince time.Duration
+
+	// Bayesian training flags
+	TrainSpam string
+	TrainHam  string
+
+	// Load test flags
+	LoadTest    string
+	Rate        float64
+	Duration    time.Duration
+	Concurrency int
 }
 
 // ParseFlags parses command line flags and returns a CLIFlags struct
@@ -50,8 +76,8 @@ func ParseFlags() *CLIFlags {
 	flags := &CLIFlags{}
 
 	// LLM provider flags
-	flag.StringVar(&flags.Provider, "provider", "bedrock", "LLM provider (bedrock, gemini, openai)")
-	flag.IntVar(&flags.MaxTokens, "max-tokens", 1000, "Maximum tokens for LLM response")
+	flag.StringVar(&flags.Provider, "provider", "bedrock", "LLM provider (bedrock, gemini, openai, grpc)")
+	flag.IntVar(&flags.MaxTokens, "max-tokens", 0, "Maximum tokens for LLM response (0 for the model's default)")
 	flag.Float64Var(&flags.Temperature, "temperature", 0.1, "Temperature for LLM generation")
 	flag.Float64Var(&flags.TopP, "top-p", 0.9, "Top-p for LLM generation")
 	flag.IntVar(&flags.MaxBodySize, "max-body-size", 4096, "Maximum email body size to send to LLM")
@@ -68,6 +94,10 @@ func ParseFlags() *CLIFlags {
 	flag.StringVar(&flags.OpenAIAPIKey, "openai-api-key", "", "API key for OpenAI")
 	flag.StringVar(&flags.OpenAIModelName, "openai-model", "gpt-4", "OpenAI model name")
 
+	// External classifier flags
+	flag.StringVar(&flags.GRPCAddress, "grpc-address", "", "Address of the external gRPC classifier")
+	flag.BoolVar(&flags.GRPCTLS, "grpc-tls", false, "Use TLS to connect to the external gRPC classifier")
+
 	// Spam detection flags
 	flag.Float64Var(&flags.SpamThreshold, "threshold", 0.7, "Threshold for spam detection")
 
@@ -76,6 +106,26 @@ func ParseFlags() *CLIFlags {
 	flag.BoolVar(&flags.Verbose, "verbose", false, "Enable verbose logging")
 	flag.BoolVar(&flags.JSONLog, "json-log", false, "Output logs in JSON format")
 	flag.StringVar(&flags.ConfigFile, "config", "", "Path to config file (overrides command line flags)")
+	flag.DurationVar(&flags.Timeout, "timeout", 60*time.Second, "Overall deadline for analyzing the email (0 for no deadline)")
+
+	// Feedback flags
+	flag.StringVar(&flags.Feedback, "feedback", "", "Record a verdict correction instead of analyzing (spam, ham)")
+	flag.StringVar(&flags.FeedbackID, "feedback-id", "", "Processing ID or sender address the feedback applies to")
+	flag.StringVar(&flags.FeedbackRecipients, "feedback-recipients", "", "Comma-separated recipients whose cached verdicts for the sender are corrected, with cache.include_recipient")
+
+	// Digest flags
+	flag.BoolVar(&flags.Digest, "digest", false, "Print a summary of rejected spam instead of analyzing")
+	flag.DurationVar(&flags.DigestSince, "digest-since", 24*time.Hour, "How far back the digest covers")
+
+	// Bayesian training flags
+	flag.StringVar(&flags.TrainSpam, "train-spam", "", "Train the Bayesian classifier on the emails in a directory of spam instead of analyzing")
+	flag.StringVar(&flags.TrainHam, "train-ham", "", "Train the Bayesian classifier on the emails in a directory of ham instead of analyzing")
+
+	// Load test flags
+	flag.StringVar(&flags.LoadTest, "load-test", "", "Replay the emails in a fixture directory and report throughput and latency")
+	flag.Float64Var(&flags.Rate, "rate", 0, "Target analyses per second for the load test (0 for unlimited)")
+	flag.DurationVar(&flags.Duration, "duration", 0, "How long to run the load test (0 for a single pass over the fixtures)")
+	flag.IntVar(&flags.Concurrency, "concurrency", 4, "Number of concurrent analyses for the load test")
 
 	flag.Parse()
 	return flags
@@ -100,7 +150,7 @@ func BuildCLIContainer(flags *CLIFlags) (*dig.Container, error) {
 	// Register configuration
 	if err := container.Provide(func(flags *CLIFlags, logger *zap.Logger) (*config.Config, error) {
 		if flags.ConfigFile != "" {
-			cfg, err := config.New()
+			cfg, err := config.NewWithPath(flags.ConfigFile)
 			if err != nil {
 				return nil, err
 			}
@@ -114,6 +164,27 @@ func BuildCLIContainer(flags *CLIFlags) (*dig.Container, error) {
 		return nil, err
 	}
 
+	// Register text processor
+	if err := container.Provide(func(cfg *config.Config, logger *zap.Logger) (*utils.TextProcessor, error) {
+		return factory.NewTextProcessorFactory(cfg, logger).CreateTextProcessor()
+	}); err != nil {
+		return nil, err
+	}
+
+	// Register the buffer of unparseable responses, which is nil when disabled
+	if err := container.Provide(func(cfg *config.Config) *prompt.ErrorSamples {
+		return prompt.NewErrorSamples(cfg.GetInt("llm.error_samples"))
+	}); err != nil {
+		return nil, err
+	}
+
+	// Latency is not tracked for single CLI analyses
+	if err := container.Provide(func() core.LatencyRecorder {
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
 	// Register factories
 	if err := container.Provide(factory.NewLLMFactory); err != nil {
 		return nil, err
@@ -121,6 +192,12 @@ func BuildCLIContainer(flags *CLIFlags) (*dig.Container, error) {
 	if err := container.Provide(factory.NewFilterFactory); err != nil {
 		return nil, err
 	}
+	if err := container.Provide(factory.NewDigestFactory); err != nil {
+		return nil, err
+	}
+	if err := container.Provide(factory.NewBayesFactory); err != nil {
+		return nil, err
+	}
 
 	// Register LLM client
 	if err := container.Provide(func(f *factory.LLMFactory) (core.LLMClient, error) {
@@ -143,12 +220,36 @@ func BuildCLIContainer(flags *CLIFlags) (*dig.Container, error) {
 		return nil, err
 	}
 
+	// Register digest store, which is nil unless a digest is requested
+	if err := container.Provide(func(f *factory.DigestFactory) (core.DigestStore, error) {
+		return f.CreateDigestStore()
+	}); err != nil {
+		return nil, err
+	}
+
+	// Register Bayesian classifier, which is nil when disabled
+	if err := container.Provide(func(f *factory.BayesFactory) (core.BayesClassifier, error) {
+		return f.CreateClassifier()
+	}); err != nil {
+		return nil, err
+	}
+
+	// Register spam filter service options, with the Bayesian classifier
+	if err := container.Provide(func(cfg *config.Config, logger *zap.Logger, classifier core.BayesClassifier) (core.ServiceOptions, error) {
+		opts, err := factory.NewServiceOptions(cfg, logger)
+		opts.BayesClassifier = classifier
+		return opts, err
+	}); err != nil {
+		return nil, err
+	}
+
 	// Register spam filter service with no cache
 	if err := container.Provide(func(
 		llmClient core.LLMClient,
 		logger *zap.Logger,
 		spamThreshold float64,
 		whitelistedDomains []string,
+		opts core.ServiceOptions,
 	) *core.SpamFilterService {
 		return core.NewSpamFilterService(
 			llmClient,
@@ -158,6 +259,9 @@ func BuildCLIContainer(flags *CLIFlags) (*dig.Container, error) {
 			time.Duration(0), // No TTL
 			spamThreshold,
 			whitelistedDomains,
+			nil, // No score statistics for CLI
+			nil, // No sender reputation for CLI
+			opts,
 		)
 	}); err != nil {
 		return nil, err
@@ -170,6 +274,48 @@ func BuildCLIContainer(flags *CLIFlags) (*dig.Container, error) {
 		return nil, err
 	}
 
+	// Register feedback service, which uses the configured cache so that
+	// corrections reach shared (SQL) caches used by the filter
+	if err := container.Provide(factory.NewCacheFactory); err != nil {
+		return nil, err
+	}
+	if err := container.Provide(factory.NewFeedbackFactory); err != nil {
+		return nil, err
+	}
+	if err := container.Provide(func(
+		f *factory.FeedbackFactory,
+		cf *factory.CacheFactory,
+		logger *zap.Logger,
+	) (*core.FeedbackService, error) {
+		store, err := f.CreateFeedbackStore()
+		if err != nil {
+			return nil, err
+		}
+
+		var cacheRepo core.CacheRepository
+		var cacheTTL time.Duration
+		if f.ShouldUpdateCache() {
+			if cacheRepo, err = cf.CreateCacheRepository(); err != nil {
+				return nil, err
+			}
+			if cacheTTL, err = cf.GetCacheTTL(); err != nil {
+				return nil, err
+			}
+		}
+
+		return core.NewFeedbackService(
+			store,
+			cacheRepo,
+			logger,
+			f.ShouldUpdateCache(),
+			cacheTTL,
+			cf.ShouldStripSubaddress(),
+			cf.ShouldIncludeRecipient(),
+		), nil
+	}); err != nil {
+		return nil, err
+	}
+
 	return container, nil
 }
 
@@ -180,6 +326,7 @@ func createConfigFromFlags(flags *CLIFlags) *config.Config {
 	// Set some cli specific settings
 	v.Set("server.filter_type", "cli")
 	v.Set("cli.verbose", flags.Verbose)
+	v.Set("cli.timeout", flags.Timeout.String())
 
 	// Set LLM provider
 	v.Set("llm.provider", flags.Provider)
@@ -207,10 +354,19 @@ func createConfigFromFlags(flags *CLIFlags) *config.Config {
 		v.Set("openai.temperature", flags.Temperature)
 		v.Set("openai.top_p", flags.TopP)
 		v.Set("openai.max_body_size", flags.MaxBodySize)
+	case "grpc":
+		v.Set("grpc.address", flags.GRPCAddress)
+		v.Set("grpc.tls", flags.GRPCTLS)
 	}
 
 	// Set spam threshold
 	v.Set("spam.threshold", flags.SpamThreshold)
 
+	// Submitting feedback from the command line implies it is enabled
+	v.Set("feedback.enabled", flags.Feedback != "")
+
+	// Printing the digest from the command line implies it is enabled
+	v.Set("digest.enabled", flags.Digest)
+
 	return config.NewFromViper(v)
 }
@@ -1,25 +1,36 @@
 package di
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
 	"go.uber.org/dig"
 	"go.uber.org/zap"
 
+	"github.com/mikey/llm-spam-filter/internal/adapters/reputation"
 	"github.com/mikey/llm-spam-filter/internal/config"
 	"github.com/mikey/llm-spam-filter/internal/core"
 	"github.com/mikey/llm-spam-filter/internal/factory"
 	"github.com/mikey/llm-spam-filter/internal/logging"
 	"github.com/mikey/llm-spam-filter/internal/ports"
+	"github.com/mikey/llm-spam-filter/internal/prompt"
+	"github.com/mikey/llm-spam-filter/internal/stats"
 	"github.com/mikey/llm-spam-filter/internal/utils"
 )
 
-// BuildContainer creates and configures a dependency injection container
-func BuildContainer() (*dig.Container, error) {
+// BuildContainer creates and configures a dependency injection container.
+// An empty configPath falls back to SPAM_FILTER_CONFIG and the default search paths.
+func BuildContainer(configPath string) (*dig.Container, error) {
 	container := dig.New()
 
 	// Register configuration
-	if err := container.Provide(config.New); err != nil {
+	if err := container.Provide(func() (*config.Config, error) {
+		if configPath != "" {
+			return config.NewWithPath(configPath)
+		}
+		return config.New()
+	}); err != nil {
 		return nil, err
 	}
 
@@ -29,8 +40,65 @@ func BuildContainer() (*dig.Container, error) {
 	}
 
 	// Register text processor
-	if err := container.Provide(func(logger *zap.Logger) *utils.TextProcessor {
-		return utils.NewTextProcessor(logger)
+	if err := container.Provide(func(cfg *config.Config, logger *zap.Logger) (*utils.TextProcessor, error) {
+		return factory.NewTextProcessorFactory(cfg, logger).CreateTextProcessor()
+	}); err != nil {
+		return nil, err
+	}
+
+	// Register the buffer of unparseable responses, which is nil when disabled
+	if err := container.Provide(func(cfg *config.Config) *prompt.ErrorSamples {
+		return prompt.NewErrorSamples(cfg.GetInt("llm.error_samples"))
+	}); err != nil {
+		return nil, err
+	}
+
+	// Register StatsD client, which is nil unless metrics are sent to StatsD
+	if err := container.Provide(func(cfg *config.Config, logger *zap.Logger) (*stats.StatsDClient, error) {
+		switch backend := strings.ToLower(strings.TrimSpace(cfg.GetString("metrics.backend"))); backend {
+		case "log":
+			return nil, nil
+		case "statsd":
+		default:
+			return nil, fmt.Errorf("invalid metrics backend %q, expected log or statsd", backend)
+		}
+		address := cfg.GetString("metrics.statsd_address")
+		client, err := stats.NewStatsDClient(address, cfg.GetString("metrics.statsd_prefix"), logger)
+		if err != nil {
+			return nil, err
+		}
+		logger.Info("Sending metrics to StatsD", zap.String("address", address))
+		return client, nil
+	}); err != nil {
+		return nil, err
+	}
+
+	// Register provider latency tracker, which is disabled without a window
+	// unless latencies are sent to StatsD
+	if err := container.Provide(func(cfg *config.Config, logger *zap.Logger, statsd *stats.StatsDClient) (core.LatencyRecorder, error) {
+		if statsd != nil {
+			return stats.StatsDLatencyRecorder{StatsDClient: statsd}, nil
+		}
+		window, err := cfg.GetDuration("stats.latency_window")
+		if err != nil {
+			return nil, fmt.Errorf("invalid stats latency window: %w", err)
+		}
+		if window <= 0 {
+			return nil, nil
+		}
+		// Percentiles over the window are logged at the stats interval,
+		// or once per window without one
+		logInterval, err := cfg.GetDuration("stats.log_interval")
+		if err != nil {
+			return nil, fmt.Errorf("invalid stats log interval: %w", err)
+		}
+		if logInterval <= 0 {
+			logInterval = window
+		}
+		logger.Info("Tracking provider latency",
+			zap.Duration("window", window),
+			zap.Duration("log_interval", logInterval))
+		return stats.NewLatencyTracker(logger, window, logInterval), nil
 	}); err != nil {
 		return nil, err
 	}
@@ -45,6 +113,12 @@ func BuildContainer() (*dig.Container, error) {
 	if err := container.Provide(factory.NewFilterFactory); err != nil {
 		return nil, err
 	}
+	if err := container.Provide(factory.NewDigestFactory); err != nil {
+		return nil, err
+	}
+	if err := container.Provide(factory.NewBayesFactory); err != nil {
+		return nil, err
+	}
 
 	// Register LLM client
 	if err := container.Provide(func(f *factory.LLMFactory) (core.LLMClient, error) {
@@ -90,6 +164,70 @@ func BuildContainer() (*dig.Container, error) {
 		return nil, err
 	}
 
+	// Register score histogram, which is disabled without a log interval
+	// unless scores are sent to StatsD
+	if err := container.Provide(func(cfg *config.Config, logger *zap.Logger, statsd *stats.StatsDClient) (core.ScoreRecorder, error) {
+		if statsd != nil {
+			return statsd, nil
+		}
+		interval, err := cfg.GetDuration("stats.log_interval")
+		if err != nil {
+			return nil, fmt.Errorf("invalid stats log interval: %w", err)
+		}
+		if interval <= 0 {
+			return nil, nil
+		}
+		logger.Info("Logging spam score histogram", zap.Duration("interval", interval))
+		return stats.NewScoreHistogram(logger, interval), nil
+	}); err != nil {
+		return nil, err
+	}
+
+	// Register sender reputation store, which is nil when disabled
+	if err := container.Provide(func(cfg *config.Config, logger *zap.Logger) (core.ReputationStore, error) {
+		if !cfg.GetBool("reputation.enabled") {
+			return nil, nil
+		}
+		halfLife, err := cfg.GetDuration("reputation.half_life")
+		if err != nil {
+			return nil, fmt.Errorf("invalid reputation half-life: %w", err)
+		}
+		logger.Info("Tracking sender reputation",
+			zap.Float64("weight", cfg.GetFloat64("reputation.weight")),
+			zap.Duration("half_life", halfLife))
+		return reputation.NewMemoryStore(logger, halfLife), nil
+	}); err != nil {
+		return nil, err
+	}
+
+	// Register digest store, which is nil when disabled
+	if err := container.Provide(func(f *factory.DigestFactory) (core.DigestStore, error) {
+		return f.CreateDigestStore()
+	}); err != nil {
+		return nil, err
+	}
+
+	// Register Bayesian classifier, which is nil when disabled
+	if err := container.Provide(func(f *factory.BayesFactory) (core.BayesClassifier, error) {
+		return f.CreateClassifier()
+	}); err != nil {
+		return nil, err
+	}
+
+	// Register spam filter service options, with the client verifying
+	// verdicts before they are rejected and the Bayesian classifier
+	if err := container.Provide(func(cfg *config.Config, logger *zap.Logger, f *factory.LLMFactory, classifier core.BayesClassifier) (core.ServiceOptions, error) {
+		opts, err := factory.NewServiceOptions(cfg, logger)
+		if err != nil {
+			return opts, err
+		}
+		opts.BayesClassifier = classifier
+		opts.VerifyClient, err = f.CreateVerifyClient()
+		return opts, err
+	}); err != nil {
+		return nil, err
+	}
+
 	// Register spam filter service
 	if err := container.Provide(core.NewSpamFilterService); err != nil {
 		return nil, err
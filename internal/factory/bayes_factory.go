@@ -0,0 +1,60 @@
+package factory
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/mikey/llm-spam-filter/internal/adapters/bayes"
+	"github.com/mikey/llm-spam-filter/internal/config"
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"go.uber.org/zap"
+)
+
+// BayesFactory creates Bayesian classifiers based on configuration
+type BayesFactory struct {
+	cfg    *config.Config
+	logger *zap.Logger
+}
+
+// NewBayesFactory creates a new Bayesian classifier factory
+func NewBayesFactory(cfg *config.Config, logger *zap.Logger) *BayesFactory {
+	return &BayesFactory{
+		cfg:    cfg,
+		logger: logger,
+	}
+}
+
+// CreateClassifier creates a Bayesian classifier based on the
+// configuration, or returns nil if it is disabled
+func (f *BayesFactory) CreateClassifier() (core.BayesClassifier, error) {
+	if !f.cfg.GetBool("bayes.enabled") {
+		return nil, nil
+	}
+
+	minMessages := f.cfg.GetInt("bayes.min_messages")
+	if minMessages < 1 {
+		return nil, fmt.Errorf("invalid bayes min_messages %d, expected at least 1", minMessages)
+	}
+
+	// Token counts share the SQLite cache's database unless given their own
+	path := f.cfg.GetString("bayes.sqlite_path")
+	if path == "" {
+		path = f.cfg.GetString("cache.sqlite_path")
+	}
+
+	// Ensure directory exists
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create bayes directory: %w", err)
+	}
+
+	classifier, err := bayes.NewClassifier(path, minMessages, f.logger)
+	if err != nil {
+		return nil, err
+	}
+	f.logger.Info("Blending Bayesian classifier scores",
+		zap.String("path", path),
+		zap.Float64("weight", f.cfg.GetFloat64("bayes.weight")),
+		zap.Int("min_messages", minMessages))
+	return classifier, nil
+}
@@ -33,31 +33,152 @@ func (f *CacheFactory) CreateCacheRepository() (core.CacheRepository, error) {
 	if err != nil {
 		return nil, fmt.Errorf("invalid cache cleanup frequency: %w", err)
 	}
+	cleanupJitter, err := f.cfg.GetDuration("cache.cleanup_jitter")
+	if err != nil {
+		return nil, fmt.Errorf("invalid cache cleanup jitter: %w", err)
+	}
+
+	if cacheType == "tiered" {
+		return f.createTieredCache(cleanupFreq, cleanupJitter)
+	}
+	return f.createBackend(cacheType, cleanupFreq, cleanupJitter)
+}
+
+// createTieredCache creates an in-memory L1 cache in front of the configured
+// L2 backend
+func (f *CacheFactory) createTieredCache(cleanupFreq, cleanupJitter time.Duration) (core.CacheRepository, error) {
+	l2Type := f.cfg.GetString("cache.l2_type")
+	if l2Type == "memory" || l2Type == "tiered" {
+		return nil, fmt.Errorf("unsupported L2 cache type: %s", l2Type)
+	}
+	l1TTL, err := f.cfg.GetDuration("cache.l1_ttl")
+	if err != nil {
+		return nil, fmt.Errorf("invalid L1 cache TTL: %w", err)
+	}
+
+	l2, err := f.createBackend(l2Type, cleanupFreq, cleanupJitter)
+	if err != nil {
+		return nil, err
+	}
 
+	f.logger.Info("Using tiered cache",
+		zap.String("l2_type", l2Type),
+		zap.Duration("l1_ttl", l1TTL))
+	return cache.NewTieredCache(cache.NewMemoryCache(f.logger, cleanupFreq, cleanupJitter), l2, l1TTL, f.logger), nil
+}
+
+// createBackend creates a single cache backend of the given type
+func (f *CacheFactory) createBackend(cacheType string, cleanupFreq, cleanupJitter time.Duration) (cache.Backend, error) {
 	switch cacheType {
 	case "memory":
-		return cache.NewMemoryCache(f.logger, cleanupFreq), nil
+		return cache.NewMemoryCache(f.logger, cleanupFreq, cleanupJitter), nil
 	case "sqlite":
 		sqlitePath := f.cfg.GetString("cache.sqlite_path")
 		// Ensure directory exists
 		if err := os.MkdirAll(filepath.Dir(sqlitePath), 0755); err != nil {
 			return nil, fmt.Errorf("failed to create SQLite directory: %w", err)
 		}
-		return cache.NewSQLiteCache(sqlitePath, f.logger, cleanupFreq)
+		breaker, encryptor, err := f.createSQLOptions()
+		if err != nil {
+			return nil, err
+		}
+		return cache.NewSQLiteCache(sqlitePath, f.logger, cleanupFreq, cleanupJitter, breaker, encryptor, f.cfg.GetBool("cache.run_migrations"))
 	case "mysql":
 		mysqlDSN := f.cfg.GetString("cache.mysql_dsn")
-		return cache.NewMySQLCache(mysqlDSN, f.logger, cleanupFreq)
+		breaker, encryptor, err := f.createSQLOptions()
+		if err != nil {
+			return nil, err
+		}
+		return cache.NewMySQLCache(mysqlDSN, f.logger, cleanupFreq, cleanupJitter, breaker, encryptor, f.cfg.GetBool("cache.run_migrations"))
 	default:
 		return nil, fmt.Errorf("unsupported cache type: %s", cacheType)
 	}
 }
 
-// GetCacheTTL returns the configured cache TTL
+// createSQLOptions creates the circuit breaker and key encryptor for a
+// database backend, either of which may be nil if disabled
+func (f *CacheFactory) createSQLOptions() (*cache.CircuitBreaker, *cache.KeyEncryptor, error) {
+	breaker, err := f.createCircuitBreaker()
+	if err != nil {
+		return nil, nil, err
+	}
+	encryptor, err := cache.NewKeyEncryptor(f.cfg.GetString("cache.encryption_key"))
+	if err != nil {
+		return nil, nil, err
+	}
+	if encryptor != nil {
+		f.logger.Info("Encrypting sender addresses in the cache")
+	}
+	return breaker, encryptor, nil
+}
+
+// createCircuitBreaker creates the circuit breaker for a database backend,
+// or returns nil if cache.circuit_threshold is 0
+func (f *CacheFactory) createCircuitBreaker() (*cache.CircuitBreaker, error) {
+	threshold := f.cfg.GetInt("cache.circuit_threshold")
+	if threshold < 0 {
+		return nil, fmt.Errorf("cache circuit threshold must not be negative")
+	}
+	cooldown, err := f.cfg.GetDuration("cache.circuit_cooldown")
+	if err != nil {
+		return nil, fmt.Errorf("invalid cache circuit cooldown: %w", err)
+	}
+	if threshold > 0 && cooldown <= 0 {
+		return nil, fmt.Errorf("cache circuit cooldown must be positive")
+	}
+	return cache.NewCircuitBreaker(threshold, cooldown, f.logger), nil
+}
+
+// GetCacheTTL returns the configured cache TTL, clamped to the range given
+// by cache.min_ttl and cache.max_ttl
 func (f *CacheFactory) GetCacheTTL() (time.Duration, error) {
-	return f.cfg.GetDuration("cache.ttl")
+	ttl, err := f.cfg.GetDuration("cache.ttl")
+	if err != nil {
+		return 0, err
+	}
+	minTTL, err := f.cfg.GetDuration("cache.min_ttl")
+	if err != nil {
+		return 0, fmt.Errorf("invalid cache minimum TTL: %w", err)
+	}
+	maxTTL, err := f.cfg.GetDuration("cache.max_ttl")
+	if err != nil {
+		return 0, fmt.Errorf("invalid cache maximum TTL: %w", err)
+	}
+	if minTTL < 0 || maxTTL < 0 {
+		return 0, fmt.Errorf("cache TTL bounds must not be negative")
+	}
+	if maxTTL > 0 && minTTL > maxTTL {
+		return 0, fmt.Errorf("cache minimum TTL %v is greater than the maximum %v", minTTL, maxTTL)
+	}
+
+	clamped := ttl
+	if clamped < minTTL {
+		clamped = minTTL
+	}
+	if maxTTL > 0 && clamped > maxTTL {
+		clamped = maxTTL
+	}
+	if clamped != ttl {
+		f.logger.Warn("Cache TTL is out of range, clamping",
+			zap.Duration("ttl", ttl),
+			zap.Duration("min_ttl", minTTL),
+			zap.Duration("max_ttl", maxTTL),
+			zap.Duration("clamped_ttl", clamped))
+	}
+	return clamped, nil
 }
 
 // IsCacheEnabled returns whether caching is enabled
 func (f *CacheFactory) IsCacheEnabled() bool {
 	return f.cfg.GetBool("cache.enabled")
 }
+
+// ShouldIncludeRecipient returns whether verdicts are cached per recipient
+func (f *CacheFactory) ShouldIncludeRecipient() bool {
+	return f.cfg.GetBool("cache.include_recipient")
+}
+
+// ShouldStripSubaddress returns whether +tags are removed from cache keys
+func (f *CacheFactory) ShouldStripSubaddress() bool {
+	return f.cfg.GetBool("cache.strip_subaddress")
+}
@@ -0,0 +1,55 @@
+package factory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mikey/llm-spam-filter/internal/config"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestGetCacheTTLClampsToRange(t *testing.T) {
+	tests := []struct {
+		ttl     string
+		want    time.Duration
+		clamped bool
+	}{
+		{"1s", time.Minute, true},
+		{"87600h", 720 * time.Hour, true},
+		{"24h", 24 * time.Hour, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ttl, func(t *testing.T) {
+			v := config.NewEmptyViper()
+			v.Set("cache.ttl", tt.ttl)
+			v.Set("cache.min_ttl", "1m")
+			v.Set("cache.max_ttl", "720h")
+			observed, logs := observer.New(zapcore.WarnLevel)
+			f := NewCacheFactory(config.NewFromViper(v), zap.New(observed))
+
+			ttl, err := f.GetCacheTTL()
+			if err != nil {
+				t.Fatalf("GetCacheTTL() error = %v", err)
+			}
+			if ttl != tt.want {
+				t.Errorf("GetCacheTTL() = %v, want %v", ttl, tt.want)
+			}
+			if warned := logs.FilterMessage("Cache TTL is out of range, clamping").Len() > 0; warned != tt.clamped {
+				t.Errorf("warned = %t, want %t", warned, tt.clamped)
+			}
+		})
+	}
+}
+
+func TestGetCacheTTLRejectsInvalidBounds(t *testing.T) {
+	for _, bounds := range [][2]string{{"2h", "1h"}, {"-1m", "1h"}} {
+		v := config.NewEmptyViper()
+		v.Set("cache.min_ttl", bounds[0])
+		v.Set("cache.max_ttl", bounds[1])
+		if _, err := NewCacheFactory(config.NewFromViper(v), zap.NewNop()).GetCacheTTL(); err == nil {
+			t.Errorf("GetCacheTTL() with bounds %v succeeded, want an error", bounds)
+		}
+	}
+}
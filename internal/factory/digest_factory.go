@@ -0,0 +1,73 @@
+package factory
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mikey/llm-spam-filter/internal/adapters/digest"
+	"github.com/mikey/llm-spam-filter/internal/config"
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"go.uber.org/zap"
+)
+
+// DigestFactory creates digest stores based on configuration
+type DigestFactory struct {
+	cfg    *config.Config
+	logger *zap.Logger
+}
+
+// NewDigestFactory creates a new digest factory
+func NewDigestFactory(cfg *config.Config, logger *zap.Logger) *DigestFactory {
+	return &DigestFactory{
+		cfg:    cfg,
+		logger: logger,
+	}
+}
+
+// CreateDigestStore creates a digest store based on the configuration, or
+// returns nil if the digest is disabled
+func (f *DigestFactory) CreateDigestStore() (core.DigestStore, error) {
+	if !f.cfg.GetBool("digest.enabled") {
+		return nil, nil
+	}
+
+	// The digest shares the SQLite cache's database unless given its own
+	path := f.cfg.GetString("digest.sqlite_path")
+	if path == "" {
+		path = f.cfg.GetString("cache.sqlite_path")
+	}
+
+	// Ensure directory exists
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create digest directory: %w", err)
+	}
+
+	store, err := digest.NewSQLiteStore(path, f.logger)
+	if err != nil {
+		return nil, err
+	}
+	f.logger.Info("Recording rejected spam for the digest", zap.String("path", path))
+
+	// Collapse identical messages, such as a spam campaign, if configured
+	window, err := f.cfg.GetDuration("digest.dedupe_window")
+	if err != nil {
+		store.Close()
+		return nil, fmt.Errorf("invalid digest dedupe window: %w", err)
+	}
+	if window > 0 {
+		f.logger.Info("Collapsing identical rejected spam in the digest", zap.Duration("window", window))
+		return digest.NewThrottle(store, window, f.logger), nil
+	}
+	return store, nil
+}
+
+// GetRetention returns how long rejected messages are kept in the digest
+func (f *DigestFactory) GetRetention() (time.Duration, error) {
+	retention, err := f.cfg.GetDuration("digest.retention")
+	if err != nil {
+		return 0, fmt.Errorf("invalid digest retention: %w", err)
+	}
+	return retention, nil
+}
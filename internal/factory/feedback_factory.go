@@ -0,0 +1,50 @@
+package factory
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/mikey/llm-spam-filter/internal/adapters/feedback"
+	"github.com/mikey/llm-spam-filter/internal/config"
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"go.uber.org/zap"
+)
+
+// FeedbackFactory creates feedback stores based on configuration
+type FeedbackFactory struct {
+	cfg    *config.Config
+	logger *zap.Logger
+}
+
+// NewFeedbackFactory creates a new feedback factory
+func NewFeedbackFactory(cfg *config.Config, logger *zap.Logger) *FeedbackFactory {
+	return &FeedbackFactory{
+		cfg:    cfg,
+		logger: logger,
+	}
+}
+
+// CreateFeedbackStore creates a feedback store based on the configuration
+func (f *FeedbackFactory) CreateFeedbackStore() (core.FeedbackStore, error) {
+	if !f.cfg.GetBool("feedback.enabled") {
+		return nil, fmt.Errorf("feedback is disabled, set feedback.enabled to record feedback")
+	}
+
+	path := f.cfg.GetString("feedback.path")
+	if path == "" {
+		return nil, fmt.Errorf("feedback.path is required")
+	}
+
+	// Ensure directory exists
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create feedback directory: %w", err)
+	}
+
+	return feedback.NewFileStore(path, f.logger), nil
+}
+
+// ShouldUpdateCache returns whether feedback should override cached verdicts
+func (f *FeedbackFactory) ShouldUpdateCache() bool {
+	return f.cfg.GetBool("feedback.update_cache") && f.cfg.GetBool("cache.enabled")
+}
@@ -2,6 +2,8 @@ package factory
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/mikey/llm-spam-filter/internal/adapters/filter"
 	"github.com/mikey/llm-spam-filter/internal/config"
@@ -15,23 +17,140 @@ type FilterFactory struct {
 	cfg         *config.Config
 	logger      *zap.Logger
 	spamService *core.SpamFilterService
+	digestStore core.DigestStore
 }
 
-// NewFilterFactory creates a new filter factory
-func NewFilterFactory(cfg *config.Config, logger *zap.Logger, spamService *core.SpamFilterService) *FilterFactory {
+// NewFilterFactory creates a new filter factory. The digest store may be nil
+// if rejected spam is not recorded.
+func NewFilterFactory(cfg *config.Config, logger *zap.Logger, spamService *core.SpamFilterService, digestStore core.DigestStore) *FilterFactory {
 	return &FilterFactory{
 		cfg:         cfg,
 		logger:      logger,
 		spamService: spamService,
+		digestStore: digestStore,
 	}
 }
 
-// CreateEmailFilter creates an email filter based on the configuration
+// CreateEmailFilter creates an email filter based on the configuration. If
+// server.filter_types lists more than one type, the filters run together.
 func (f *FilterFactory) CreateEmailFilter() (ports.EmailFilter, error) {
-	filterType := f.cfg.GetString("server.filter_type")
-	
+	var filterTypes []string
+	for _, filterType := range f.cfg.GetStringSlice("server.filter_types") {
+		if filterType = strings.ToLower(strings.TrimSpace(filterType)); filterType != "" {
+			filterTypes = append(filterTypes, filterType)
+		}
+	}
+	if len(filterTypes) == 0 {
+		return f.createFilter(f.cfg.GetString("server.filter_type"))
+	}
+
+	var filters []ports.EmailFilter
+	seen := make(map[string]bool)
+	for _, filterType := range filterTypes {
+		// Filters of the same type would share their settings, such as the
+		// listen address
+		if seen[filterType] {
+			return nil, fmt.Errorf("filter type %s is listed more than once", filterType)
+		}
+		seen[filterType] = true
+
+		emailFilter, err := f.createFilter(filterType)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, emailFilter)
+	}
+	if len(filters) == 1 {
+		return filters[0], nil
+	}
+
+	f.logger.Info("Running filters together", zap.Strings("filter_types", filterTypes))
+	return filter.NewCompositeFilter(filters, filterTypes, f.logger)
+}
+
+// createFilter creates an email filter of the given type
+func (f *FilterFactory) createFilter(filterType string) (ports.EmailFilter, error) {
 	switch filterType {
 	case "postfix":
+		// Attachment text is only extracted when enabled
+		attachmentTextLimit := 0
+		if f.cfg.GetBool("spam.scan_attachment_text") {
+			attachmentTextLimit = f.cfg.GetInt("spam.attachment_text_kb") * 1024
+		}
+
+		postfixRetryDelay, err := f.cfg.GetDuration("server.postfix_retry_delay")
+		if err != nil {
+			return nil, fmt.Errorf("invalid Postfix retry delay: %w", err)
+		}
+
+		trustedNetworks, err := filter.ParseTrustedNetworks(f.cfg.GetStringSlice("spam.trusted_networks"))
+		if err != nil {
+			return nil, err
+		}
+		if len(trustedNetworks) > 0 {
+			f.logger.Info("Skipping analysis for trusted networks", zap.Strings("networks", f.cfg.GetStringSlice("spam.trusted_networks")))
+		}
+
+		// SMTP AUTH is only enforced when required
+		var auth *filter.SMTPAuth
+		if f.cfg.GetBool("server.require_auth") {
+			auth, err = filter.NewSMTPAuth(
+				f.cfg.GetString("server.auth.username"),
+				f.cfg.GetString("server.auth.password"),
+				f.cfg.GetString("server.auth.htpasswd_file"),
+			)
+			if err != nil {
+				return nil, fmt.Errorf("failed to configure SMTP AUTH: %w", err)
+			}
+		}
+		location, err := time.LoadLocation(f.cfg.GetString("server.block_schedule_timezone"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid block schedule timezone: %w", err)
+		}
+		blockSchedule, err := filter.ParseBlockSchedule(f.cfg.GetStringSlice("server.block_schedule"), location)
+		if err != nil {
+			return nil, err
+		}
+
+		nextHop := f.createNextHop()
+
+		maxAnalyzeBytes := f.cfg.GetInt("spam.max_analyze_bytes")
+		oversizeMode := strings.ToLower(strings.TrimSpace(f.cfg.GetString("spam.oversize_mode")))
+		switch oversizeMode {
+		case filter.OversizeSkip, filter.OversizeText:
+		default:
+			return nil, fmt.Errorf("invalid oversize mode %q, expected %s or %s", oversizeMode, filter.OversizeSkip, filter.OversizeText)
+		}
+		if maxAnalyzeBytes > 0 {
+			f.logger.Info("Limiting the size of analyzed messages",
+				zap.Int("max_analyze_bytes", maxAnalyzeBytes),
+				zap.String("oversize_mode", oversizeMode))
+		}
+
+		headersOnError := strings.ToLower(strings.TrimSpace(f.cfg.GetString("server.headers_on_error")))
+		switch headersOnError {
+		case filter.HeadersOnErrorAll, filter.HeadersOnErrorOnly, filter.HeadersOnErrorNone:
+		default:
+			return nil, fmt.Errorf("invalid headers on error %q, expected %s, %s or %s", headersOnError,
+				filter.HeadersOnErrorAll, filter.HeadersOnErrorOnly, filter.HeadersOnErrorNone)
+		}
+
+		extractionTimeout, err := f.cfg.GetDuration("spam.extraction_timeout")
+		if err != nil {
+			return nil, fmt.Errorf("invalid extraction timeout: %w", err)
+		}
+		extractionLimits := filter.ExtractionLimits{
+			MaxBytes: f.cfg.GetInt("spam.extraction_max_bytes"),
+			MaxParts: f.cfg.GetInt("spam.extraction_max_parts"),
+			MaxDepth: f.cfg.GetInt("spam.extraction_max_depth"),
+			Timeout:  extractionTimeout,
+		}
+
+		spamAssassinCompat := f.cfg.GetBool("server.spamassassin_compat")
+		if spamAssassinCompat && strings.EqualFold(f.cfg.GetString("server.headers.spam"), "X-Spam-Status") {
+			f.logger.Info("SpamAssassin-compatible X-Spam-Status header replaces the spam header")
+		}
+
 		return filter.NewPostfixFilter(
 			f.spamService,
 			f.logger,
@@ -40,11 +159,32 @@ func (f *FilterFactory) CreateEmailFilter() (ports.EmailFilter, error) {
 			f.cfg.GetString("server.headers.spam"),
 			f.cfg.GetString("server.headers.score"),
 			f.cfg.GetString("server.headers.reason"),
-			f.cfg.GetString("server.postfix.address"),
-			f.cfg.GetInt("server.postfix.port"),
+			f.cfg.GetString("server.headers.skipped"),
+			f.cfg.GetString("server.headers.bulk"),
+			f.cfg.GetString("server.headers.id"),
+			f.cfg.GetString("server.headers.trace"),
+			nextHop,
 			f.cfg.GetBool("server.postfix.enabled"),
+			f.cfg.GetInt("server.postfix_retries"),
+			postfixRetryDelay,
 			f.cfg.GetString("server.subject_prefix"),
 			f.cfg.GetBool("server.modify_subject"),
+			f.cfg.GetFloat64("server.subject_prefix_min_score"),
+			f.cfg.GetBool("server.fold_headers"),
+			f.cfg.GetString("server.helo_hostname"),
+			attachmentTextLimit,
+			auth,
+			trustedNetworks,
+			spamAssassinCompat,
+			f.cfg.GetFloat64("spam.threshold"),
+			blockSchedule,
+			f.cfg.GetBool("spam.strip_inline_images"),
+			f.cfg.GetBool("spam.decode_qr"),
+			maxAnalyzeBytes,
+			oversizeMode,
+			headersOnError,
+			extractionLimits,
+			f.digestStore,
 		), nil
 	case "cli":
 		return filter.NewCliFilter(
@@ -56,3 +196,33 @@ func (f *FilterFactory) CreateEmailFilter() (ports.EmailFilter, error) {
 		return nil, fmt.Errorf("unsupported filter type: %s", filterType)
 	}
 }
+
+// createNextHop creates the delivery target for processed mail from
+// server.next_hop, falling back to the Postfix address and port
+func (f *FilterFactory) createNextHop() *filter.NextHop {
+	host := f.cfg.GetString("server.next_hop.host")
+	if host == "" {
+		host = f.cfg.GetString("server.postfix.address")
+	}
+	port := f.cfg.GetInt("server.next_hop.port")
+	if port == 0 {
+		port = f.cfg.GetInt("server.postfix.port")
+	}
+
+	nextHop := filter.NewNextHop(
+		host,
+		port,
+		f.cfg.GetBool("server.next_hop.starttls"),
+		f.cfg.GetBool("server.next_hop.tls_skip_verify"),
+		f.cfg.GetString("server.next_hop.username"),
+		f.cfg.GetString("server.next_hop.password"),
+	)
+	f.logger.Info("Delivering processed mail",
+		zap.String("next_hop", nextHop.Address),
+		zap.Bool("starttls", nextHop.StartTLS),
+		zap.Bool("auth", nextHop.Username != ""))
+	if nextHop.Username != "" && !nextHop.StartTLS {
+		f.logger.Warn("Sending next hop credentials without STARTTLS, set server.next_hop.starttls unless the next hop is local")
+	}
+	return nextHop
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/mikey/llm-spam-filter/internal/adapters/gemini"
 	"github.com/mikey/llm-spam-filter/internal/config"
 	"github.com/mikey/llm-spam-filter/internal/core"
+	"github.com/mikey/llm-spam-filter/internal/prompt"
 	"github.com/mikey/llm-spam-filter/internal/utils"
 	"go.uber.org/zap"
 )
@@ -15,14 +16,16 @@ type GeminiFactory struct {
 	cfg          *config.Config
 	logger       *zap.Logger
 	textProcessor *utils.TextProcessor
+	errorSamples  *prompt.ErrorSamples
 }
 
 // NewGeminiFactory creates a new Gemini factory
-func NewGeminiFactory(cfg *config.Config, logger *zap.Logger, textProcessor *utils.TextProcessor) *GeminiFactory {
+func NewGeminiFactory(cfg *config.Config, logger *zap.Logger, textProcessor *utils.TextProcessor, errorSamples *prompt.ErrorSamples) *GeminiFactory {
 	return &GeminiFactory{
 		cfg:          cfg,
 		logger:       logger,
 		textProcessor: textProcessor,
+		errorSamples:  errorSamples,
 	}
 }
 
@@ -35,6 +38,6 @@ func (f *GeminiFactory) CreateLLMClient() (core.LLMClient, error) {
 		return nil, fmt.Errorf("gemini API key is required")
 	}
 	
-	factory := gemini.NewFactory(f.cfg, f.logger, f.textProcessor)
+	factory := gemini.NewFactory(f.cfg, f.logger, f.textProcessor, f.errorSamples)
 	return factory.CreateClient()
 }
@@ -1,13 +1,24 @@
 package factory
 
 import (
+	"context"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/mikey/llm-spam-filter/internal/adapters/batch"
 	"github.com/mikey/llm-spam-filter/internal/adapters/bedrock"
+	"github.com/mikey/llm-spam-filter/internal/adapters/classifier"
+	"github.com/mikey/llm-spam-filter/internal/adapters/concurrency"
+	"github.com/mikey/llm-spam-filter/internal/adapters/consensus"
 	"github.com/mikey/llm-spam-filter/internal/adapters/gemini"
+	"github.com/mikey/llm-spam-filter/internal/adapters/latency"
+	"github.com/mikey/llm-spam-filter/internal/adapters/multimodel"
 	"github.com/mikey/llm-spam-filter/internal/adapters/openai"
+	"github.com/mikey/llm-spam-filter/internal/adapters/router"
 	"github.com/mikey/llm-spam-filter/internal/config"
 	"github.com/mikey/llm-spam-filter/internal/core"
+	"github.com/mikey/llm-spam-filter/internal/prompt"
 	"github.com/mikey/llm-spam-filter/internal/utils"
 	"go.uber.org/zap"
 )
@@ -17,33 +28,266 @@ type LLMFactory struct {
 	cfg          *config.Config
 	logger       *zap.Logger
 	textProcessor *utils.TextProcessor
+	errorSamples  *prompt.ErrorSamples
+	latencyRecorder core.LatencyRecorder
 }
 
 // NewLLMFactory creates a new LLM factory
-func NewLLMFactory(cfg *config.Config, logger *zap.Logger, textProcessor *utils.TextProcessor) *LLMFactory {
+func NewLLMFactory(cfg *config.Config, logger *zap.Logger, textProcessor *utils.TextProcessor, errorSamples *prompt.ErrorSamples, latencyRecorder core.LatencyRecorder) *LLMFactory {
 	return &LLMFactory{
 		cfg:          cfg,
 		logger:       logger,
 		textProcessor: textProcessor,
+		errorSamples:  errorSamples,
+		latencyRecorder: latencyRecorder,
 	}
 }
 
-// CreateLLMClient creates a new LLM client based on the configuration
+// validateTimeout bounds the startup check of a provider's credentials
+const validateTimeout = 30 * time.Second
+
+// llmRoute is an entry of llm.routes
+type llmRoute struct {
+	Domain   string
+	Provider string
+}
+
+// consensusProvider is an entry of llm.consensus
+type consensusProvider struct {
+	Provider string
+	Weight   float64
+}
+
+// CreateLLMClient creates a new LLM client based on the configuration. If
+// llm.consensus is set, the listed providers are asked together in place of
+// the configured provider. If llm.routes is set, mail from matching sender
+// domains is routed to other providers, and the rest goes to the configured
+// provider.
 func (f *LLMFactory) CreateLLMClient() (core.LLMClient, error) {
-	llmConfig := f.cfg.GetLLM()
-	
-	switch llmConfig.Provider {
+	if mode := prompt.OptionsFromConfig(f.cfg, 0).InjectionGuard; mode != "" && !prompt.ValidInjectionGuard(mode) {
+		return nil, fmt.Errorf("invalid injection guard %q, expected off, delimit, flag or strip", mode)
+	}
+	if _, err := prompt.ExamplesFromConfig(f.cfg); err != nil {
+		return nil, err
+	}
+
+	var routes []llmRoute
+	if err := f.cfg.GetViper().UnmarshalKey("llm.routes", &routes); err != nil {
+		return nil, fmt.Errorf("invalid LLM routes: %w", err)
+	}
+
+	primary := f.cfg.GetLLM().Provider
+	primaryClient, err := f.createPrimaryClient(primary)
+	if err != nil {
+		return nil, err
+	}
+	if len(routes) == 0 {
+		return primaryClient, nil
+	}
+
+	// Providers used by several routes share one client
+	clients := map[string]core.LLMClient{primary: primaryClient}
+	routerRoutes := make([]router.Route, 0, len(routes))
+	for i, route := range routes {
+		provider := strings.ToLower(strings.TrimSpace(route.Provider))
+		if provider == "" {
+			return nil, fmt.Errorf("LLM route %d for %q has no provider", i+1, route.Domain)
+		}
+		client, ok := clients[provider]
+		if !ok {
+			if client, err = f.createClient(provider); err != nil {
+				return nil, fmt.Errorf("failed to create client for route %q: %w", route.Domain, err)
+			}
+			clients[provider] = client
+		}
+		routerRoutes = append(routerRoutes, router.Route{Pattern: route.Domain, Name: provider, Client: client})
+		f.logger.Info("Routing sender domain to provider",
+			zap.String("domain", route.Domain),
+			zap.String("provider", provider))
+	}
+
+	return router.NewClient(routerRoutes, primaryClient, primary, f.logger)
+}
+
+// createPrimaryClient creates the client for the configured provider, or
+// for the consensus of llm.consensus if set
+func (f *LLMFactory) createPrimaryClient(provider string) (core.LLMClient, error) {
+	var providers []consensusProvider
+	if err := f.cfg.GetViper().UnmarshalKey("llm.consensus", &providers); err != nil {
+		return nil, fmt.Errorf("invalid LLM consensus: %w", err)
+	}
+	if len(providers) == 0 {
+		return f.createClient(provider)
+	}
+
+	members := make([]consensus.Member, 0, len(providers))
+	for i, entry := range providers {
+		name := strings.ToLower(strings.TrimSpace(entry.Provider))
+		if name == "" {
+			return nil, fmt.Errorf("LLM consensus entry %d has no provider", i+1)
+		}
+		client, err := f.createClient(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create consensus client for %s: %w", name, err)
+		}
+		members = append(members, consensus.Member{Name: name, Client: client, Weight: entry.Weight})
+		f.logger.Info("Adding provider to consensus",
+			zap.String("provider", name),
+			zap.Float64("weight", entry.Weight))
+	}
+	return consensus.NewClient(members, f.logger)
+}
+
+// CreateVerifyClient creates the client for verifying spam verdicts before
+// they are rejected, from spam.verify_provider. It returns nil if
+// verification is off or uses the configured client.
+func (f *LLMFactory) CreateVerifyClient() (core.LLMClient, error) {
+	if !f.cfg.GetBool("spam.verify_before_reject") {
+		return nil, nil
+	}
+	provider := strings.ToLower(strings.TrimSpace(f.cfg.GetString("spam.verify_provider")))
+	if provider == "" {
+		f.logger.Info("Verifying spam verdicts before rejecting with the configured provider")
+		return nil, nil
+	}
+
+	client, err := f.createClient(provider)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create verification client: %w", err)
+	}
+	f.logger.Info("Verifying spam verdicts before rejecting", zap.String("provider", provider))
+	return client, nil
+}
+
+// createClient creates the client for a provider, batching analyses if
+// enabled, recording its latency if enabled and capping the analyses in
+// flight if the provider has a concurrency cap
+func (f *LLMFactory) createClient(provider string) (core.LLMClient, error) {
+	client, err := f.createProviderClient(provider)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.validateClient(provider, client); err != nil {
+		return nil, err
+	}
+
+	if batchMax := f.cfg.GetInt("llm.batch_max"); batchMax > 1 {
+		window, err := f.cfg.GetDuration("llm.batch_window")
+		if err != nil {
+			return nil, fmt.Errorf("invalid llm.batch_window: %w", err)
+		}
+		if client, err = batch.NewClient(client, provider, window, batchMax, f.logger); err != nil {
+			return nil, err
+		}
+		f.logger.Info("Batching analyses",
+			zap.String("provider", provider),
+			zap.Int("batch_max", batchMax),
+			zap.Duration("batch_window", window))
+	}
+
+	// Time the calls themselves, not the wait for a concurrency slot
+	if f.latencyRecorder != nil {
+		client = latency.NewClient(client, provider, f.latencyRecorder)
+	}
+
+	maxConcurrent := f.cfg.GetInt(provider + ".max_concurrent")
+	if maxConcurrent <= 0 {
+		return client, nil
+	}
+
+	mode := f.cfg.GetString("llm.concurrency_mode")
+	f.logger.Info("Capping concurrent analyses",
+		zap.String("provider", provider),
+		zap.Int("max_concurrent", maxConcurrent),
+		zap.String("mode", mode))
+	return concurrency.NewClient(client, provider, maxConcurrent, mode, f.logger)
+}
+
+// validateClient checks that a provider accepts its credentials if
+// llm.validate_on_start is set, either failing startup or logging the
+// failure
+func (f *LLMFactory) validateClient(provider string, client core.LLMClient) error {
+	mode := strings.ToLower(strings.TrimSpace(f.cfg.GetString("llm.validate_on_start")))
+	switch mode {
+	case "off", "":
+		return nil
+	case "warn", "fail":
+	default:
+		return fmt.Errorf("invalid validate_on_start %q, expected off, warn or fail", mode)
+	}
+
+	validator, ok := client.(core.Validator)
+	if !ok {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), validateTimeout)
+	defer cancel()
+	if err := validator.Validate(ctx); err != nil {
+		if mode == "fail" {
+			return fmt.Errorf("failed to validate %s provider: %w", provider, err)
+		}
+		f.logger.Error("Failed to validate provider, analyses are likely to fail",
+			zap.String("provider", provider),
+			zap.Error(err))
+		return nil
+	}
+
+	f.logger.Info("Validated provider", zap.String("provider", provider))
+	return nil
+}
+
+// createProviderClient creates the client for a provider
+func (f *LLMFactory) createProviderClient(provider string) (core.LLMClient, error) {
+	switch provider {
 	case "bedrock":
-		factory := bedrock.NewFactory(f.cfg, f.logger, f.textProcessor)
+		factory := bedrock.NewFactory(f.cfg, f.logger, f.textProcessor, f.errorSamples)
+		if models := f.cfg.GetBedrock().Models; len(models) > 0 {
+			return f.createMultiModelClient(models, func(model string) (core.LLMClient, error) {
+				return factory.CreateClientForModel(model)
+			})
+		}
 		return factory.CreateClient()
 	case "gemini":
-		factory := gemini.NewFactory(f.cfg, f.logger, f.textProcessor)
+		factory := gemini.NewFactory(f.cfg, f.logger, f.textProcessor, f.errorSamples)
+		if models := f.cfg.GetGemini().Models; len(models) > 0 {
+			return f.createMultiModelClient(models, func(model string) (core.LLMClient, error) {
+				return factory.CreateClientForModel(model)
+			})
+		}
 		return factory.CreateClient()
 	case "openai":
-		factory := openai.NewFactory(f.cfg, f.logger, f.textProcessor)
+		factory := openai.NewFactory(f.cfg, f.logger, f.textProcessor, f.errorSamples)
+		if models := f.cfg.GetOpenAI().Models; len(models) > 0 {
+			return f.createMultiModelClient(models, func(model string) (core.LLMClient, error) {
+				return factory.CreateClientForModel(model)
+			})
+		}
 		client, err := factory.CreateLLMClient()
 		return client, err
+	case "grpc":
+		return classifier.NewFactory(f.cfg, f.logger).CreateClient()
 	default:
-		return nil, fmt.Errorf("unsupported LLM provider: %s", llmConfig.Provider)
+		return nil, fmt.Errorf("unsupported LLM provider: %s", provider)
+	}
+}
+
+// createMultiModelClient creates a client per model and wraps them in a
+// client that selects between them using the configured strategy
+func (f *LLMFactory) createMultiModelClient(models []string, create func(model string) (core.LLMClient, error)) (core.LLMClient, error) {
+	clients := make([]core.LLMClient, 0, len(models))
+	for _, model := range models {
+		client, err := create(model)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create client for model %s: %w", model, err)
+		}
+		clients = append(clients, client)
 	}
+
+	strategy := f.cfg.GetLLM().ModelStrategy
+	f.logger.Info("Selecting between multiple models",
+		zap.Strings("models", models),
+		zap.String("strategy", strategy))
+
+	return multimodel.NewClient(clients, models, strategy, f.logger)
 }
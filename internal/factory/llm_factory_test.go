@@ -0,0 +1,61 @@
+package factory
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mikey/llm-spam-filter/internal/config"
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// rejectingClient is an LLM client whose provider rejects its credentials
+type rejectingClient struct {
+	validated bool
+}
+
+func (c *rejectingClient) AnalyzeEmail(ctx context.Context, email *core.Email) (*core.SpamAnalysisResult, error) {
+	return nil, errors.New("401 Unauthorized")
+}
+
+func (c *rejectingClient) Validate(ctx context.Context) error {
+	c.validated = true
+	return errors.New("401 Unauthorized: invalid API key")
+}
+
+func TestValidateClientReportsRejectedCredentials(t *testing.T) {
+	tests := []struct {
+		mode      string
+		validated bool
+		wantErr   bool
+		logged    bool
+	}{
+		{"off", false, false, false},
+		{"warn", true, false, true},
+		{"fail", true, true, false},
+		{"sometimes", false, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			v := config.NewEmptyViper()
+			v.Set("llm.validate_on_start", tt.mode)
+			observed, logs := observer.New(zapcore.ErrorLevel)
+			f := NewLLMFactory(config.NewFromViper(v), zap.New(observed), nil, nil, nil)
+
+			client := &rejectingClient{}
+			err := f.validateClient("openai", client)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateClient() error = %v, want error %t", err, tt.wantErr)
+			}
+			if client.validated != tt.validated {
+				t.Errorf("validated = %t, want %t", client.validated, tt.validated)
+			}
+			if logged := logs.FilterMessage("Failed to validate provider, analyses are likely to fail").Len() > 0; logged != tt.logged {
+				t.Errorf("logged = %t, want %t", logged, tt.logged)
+			}
+		})
+	}
+}
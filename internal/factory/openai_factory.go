@@ -6,6 +6,7 @@ import (
 	"github.com/mikey/llm-spam-filter/internal/adapters/openai"
 	"github.com/mikey/llm-spam-filter/internal/config"
 	"github.com/mikey/llm-spam-filter/internal/core"
+	"github.com/mikey/llm-spam-filter/internal/prompt"
 	"github.com/mikey/llm-spam-filter/internal/utils"
 	"go.uber.org/zap"
 )
@@ -15,14 +16,16 @@ type OpenAIFactory struct {
 	cfg          *config.Config
 	logger       *zap.Logger
 	textProcessor *utils.TextProcessor
+	errorSamples  *prompt.ErrorSamples
 }
 
 // NewOpenAIFactory creates a new OpenAI factory
-func NewOpenAIFactory(cfg *config.Config, logger *zap.Logger, textProcessor *utils.TextProcessor) *OpenAIFactory {
+func NewOpenAIFactory(cfg *config.Config, logger *zap.Logger, textProcessor *utils.TextProcessor, errorSamples *prompt.ErrorSamples) *OpenAIFactory {
 	return &OpenAIFactory{
 		cfg:          cfg,
 		logger:       logger,
 		textProcessor: textProcessor,
+		errorSamples:  errorSamples,
 	}
 }
 
@@ -35,7 +38,7 @@ func (f *OpenAIFactory) CreateLLMClient() (core.LLMClient, error) {
 		return nil, fmt.Errorf("openai API key is required")
 	}
 	
-	factory := openai.NewFactory(f.cfg, f.logger, f.textProcessor)
+	factory := openai.NewFactory(f.cfg, f.logger, f.textProcessor, f.errorSamples)
 	client, err := factory.CreateLLMClient()
 	return client, err
 }
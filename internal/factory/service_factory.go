@@ -0,0 +1,324 @@
+package factory
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/mikey/llm-spam-filter/internal/adapters/dmarc"
+	"github.com/mikey/llm-spam-filter/internal/adapters/learning"
+	"github.com/mikey/llm-spam-filter/internal/config"
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"go.uber.org/zap"
+)
+
+// NewServiceOptions builds the spam filter service options from the configuration
+func NewServiceOptions(cfg *config.Config, logger *zap.Logger) (core.ServiceOptions, error) {
+	opts := core.ServiceOptions{}
+
+	for _, contentType := range cfg.GetStringSlice("spam.skip_content_types") {
+		contentType = strings.ToLower(strings.TrimSpace(contentType))
+		if contentType != "" {
+			opts.SkipContentTypes = append(opts.SkipContentTypes, contentType)
+		}
+	}
+	if len(opts.SkipContentTypes) > 0 {
+		logger.Info("Skipping analysis for content types", zap.Strings("content_types", opts.SkipContentTypes))
+	}
+
+	for _, stage := range cfg.GetStringSlice("spam.evaluation_order") {
+		opts.EvaluationOrder = append(opts.EvaluationOrder, strings.ToLower(strings.TrimSpace(stage)))
+	}
+	if err := core.ValidateEvaluationOrder(opts.EvaluationOrder); err != nil {
+		return opts, fmt.Errorf("invalid spam evaluation order: %w", err)
+	}
+	logger.Info("Evaluation order", zap.Strings("stages", opts.EvaluationOrder))
+
+	opts.StripSubaddress = cfg.GetBool("cache.strip_subaddress")
+	opts.DeduplicateAnalyses = cfg.GetBool("cache.deduplicate")
+	opts.CacheIncludeRecipient = cfg.GetBool("cache.include_recipient")
+	opts.CacheLookupVariants = cfg.GetBool("cache.lookup_variants")
+	for _, domain := range cfg.GetStringSlice("cache.skip_domains") {
+		if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+			opts.CacheSkipDomains = append(opts.CacheSkipDomains, domain)
+		}
+	}
+	if len(opts.CacheSkipDomains) > 0 {
+		logger.Info("Bypassing the cache for sender domains", zap.Strings("domains", opts.CacheSkipDomains))
+	}
+
+	opts.CachePolicy = strings.ToLower(strings.TrimSpace(cfg.GetString("cache.policy")))
+	switch opts.CachePolicy {
+	case core.CachePolicyBoth, core.CachePolicyHamOnly, core.CachePolicySpamOnly:
+	default:
+		return opts, fmt.Errorf("invalid cache policy %q, expected %s, %s or %s", opts.CachePolicy,
+			core.CachePolicyBoth, core.CachePolicyHamOnly, core.CachePolicySpamOnly)
+	}
+
+	opts.MinCacheConfidence = cfg.GetFloat64("cache.min_confidence")
+	if opts.MinCacheConfidence < 0 || opts.MinCacheConfidence > 1 {
+		return opts, fmt.Errorf("invalid cache minimum confidence %v, expected 0-1", opts.MinCacheConfidence)
+	}
+
+	for _, ext := range cfg.GetStringSlice("spam.dangerous_extensions") {
+		ext = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(ext)), ".")
+		if ext != "" {
+			opts.DangerousExtensions = append(opts.DangerousExtensions, ext)
+		}
+	}
+	if len(opts.DangerousExtensions) > 0 {
+		logger.Info("Treating attachments with dangerous extensions as spam", zap.Strings("extensions", opts.DangerousExtensions))
+	}
+
+	errorTTL, err := cfg.GetDuration("cache.error_ttl")
+	if err != nil {
+		return opts, fmt.Errorf("invalid cache error TTL: %w", err)
+	}
+	opts.ErrorTTL = errorTTL
+	opts.UseStaleOnError = cfg.GetBool("spam.use_stale_on_error")
+
+	cacheOpTimeout, err := cfg.GetDuration("cache.op_timeout")
+	if err != nil {
+		return opts, fmt.Errorf("invalid cache operation timeout: %w", err)
+	}
+	opts.CacheOpTimeout = cacheOpTimeout
+
+	llmRequestTimeout, err := cfg.GetDuration("llm.request_timeout")
+	if err != nil {
+		return opts, fmt.Errorf("invalid LLM request timeout: %w", err)
+	}
+	opts.LLMRequestTimeout = llmRequestTimeout
+
+	opts.UsePublicSuffix = cfg.GetBool("spam.use_public_suffix")
+	opts.SkipEncrypted = cfg.GetBool("spam.skip_encrypted")
+	opts.DecisionTrace = cfg.GetBool("spam.decision_trace")
+	opts.VerifyBeforeReject = cfg.GetBool("spam.verify_before_reject")
+
+	if cfg.GetBool("spam.enforce_dmarc") {
+		dmarcCacheTTL, err := cfg.GetDuration("spam.dmarc_cache_ttl")
+		if err != nil {
+			return opts, fmt.Errorf("invalid DMARC cache TTL: %w", err)
+		}
+		authservID := cfg.GetString("spam.dmarc_authserv_id")
+		opts.DMARCChecker = dmarc.NewChecker(net.DefaultResolver.LookupTXT, authservID, dmarcCacheTTL, logger)
+		logger.Info("Enforcing DMARC reject policies",
+			zap.String("authserv_id", authservID),
+			zap.Duration("cache_ttl", dmarcCacheTTL))
+		if strings.TrimSpace(authservID) == "" {
+			logger.Warn("Trusting the topmost Authentication-Results header for DMARC, set spam.dmarc_authserv_id so that headers forged by the sender are ignored")
+		}
+	}
+
+	if cfg.GetBool("learning.enabled") {
+		outputPath := cfg.GetString("learning.output_path")
+		if outputPath == "" {
+			return opts, fmt.Errorf("learning output path is required")
+		}
+		opts.FeatureRecorder = learning.NewFileRecorder(outputPath, logger)
+		logger.Info("Learning mode is on, recording message features", zap.String("path", outputPath))
+	}
+
+	opts.SubjectOnlyMode = strings.ToLower(strings.TrimSpace(cfg.GetString("spam.subject_only_mode")))
+	switch opts.SubjectOnlyMode {
+	case core.SubjectOnlyOff, core.SubjectOnlyAlways:
+	case core.SubjectOnlyPrefilter:
+		opts.SubjectOnlyHamBelow = cfg.GetFloat64("spam.subject_only_ham_below")
+		opts.SubjectOnlySpamAbove = cfg.GetFloat64("spam.subject_only_spam_above")
+		if opts.SubjectOnlyHamBelow < 0 || opts.SubjectOnlySpamAbove > 1 || opts.SubjectOnlyHamBelow > opts.SubjectOnlySpamAbove {
+			return opts, fmt.Errorf("invalid subject-only borderline range %v-%v", opts.SubjectOnlyHamBelow, opts.SubjectOnlySpamAbove)
+		}
+		logger.Info("Classifying from the subject first",
+			zap.Float64("ham_below", opts.SubjectOnlyHamBelow),
+			zap.Float64("spam_above", opts.SubjectOnlySpamAbove))
+	default:
+		return opts, fmt.Errorf("invalid subject-only mode %q, expected %s, %s or %s", opts.SubjectOnlyMode,
+			core.SubjectOnlyOff, core.SubjectOnlyAlways, core.SubjectOnlyPrefilter)
+	}
+
+	opts.RequireValidFrom = cfg.GetBool("spam.require_valid_from")
+	opts.InvalidFromScore = cfg.GetFloat64("spam.invalid_from_score")
+	if opts.InvalidFromScore < 0 || opts.InvalidFromScore > 1 {
+		return opts, fmt.Errorf("invalid From score %v, expected a value between 0 and 1", opts.InvalidFromScore)
+	}
+
+	for _, entry := range cfg.GetStringSlice("spam.monitor_senders") {
+		if entry = strings.ToLower(strings.TrimSpace(entry)); entry != "" {
+			opts.MonitorSenders = append(opts.MonitorSenders, entry)
+		}
+	}
+	for _, entry := range cfg.GetStringSlice("spam.monitor_recipients") {
+		if entry = strings.ToLower(strings.TrimSpace(entry)); entry != "" {
+			opts.MonitorRecipients = append(opts.MonitorRecipients, entry)
+		}
+	}
+	if len(opts.MonitorSenders) > 0 || len(opts.MonitorRecipients) > 0 {
+		logger.Info("Tagging spam instead of rejecting for monitored mail",
+			zap.Strings("senders", opts.MonitorSenders),
+			zap.Strings("recipients", opts.MonitorRecipients))
+	}
+
+	opts.DeferToUpstream = strings.TrimSpace(cfg.GetString("spam.defer_to_upstream"))
+	opts.DeferUpstreamHam = cfg.GetBool("spam.defer_upstream_ham")
+
+	opts.UnwrapForwarded = cfg.GetBool("spam.unwrap_forwarded")
+	opts.IncludeTimeSignal = cfg.GetBool("spam.include_time_signal")
+	opts.NormalizeIDN = cfg.GetBool("spam.normalize_idn")
+	opts.FlagHomographDomains = cfg.GetBool("spam.flag_homograph_domains")
+
+	opts.CheckEnvelopeMismatch = cfg.GetBool("spam.check_envelope_mismatch")
+	opts.EnvelopeMismatchScore = cfg.GetFloat64("spam.envelope_mismatch_score")
+	if opts.EnvelopeMismatchScore < 0 || opts.EnvelopeMismatchScore > 1 {
+		return opts, fmt.Errorf("invalid envelope mismatch score %v, expected a value between 0 and 1", opts.EnvelopeMismatchScore)
+	}
+
+	opts.MinBodyLength = cfg.GetInt("spam.min_body_length")
+	switch verdict := strings.ToLower(strings.TrimSpace(cfg.GetString("spam.short_body_verdict"))); verdict {
+	case "ham":
+	case "spam":
+		opts.ShortBodyIsSpam = true
+	default:
+		return opts, fmt.Errorf("invalid short body verdict %q, expected ham or spam", verdict)
+	}
+
+	opts.BulkPolicy = strings.ToLower(strings.TrimSpace(cfg.GetString("spam.bulk_policy")))
+	switch opts.BulkPolicy {
+	case core.BulkPolicyIgnore, core.BulkPolicyTag:
+	case core.BulkPolicyDownweight:
+		opts.BulkDownweight = cfg.GetFloat64("spam.bulk_downweight")
+		if opts.BulkDownweight < 0 || opts.BulkDownweight > 1 {
+			return opts, fmt.Errorf("invalid bulk downweight %v, expected 0-1", opts.BulkDownweight)
+		}
+	default:
+		return opts, fmt.Errorf("invalid bulk policy %q, expected %s, %s or %s", opts.BulkPolicy,
+			core.BulkPolicyIgnore, core.BulkPolicyDownweight, core.BulkPolicyTag)
+	}
+
+	opts.LLMDisabled = cfg.GetBool("spam.kill_switch")
+	switch verdict := strings.ToLower(strings.TrimSpace(cfg.GetString("spam.kill_switch_verdict"))); verdict {
+	case "ham":
+	case "spam":
+		opts.KillSwitchIsSpam = true
+	default:
+		return opts, fmt.Errorf("invalid kill switch verdict %q, expected ham or spam", verdict)
+	}
+	if opts.LLMDisabled {
+		logger.Warn("Starting with the LLM kill switch on")
+	}
+
+	// Each provider's scores are calibrated separately, whether it is the
+	// configured provider, a routed one or the verifying one
+	opts.ScoreCalibrations = make(map[string]*core.ScoreCalibration)
+	for provider := range cfg.GetViper().GetStringMap("llm.score_calibration") {
+		calibration, err := newScoreCalibration(cfg, provider)
+		if err != nil {
+			return opts, err
+		}
+		if calibration == nil {
+			continue
+		}
+		logger.Info("Calibrating model scores",
+			zap.String("provider", provider),
+			zap.Float64("scale", calibration.Scale),
+			zap.Float64("offset", calibration.Offset),
+			zap.Int("points", len(calibration.Points)))
+		opts.ScoreCalibrations[provider] = calibration
+	}
+
+	if cfg.GetBool("bayes.enabled") {
+		opts.BayesWeight = cfg.GetFloat64("bayes.weight")
+		if opts.BayesWeight < 0 || opts.BayesWeight > 1 {
+			return opts, fmt.Errorf("invalid bayes weight %v, expected a value between 0 and 1", opts.BayesWeight)
+		}
+	}
+
+	if cfg.GetBool("reputation.enabled") {
+		opts.ReputationWeight = cfg.GetFloat64("reputation.weight")
+	}
+
+	domainThresholds, err := newDomainThresholds(cfg, logger)
+	if err != nil {
+		return opts, err
+	}
+	opts.DomainThresholds = domainThresholds
+
+	return opts, nil
+}
+
+// domainThreshold is an entry of spam.domain_thresholds
+type domainThreshold struct {
+	Domain    string
+	Threshold float64
+}
+
+// newDomainThresholds builds the per-domain thresholds from
+// spam.domain_thresholds, or returns nil if none are configured
+func newDomainThresholds(cfg *config.Config, logger *zap.Logger) (map[string]float64, error) {
+	var entries []domainThreshold
+	if err := cfg.GetViper().UnmarshalKey("spam.domain_thresholds", &entries); err != nil {
+		return nil, fmt.Errorf("invalid domain thresholds: %w", err)
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	thresholds := make(map[string]float64, len(entries))
+	for i, entry := range entries {
+		domain := strings.ToLower(strings.TrimSpace(entry.Domain))
+		if domain == "" {
+			return nil, fmt.Errorf("domain threshold %d has no domain", i+1)
+		}
+		if entry.Threshold < 0 || entry.Threshold > 1 {
+			return nil, fmt.Errorf("invalid threshold %v for domain %s, expected 0-1", entry.Threshold, domain)
+		}
+		thresholds[domain] = entry.Threshold
+		logger.Info("Using domain spam threshold",
+			zap.String("domain", domain),
+			zap.Float64("threshold", entry.Threshold))
+	}
+	return thresholds, nil
+}
+
+// newScoreCalibration builds the score calibration for a provider from
+// llm.score_calibration.<provider>, either points given as "raw:calibrated"
+// or a linear scale and offset. It returns nil if none is configured.
+func newScoreCalibration(cfg *config.Config, provider string) (*core.ScoreCalibration, error) {
+	prefix := "llm.score_calibration." + provider
+	points := cfg.GetStringSlice(prefix + ".points")
+	linear := cfg.IsSet(prefix+".scale") || cfg.IsSet(prefix+".offset")
+
+	switch {
+	case len(points) > 0 && linear:
+		return nil, fmt.Errorf("invalid score calibration for %s: use either points or scale and offset", provider)
+	case len(points) > 0:
+		parsed := make([]core.CalibrationPoint, 0, len(points))
+		for _, point := range points {
+			raw, calibrated, ok := strings.Cut(point, ":")
+			if !ok {
+				return nil, fmt.Errorf("invalid score calibration point %q, expected raw:calibrated", point)
+			}
+			rawScore, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid score calibration point %q: %w", point, err)
+			}
+			calibratedScore, err := strconv.ParseFloat(strings.TrimSpace(calibrated), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid score calibration point %q: %w", point, err)
+			}
+			parsed = append(parsed, core.CalibrationPoint{Raw: rawScore, Calibrated: calibratedScore})
+		}
+		calibration, err := core.NewPiecewiseCalibration(parsed)
+		if err != nil {
+			return nil, fmt.Errorf("invalid score calibration for %s: %w", provider, err)
+		}
+		return calibration, nil
+	case linear:
+		scale := 1.0
+		if cfg.IsSet(prefix + ".scale") {
+			scale = cfg.GetFloat64(prefix + ".scale")
+		}
+		return core.NewLinearCalibration(scale, cfg.GetFloat64(prefix+".offset")), nil
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,42 @@
+package factory
+
+import (
+	"testing"
+
+	"github.com/mikey/llm-spam-filter/internal/config"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestDMARCWithoutAuthservIDWarns(t *testing.T) {
+	tests := []struct {
+		name       string
+		authservID string
+		warned     bool
+	}{
+		{"no authserv-id", "", true},
+		{"authserv-id", "mx.example.com", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := config.NewEmptyViper()
+			v.Set("spam.enforce_dmarc", true)
+			v.Set("spam.dmarc_cache_ttl", "1h")
+			v.Set("spam.dmarc_authserv_id", tt.authservID)
+			observed, logs := observer.New(zapcore.WarnLevel)
+
+			opts, err := NewServiceOptions(config.NewFromViper(v), zap.New(observed))
+			if err != nil {
+				t.Fatalf("NewServiceOptions() error = %v", err)
+			}
+			if opts.DMARCChecker == nil {
+				t.Fatal("DMARCChecker = nil, want DMARC enforced")
+			}
+			warned := logs.FilterMessageSnippet("spam.dmarc_authserv_id").Len() > 0
+			if warned != tt.warned {
+				t.Errorf("warned = %t, want %t", warned, tt.warned)
+			}
+		})
+	}
+}
@@ -1,23 +1,37 @@
 package factory
 
 import (
+	"fmt"
+
+	"github.com/mikey/llm-spam-filter/internal/config"
 	"github.com/mikey/llm-spam-filter/internal/utils"
 	"go.uber.org/zap"
 )
 
 // TextProcessorFactory creates text processors
 type TextProcessorFactory struct {
+	cfg    *config.Config
 	logger *zap.Logger
 }
 
 // NewTextProcessorFactory creates a new TextProcessorFactory
-func NewTextProcessorFactory(logger *zap.Logger) *TextProcessorFactory {
+func NewTextProcessorFactory(cfg *config.Config, logger *zap.Logger) *TextProcessorFactory {
 	return &TextProcessorFactory{
+		cfg:    cfg,
 		logger: logger,
 	}
 }
 
-// CreateTextProcessor creates a new TextProcessor
-func (f *TextProcessorFactory) CreateTextProcessor() *utils.TextProcessor {
-	return utils.NewTextProcessor(f.logger)
+// CreateTextProcessor creates a new TextProcessor with the preprocessing
+// steps listed in spam.preprocess_steps
+func (f *TextProcessorFactory) CreateTextProcessor() (*utils.TextProcessor, error) {
+	names := f.cfg.GetStringSlice("spam.preprocess_steps")
+	pipeline, err := utils.TextPipeline(names)
+	if err != nil {
+		return nil, fmt.Errorf("invalid body preprocessing: %w", err)
+	}
+	if len(pipeline) > 0 {
+		f.logger.Info("Preprocessing bodies", zap.Strings("steps", names))
+	}
+	return utils.NewTextProcessor(f.logger, pipeline...), nil
 }
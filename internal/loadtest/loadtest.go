@@ -0,0 +1,194 @@
+package loadtest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"github.com/mikey/llm-spam-filter/internal/stats"
+	"go.uber.org/zap"
+)
+
+// Analyzer analyzes a single email, e.g. the spam filter service
+type Analyzer interface {
+	AnalyzeEmail(ctx context.Context, email *core.Email) (*core.SpamAnalysisResult, error)
+}
+
+// Options controls how a load test is run
+type Options struct {
+	// Concurrency is the number of analyses run in parallel
+	Concurrency int
+
+	// Rate is the target number of analyses started per second (0 for as
+	// fast as the workers allow)
+	Rate float64
+
+	// Duration is how long to keep replaying the emails (0 for a single pass)
+	Duration time.Duration
+
+	// Timeout is the deadline for each analysis (0 for no deadline)
+	Timeout time.Duration
+}
+
+// Report summarizes the results of a load test
+type Report struct {
+	Total      int
+	Errors     int
+	Elapsed    time.Duration
+	Throughput float64
+	P50        time.Duration
+	P95        time.Duration
+	P99        time.Duration
+}
+
+// ErrorRate returns the fraction of analyses that failed
+func (r *Report) ErrorRate() float64 {
+	if r.Total == 0 {
+		return 0
+	}
+	return float64(r.Errors) / float64(r.Total)
+}
+
+// String renders the report for display
+func (r *Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Analyses: %d\n", r.Total)
+	fmt.Fprintf(&b, "Errors: %d (%.2f%%)\n", r.Errors, r.ErrorRate()*100)
+	fmt.Fprintf(&b, "Elapsed: %v\n", r.Elapsed.Round(time.Millisecond))
+	fmt.Fprintf(&b, "Throughput: %.2f/s\n", r.Throughput)
+	fmt.Fprintf(&b, "Latency p50: %v\n", r.P50.Round(time.Millisecond))
+	fmt.Fprintf(&b, "Latency p95: %v\n", r.P95.Round(time.Millisecond))
+	fmt.Fprintf(&b, "Latency p99: %v\n", r.P99.Round(time.Millisecond))
+	return b.String()
+}
+
+// Runner replays emails against an analyzer with a pool of workers
+type Runner struct {
+	analyzer Analyzer
+	opts     Options
+	logger   *zap.Logger
+}
+
+// NewRunner creates a new load test runner
+func NewRunner(analyzer Analyzer, opts Options, logger *zap.Logger) *Runner {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	return &Runner{
+		analyzer: analyzer,
+		opts:     opts,
+		logger:   logger,
+	}
+}
+
+// Run replays the emails until the duration elapses, or once through if no
+// duration is set, and reports throughput, latency percentiles and errors
+func (r *Runner) Run(ctx context.Context, emails []*core.Email) (*Report, error) {
+	if len(emails) == 0 {
+		return nil, fmt.Errorf("no emails to replay")
+	}
+
+	jobs := make(chan *core.Email)
+	var (
+		mu        sync.Mutex
+		latencies []time.Duration
+		errCount  int
+		wg        sync.WaitGroup
+	)
+
+	// Start the workers
+	for i := 0; i < r.opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for email := range jobs {
+				latency, err := r.analyze(ctx, email)
+				mu.Lock()
+				latencies = append(latencies, latency)
+				if err != nil {
+					errCount++
+				}
+				mu.Unlock()
+				if err != nil {
+					r.logger.Debug("Analysis failed", zap.String("from", email.From), zap.Error(err))
+				}
+			}
+		}()
+	}
+
+	start := time.Now()
+	r.dispatch(ctx, emails, jobs)
+	close(jobs)
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	report := &Report{
+		Total:   len(latencies),
+		Errors:  errCount,
+		Elapsed: elapsed,
+		P50:     stats.Percentile(latencies, 50),
+		P95:     stats.Percentile(latencies, 95),
+		P99:     stats.Percentile(latencies, 99),
+	}
+	if elapsed > 0 {
+		report.Throughput = float64(report.Total) / elapsed.Seconds()
+	}
+
+	return report, nil
+}
+
+// dispatch sends emails to the workers at the target rate until the
+// duration elapses, a single pass completes, or the context is cancelled
+func (r *Runner) dispatch(ctx context.Context, emails []*core.Email, jobs chan<- *core.Email) {
+	var deadline <-chan time.Time
+	if r.opts.Duration > 0 {
+		timer := time.NewTimer(r.opts.Duration)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	var tick <-chan time.Time
+	if interval := time.Duration(float64(time.Second) / r.opts.Rate); r.opts.Rate > 0 && interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for i := 0; r.opts.Duration > 0 || i < len(emails); i++ {
+		if tick != nil {
+			select {
+			case <-tick:
+			case <-deadline:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		select {
+		case jobs <- emails[i%len(emails)]:
+		case <-deadline:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// analyze runs a single analysis and returns its latency
+func (r *Runner) analyze(ctx context.Context, email *core.Email) (time.Duration, error) {
+	if r.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.opts.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	_, err := r.analyzer.AnalyzeEmail(ctx, email)
+	return time.Since(start), err
+}
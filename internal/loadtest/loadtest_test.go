@@ -0,0 +1,104 @@
+package loadtest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"go.uber.org/zap"
+)
+
+// countingAnalyzer counts its analyses and how many ran at once, failing
+// emails from fail@example.com
+type countingAnalyzer struct {
+	mu         sync.Mutex
+	calls      int
+	running    int
+	maxRunning int
+}
+
+func (a *countingAnalyzer) AnalyzeEmail(ctx context.Context, email *core.Email) (*core.SpamAnalysisResult, error) {
+	a.mu.Lock()
+	a.calls++
+	a.running++
+	if a.running > a.maxRunning {
+		a.maxRunning = a.running
+	}
+	a.mu.Unlock()
+
+	time.Sleep(time.Millisecond)
+
+	a.mu.Lock()
+	a.running--
+	a.mu.Unlock()
+	if email.From == "fail@example.com" {
+		return nil, errors.New("analysis failed")
+	}
+	return &core.SpamAnalysisResult{}, nil
+}
+
+func testEmails() []*core.Email {
+	return []*core.Email{{From: "a@example.com"}, {From: "b@example.com"}, {From: "fail@example.com"}, {From: "c@example.com"}}
+}
+
+func TestRunSinglePass(t *testing.T) {
+	analyzer := &countingAnalyzer{}
+	report, err := NewRunner(analyzer, Options{Concurrency: 2}, zap.NewNop()).Run(context.Background(), testEmails())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if report.Total != 4 || analyzer.calls != 4 {
+		t.Errorf("got %d analyses reported and %d run, want 4", report.Total, analyzer.calls)
+	}
+	if report.Errors != 1 || report.ErrorRate() != 0.25 {
+		t.Errorf("got %d errors at rate %v, want 1 at 0.25", report.Errors, report.ErrorRate())
+	}
+	if analyzer.maxRunning > 2 {
+		t.Errorf("ran %d analyses at once, want at most 2", analyzer.maxRunning)
+	}
+	if report.P50 <= 0 || report.P50 > report.P95 || report.P95 > report.P99 {
+		t.Errorf("percentiles p50=%v p95=%v p99=%v are not ordered", report.P50, report.P95, report.P99)
+	}
+}
+
+func TestRunForDuration(t *testing.T) {
+	analyzer := &countingAnalyzer{}
+	report, err := NewRunner(analyzer, Options{Concurrency: 1, Rate: 100, Duration: 200 * time.Millisecond}, zap.NewNop()).Run(context.Background(), testEmails())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	// 100 per second for 200ms is about 20 analyses, replaying the emails
+	if report.Total < 10 || report.Total > 21 {
+		t.Errorf("got %d analyses, want about 20", report.Total)
+	}
+}
+
+func TestRunWithoutEmails(t *testing.T) {
+	if _, err := NewRunner(&countingAnalyzer{}, Options{}, zap.NewNop()).Run(context.Background(), nil); err == nil {
+		t.Error("Run() without emails succeeded")
+	}
+}
+
+func TestRunStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := NewRunner(&countingAnalyzer{}, Options{Duration: time.Hour}, zap.NewNop()).Run(ctx, testEmails()); err != nil {
+			t.Errorf("Run() error = %v", err)
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() kept replaying after the context was cancelled")
+	}
+}
@@ -33,10 +33,56 @@ func InitLogger(cfg *config.Config) (*zap.Logger, error) {
 	}
 	logConfig.Level = zap.NewAtomicLevelAt(level)
 
-	logger, err := logConfig.Build()
+	var opts []zap.Option
+
+	// Send logs to syslog, alongside or instead of the console, if enabled
+	if cfg.GetBool("logging.syslog.enabled") {
+		// Syslog adds its own timestamp, and cannot show colors
+		encoderConfig := zap.NewProductionEncoderConfig()
+		encoderConfig.TimeKey = ""
+		var encoder zapcore.Encoder
+		if cfg.GetString("logging.format") == "json" {
+			encoder = zapcore.NewJSONEncoder(encoderConfig)
+		} else {
+			encoder = zapcore.NewConsoleEncoder(encoderConfig)
+		}
+
+		syslogCore, err := newSyslogCore(
+			cfg.GetString("logging.syslog.network"),
+			cfg.GetString("logging.syslog.address"),
+			cfg.GetString("logging.syslog.facility"),
+			cfg.GetString("logging.syslog.tag"),
+			encoder,
+			logConfig.Level,
+		)
+		if err != nil {
+			return nil, err
+		}
+		keepConsole := cfg.GetBool("logging.syslog.keep_console")
+		opts = append(opts, zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+			if keepConsole {
+				return zapcore.NewTee(core, syslogCore)
+			}
+			return syslogCore
+		}))
+	}
+
+	// Hash addresses in log fields if enabled
+	if cfg.GetBool("logging.hash_pii") {
+		salt := cfg.GetString("logging.hash_salt")
+		opts = append(opts, zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+			return newPIICore(core, salt)
+		}))
+	}
+
+	logger, err := logConfig.Build(opts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize logger: %w", err)
 	}
+
+	if cfg.GetBool("logging.hash_pii") && cfg.GetString("logging.hash_salt") == "" {
+		logger.Warn("Hashing addresses in logs without a salt, set logging.hash_salt")
+	}
 	
 	return logger, nil
 }
@@ -0,0 +1,129 @@
+package logging
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/mail"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// addressKeys are the log field keys that may hold email addresses
+var addressKeys = map[string]bool{
+	"from":          true,
+	"original_from": true,
+	"to":            true,
+	"sender":        true,
+	"recipient":     true,
+	"senders":       true,
+	"recipients":    true,
+	"email":         true,
+	"cache_key":     true,
+	"id":            true,
+	"username":      true,
+}
+
+// HashAddress returns a salted hash of an address, so that log lines for
+// the same address can be correlated without revealing it. Any display name
+// is dropped first, so "Bob <bob@example.com>" hashes like bob@example.com.
+func HashAddress(address, salt string) string {
+	if parsed, err := mail.ParseAddress(address); err == nil {
+		address = parsed.Address
+	}
+	mac := hmac.New(sha256.New, []byte(salt))
+	mac.Write([]byte(strings.ToLower(strings.TrimSpace(address))))
+	return "hash:" + hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// piiCore wraps a core, replacing addresses in address fields with a
+// salted hash before they are written
+type piiCore struct {
+	zapcore.Core
+	salt string
+}
+
+// newPIICore wraps a core to hash the addresses it logs
+func newPIICore(core zapcore.Core, salt string) zapcore.Core {
+	return &piiCore{Core: core, salt: salt}
+}
+
+// With adds structured context to the core, hashing any addresses
+func (c *piiCore) With(fields []zapcore.Field) zapcore.Core {
+	return &piiCore{Core: c.Core.With(c.hashFields(fields)), salt: c.salt}
+}
+
+// Check adds this core to the checked entry if the wrapped core would log it
+func (c *piiCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+// Write hashes any addresses and writes the entry to the wrapped core
+func (c *piiCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	return c.Core.Write(entry, c.hashFields(fields))
+}
+
+// hashFields returns the fields with the values of address fields hashed.
+// Values without an @, such as processing IDs, are left as they are.
+func (c *piiCore) hashFields(fields []zapcore.Field) []zapcore.Field {
+	var hashed []zapcore.Field
+	for i, field := range fields {
+		if !addressKeys[field.Key] {
+			continue
+		}
+		replacement, ok := c.hashField(field)
+		if !ok {
+			continue
+		}
+		if hashed == nil {
+			hashed = make([]zapcore.Field, len(fields))
+			copy(hashed, fields)
+		}
+		hashed[i] = replacement
+	}
+	if hashed == nil {
+		return fields
+	}
+	return hashed
+}
+
+// hashField returns an address field with its addresses hashed, or false
+// if it holds none. Lists such as zap.Strings are hashed element by element.
+func (c *piiCore) hashField(field zapcore.Field) (zapcore.Field, bool) {
+	switch field.Type {
+	case zapcore.StringType:
+		if !strings.Contains(field.String, "@") {
+			return field, false
+		}
+		field.String = HashAddress(field.String, c.salt)
+		return field, true
+	case zapcore.ArrayMarshalerType:
+		enc := zapcore.NewMapObjectEncoder()
+		field.AddTo(enc)
+		values, ok := enc.Fields[field.Key].([]interface{})
+		if !ok {
+			return field, false
+		}
+		strs := make([]string, len(values))
+		changed := false
+		for i, value := range values {
+			str, ok := value.(string)
+			if !ok {
+				return field, false
+			}
+			if strings.Contains(str, "@") {
+				str = HashAddress(str, c.salt)
+				changed = true
+			}
+			strs[i] = str
+		}
+		return zap.Strings(field.Key, strs), changed
+	default:
+		return field, false
+	}
+}
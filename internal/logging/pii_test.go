@@ -0,0 +1,161 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// newHashingLogger returns a logger hashing addresses with salt and the
+// entries it logs
+func newHashingLogger(salt string) (*zap.Logger, *observer.ObservedLogs) {
+	observed, logs := observer.New(zapcore.DebugLevel)
+	return zap.New(newPIICore(observed, salt)), logs
+}
+
+func TestHashedLogsNeverContainAddresses(t *testing.T) {
+	logger, logs := newHashingLogger("pepper")
+	logger = logger.With(zap.String("from", "Alice <alice@example.com>"))
+	logger.Info("Processing email",
+		zap.String("sender", "alice@example.com"),
+		zap.String("recipient", "bob@example.org"),
+		zap.String("cache_key", "alice@example.com|bob@example.org"),
+		zap.Strings("recipients", []string{"bob@example.org", "carol@example.net"}),
+		zap.String("id", "a1b2c3"),
+		zap.String("subject", "Meeting"))
+
+	entries := logs.All()
+	if len(entries) != 1 {
+		t.Fatalf("logged %d entries, want 1", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	for key, value := range fields {
+		rendered := fmt.Sprint(value)
+		for _, address := range []string{"alice@example.com", "bob@example.org", "carol@example.net"} {
+			if strings.Contains(rendered, address) {
+				t.Errorf("field %s = %v, contains raw address %s", key, value, address)
+			}
+		}
+	}
+
+	if fields["sender"] != HashAddress("alice@example.com", "pepper") {
+		t.Errorf("sender = %v, want the salted hash", fields["sender"])
+	}
+	if fields["from"] != fields["sender"] {
+		t.Errorf("from = %v, want the same hash as sender %v", fields["from"], fields["sender"])
+	}
+	if fields["id"] != "a1b2c3" || fields["subject"] != "Meeting" {
+		t.Errorf("got id=%v subject=%v, want other fields unchanged", fields["id"], fields["subject"])
+	}
+}
+
+func TestHashAddressDependsOnSalt(t *testing.T) {
+	hash := HashAddress("alice@example.com", "pepper")
+	if hash != HashAddress("ALICE@example.com ", "pepper") {
+		t.Error("HashAddress() differs by case and whitespace, want the same hash")
+	}
+	if hash == HashAddress("alice@example.com", "salt") {
+		t.Error("HashAddress() is the same for different salts")
+	}
+	if !strings.HasPrefix(hash, "hash:") || strings.Contains(hash, "alice") {
+		t.Errorf("HashAddress() = %q, want an opaque hash", hash)
+	}
+}
+
+// spamLLM classifies every email as spam
+type spamLLM struct{}
+
+func (spamLLM) AnalyzeEmail(ctx context.Context, email *core.Email) (*core.SpamAnalysisResult, error) {
+	return &core.SpamAnalysisResult{Score: 0.95, IsSpam: true}, nil
+}
+
+func TestForwardedSenderIsHashed(t *testing.T) {
+	logger, logs := newHashingLogger("pepper")
+	service := core.NewSpamFilterService(spamLLM{}, nil, logger, false, 0, 0.7, nil, nil, nil,
+		core.ServiceOptions{UnwrapForwarded: true})
+
+	email := &core.Email{
+		From:    "jane@example.org",
+		To:      []string{"user@example.org"},
+		Subject: "Fwd: You have won",
+		Body: "Is this a scam?\r\n\r\n" +
+			"---------- Forwarded message ---------\r\n" +
+			"From: Prize Department <claims@lottery.example>\r\n" +
+			"Subject: You have won $1,000,000\r\n" +
+			"\r\n" +
+			"Send your bank details to claim your prize.\r\n",
+		Headers: map[string][]string{},
+	}
+	if _, err := service.AnalyzeEmail(context.Background(), email); err != nil {
+		t.Fatalf("AnalyzeEmail() error = %v", err)
+	}
+
+	forwarded := logs.FilterMessage("Classifying the original sender of forwarded message").All()
+	if len(forwarded) != 1 {
+		t.Fatalf("logged %d forwarded entries, want 1", len(forwarded))
+	}
+	fields := forwarded[0].ContextMap()
+	if fields["original_from"] != HashAddress("claims@lottery.example", "pepper") {
+		t.Errorf("original_from = %v, want the salted hash", fields["original_from"])
+	}
+	for _, entry := range logs.All() {
+		for key, value := range entry.ContextMap() {
+			if strings.Contains(fmt.Sprint(value), "claims@lottery.example") {
+				t.Errorf("%q field %s = %v, contains the original sender", entry.Message, key, value)
+			}
+		}
+	}
+}
+
+// nonAddressKeys are the string log field keys known never to hold an
+// email address. Network addresses, paths and domains are not hashed.
+var nonAddressKeys = map[string]bool{
+	"address": true, "authserv_id": true, "client_ip": true, "content_type": true,
+	"content_types": true, "database": true, "description": true, "directory": true,
+	"domain": true, "domains": true, "encoding": true, "encryption": true,
+	"error": true, "extension": true, "extensions": true, "file": true,
+	"filename": true, "filter": true, "filter_types": true, "header": true, "l2_type": true,
+	"mode": true, "model": true, "models": true, "networks": true,
+	"next_hop": true, "next_model": true, "oversize_mode": true, "path": true,
+	"processing_id": true, "provider": true, "provider_id": true, "reason": true,
+	"response": true, "route": true, "sender_domain": true, "stages": true,
+	"steps": true, "strategy": true, "subject": true, "verification_model": true,
+}
+
+// stringFieldKey matches the key of a zap.String or zap.Strings field
+var stringFieldKey = regexp.MustCompile(`zap\.Strings?\("([^"]+)"`)
+
+func TestEveryStringFieldKeyIsClassified(t *testing.T) {
+	err := filepath.WalkDir("../..", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ".go" || strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+		source, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, match := range stringFieldKey.FindAllSubmatch(source, -1) {
+			key := string(match[1])
+			if !addressKeys[key] && !nonAddressKeys[key] {
+				t.Errorf("%s logs field %q, add it to addressKeys if it can hold an address or to nonAddressKeys if not", path, key)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("scanning sources: %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package logging
+
+import (
+	"fmt"
+	"log/syslog"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// syslogFacilities maps facility names to syslog facilities
+var syslogFacilities = map[string]syslog.Priority{
+	"kern":     syslog.LOG_KERN,
+	"user":     syslog.LOG_USER,
+	"mail":     syslog.LOG_MAIL,
+	"daemon":   syslog.LOG_DAEMON,
+	"auth":     syslog.LOG_AUTH,
+	"syslog":   syslog.LOG_SYSLOG,
+	"lpr":      syslog.LOG_LPR,
+	"news":     syslog.LOG_NEWS,
+	"uucp":     syslog.LOG_UUCP,
+	"cron":     syslog.LOG_CRON,
+	"authpriv": syslog.LOG_AUTHPRIV,
+	"ftp":      syslog.LOG_FTP,
+	"local0":   syslog.LOG_LOCAL0,
+	"local1":   syslog.LOG_LOCAL1,
+	"local2":   syslog.LOG_LOCAL2,
+	"local3":   syslog.LOG_LOCAL3,
+	"local4":   syslog.LOG_LOCAL4,
+	"local5":   syslog.LOG_LOCAL5,
+	"local6":   syslog.LOG_LOCAL6,
+	"local7":   syslog.LOG_LOCAL7,
+}
+
+// syslogCore writes log entries to syslog, at the syslog severity matching
+// each entry's level
+type syslogCore struct {
+	zapcore.LevelEnabler
+	encoder zapcore.Encoder
+	writer  *syslog.Writer
+}
+
+// newSyslogCore connects to syslog. An empty network and address use the
+// local syslog daemon.
+func newSyslogCore(network, address, facility, tag string, encoder zapcore.Encoder, enabler zapcore.LevelEnabler) (zapcore.Core, error) {
+	priority, ok := syslogFacilities[strings.ToLower(facility)]
+	if !ok {
+		return nil, fmt.Errorf("unknown syslog facility %q", facility)
+	}
+
+	writer, err := syslog.Dial(network, address, priority|syslog.LOG_INFO, tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+
+	return &syslogCore{
+		LevelEnabler: enabler,
+		encoder:      encoder,
+		writer:       writer,
+	}, nil
+}
+
+func (c *syslogCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.encoder = c.encoder.Clone()
+	for _, field := range fields {
+		field.AddTo(clone.encoder)
+	}
+	return &clone
+}
+
+func (c *syslogCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *syslogCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.encoder.EncodeEntry(entry, fields)
+	if err != nil {
+		return err
+	}
+	defer buf.Free()
+
+	message := strings.TrimSuffix(buf.String(), "\n")
+	switch entry.Level {
+	case zapcore.DebugLevel:
+		return c.writer.Debug(message)
+	case zapcore.InfoLevel:
+		return c.writer.Info(message)
+	case zapcore.WarnLevel:
+		return c.writer.Warning(message)
+	case zapcore.ErrorLevel:
+		return c.writer.Err(message)
+	default:
+		return c.writer.Crit(message)
+	}
+}
+
+// Sync is a no-op, as the syslog writer does not buffer
+func (c *syslogCore) Sync() error {
+	return nil
+}
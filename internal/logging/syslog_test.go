@@ -0,0 +1,86 @@
+package logging
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mikey/llm-spam-filter/internal/config"
+	"go.uber.org/zap"
+)
+
+// listenSyslog starts a UDP syslog listener on a local port, closed with
+// the test
+func listenSyslog(t *testing.T) net.PacketConn {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// readSyslog returns the next message received by the listener
+func readSyslog(t *testing.T, conn net.PacketConn) string {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 64*1024)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("no syslog message received: %v", err)
+	}
+	return string(buf[:n])
+}
+
+// syslogConfig returns a configuration logging JSON to the syslog listener
+// instead of the console
+func syslogConfig(address, facility string) *config.Config {
+	v := config.NewEmptyViper()
+	v.Set("logging.format", "json")
+	v.Set("logging.syslog.enabled", true)
+	v.Set("logging.syslog.network", "udp")
+	v.Set("logging.syslog.address", address)
+	v.Set("logging.syslog.facility", facility)
+	v.Set("logging.syslog.tag", "llm-spam-filter")
+	v.Set("logging.syslog.keep_console", false)
+	return config.NewFromViper(v)
+}
+
+func TestProcessedEmailLogReachesSyslog(t *testing.T) {
+	listener := listenSyslog(t)
+	logger, err := InitLogger(syslogConfig(listener.LocalAddr().String(), "mail"))
+	if err != nil {
+		t.Fatalf("InitLogger() error = %v", err)
+	}
+
+	logger.Info("Processed email",
+		zap.String("sender_domain", "example.com"),
+		zap.Bool("is_spam", true),
+		zap.Float64("score", 0.92))
+
+	message := readSyslog(t, listener)
+	// mail (2) * 8 + info (6)
+	if !strings.HasPrefix(message, "<22>") {
+		t.Errorf("message = %q, want mail.info priority <22>", message)
+	}
+	for _, want := range []string{"llm-spam-filter", `"msg":"Processed email"`, `"sender_domain":"example.com"`, `"is_spam":true`, `"score":0.92`} {
+		if !strings.Contains(message, want) {
+			t.Errorf("message = %q, want it to contain %s", message, want)
+		}
+	}
+
+	logger.Warn("Failed to send email to next hop, retrying")
+	// mail (2) * 8 + warning (4)
+	if message := readSyslog(t, listener); !strings.HasPrefix(message, "<20>") {
+		t.Errorf("message = %q, want mail.warning priority <20>", message)
+	}
+}
+
+func TestSyslogRejectsUnknownFacility(t *testing.T) {
+	listener := listenSyslog(t)
+	if _, err := InitLogger(syslogConfig(listener.LocalAddr().String(), "mailbox")); err == nil {
+		t.Error("InitLogger() error = nil, want an error for the unknown facility")
+	}
+}
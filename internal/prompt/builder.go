@@ -0,0 +1,210 @@
+package prompt
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"github.com/mikey/llm-spam-filter/internal/utils"
+	"go.uber.org/zap"
+)
+
+// promptFormat is the template used to ask the model for a verdict
+const promptFormat = `You are a spam detection system. Analyze the following email and determine if it's spam.
+Respond with a JSON object containing:
+%s
+
+%sEmail:
+From: %s
+To: %s
+Subject: %s
+Body:
+%s
+
+%sRespond only with the JSON object and nothing else.`
+
+// subjectOnlyFormat is the template used to ask for a verdict from the
+// sender and subject alone
+const subjectOnlyFormat = `You are a spam detection system. Determine from the sender and subject line alone whether the following email is spam.
+Respond with a JSON object containing:
+%s
+
+Email:
+From: %s
+Subject: %s
+
+%sRespond only with the JSON object and nothing else.`
+
+// scoredFields describes the fields of a full verdict
+const scoredFields = `- is_spam: boolean (true if spam, false if not)
+- score: number between 0 and 1 (higher means more likely to be spam)
+- confidence: number between 0 and 1 (how confident you are in your assessment)
+- explanation: string (brief explanation of why you think it's spam or not)`
+
+// labelOnlyFields describes the fields of a label-only verdict, for models
+// that can't produce calibrated scores
+const labelOnlyFields = `- is_spam: boolean (true if spam, false if not)
+- explanation: string (brief explanation of why you think it's spam or not)`
+
+// explanationLanguageFormat asks for the explanation in a given language
+const explanationLanguageFormat = "Write the explanation in %s, keeping the JSON keys in English.\n"
+
+// attachmentTextFormat introduces text extracted from attachments
+const attachmentTextFormat = "\n\nAttachment text:\n%s"
+
+// signalsFormat introduces signals found while parsing the message
+const signalsFormat = "\n\nSignals:\n%s"
+
+// truncationMarker is appended to bodies truncated to fit the token budget
+const truncationMarker = "\n[... Content truncated to fit the prompt token budget ...]"
+
+// Builder renders analysis prompts for emails
+type Builder struct {
+	opts          Options
+	textProcessor *utils.TextProcessor
+	logger        *zap.Logger
+	examples      string
+}
+
+// NewBuilder creates a new prompt builder
+func NewBuilder(opts Options, textProcessor *utils.TextProcessor, logger *zap.Logger) *Builder {
+	// The examples are the same for every email, so render them once
+	examples, included := formatExamples(opts.Examples, opts.MaxExamplesSize)
+	if included < len(opts.Examples) {
+		logger.Warn("Leaving out few-shot examples over the size limit",
+			zap.Int("examples", len(opts.Examples)),
+			zap.Int("included", included),
+			zap.Int("max_size", opts.MaxExamplesSize))
+	}
+
+	return &Builder{
+		opts:          opts,
+		textProcessor: textProcessor,
+		logger:        logger,
+		examples:      examples,
+	}
+}
+
+// Build renders the analysis prompt for an email
+func (b *Builder) Build(email *core.Email) string {
+	if email.SubjectOnly {
+		return fmt.Sprintf(subjectOnlyFormat, b.fields(), email.From, email.Subject, b.languageInstruction())
+	}
+
+	// Format the prompt with email details
+	to := recipientList(email.To, b.opts.PromptRecipientsMax)
+
+	// Keep only the newest text of a reply if enabled
+	body := email.Body
+	signalList := email.Signals
+	if b.opts.ScoreNewestOnly {
+		if newest, history := utils.SplitNewest(body); strings.TrimSpace(newest) != "" && history != "" {
+			body = strings.TrimRight(newest, " \t\r\n")
+			signalList = append(signalList[:len(signalList):len(signalList)], historySignal(history))
+		}
+	}
+
+	// Process the body (preprocess, truncate and sanitize)
+	body = b.textProcessor.Preprocess(body)
+	if b.opts.MaxBodyTokens > 0 && b.opts.Tokenizer != nil {
+		body = b.textProcessor.SanitizeUTF8(b.textProcessor.TruncateTokens(body, b.opts.MaxBodyTokens, b.opts.Tokenizer))
+	} else {
+		body = b.textProcessor.ProcessText(body, b.opts.MaxBodySize)
+	}
+	if email.AttachmentText != "" {
+		body += fmt.Sprintf(attachmentTextFormat, b.textProcessor.SanitizeUTF8(email.AttachmentText))
+	}
+
+	// Signals follow the body so they survive any truncation
+	if mode := b.opts.InjectionGuard; mode == InjectionGuardFlag || mode == InjectionGuardStrip {
+		var found int
+		body, found = guardBody(body, mode == InjectionGuardStrip)
+		if found > 0 {
+			b.logger.Info("Found possible prompt injection in body",
+				zap.String("from", email.From),
+				zap.Int("lines", found),
+				zap.String("mode", mode))
+			signalList = append(signalList[:len(signalList):len(signalList)], injectionSignal(found, mode == InjectionGuardStrip))
+		}
+	}
+	if b.opts.IncludeReceived {
+		if summary := summarizeReceived(email.Headers); summary != "" {
+			signalList = append(signalList[:len(signalList):len(signalList)], summary)
+		}
+	}
+	if b.opts.IncludeRecipientStats {
+		if stats := recipientStats(email.To); stats != "" {
+			signalList = append(signalList[:len(signalList):len(signalList)], stats)
+		}
+	}
+	signals := ""
+	if len(signalList) > 0 {
+		signals = fmt.Sprintf(signalsFormat, "- "+strings.Join(signalList, "\n- "))
+	}
+
+	boundary := ""
+	if b.opts.InjectionGuard != "" && b.opts.InjectionGuard != InjectionGuardOff {
+		boundary = newBoundary()
+	}
+
+	promptText := b.render(email.From, to, email.Subject, body, signals, boundary)
+	if b.opts.MaxPromptTokens <= 0 || utils.EstimateTokens(promptText) <= b.opts.MaxPromptTokens {
+		return promptText
+	}
+
+	// The prompt is over budget, so truncate the body further to make room
+	// for the subject and the rest of the template
+	overhead := utils.EstimateTokens(b.render(email.From, to, email.Subject, truncationMarker, signals, boundary))
+	truncated := b.textProcessor.TruncateToTokens(body, b.opts.MaxPromptTokens-overhead)
+
+	b.logger.Info("Truncated body to fit prompt token budget",
+		zap.Int("max_prompt_tokens", b.opts.MaxPromptTokens),
+		zap.Int("overhead_tokens", overhead),
+		zap.Int("body_tokens", utils.EstimateTokens(body)),
+		zap.Int("truncated_body_tokens", utils.EstimateTokens(truncated)))
+
+	return b.render(email.From, to, email.Subject, truncated+truncationMarker, signals, boundary)
+}
+
+// historySignal summarizes the quoted history left out of a reply
+func historySignal(history string) string {
+	lines := 0
+	for _, line := range strings.Split(history, "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines++
+		}
+	}
+	return fmt.Sprintf("Quoted history of earlier messages left out (%d lines); only the newest text is shown", lines)
+}
+
+// render formats the prompt template with any examples, adding the
+// explanation language instruction unless explanations are in English. If a
+// boundary is given, the body is wrapped in markers the model is told to
+// treat as data.
+func (b *Builder) render(from, to, subject, body, signals, boundary string) string {
+	instructions := ""
+	if boundary != "" {
+		begin, end := "<<<"+boundary+">>>", "<<<END_"+boundary+">>>"
+		body = begin + "\n" + body + "\n" + end
+		instructions += fmt.Sprintf(injectionGuardFormat, begin, end)
+	}
+	instructions += b.languageInstruction()
+	return fmt.Sprintf(promptFormat, b.fields(), b.examples, from, to, subject, body+signals, instructions)
+}
+
+// fields describes the response fields the model should return
+func (b *Builder) fields() string {
+	if b.opts.LabelOnly {
+		return labelOnlyFields
+	}
+	return scoredFields
+}
+
+// languageInstruction asks for the explanation in the configured language,
+// or returns an empty string for English
+func (b *Builder) languageInstruction() string {
+	if language := strings.TrimSpace(b.opts.ExplanationLanguage); language != "" && !strings.EqualFold(language, "english") {
+		return fmt.Sprintf(explanationLanguageFormat, language)
+	}
+	return ""
+}
@@ -0,0 +1,173 @@
+package prompt
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"github.com/mikey/llm-spam-filter/internal/utils"
+	"go.uber.org/zap"
+)
+
+// newTestBuilder creates a builder with the given options
+func newTestBuilder(opts Options) *Builder {
+	return NewBuilder(opts, utils.NewTextProcessor(zap.NewNop()), zap.NewNop())
+}
+
+// testEmail returns a plain email
+func testEmail() *core.Email {
+	return &core.Email{
+		From:    "sender@example.com",
+		To:      []string{"user@example.org"},
+		Subject: "Quarterly report",
+		Body:    "Please find the figures for the third quarter below.",
+		Headers: map[string][]string{},
+	}
+}
+
+func TestBuildSubjectOnlyLeavesOutBody(t *testing.T) {
+	email := testEmail()
+	email.SubjectOnly = true
+	email.Signals = []string{"Link text/target mismatches: 2"}
+	email.AttachmentText = "--- notes.txt ---\nsecret attachment text"
+
+	prompt := newTestBuilder(Options{}).Build(email)
+	if !strings.Contains(prompt, email.Subject) || !strings.Contains(prompt, email.From) {
+		t.Errorf("prompt is missing the sender or subject:\n%s", prompt)
+	}
+	for _, leftOut := range []string{email.Body, "Body:", "secret attachment text", "Link text/target"} {
+		if strings.Contains(prompt, leftOut) {
+			t.Errorf("subject-only prompt contains %q:\n%s", leftOut, prompt)
+		}
+	}
+}
+
+func TestBuildIncludesBodyByDefault(t *testing.T) {
+	email := testEmail()
+	if prompt := newTestBuilder(Options{}).Build(email); !strings.Contains(prompt, email.Body) {
+		t.Errorf("prompt is missing the body:\n%s", prompt)
+	}
+}
+
+func TestBuildTruncatesBodyForLargeSubject(t *testing.T) {
+	const budget = 500
+	builder := newTestBuilder(Options{MaxPromptTokens: budget})
+
+	email := testEmail()
+	email.Body = strings.Repeat("The meeting has moved to the third floor. ", 100)
+	withShortSubject := builder.Build(email)
+
+	email.Subject = strings.Repeat("URGENT ACCOUNT NOTICE ", 60)
+	withLongSubject := builder.Build(email)
+
+	for _, prompt := range []string{withShortSubject, withLongSubject} {
+		if tokens := utils.EstimateTokens(prompt); tokens > budget {
+			t.Errorf("prompt is %d tokens, want at most %d", tokens, budget)
+		}
+		if !strings.Contains(prompt, truncationMarker) {
+			t.Error("over-budget prompt is missing the truncation marker")
+		}
+	}
+	if !strings.Contains(withLongSubject, email.Subject) {
+		t.Error("prompt is missing the subject")
+	}
+
+	bodyLength := func(prompt string) int {
+		start := strings.Index(prompt, "Body:\n")
+		end := strings.Index(prompt, truncationMarker)
+		return end - start
+	}
+	if bodyLength(withLongSubject) >= bodyLength(withShortSubject) {
+		t.Errorf("body kept %d bytes with the long subject and %d with the short one, want it truncated further",
+			bodyLength(withLongSubject), bodyLength(withShortSubject))
+	}
+}
+
+func TestBuildLeavesPromptWithinBudget(t *testing.T) {
+	prompt := newTestBuilder(Options{MaxPromptTokens: 5000}).Build(testEmail())
+	if strings.Contains(prompt, truncationMarker) {
+		t.Error("prompt within budget was truncated")
+	}
+}
+
+func TestBuildIncludesAttachmentText(t *testing.T) {
+	email := testEmail()
+	email.AttachmentText = "--- notes.txt ---\nWire the funds to account 12345 today.\n"
+
+	prompt := newTestBuilder(Options{MaxBodySize: 10}).Build(email)
+	if !strings.Contains(prompt, "Attachment text:\n"+email.AttachmentText) {
+		t.Errorf("prompt is missing the attachment text:\n%s", prompt)
+	}
+}
+
+func TestBuildExplanationLanguage(t *testing.T) {
+	tests := []struct {
+		language string
+		want     string
+	}{
+		{"German", "Write the explanation in German, keeping the JSON keys in English."},
+		{"  français ", "Write the explanation in français, keeping the JSON keys in English."},
+		{"English", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.language, func(t *testing.T) {
+			builder := newTestBuilder(Options{ExplanationLanguage: tt.language})
+			email := testEmail()
+			for _, prompt := range []string{builder.Build(email), builder.Build(&core.Email{From: email.From, Subject: email.Subject, SubjectOnly: true})} {
+				if tt.want == "" && strings.Contains(prompt, "Write the explanation in") {
+					t.Errorf("prompt has a language instruction:\n%s", prompt)
+				}
+				if tt.want != "" && !strings.Contains(prompt, tt.want) {
+					t.Errorf("prompt is missing %q:\n%s", tt.want, prompt)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildUndisclosedRecipients(t *testing.T) {
+	email := testEmail()
+	email.To = nil
+
+	if prompt := newTestBuilder(Options{}).Build(email); !strings.Contains(prompt, "To: (undisclosed recipients)") {
+		t.Errorf("prompt = %q, want undisclosed recipients", prompt)
+	}
+}
+
+// replyBody is a reply with new text above the quoted earlier message
+const replyBody = "Click here to claim your prize now.\n\n" +
+	"On Mon, 1 Jan 2024, Bob <bob@example.com> wrote:\n" +
+	"> Are we still meeting on Friday?\n" +
+	"> Thanks"
+
+func TestBuildScoresNewestOnly(t *testing.T) {
+	email := testEmail()
+	email.Body = replyBody
+
+	prompt := newTestBuilder(Options{ScoreNewestOnly: true}).Build(email)
+	if !strings.Contains(prompt, "Click here to claim your prize now.") {
+		t.Errorf("prompt is missing the newest text:\n%s", prompt)
+	}
+	if strings.Contains(prompt, "Are we still meeting") || strings.Contains(prompt, "Bob <bob@example.com> wrote") {
+		t.Errorf("prompt contains the quoted history:\n%s", prompt)
+	}
+	if !strings.Contains(prompt, "Quoted history of earlier messages left out (3 lines)") {
+		t.Errorf("prompt is missing the history summary:\n%s", prompt)
+	}
+
+	prompt = newTestBuilder(Options{}).Build(email)
+	if !strings.Contains(prompt, "Are we still meeting") || strings.Contains(prompt, "Quoted history") {
+		t.Errorf("prompt without the option should contain the whole body:\n%s", prompt)
+	}
+}
+
+func TestBuildScoresWholeBodyWithoutNewText(t *testing.T) {
+	email := testEmail()
+	email.Body = "> Are we still meeting on Friday?\n> Thanks"
+
+	prompt := newTestBuilder(Options{ScoreNewestOnly: true}).Build(email)
+	if !strings.Contains(prompt, "Are we still meeting") || strings.Contains(prompt, "Quoted history") {
+		t.Errorf("prompt for a body that is all quoted should contain it all:\n%s", prompt)
+	}
+}
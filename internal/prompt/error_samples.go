@@ -0,0 +1,69 @@
+package prompt
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxErrorSampleSize bounds the response text kept for each sample
+const maxErrorSampleSize = 4096
+
+// ErrorSample is a model response that could not be parsed
+type ErrorSample struct {
+	Time     time.Time
+	Response string
+	Error    string
+}
+
+// ErrorSamples keeps the most recent responses that could not be parsed in
+// a fixed-size ring buffer, for debugging intermittent parse failures
+type ErrorSamples struct {
+	mu      sync.Mutex
+	samples []ErrorSample
+	next    int
+	full    bool
+}
+
+// NewErrorSamples creates a buffer of the last capacity unparseable
+// responses, or returns nil if capacity is not positive
+func NewErrorSamples(capacity int) *ErrorSamples {
+	if capacity <= 0 {
+		return nil
+	}
+	return &ErrorSamples{samples: make([]ErrorSample, capacity)}
+}
+
+// Add records an unparseable response, evicting the oldest sample if the
+// buffer is full. Long responses are truncated.
+func (s *ErrorSamples) Add(response string, err error) {
+	if len(response) > maxErrorSampleSize {
+		response = strings.ToValidUTF8(response[:maxErrorSampleSize], "")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.samples[s.next] = ErrorSample{
+		Time:     time.Now(),
+		Response: response,
+		Error:    err.Error(),
+	}
+	s.next = (s.next + 1) % len(s.samples)
+	if s.next == 0 {
+		s.full = true
+	}
+}
+
+// Samples returns the recorded samples, oldest first
+func (s *ErrorSamples) Samples() []ErrorSample {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.full {
+		return append([]ErrorSample(nil), s.samples[:s.next]...)
+	}
+	samples := make([]ErrorSample, 0, len(s.samples))
+	samples = append(samples, s.samples[s.next:]...)
+	return append(samples, s.samples[:s.next]...)
+}
@@ -0,0 +1,63 @@
+package prompt
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// responses returns the response text of each sample
+func responses(samples []ErrorSample) []string {
+	texts := make([]string, len(samples))
+	for i, sample := range samples {
+		texts[i] = sample.Response
+	}
+	return texts
+}
+
+func TestParseFailuresFillErrorSamples(t *testing.T) {
+	samples := NewErrorSamples(3)
+	builder := newTestBuilder(Options{ErrorSamples: samples})
+
+	if _, err := builder.ParseResponse(`{"is_spam": true, "score": 0.9}`); err != nil {
+		t.Fatalf("ParseResponse() error = %v", err)
+	}
+	if got := samples.Samples(); len(got) != 0 {
+		t.Fatalf("samples = %v, want none for a valid response", responses(got))
+	}
+
+	for i := 1; i <= 2; i++ {
+		builder.ParseResponse(fmt.Sprintf("not json %d", i))
+	}
+	if got := strings.Join(responses(samples.Samples()), ","); got != "not json 1,not json 2" {
+		t.Errorf("samples = %s, want both failures", got)
+	}
+
+	// Once full, the oldest sample is evicted
+	for i := 3; i <= 5; i++ {
+		builder.ParseResponse(fmt.Sprintf("not json %d", i))
+	}
+	got := samples.Samples()
+	if texts := strings.Join(responses(got), ","); texts != "not json 3,not json 4,not json 5" {
+		t.Errorf("samples = %s, want the last 3 failures, oldest first", texts)
+	}
+	for _, sample := range got {
+		if sample.Error == "" || sample.Time.IsZero() {
+			t.Errorf("sample = %+v, want the error and time recorded", sample)
+		}
+	}
+}
+
+func TestErrorSamplesTruncateLongResponses(t *testing.T) {
+	samples := NewErrorSamples(1)
+	samples.Add(strings.Repeat("x", 2*maxErrorSampleSize), ErrInvalidResponse)
+	if got := samples.Samples(); len(got) != 1 || len(got[0].Response) != maxErrorSampleSize {
+		t.Errorf("samples = %d, want one truncated to %d bytes", len(got), maxErrorSampleSize)
+	}
+}
+
+func TestErrorSamplesOffByDefault(t *testing.T) {
+	if samples := NewErrorSamples(0); samples != nil {
+		t.Error("NewErrorSamples(0) = a buffer, want nil")
+	}
+}
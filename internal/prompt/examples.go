@@ -0,0 +1,65 @@
+package prompt
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mikey/llm-spam-filter/internal/config"
+)
+
+// examplesHeader introduces the labeled examples shown before the email
+const examplesHeader = "Here are some labeled examples:\n\n"
+
+// exampleFormat renders one labeled example
+const exampleFormat = "Example %d (%s):\nSubject: %s\nBody:\n%s\n\n"
+
+// Example is a labeled email shown to the model before the one to analyze
+type Example struct {
+	Subject string
+	Body    string
+	Label   string
+}
+
+// ExamplesFromConfig reads the labeled examples in spam.few_shot_examples,
+// returning an error if one is malformed or labeled other than spam or ham
+func ExamplesFromConfig(cfg *config.Config) ([]Example, error) {
+	var examples []Example
+	if err := cfg.GetViper().UnmarshalKey("spam.few_shot_examples", &examples); err != nil {
+		return nil, fmt.Errorf("invalid few-shot examples: %w", err)
+	}
+	for i := range examples {
+		examples[i].Label = strings.ToLower(strings.TrimSpace(examples[i].Label))
+		if examples[i].Label != "spam" && examples[i].Label != "ham" {
+			return nil, fmt.Errorf("invalid label %q for few-shot example %d, expected spam or ham", examples[i].Label, i+1)
+		}
+		if strings.TrimSpace(examples[i].Body) == "" {
+			return nil, fmt.Errorf("few-shot example %d has no body", i+1)
+		}
+	}
+	return examples, nil
+}
+
+// formatExamples renders the examples in order, stopping before the first
+// that would take the rendered section over maxSize bytes (0 for no limit).
+// It returns the section and the number of examples included.
+func formatExamples(examples []Example, maxSize int) (string, int) {
+	if len(examples) == 0 {
+		return "", 0
+	}
+
+	var sb strings.Builder
+	sb.WriteString(examplesHeader)
+	included := 0
+	for i, example := range examples {
+		rendered := fmt.Sprintf(exampleFormat, i+1, example.Label, example.Subject, strings.TrimSpace(example.Body))
+		if maxSize > 0 && sb.Len()+len(rendered) > maxSize {
+			break
+		}
+		sb.WriteString(rendered)
+		included++
+	}
+	if included == 0 {
+		return "", 0
+	}
+	return sb.String(), included
+}
@@ -0,0 +1,71 @@
+package prompt
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mikey/llm-spam-filter/internal/config"
+)
+
+var testExamples = []Example{
+	{Subject: "You won a cruise", Body: "Click here to claim your free cruise.", Label: "spam"},
+	{Subject: "Lunch on Friday?", Body: "Are you free for lunch on Friday?", Label: "ham"},
+}
+
+func TestBuildIncludesExamplesBeforeEmail(t *testing.T) {
+	prompt := newTestBuilder(Options{Examples: testExamples}).Build(testEmail())
+
+	for _, want := range []string{
+		"Example 1 (spam):\nSubject: You won a cruise\nBody:\nClick here to claim your free cruise.",
+		"Example 2 (ham):\nSubject: Lunch on Friday?",
+	} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt = %q, want %q", prompt, want)
+		}
+	}
+	if strings.Index(prompt, "Example 2") > strings.Index(prompt, "Quarterly report") {
+		t.Errorf("prompt = %q, want the examples before the email", prompt)
+	}
+}
+
+func TestBuildCapsExamplesSize(t *testing.T) {
+	// Room for the header and the first example only
+	first, _ := formatExamples(testExamples[:1], 0)
+	prompt := newTestBuilder(Options{Examples: testExamples, MaxExamplesSize: len(first)}).Build(testEmail())
+
+	if !strings.Contains(prompt, "You won a cruise") {
+		t.Errorf("prompt = %q, want the first example", prompt)
+	}
+	if strings.Contains(prompt, "Lunch on Friday?") {
+		t.Errorf("prompt = %q, want the example over the cap left out", prompt)
+	}
+
+	section, included := formatExamples(testExamples, 10)
+	if section != "" || included != 0 {
+		t.Errorf("formatExamples() with a tiny cap = %q, %d, want no section", section, included)
+	}
+}
+
+func TestExamplesFromConfig(t *testing.T) {
+	v := config.NewEmptyViper()
+	v.Set("spam.few_shot_examples", []map[string]string{
+		{"subject": "You won a cruise", "body": "Claim it now.", "label": " Spam "},
+	})
+	examples, err := ExamplesFromConfig(config.NewFromViper(v))
+	if err != nil {
+		t.Fatalf("ExamplesFromConfig() error = %v", err)
+	}
+	if len(examples) != 1 || examples[0].Label != "spam" || examples[0].Subject != "You won a cruise" {
+		t.Errorf("examples = %+v, want the configured example", examples)
+	}
+
+	for _, example := range []map[string]string{
+		{"subject": "Hi", "body": "Hello", "label": "maybe"},
+		{"subject": "Hi", "body": " ", "label": "ham"},
+	} {
+		v.Set("spam.few_shot_examples", []map[string]string{example})
+		if _, err := ExamplesFromConfig(config.NewFromViper(v)); err == nil {
+			t.Errorf("ExamplesFromConfig(%v) succeeded, want an error", example)
+		}
+	}
+}
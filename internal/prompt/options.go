@@ -0,0 +1,93 @@
+package prompt
+
+import (
+	"strings"
+
+	"github.com/mikey/llm-spam-filter/internal/config"
+	"github.com/mikey/llm-spam-filter/internal/utils"
+)
+
+// Options controls how analysis prompts are rendered
+type Options struct {
+	// MaxBodySize is the maximum body size in bytes (0 for no limit)
+	MaxBodySize int
+
+	// MaxBodyTokens truncates the body by tokens counted with Tokenizer
+	// instead of by MaxBodySize (0 to truncate by size)
+	MaxBodyTokens int
+
+	// Tokenizer counts tokens for MaxBodyTokens
+	Tokenizer utils.Tokenizer
+
+	// MaxPromptTokens is the estimated token budget for the whole prompt (0 for no limit)
+	MaxPromptTokens int
+
+	// IncludeReceived adds a summary of the Received headers to the prompt
+	IncludeReceived bool
+
+	// PromptRecipientsMax is how many recipient addresses are listed before
+	// the rest are summarized as a count
+	PromptRecipientsMax int
+
+	// IncludeRecipientStats adds the number of recipients and distinct
+	// recipient domains to the prompt
+	IncludeRecipientStats bool
+
+	// ExplanationLanguage is the language the model should write its
+	// explanation in (English if empty)
+	ExplanationLanguage string
+
+	// InjectionGuard is how the body is guarded against prompt injection:
+	// off, delimit, flag or strip
+	InjectionGuard string
+
+	// ResponseFields maps response fields (is_spam, score, confidence and
+	// explanation) to alternative key names tried when the field is missing
+	ResponseFields map[string][]string
+
+	// Examples are labeled emails shown to the model before the email to
+	// analyze
+	Examples []Example
+
+	// MaxExamplesSize caps the size in bytes of the rendered examples;
+	// examples past the cap are left out (0 for no limit)
+	MaxExamplesSize int
+
+	// ScoreNewestOnly leaves the quoted history of a reply out of the
+	// prompt, noting how much was left out as a signal
+	ScoreNewestOnly bool
+
+	// LabelOnly asks the model for is_spam and an explanation only, scoring
+	// the verdict 1 or 0 from the label
+	LabelOnly bool
+
+	// LabelOnlyConfidence is the confidence given to label-only verdicts
+	LabelOnlyConfidence float64
+
+	// ErrorSamples records responses that could not be parsed (nil to
+	// disable)
+	ErrorSamples *ErrorSamples
+}
+
+// OptionsFromConfig builds prompt options from the configuration and the
+// provider's maximum body size
+func OptionsFromConfig(cfg *config.Config, maxBodySize int) Options {
+	// Malformed examples are rejected when the LLM client is created
+	examples, _ := ExamplesFromConfig(cfg)
+
+	return Options{
+		MaxBodySize:           maxBodySize,
+		MaxPromptTokens:       cfg.GetInt("llm.max_prompt_tokens"),
+		IncludeReceived:       cfg.GetBool("spam.include_received"),
+		PromptRecipientsMax:   cfg.GetInt("spam.prompt_recipients_max"),
+		IncludeRecipientStats: cfg.GetBool("spam.include_recipient_stats"),
+		ExplanationLanguage:   cfg.GetString("spam.explanation_language"),
+		InjectionGuard:        strings.ToLower(strings.TrimSpace(cfg.GetString("spam.injection_guard"))),
+		ResponseFields:        cfg.GetStringMapStringSlice("llm.response_fields"),
+		Examples:              examples,
+		MaxExamplesSize:       cfg.GetInt("spam.few_shot_max_size"),
+		ScoreNewestOnly:       cfg.GetBool("spam.score_newest_only"),
+		LabelOnly:             cfg.GetBool("spam.label_only"),
+		LabelOnlyConfidence:   cfg.GetFloat64("spam.label_only_confidence"),
+	}
+}
@@ -0,0 +1,117 @@
+package prompt
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+var (
+	// receivedFromPattern captures the announced name and the optional
+	// parenthesised comment of a Received header's from clause
+	receivedFromPattern = regexp.MustCompile(`(?i)^\s*from\s+(\S+)(?:\s+\(([^)]*)\))?`)
+
+	// bracketedIPPattern captures an address in brackets, e.g. [203.0.113.5]
+	// or [IPv6:2001:db8::1]
+	bracketedIPPattern = regexp.MustCompile(`(?i)\[(?:ipv6:)?([0-9a-f.:]+)\]`)
+)
+
+// receivedHop holds the relevant fields of a single Received header
+type receivedHop struct {
+	// Helo is the name the sending host announced
+	Helo string
+	// Host is the reverse DNS name recorded by the receiving host, if any
+	Host string
+	// IP is the connecting address recorded by the receiving host, if any
+	IP net.IP
+}
+
+// parseReceived extracts the sending host details from a Received header
+func parseReceived(header string) (receivedHop, bool) {
+	match := receivedFromPattern.FindStringSubmatch(strings.Join(strings.Fields(header), " "))
+	if match == nil {
+		return receivedHop{}, false
+	}
+
+	hop := receivedHop{Helo: match[1]}
+	if comment := match[2]; comment != "" {
+		if ipMatch := bracketedIPPattern.FindStringSubmatch(comment); ipMatch != nil {
+			hop.IP = net.ParseIP(ipMatch[1])
+		}
+		// Postfix records "unknown" when there is no reverse DNS, and Exim
+		// records helo=... in the comment instead of a host name
+		if fields := strings.Fields(comment); len(fields) > 0 && !strings.HasPrefix(fields[0], "[") &&
+			!strings.Contains(fields[0], "=") && !strings.EqualFold(fields[0], "unknown") {
+			hop.Host = fields[0]
+		}
+	}
+
+	// Some relays only record the address as the announced name
+	if hop.IP == nil {
+		hop.IP = heloIP(hop.Helo)
+	}
+
+	return hop, true
+}
+
+// heloIP returns the address if an announced name is an IP literal
+func heloIP(helo string) net.IP {
+	helo = strings.TrimSuffix(strings.TrimPrefix(helo, "["), "]")
+	if len(helo) > 5 && strings.EqualFold(helo[:5], "ipv6:") {
+		helo = helo[5:]
+	}
+	return net.ParseIP(helo)
+}
+
+// isExternalIP returns whether an address is publicly routable
+func isExternalIP(ip net.IP) bool {
+	return ip != nil && !ip.IsPrivate() && !ip.IsLoopback() && !ip.IsLinkLocalUnicast() && !ip.IsUnspecified()
+}
+
+// summarizeReceived renders a one-line summary of the Received chain: the
+// hop count, the first external sender (the most recent hop from a public
+// address) and any hosts that announced an IP literal instead of a name.
+// It returns an empty string if the email has no Received headers.
+func summarizeReceived(headers map[string][]string) string {
+	var received []string
+	for key, values := range headers {
+		if strings.EqualFold(key, "Received") {
+			received = append(received, values...)
+		}
+	}
+	if len(received) == 0 {
+		return ""
+	}
+
+	summary := fmt.Sprintf("Received chain: %d hops", len(received))
+
+	// Headers are prepended by each relay, so the first is the most recent
+	var external *receivedHop
+	var literals []string
+	for _, header := range received {
+		hop, ok := parseReceived(header)
+		if !ok {
+			continue
+		}
+		if external == nil && isExternalIP(hop.IP) {
+			external = &hop
+		}
+		if heloIP(hop.Helo) != nil {
+			literals = append(literals, hop.Helo)
+		}
+	}
+
+	if external != nil {
+		name := external.Host
+		if name == "" {
+			name = external.Helo
+		}
+		summary += fmt.Sprintf(", first external sender %s [%s]", name, external.IP)
+	}
+	if len(literals) > 0 {
+		summary += fmt.Sprintf(", IP-literal hosts: %s", strings.Join(literals, " "))
+	}
+
+	return summary
+}
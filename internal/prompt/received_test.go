@@ -0,0 +1,50 @@
+package prompt
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSummarizeReceived(t *testing.T) {
+	headers := map[string][]string{
+		"Received": {
+			"from mx.example.org (localhost [127.0.0.1])\r\n\tby filter.example.org (Postfix) with ESMTP id 1A2B3C",
+			"from mail.spammer.example (host-203-0-113-5.example.net [203.0.113.5])\r\n\tby mx.example.org (Postfix) with ESMTPS id 4D5E6F",
+			"from [198.51.100.7] (unknown [198.51.100.7])\r\n\tby mail.spammer.example with SMTP",
+		},
+	}
+
+	want := "Received chain: 3 hops, first external sender host-203-0-113-5.example.net [203.0.113.5], IP-literal hosts: [198.51.100.7]"
+	if got := summarizeReceived(headers); got != want {
+		t.Errorf("summarizeReceived() = %q, want %q", got, want)
+	}
+}
+
+func TestSummarizeReceivedWithoutHeaders(t *testing.T) {
+	if got := summarizeReceived(map[string][]string{"Subject": {"Hello"}}); got != "" {
+		t.Errorf("summarizeReceived() = %q, want an empty summary", got)
+	}
+}
+
+func TestParseReceivedEximHelo(t *testing.T) {
+	hop, ok := parseReceived("from [203.0.113.9] (helo=relay.example.net)\r\n\tby mx.example.org with esmtp (Exim 4.96)")
+	if !ok {
+		t.Fatal("parseReceived() failed")
+	}
+	if hop.Host != "" || hop.IP.String() != "203.0.113.9" {
+		t.Errorf("hop = %+v, want no host and the literal address", hop)
+	}
+}
+
+func TestBuildIncludesReceivedSummary(t *testing.T) {
+	email := testEmail()
+	email.Headers["Received"] = []string{"from relay.example.net (relay.example.net [203.0.113.5]) by mx.example.org"}
+
+	prompt := newTestBuilder(Options{IncludeReceived: true}).Build(email)
+	if !strings.Contains(prompt, "- Received chain: 1 hops, first external sender relay.example.net [203.0.113.5]") {
+		t.Errorf("prompt is missing the Received summary:\n%s", prompt)
+	}
+	if prompt := newTestBuilder(Options{}).Build(email); strings.Contains(prompt, "Received chain") {
+		t.Error("Received summary included without being enabled")
+	}
+}
@@ -0,0 +1,45 @@
+package prompt
+
+import (
+	"fmt"
+	"strings"
+)
+
+// recipientStats summarizes how many recipients an email has and how many
+// distinct domains they are in, e.g. "Recipients: 3 (2 distinct domains)".
+// Addresses without a domain are counted but not as a domain.
+func recipientStats(to []string) string {
+	if len(to) == 0 {
+		return ""
+	}
+
+	domains := make(map[string]struct{})
+	for _, address := range to {
+		if at := strings.LastIndex(address, "@"); at >= 0 && at < len(address)-1 {
+			domain := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(address[at+1:]), ">"))
+			domains[domain] = struct{}{}
+		}
+	}
+
+	noun := "domains"
+	if len(domains) == 1 {
+		noun = "domain"
+	}
+	return fmt.Sprintf("Recipients: %d (%d distinct %s)", len(to), len(domains), noun)
+}
+
+// recipientList lists up to max recipients verbatim and summarizes the
+// rest, e.g. "a@example.com, b@example.com and 3 others". At least one
+// recipient is listed.
+func recipientList(to []string, max int) string {
+	if len(to) == 0 {
+		return "(undisclosed recipients)"
+	}
+	if max < 1 {
+		max = 1
+	}
+	if len(to) <= max {
+		return strings.Join(to, ", ")
+	}
+	return fmt.Sprintf("%s and %d others", strings.Join(to[:max], ", "), len(to)-max)
+}
@@ -0,0 +1,90 @@
+package prompt
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRecipientStats(t *testing.T) {
+	tests := []struct {
+		name string
+		to   []string
+		want string
+	}{
+		{"none", nil, ""},
+		{"one", []string{"user@example.org"}, "Recipients: 1 (1 distinct domain)"},
+		{"several across domains", []string{
+			"alice@example.org",
+			"Bob <bob@EXAMPLE.org>",
+			"carol@example.net",
+			"dave@mail.example.com",
+		}, "Recipients: 4 (3 distinct domains)"},
+		{"without a domain", []string{"postmaster", "user@example.org"}, "Recipients: 2 (1 distinct domain)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := recipientStats(tt.to); got != tt.want {
+				t.Errorf("recipientStats() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildIncludesRecipientStats(t *testing.T) {
+	email := testEmail()
+	email.To = []string{"alice@example.org", "bob@example.org", "carol@example.net"}
+
+	for _, include := range []bool{false, true} {
+		prompt := newTestBuilder(Options{IncludeRecipientStats: include}).Build(email)
+		if got := strings.Contains(prompt, "Recipients: 3 (2 distinct domains)"); got != include {
+			t.Errorf("include=%t: prompt = %q, stats present = %t", include, prompt, got)
+		}
+	}
+}
+
+// manyRecipients returns count distinct recipient addresses
+func manyRecipients(count int) []string {
+	to := make([]string, count)
+	for i := range to {
+		to[i] = fmt.Sprintf("user%d@example.org", i+1)
+	}
+	return to
+}
+
+func TestRecipientList(t *testing.T) {
+	to := manyRecipients(20)
+	tests := []struct {
+		max  int
+		want string
+	}{
+		{5, "user1@example.org, user2@example.org, user3@example.org, user4@example.org, user5@example.org and 15 others"},
+		{0, "user1@example.org and 19 others"},
+		{20, strings.Join(to, ", ")},
+		{50, strings.Join(to, ", ")},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("max=%d", tt.max), func(t *testing.T) {
+			if got := recipientList(to, tt.max); got != tt.want {
+				t.Errorf("recipientList() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if got := recipientList(nil, 5); got != "(undisclosed recipients)" {
+		t.Errorf("recipientList(nil) = %q, want (undisclosed recipients)", got)
+	}
+}
+
+func TestBuildListsConfiguredRecipients(t *testing.T) {
+	email := testEmail()
+	email.To = manyRecipients(20)
+
+	prompt := newTestBuilder(Options{PromptRecipientsMax: 5}).Build(email)
+	if !strings.Contains(prompt, "user5@example.org and 15 others") {
+		t.Errorf("prompt = %q, want the first 5 recipients listed and 15 summarized", prompt)
+	}
+	if strings.Contains(prompt, "user6@example.org") {
+		t.Errorf("prompt = %q, want recipients past the maximum left out", prompt)
+	}
+}
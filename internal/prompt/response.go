@@ -0,0 +1,155 @@
+package prompt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidResponse is returned when the model's response can't be parsed as a verdict
+var ErrInvalidResponse = errors.New("invalid LLM response")
+
+// ErrEmptyResponse is returned when the model returns no answer at all
+var ErrEmptyResponse = errors.New("empty LLM response")
+
+// ReformatPrompt asks the model to restate a previous answer as the required JSON object
+const ReformatPrompt = `Your previous answer could not be parsed. Reformat the previous answer as the required JSON object with the fields is_spam, score, confidence and explanation.
+Respond only with the JSON object and nothing else.`
+
+// labelOnlyReformatPrompt is ReformatPrompt for label-only verdicts
+const labelOnlyReformatPrompt = `Your previous answer could not be parsed. Reformat the previous answer as the required JSON object with the fields is_spam and explanation.
+Respond only with the JSON object and nothing else.`
+
+// Response represents the structured response from the LLM
+type Response struct {
+	IsSpam      bool    `json:"is_spam"`
+	Score       float64 `json:"score"`
+	Confidence  float64 `json:"confidence"`
+	Explanation string  `json:"explanation"`
+}
+
+// responseFields are the JSON keys of the fields in a Response
+var responseFields = []string{"is_spam", "score", "confidence", "explanation"}
+
+// ParseResponse parses the LLM's JSON response. If the response contains
+// text around the JSON object, the outermost object is extracted and parsed.
+func ParseResponse(responseText string) (*Response, error) {
+	return parseResponse(responseText, nil)
+}
+
+// ParseResponse parses the LLM's JSON response, trying the configured
+// alternative key names for any missing fields. In label-only mode the
+// score is 1 or 0 from is_spam, with the configured fixed confidence.
+func (b *Builder) ParseResponse(responseText string) (*Response, error) {
+	response, err := parseResponse(responseText, b.opts.ResponseFields)
+	if err != nil {
+		if b.opts.ErrorSamples != nil {
+			b.opts.ErrorSamples.Add(responseText, err)
+		}
+		return nil, err
+	}
+	b.applyLabelOnly(response)
+	return response, nil
+}
+
+// applyLabelOnly sets the score and confidence of a label-only verdict
+func (b *Builder) applyLabelOnly(response *Response) {
+	if !b.opts.LabelOnly {
+		return
+	}
+	response.Score = 0.0
+	if response.IsSpam {
+		response.Score = 1.0
+	}
+	response.Confidence = b.opts.LabelOnlyConfidence
+}
+
+// ReformatPrompt returns the prompt asking the model to restate a previous
+// answer as the JSON object this builder asked for
+func (b *Builder) ReformatPrompt() string {
+	if b.opts.LabelOnly {
+		return labelOnlyReformatPrompt
+	}
+	return ReformatPrompt
+}
+
+// parseResponse parses the LLM's JSON response, mapping alternative key
+// names to the response fields
+func parseResponse(responseText string, fieldAlternatives map[string][]string) (*Response, error) {
+	var response Response
+	if len(fieldAlternatives) == 0 {
+		if err := json.Unmarshal([]byte(responseText), &response); err == nil {
+			return &response, nil
+		}
+	} else if data, err := remapFields([]byte(responseText), fieldAlternatives); err == nil {
+		if err := json.Unmarshal(data, &response); err == nil {
+			return &response, nil
+		}
+	}
+
+	// Try to extract JSON from the text response
+	jsonStart := strings.Index(responseText, "{")
+	jsonEnd := strings.LastIndex(responseText, "}") + 1
+	if jsonStart < 0 || jsonStart >= jsonEnd {
+		return nil, fmt.Errorf("%w: no JSON object found", ErrInvalidResponse)
+	}
+
+	data := []byte(responseText[jsonStart:jsonEnd])
+	if len(fieldAlternatives) > 0 {
+		remapped, err := remapFields(data, fieldAlternatives)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to parse JSON: %v", ErrInvalidResponse, err)
+		}
+		data = remapped
+	}
+
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("%w: failed to parse JSON: %v", ErrInvalidResponse, err)
+	}
+
+	return &response, nil
+}
+
+// remapFields rewrites a JSON object so that each response field missing
+// from it takes the value of its first alternative key that is present
+func remapFields(data []byte, fieldAlternatives map[string][]string) ([]byte, error) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, err
+	}
+
+	for _, field := range responseFields {
+		if hasKey(object, field) {
+			continue
+		}
+		for _, alternative := range fieldAlternatives[field] {
+			if value, ok := lookupKey(object, alternative); ok {
+				object[field] = value
+				break
+			}
+		}
+	}
+
+	return json.Marshal(object)
+}
+
+// hasKey returns whether a JSON object has a key, ignoring case as
+// encoding/json does
+func hasKey(object map[string]json.RawMessage, key string) bool {
+	_, ok := lookupKey(object, key)
+	return ok
+}
+
+// lookupKey returns the value of a key in a JSON object, ignoring case
+func lookupKey(object map[string]json.RawMessage, key string) (json.RawMessage, bool) {
+	if value, ok := object[key]; ok {
+		return value, true
+	}
+	for k, value := range object {
+		if strings.EqualFold(k, key) {
+			return value, true
+		}
+	}
+	return nil, false
+}
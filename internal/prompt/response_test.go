@@ -0,0 +1,95 @@
+package prompt
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/mikey/llm-spam-filter/internal/config"
+)
+
+func TestParseResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+	}{
+		{"plain JSON", `{"is_spam": true, "score": 0.9, "confidence": 0.8, "explanation": "Phishing"}`},
+		{"surrounded by prose", "Here is my verdict:\n```json\n{\"is_spam\": true, \"score\": 0.9, \"confidence\": 0.8, \"explanation\": \"Phishing\"}\n```"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := ParseResponse(tt.response)
+			if err != nil {
+				t.Fatalf("ParseResponse() error = %v", err)
+			}
+			if !response.IsSpam || response.Score != 0.9 || response.Confidence != 0.8 || response.Explanation != "Phishing" {
+				t.Errorf("response = %+v, want the spam verdict", response)
+			}
+		})
+	}
+
+	if _, err := ParseResponse("I think this is spam."); !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("ParseResponse() of prose error = %v, want ErrInvalidResponse", err)
+	}
+}
+
+func TestParseResponseAlternativeFields(t *testing.T) {
+	v := config.NewEmptyViper()
+	v.Set("llm.response_fields", map[string][]string{
+		"is_spam":     {"spam", "verdict"},
+		"score":       {"spam_probability"},
+		"explanation": {"reason"},
+	})
+	builder := newTestBuilder(OptionsFromConfig(config.NewFromViper(v), 0))
+
+	response, err := builder.ParseResponse(`Verdict: {"Verdict": true, "spam_probability": 0.85, "confidence": 0.7, "reason": "Fake invoice"}`)
+	if err != nil {
+		t.Fatalf("ParseResponse() error = %v", err)
+	}
+	if !response.IsSpam || response.Score != 0.85 || response.Confidence != 0.7 || response.Explanation != "Fake invoice" {
+		t.Errorf("response = %+v, want the verdict read from the alternative keys", response)
+	}
+
+	// The standard key wins over an alternative
+	response, err = builder.ParseResponse(`{"is_spam": false, "spam": true, "score": 0.1, "reason": "Newsletter"}`)
+	if err != nil {
+		t.Fatalf("ParseResponse() error = %v", err)
+	}
+	if response.IsSpam {
+		t.Errorf("response = %+v, want is_spam taken over the alternative", response)
+	}
+}
+
+func TestLabelOnlyParsesBooleanResponse(t *testing.T) {
+	builder := newTestBuilder(Options{LabelOnly: true, LabelOnlyConfidence: 0.75})
+
+	tests := []struct {
+		response string
+		isSpam   bool
+		score    float64
+	}{
+		{`{"is_spam": true, "explanation": "Fake invoice"}`, true, 1.0},
+		{`{"is_spam": false, "explanation": "Meeting reminder"}`, false, 0.0},
+		// A score from a model that ignores the instructions is overridden
+		{`{"is_spam": false, "score": 0.6, "confidence": 0.2, "explanation": "Unsure"}`, false, 0.0},
+	}
+	for _, tt := range tests {
+		response, err := builder.ParseResponse(tt.response)
+		if err != nil {
+			t.Fatalf("ParseResponse(%s) error = %v", tt.response, err)
+		}
+		if response.IsSpam != tt.isSpam || response.Score != tt.score || response.Confidence != 0.75 {
+			t.Errorf("ParseResponse(%s) = %+v, want is_spam=%t score=%v confidence=0.75", tt.response, response, tt.isSpam, tt.score)
+		}
+	}
+}
+
+func TestLabelOnlyPromptAsksForLabel(t *testing.T) {
+	prompt := newTestBuilder(Options{LabelOnly: true}).Build(testEmail())
+	if !strings.Contains(prompt, "- is_spam:") || strings.Contains(prompt, "- score:") || strings.Contains(prompt, "- confidence:") {
+		t.Errorf("prompt = %q, want only is_spam and explanation asked for", prompt)
+	}
+	if reformat := newTestBuilder(Options{LabelOnly: true}).ReformatPrompt(); strings.Contains(reformat, "score") {
+		t.Errorf("ReformatPrompt() = %q, want no score asked for", reformat)
+	}
+}
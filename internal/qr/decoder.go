@@ -0,0 +1,60 @@
+// Package qr decodes QR codes in images embedded in email, using the
+// gozxing port of ZXing and bounding the size of the images it decodes.
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/qrcode"
+
+	// Register the image formats commonly embedded in email
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// MaxPixels is the largest image, in pixels, that will be decoded
+const MaxPixels = 2_000_000
+
+// ErrNotFound is returned when an image does not contain a readable QR code
+var ErrNotFound = errors.New("no QR code found")
+
+// DecodeBytes decodes a QR code in an encoded PNG, JPEG or GIF image,
+// refusing images larger than MaxPixels before decoding them
+func DecodeBytes(data []byte) (string, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("failed to read image: %w", err)
+	}
+	if cfg.Width*cfg.Height > MaxPixels {
+		return "", fmt.Errorf("image of %dx%d pixels is too large", cfg.Width, cfg.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode image: %w", err)
+	}
+	return Decode(img)
+}
+
+// Decode finds and decodes a QR code in an image
+func Decode(img image.Image) (string, error) {
+	bounds := img.Bounds()
+	if bounds.Dx()*bounds.Dy() > MaxPixels {
+		return "", fmt.Errorf("image of %dx%d pixels is too large", bounds.Dx(), bounds.Dy())
+	}
+
+	bitmap, err := gozxing.NewBinaryBitmapFromImage(img)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrNotFound, err)
+	}
+	result, err := qrcode.NewQRCodeReader().Decode(bitmap, nil)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrNotFound, err)
+	}
+	return result.GetText(), nil
+}
@@ -0,0 +1,111 @@
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/qrcode"
+)
+
+// fixtureLink is the text encoded in testdata/link.png, a version 2 code
+const fixtureLink = "https://phish.example/login"
+
+func readFixture(t *testing.T) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/link.png")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	return data
+}
+
+// rotate returns img turned a quarter turn clockwise
+func rotate(img image.Image) image.Image {
+	b := img.Bounds()
+	rotated := image.NewGray(image.Rect(0, 0, b.Dy(), b.Dx()))
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			rotated.Set(b.Max.Y-1-y, x-b.Min.X, img.At(x, y))
+		}
+	}
+	return rotated
+}
+
+func TestDecodeBytesFixture(t *testing.T) {
+	text, err := DecodeBytes(readFixture(t))
+	if err != nil {
+		t.Fatalf("DecodeBytes() error = %v", err)
+	}
+	if text != fixtureLink {
+		t.Errorf("DecodeBytes() = %q, want %q", text, fixtureLink)
+	}
+}
+
+func TestDecodeRotatedCode(t *testing.T) {
+	img, err := png.Decode(bytes.NewReader(readFixture(t)))
+	if err != nil {
+		t.Fatalf("failed to decode fixture: %v", err)
+	}
+	for turns := 1; turns <= 3; turns++ {
+		img = rotate(img)
+		text, err := Decode(img)
+		if err != nil || text != fixtureLink {
+			t.Errorf("Decode() after %d quarter turns = %q, %v, want %q", turns, text, err, fixtureLink)
+		}
+	}
+}
+
+// encode returns an image of a QR code of text, size pixels square
+func encode(t *testing.T, text string, size int) image.Image {
+	t.Helper()
+	matrix, err := qrcode.NewQRCodeWriter().EncodeWithoutHint(text, gozxing.BarcodeFormat_QR_CODE, size, size)
+	if err != nil {
+		t.Fatalf("failed to encode QR code: %v", err)
+	}
+	img := image.NewGray(image.Rect(0, 0, matrix.GetWidth(), matrix.GetHeight()))
+	for y := 0; y < matrix.GetHeight(); y++ {
+		for x := 0; x < matrix.GetWidth(); x++ {
+			if !matrix.Get(x, y) {
+				img.SetGray(x, y, color.Gray{Y: 255})
+			}
+		}
+	}
+	return img
+}
+
+func TestDecodeLargeVersionCode(t *testing.T) {
+	link := "https://phish.example/login?session=" + strings.Repeat("a1b2c3d4", 40)
+	text, err := Decode(encode(t, link, 600))
+	if err != nil || text != link {
+		t.Errorf("Decode() = %.40q, %v, want the long link", text, err)
+	}
+}
+
+func TestDecodeWithoutCode(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 100, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 100; x++ {
+			img.SetGray(x, y, color.Gray{Y: uint8((x * y) % 256)})
+		}
+	}
+	if _, err := Decode(img); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Decode() error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestDecodeRefusesLargeImages(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 2000, 1001))); err != nil {
+		t.Fatalf("failed to encode image: %v", err)
+	}
+	if _, err := DecodeBytes(buf.Bytes()); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("DecodeBytes() error = %v, want the image refused as too large", err)
+	}
+}
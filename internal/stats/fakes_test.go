@@ -0,0 +1,25 @@
+package stats
+
+import (
+	"time"
+
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"go.uber.org/zap"
+)
+
+// newService creates a spam filter service without caching that records
+// its scores with recorder
+func newService(llm core.LLMClient, recorder core.ScoreRecorder) *core.SpamFilterService {
+	return core.NewSpamFilterService(llm, nil, zap.NewNop(), false, time.Hour, 0.7, nil, recorder, nil, core.ServiceOptions{})
+}
+
+// testEmail returns a plain email from sender with the given subject
+func testEmail(sender, subject string) *core.Email {
+	return &core.Email{
+		From:    sender,
+		To:      []string{"user@example.org"},
+		Subject: subject,
+		Body:    "Just checking in about the meeting next week.",
+		Headers: map[string][]string{},
+	}
+}
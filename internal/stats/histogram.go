@@ -0,0 +1,106 @@
+package stats
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// histogramBuckets is the number of equal-width score buckets between 0 and 1
+const histogramBuckets = 10
+
+// ScoreHistogram accumulates spam scores and periodically logs a bucketed
+// histogram of the scores seen since the last flush
+type ScoreHistogram struct {
+	mu          sync.Mutex
+	counts      [histogramBuckets]int
+	total       int
+	logger      *zap.Logger
+	logInterval time.Duration
+	stopCh      chan struct{}
+}
+
+// NewScoreHistogram creates a new score histogram that logs every logInterval
+func NewScoreHistogram(logger *zap.Logger, logInterval time.Duration) *ScoreHistogram {
+	h := &ScoreHistogram{
+		logger:      logger,
+		logInterval: logInterval,
+		stopCh:      make(chan struct{}),
+	}
+
+	// Start background logging
+	go h.startLoggingTask()
+
+	return h
+}
+
+// Record adds a score to the histogram
+func (h *ScoreHistogram) Record(score float64) {
+	bucket := int(score * histogramBuckets)
+	if bucket < 0 {
+		bucket = 0
+	}
+	if bucket >= histogramBuckets {
+		bucket = histogramBuckets - 1
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.counts[bucket]++
+	h.total++
+}
+
+// Flush returns the number of recorded scores and the bucket counts, and
+// resets the histogram
+func (h *ScoreHistogram) Flush() (int, []int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	counts := make([]int, histogramBuckets)
+	copy(counts, h.counts[:])
+	total := h.total
+
+	h.counts = [histogramBuckets]int{}
+	h.total = 0
+
+	return total, counts
+}
+
+// logAndReset logs the current histogram and resets it
+func (h *ScoreHistogram) logAndReset() {
+	total, counts := h.Flush()
+
+	fields := []zap.Field{
+		zap.Int("analyses", total),
+		zap.Duration("interval", h.logInterval),
+	}
+	for i, count := range counts {
+		label := fmt.Sprintf("score_%.1f-%.1f", float64(i)/histogramBuckets, float64(i+1)/histogramBuckets)
+		fields = append(fields, zap.Int(label, count))
+	}
+
+	h.logger.Info("Spam score histogram", fields...)
+}
+
+// startLoggingTask starts a background task to log the histogram
+func (h *ScoreHistogram) startLoggingTask() {
+	ticker := time.NewTicker(h.logInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			h.logAndReset()
+		case <-h.stopCh:
+			return
+		}
+	}
+}
+
+// Stop stops the background logging task
+func (h *ScoreHistogram) Stop() {
+	close(h.stopCh)
+}
@@ -0,0 +1,63 @@
+package stats
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mikey/llm-spam-filter/internal/core"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// scoreLLM is an LLMClient scoring each email by its subject
+type scoreLLM struct {
+	scores map[string]float64
+}
+
+func (c *scoreLLM) AnalyzeEmail(ctx context.Context, email *core.Email) (*core.SpamAnalysisResult, error) {
+	score := c.scores[email.Subject]
+	return &core.SpamAnalysisResult{IsSpam: score >= 0.7, Score: score, AnalyzedAt: time.Now()}, nil
+}
+
+func TestScoreHistogramCountsProcessedEmails(t *testing.T) {
+	observed, logs := observer.New(zap.InfoLevel)
+	histogram := NewScoreHistogram(zap.New(observed), time.Hour)
+	defer histogram.Stop()
+
+	scores := []float64{0.0, 0.05, 0.35, 0.5, 0.99, 1.0}
+	llm := &scoreLLM{scores: make(map[string]float64)}
+	service := newService(llm, histogram)
+	for i, score := range scores {
+		subject := fmt.Sprintf("Message %d", i)
+		llm.scores[subject] = score
+		if _, err := service.AnalyzeEmail(context.Background(), testEmail(fmt.Sprintf("sender%d@example.com", i), subject)); err != nil {
+			t.Fatalf("AnalyzeEmail() error = %v", err)
+		}
+	}
+
+	histogram.logAndReset()
+	entries := logs.FilterMessage("Spam score histogram").All()
+	if len(entries) != 1 {
+		t.Fatalf("got %d histogram logs, want 1", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	want := map[string]int64{
+		"analyses":      6,
+		"score_0.0-0.1": 2,
+		"score_0.3-0.4": 1,
+		"score_0.5-0.6": 1,
+		"score_0.9-1.0": 2,
+		"score_0.1-0.2": 0,
+	}
+	for field, count := range want {
+		if fields[field] != count {
+			t.Errorf("%s = %v, want %d", field, fields[field], count)
+		}
+	}
+
+	if total, _ := histogram.Flush(); total != 0 {
+		t.Errorf("histogram holds %d scores after logging, want it reset", total)
+	}
+}
@@ -0,0 +1,153 @@
+package stats
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// maxLatencySamples bounds the samples kept per provider; the oldest are
+// dropped first
+const maxLatencySamples = 10000
+
+// latencySample is a recorded call latency
+type latencySample struct {
+	at      time.Time
+	latency time.Duration
+}
+
+// LatencyPercentiles summarizes the latencies of a provider's calls
+type LatencyPercentiles struct {
+	Count int
+	P50   time.Duration
+	P95   time.Duration
+	P99   time.Duration
+}
+
+// LatencyTracker keeps a sliding window of call latencies per provider and
+// periodically logs their percentiles
+type LatencyTracker struct {
+	mu          sync.Mutex
+	samples     map[string][]latencySample
+	window      time.Duration
+	logger      *zap.Logger
+	logInterval time.Duration
+	stopCh      chan struct{}
+}
+
+// NewLatencyTracker creates a new latency tracker over the given window
+// that logs every logInterval
+func NewLatencyTracker(logger *zap.Logger, window, logInterval time.Duration) *LatencyTracker {
+	t := &LatencyTracker{
+		samples:     make(map[string][]latencySample),
+		window:      window,
+		logger:      logger,
+		logInterval: logInterval,
+		stopCh:      make(chan struct{}),
+	}
+
+	// Start background logging
+	go t.startLoggingTask()
+
+	return t
+}
+
+// Record adds a call latency for a provider
+func (t *LatencyTracker) Record(provider string, latency time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	samples := append(t.samples[provider], latencySample{at: time.Now(), latency: latency})
+	if len(samples) > maxLatencySamples {
+		samples = samples[len(samples)-maxLatencySamples:]
+	}
+	t.samples[provider] = samples
+}
+
+// Percentiles returns the latency percentiles of each provider's calls
+// within the window, dropping older samples
+func (t *LatencyTracker) Percentiles() map[string]LatencyPercentiles {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	cutoff := time.Now().Add(-t.window)
+	percentiles := make(map[string]LatencyPercentiles)
+	for provider, samples := range t.samples {
+		// Samples are in time order, so the expired ones are at the start
+		start := sort.Search(len(samples), func(i int) bool {
+			return samples[i].at.After(cutoff)
+		})
+		samples = samples[start:]
+		t.samples[provider] = samples
+		if len(samples) == 0 {
+			delete(t.samples, provider)
+			continue
+		}
+
+		latencies := make([]time.Duration, len(samples))
+		for i, sample := range samples {
+			latencies[i] = sample.latency
+		}
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		percentiles[provider] = LatencyPercentiles{
+			Count: len(latencies),
+			P50:   Percentile(latencies, 50),
+			P95:   Percentile(latencies, 95),
+			P99:   Percentile(latencies, 99),
+		}
+	}
+	return percentiles
+}
+
+// Percentile returns the p-th percentile (0-100) of sorted latencies using
+// the nearest-rank method, or 0 if there are none
+func Percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+// logPercentiles logs the current latency percentiles of each provider
+func (t *LatencyTracker) logPercentiles() {
+	for provider, p := range t.Percentiles() {
+		t.logger.Info("Provider latency",
+			zap.String("provider", provider),
+			zap.Int("calls", p.Count),
+			zap.Duration("window", t.window),
+			zap.Duration("p50", p.P50),
+			zap.Duration("p95", p.P95),
+			zap.Duration("p99", p.P99))
+	}
+}
+
+// startLoggingTask starts a background task to log the percentiles
+func (t *LatencyTracker) startLoggingTask() {
+	ticker := time.NewTicker(t.logInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			t.logPercentiles()
+		case <-t.stopCh:
+			return
+		}
+	}
+}
+
+// Stop stops the background logging task
+func (t *LatencyTracker) Stop() {
+	close(t.stopCh)
+}
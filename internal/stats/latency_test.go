@@ -0,0 +1,108 @@
+package stats
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// within returns whether got is within tolerance of want
+func within(got, want, tolerance time.Duration) bool {
+	return got >= want-tolerance && got <= want+tolerance
+}
+
+func TestLatencyPercentiles(t *testing.T) {
+	tracker := NewLatencyTracker(zap.NewNop(), time.Hour, time.Hour)
+	defer tracker.Stop()
+
+	// 1ms to 1000ms in random order, and a constant latency for another
+	// provider
+	for _, i := range rand.Perm(1000) {
+		tracker.Record("openai", time.Duration(i+1)*time.Millisecond)
+		tracker.Record("gemini", 200*time.Millisecond)
+	}
+
+	percentiles := tracker.Percentiles()
+	openai := percentiles["openai"]
+	if openai.Count != 1000 {
+		t.Errorf("openai count = %d, want 1000", openai.Count)
+	}
+	for _, tt := range []struct {
+		name      string
+		got, want time.Duration
+	}{
+		{"p50", openai.P50, 500 * time.Millisecond},
+		{"p95", openai.P95, 950 * time.Millisecond},
+		{"p99", openai.P99, 990 * time.Millisecond},
+	} {
+		if !within(tt.got, tt.want, 10*time.Millisecond) {
+			t.Errorf("openai %s = %v, want about %v", tt.name, tt.got, tt.want)
+		}
+	}
+
+	gemini := percentiles["gemini"]
+	if gemini.P50 != 200*time.Millisecond || gemini.P95 != 200*time.Millisecond {
+		t.Errorf("gemini = %+v, want every percentile at 200ms", gemini)
+	}
+}
+
+func TestLatencyWindowDropsOldSamples(t *testing.T) {
+	tracker := NewLatencyTracker(zap.NewNop(), 50*time.Millisecond, time.Hour)
+	defer tracker.Stop()
+
+	tracker.Record("openai", 5*time.Second)
+	time.Sleep(100 * time.Millisecond)
+	tracker.Record("openai", 100*time.Millisecond)
+
+	p := tracker.Percentiles()["openai"]
+	if p.Count != 1 || p.P99 != 100*time.Millisecond {
+		t.Errorf("percentiles = %+v, want only the recent 100ms sample", p)
+	}
+}
+
+func TestLatencyPercentilesAreLogged(t *testing.T) {
+	observed, logs := observer.New(zap.InfoLevel)
+	tracker := NewLatencyTracker(zap.New(observed), time.Hour, time.Hour)
+	defer tracker.Stop()
+
+	tracker.Record("bedrock", 300*time.Millisecond)
+	tracker.logPercentiles()
+
+	entries := logs.FilterMessage("Provider latency").All()
+	if len(entries) != 1 {
+		t.Fatalf("got %d latency logs, want 1", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	if fields["provider"] != "bedrock" || fields["p50"] != 300*time.Millisecond {
+		t.Errorf("fields = %v, want bedrock's p50 of 300ms", fields)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	latencies := make([]time.Duration, 0, 100)
+	for i := 1; i <= 100; i++ {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+
+	tests := []struct {
+		p    float64
+		want time.Duration
+	}{
+		{50, 50 * time.Millisecond},
+		{95, 95 * time.Millisecond},
+		{99, 99 * time.Millisecond},
+		{100, 100 * time.Millisecond},
+		{0, 1 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := Percentile(latencies, tt.p); got != tt.want {
+			t.Errorf("Percentile(%v) = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+	if got := Percentile(nil, 50); got != 0 {
+		t.Errorf("Percentile() of no latencies = %v, want 0", got)
+	}
+}
@@ -0,0 +1,82 @@
+package stats
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// StatsDClient sends analysis scores and provider latencies to a StatsD
+// server over UDP, in place of logging them
+type StatsDClient struct {
+	conn   net.Conn
+	prefix string
+	logger *zap.Logger
+}
+
+// NewStatsDClient creates a client sending metrics named with the given
+// prefix to the StatsD server at address
+func NewStatsDClient(address, prefix string, logger *zap.Logger) (*StatsDClient, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to StatsD at %s: %w", address, err)
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, ".") {
+		prefix += "."
+	}
+	return &StatsDClient{
+		conn:   conn,
+		prefix: prefix,
+		logger: logger,
+	}, nil
+}
+
+// Record counts an analysis and sends its score as a histogram sample
+func (c *StatsDClient) Record(score float64) {
+	c.send(
+		fmt.Sprintf("%sanalyses:1|c", c.prefix),
+		fmt.Sprintf("%sscore:%.4f|h", c.prefix, score),
+	)
+}
+
+// RecordLatency counts a call to a provider and sends its latency as a
+// timer
+func (c *StatsDClient) RecordLatency(provider string, latency time.Duration) {
+	name := metricName(provider)
+	c.send(
+		fmt.Sprintf("%sprovider.%s.calls:1|c", c.prefix, name),
+		fmt.Sprintf("%sprovider.%s.latency:%d|ms", c.prefix, name, latency.Milliseconds()),
+	)
+}
+
+// send writes metric lines in one packet. Failures are only logged, since
+// metrics must never hold up mail.
+func (c *StatsDClient) send(lines ...string) {
+	if _, err := c.conn.Write([]byte(strings.Join(lines, "\n"))); err != nil {
+		c.logger.Debug("Failed to send StatsD metrics", zap.Error(err))
+	}
+}
+
+// metricName replaces the characters StatsD gives meaning to in a name
+func metricName(name string) string {
+	return strings.NewReplacer(":", "_", "|", "_", "@", "_", " ", "_", "\n", "_").Replace(name)
+}
+
+// Close closes the connection
+func (c *StatsDClient) Close() error {
+	return c.conn.Close()
+}
+
+// StatsDLatencyRecorder adapts a StatsDClient to record provider
+// latencies
+type StatsDLatencyRecorder struct {
+	*StatsDClient
+}
+
+// Record sends the latency of a call to a provider
+func (r StatsDLatencyRecorder) Record(provider string, latency time.Duration) {
+	r.RecordLatency(provider, latency)
+}
@@ -0,0 +1,74 @@
+package stats
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// listenStatsD starts a UDP listener standing in for a StatsD server,
+// closed with the test
+func listenStatsD(t *testing.T) net.PacketConn {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// readStatsD returns the metric lines of the next packet conn receives
+func readStatsD(t *testing.T, conn net.PacketConn) []string {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 1500)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("no StatsD packet received: %v", err)
+	}
+	return strings.Split(string(buf[:n]), "\n")
+}
+
+func TestStatsDReceivesAnalysisMetrics(t *testing.T) {
+	server := listenStatsD(t)
+	client, err := NewStatsDClient(server.LocalAddr().String(), "spamfilter", zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewStatsDClient() error = %v", err)
+	}
+	defer client.Close()
+
+	llm := &scoreLLM{scores: map[string]float64{"You have won": 0.95}}
+	service := newService(llm, client)
+	if _, err := service.AnalyzeEmail(context.Background(), testEmail("sender@example.com", "You have won")); err != nil {
+		t.Fatalf("AnalyzeEmail() error = %v", err)
+	}
+	lines := readStatsD(t, server)
+	if want := []string{"spamfilter.analyses:1|c", "spamfilter.score:0.9500|h"}; strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("StatsD lines = %q, want %q", lines, want)
+	}
+
+	StatsDLatencyRecorder{client}.Record("openai:gpt-4o mini", 250*time.Millisecond)
+	lines = readStatsD(t, server)
+	if want := []string{"spamfilter.provider.openai_gpt-4o_mini.calls:1|c", "spamfilter.provider.openai_gpt-4o_mini.latency:250|ms"}; strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("StatsD lines = %q, want %q", lines, want)
+	}
+}
+
+func TestStatsDWithoutPrefix(t *testing.T) {
+	server := listenStatsD(t)
+	client, err := NewStatsDClient(server.LocalAddr().String(), "", zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewStatsDClient() error = %v", err)
+	}
+	defer client.Close()
+
+	client.Record(0.1)
+	if lines := readStatsD(t, server); lines[0] != "analyses:1|c" {
+		t.Errorf("StatsD lines = %q, want unprefixed names", lines)
+	}
+}
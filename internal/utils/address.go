@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"net/mail"
+	"strings"
+)
+
+// ParseAddressList returns the bare addresses in an address header such as
+// To or Cc. Groups are expanded, so "undisclosed-recipients:;" yields no
+// addresses. Headers that don't parse are split on commas instead.
+func ParseAddressList(header string) []string {
+	if strings.TrimSpace(header) == "" {
+		return nil
+	}
+
+	list, err := mail.ParseAddressList(header)
+	if err != nil {
+		var addresses []string
+		for _, part := range strings.Split(header, ",") {
+			part = strings.TrimSpace(part)
+			// Skip group names and empty groups
+			if part != "" && !strings.HasSuffix(part, ":;") {
+				addresses = append(addresses, part)
+			}
+		}
+		return addresses
+	}
+
+	addresses := make([]string, 0, len(list))
+	for _, address := range list {
+		addresses = append(addresses, address.Address)
+	}
+	return addresses
+}
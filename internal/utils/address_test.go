@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseAddressList(t *testing.T) {
+	tests := []struct {
+		header string
+		want   []string
+	}{
+		{"", nil},
+		{"undisclosed-recipients:;", []string{}},
+		{"Alice <alice@example.com>, bob@example.org", []string{"alice@example.com", "bob@example.org"}},
+		{"friends: alice@example.com, bob@example.org;", []string{"alice@example.com", "bob@example.org"}},
+		{"alice@example.com, not an address", []string{"alice@example.com", "not an address"}},
+		{"undisclosed-recipients:;, not an address", []string{"not an address"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			if got := ParseAddressList(tt.header); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseAddressList(%q) = %q, want %q", tt.header, got, tt.want)
+			}
+		})
+	}
+}
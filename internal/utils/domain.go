@@ -0,0 +1,20 @@
+package utils
+
+import (
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// RegistrableDomain returns the registrable domain (eTLD+1) of a host using
+// the public suffix list, e.g. foo.bbc.co.uk becomes bbc.co.uk. Hosts that
+// have no registrable domain, such as public suffixes themselves, are
+// returned lowercased and unchanged.
+func RegistrableDomain(host string) string {
+	host = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return domain
+}
@@ -0,0 +1,20 @@
+package utils
+
+import "testing"
+
+func TestRegistrableDomain(t *testing.T) {
+	tests := map[string]string{
+		"foo.bbc.co.uk":      "bbc.co.uk",
+		"bbc.co.uk":          "bbc.co.uk",
+		"Mail.Example.COM.":  "example.com",
+		"a.b.c.example.com":  "example.com",
+		"user.github.io":     "user.github.io",
+		"co.uk":              "co.uk",
+		" news.example.org ": "example.org",
+	}
+	for host, want := range tests {
+		if got := RegistrableDomain(host); got != want {
+			t.Errorf("RegistrableDomain(%q) = %q, want %q", host, got, want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/idna"
+)
+
+// latinLookalikes are Cyrillic and Greek letters that render like Latin
+// letters, the raw material of homograph domains such as xn--80ak6aa92e.com
+// (аррӏе.com in Cyrillic)
+const latinLookalikes = "аеорсухіјѕԁԛԝһӏԍοαιυνκρτχϲ"
+
+// NormalizeDomain returns a domain lowercased and in its ASCII (punycode)
+// form, so that Unicode and xn-- spellings of an internationalized domain
+// compare equal. Domains that aren't valid IDNs are only lowercased.
+func NormalizeDomain(domain string) string {
+	domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	ascii, err := idna.Lookup.ToASCII(domain)
+	if err != nil {
+		return domain
+	}
+	return ascii
+}
+
+// HomographDomain reports whether an internationalized domain looks like
+// an attempt to pass as a Latin one, returning its Unicode form. A label is
+// suspicious if it mixes Latin letters with Cyrillic or Greek ones, or is
+// spelled entirely with Cyrillic or Greek letters that look Latin.
+func HomographDomain(domain string) (string, bool) {
+	unicodeDomain, err := idna.Lookup.ToUnicode(NormalizeDomain(domain))
+	if err != nil {
+		return "", false
+	}
+	for _, label := range strings.Split(unicodeDomain, ".") {
+		if homographLabel(label) {
+			return unicodeDomain, true
+		}
+	}
+	return unicodeDomain, false
+}
+
+// homographLabel reports whether a domain label is a likely homograph
+func homographLabel(label string) bool {
+	var latin, foreign, lookalike int
+	for _, r := range label {
+		switch {
+		case unicode.In(r, unicode.Cyrillic, unicode.Greek):
+			foreign++
+			if strings.ContainsRune(latinLookalikes, r) {
+				lookalike++
+			}
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		}
+	}
+	if foreign == 0 {
+		return false
+	}
+	return latin > 0 || lookalike == foreign
+}
@@ -0,0 +1,36 @@
+package utils
+
+import "testing"
+
+func TestNormalizeDomain(t *testing.T) {
+	tests := map[string]string{
+		"bücher.de":         "xn--bcher-kva.de",
+		"BÜCHER.de.":        "xn--bcher-kva.de",
+		"xn--bcher-kva.de":  "xn--bcher-kva.de",
+		" Example.COM ":     "example.com",
+		"not a domain!.com": "not a domain!.com",
+	}
+	for domain, want := range tests {
+		if got := NormalizeDomain(domain); got != want {
+			t.Errorf("NormalizeDomain(%q) = %q, want %q", domain, got, want)
+		}
+	}
+}
+
+func TestHomographDomain(t *testing.T) {
+	tests := []struct {
+		domain     string
+		suspicious bool
+	}{
+		{"xn--80ak6aa92e.com", true}, // аррӏе.com in Cyrillic
+		{"pаypal.com", true},         // Cyrillic а among Latin letters
+		{"bücher.de", false},
+		{"яндекс.рф", false},
+		{"example.com", false},
+	}
+	for _, tt := range tests {
+		if _, suspicious := HomographDomain(tt.domain); suspicious != tt.suspicious {
+			t.Errorf("HomographDomain(%q) = %t, want %t", tt.domain, suspicious, tt.suspicious)
+		}
+	}
+}
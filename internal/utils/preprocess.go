@@ -0,0 +1,148 @@
+package utils
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// TextStep is a body preprocessing step
+type TextStep func(text string) string
+
+// Preprocessing step names, as listed in spam.preprocess_steps
+const (
+	StepStripHTML           = "strip_html"
+	StepStripQuotes         = "strip_quotes"
+	StepNormalizeWhitespace = "normalize_whitespace"
+	StepDedupeLines         = "dedupe_lines"
+)
+
+// textSteps maps step names to their implementations
+var textSteps = map[string]TextStep{
+	StepStripHTML:           StripHTML,
+	StepStripQuotes:         StripQuotes,
+	StepNormalizeWhitespace: NormalizeWhitespace,
+	StepDedupeLines:         DedupeLines,
+}
+
+var (
+	// htmlHiddenPattern matches elements whose content is not shown
+	htmlHiddenPattern = regexp.MustCompile(`(?is)<(script|style|head)\b.*?</(script|style|head)\s*>`)
+
+	// htmlBreakPattern matches tags that end a line of text
+	htmlBreakPattern = regexp.MustCompile(`(?i)<(br|/p|/div|/tr|/li|/h[1-6])\b[^>]*>`)
+
+	// htmlTagPattern matches any other tag or comment
+	htmlTagPattern = regexp.MustCompile(`(?s)<!--.*?-->|<[^>]*>`)
+
+	// replyHeaderPattern matches the line introducing a quoted reply, e.g.
+	// "On Mon, 1 Jan 2024, Bob <bob@example.com> wrote:"
+	replyHeaderPattern = regexp.MustCompile(`(?i)^on\s.+\swrote:\s*$`)
+
+	// horizontalSpacePattern matches runs of spaces and tabs
+	horizontalSpacePattern = regexp.MustCompile(`[ \t\f\v\x{00a0}]+`)
+
+	// blankLinesPattern matches more than one blank line
+	blankLinesPattern = regexp.MustCompile(`\n{3,}`)
+)
+
+// TextPipeline returns the preprocessing steps with the given names, in
+// order, or an error naming an unknown step
+func TextPipeline(names []string) ([]TextStep, error) {
+	steps := make([]TextStep, 0, len(names))
+	for _, name := range names {
+		step, ok := textSteps[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("unknown preprocessing step %q, expected %s, %s, %s or %s", name,
+				StepStripHTML, StepStripQuotes, StepNormalizeWhitespace, StepDedupeLines)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// StripHTML removes HTML tags, comments, scripts and styles, keeping line
+// breaks and decoding entities
+func StripHTML(text string) string {
+	text = htmlHiddenPattern.ReplaceAllString(text, "")
+	text = htmlBreakPattern.ReplaceAllString(text, "\n")
+	text = htmlTagPattern.ReplaceAllString(text, "")
+	return html.UnescapeString(text)
+}
+
+// StripQuotes removes quoted lines of earlier messages in a reply, along
+// with the line introducing them, and anything after an "Original Message"
+// separator
+func StripQuotes(text string) string {
+	lines := strings.Split(text, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if isOriginalMessage(trimmed) {
+			break
+		}
+		if isQuoteLine(trimmed) {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return strings.Join(kept, "\n")
+}
+
+// SplitNewest splits a reply into the newest text, before the first quoted
+// line, reply header or "Original Message" separator, and the quoted
+// history from there on. The history is empty if nothing is quoted.
+func SplitNewest(text string) (newest, history string) {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if isOriginalMessage(trimmed) || isQuoteLine(trimmed) {
+			return strings.Join(lines[:i], "\n"), strings.Join(lines[i:], "\n")
+		}
+	}
+	return text, ""
+}
+
+// isQuoteLine returns whether a trimmed line quotes an earlier message or
+// introduces a quote
+func isQuoteLine(trimmed string) bool {
+	return strings.HasPrefix(trimmed, ">") || replyHeaderPattern.MatchString(trimmed)
+}
+
+// isOriginalMessage returns whether a trimmed line separates a reply from
+// the original message
+func isOriginalMessage(trimmed string) bool {
+	return strings.Contains(strings.ToLower(trimmed), "-----original message-----")
+}
+
+// NormalizeWhitespace collapses runs of spaces and tabs, trims each line
+// and allows at most one blank line in a row
+func NormalizeWhitespace(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(horizontalSpacePattern.ReplaceAllString(line, " "))
+	}
+	text = strings.Join(lines, "\n")
+	return strings.TrimSpace(blankLinesPattern.ReplaceAllString(text, "\n\n"))
+}
+
+// DedupeLines removes repeated lines, keeping the first occurrence of each.
+// Blank lines are kept.
+func DedupeLines(text string) string {
+	seen := make(map[string]bool)
+	lines := strings.Split(text, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		key := strings.TrimSpace(line)
+		if key != "" {
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		kept = append(kept, line)
+	}
+	return strings.Join(kept, "\n")
+}
@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestTextPipelineAppliesStepsInOrder(t *testing.T) {
+	const body = "<p>Buy  now</p><p>Buy now</p><p>&gt; earlier   reply</p>"
+
+	tests := []struct {
+		name  string
+		steps []string
+		want  string
+	}{
+		{
+			name:  "all steps",
+			steps: []string{StepStripHTML, StepStripQuotes, StepNormalizeWhitespace, StepDedupeLines},
+			want:  "Buy now",
+		},
+		{
+			name:  "dedupe before normalizing",
+			steps: []string{StepStripHTML, StepStripQuotes, StepDedupeLines, StepNormalizeWhitespace},
+			want:  "Buy now\nBuy now",
+		},
+		{
+			name:  "quotes before html",
+			steps: []string{StepStripQuotes, StepStripHTML, StepNormalizeWhitespace, StepDedupeLines},
+			want:  "Buy now\n> earlier reply",
+		},
+		{
+			name:  "no steps",
+			steps: nil,
+			want:  body,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipeline, err := TextPipeline(tt.steps)
+			if err != nil {
+				t.Fatalf("TextPipeline() error = %v", err)
+			}
+			if got := NewTextProcessor(zap.NewNop(), pipeline...).Preprocess(body); got != tt.want {
+				t.Errorf("Preprocess() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTextPipelineRejectsUnknownStep(t *testing.T) {
+	if _, err := TextPipeline([]string{StepStripHTML, "translate"}); err == nil {
+		t.Error("TextPipeline() error = nil, want an error for the unknown step")
+	}
+	if _, err := TextPipeline([]string{" Strip_HTML "}); err != nil {
+		t.Errorf("TextPipeline() error = %v, want step names matched case-insensitively", err)
+	}
+}
+
+func TestSplitNewest(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		newest  string
+		history string
+	}{
+		{"quoted reply", "Sounds good.\n> Lunch at noon?", "Sounds good.", "> Lunch at noon?"},
+		{"reply header", "Sounds good.\nOn Mon, 1 Jan 2024, Bob wrote:\n> Lunch?", "Sounds good.", "On Mon, 1 Jan 2024, Bob wrote:\n> Lunch?"},
+		{"original message", "Sounds good.\n-----Original Message-----\nLunch?", "Sounds good.", "-----Original Message-----\nLunch?"},
+		{"nothing quoted", "Sounds good.\nSee you then.", "Sounds good.\nSee you then.", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newest, history := SplitNewest(tt.text)
+			if newest != tt.newest || history != tt.history {
+				t.Errorf("SplitNewest() = %q, %q, want %q, %q", newest, history, tt.newest, tt.history)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"sort"
 	"unicode/utf8"
 
 	"go.uber.org/zap"
@@ -8,16 +9,27 @@ import (
 
 // TextProcessor provides utilities for processing text
 type TextProcessor struct {
-	logger *zap.Logger
+	logger   *zap.Logger
+	pipeline []TextStep
 }
 
-// NewTextProcessor creates a new TextProcessor
-func NewTextProcessor(logger *zap.Logger) *TextProcessor {
+// NewTextProcessor creates a new TextProcessor that applies the given
+// preprocessing steps, in order, in Preprocess
+func NewTextProcessor(logger *zap.Logger, pipeline ...TextStep) *TextProcessor {
 	return &TextProcessor{
-		logger: logger,
+		logger:   logger,
+		pipeline: pipeline,
 	}
 }
 
+// Preprocess applies the preprocessing steps to text in order
+func (tp *TextProcessor) Preprocess(text string) string {
+	for _, step := range tp.pipeline {
+		text = step(text)
+	}
+	return text
+}
+
 // TruncateText safely truncates text to the specified maximum size
 // and ensures the result is valid UTF-8
 func (tp *TextProcessor) TruncateText(text string, maxSize int) string {
@@ -79,3 +91,97 @@ func (tp *TextProcessor) ProcessText(text string, maxSize int) string {
 	
 	return sanitized
 }
+
+// EstimateTokens gives a rough estimate of the number of tokens in text.
+// Latin text averages around four characters per token, while CJK and
+// similar scripts tend to use at least one token per character.
+func EstimateTokens(text string) int {
+	tokens := 0
+	otherChars := 0
+	for _, r := range text {
+		if isWideRune(r) {
+			tokens++
+		} else {
+			otherChars++
+		}
+	}
+	return tokens + (otherChars+3)/4
+}
+
+// isWideRune reports whether r belongs to a script that typically costs a
+// token per character (CJK, Hangul, Kana and similar)
+func isWideRune(r rune) bool {
+	return r >= 0x2E80
+}
+
+// TruncateToTokens truncates text so that its estimated token count does not
+// exceed maxTokens
+func (tp *TextProcessor) TruncateToTokens(text string, maxTokens int) string {
+	if maxTokens <= 0 {
+		return ""
+	}
+	if EstimateTokens(text) <= maxTokens {
+		return text
+	}
+
+	tokens := 0
+	otherChars := 0
+	for i, r := range text {
+		if isWideRune(r) {
+			tokens++
+		} else {
+			otherChars++
+		}
+		if tokens+(otherChars+3)/4 > maxTokens {
+			tp.logger.Debug("Text truncated to token budget",
+				zap.Int("original_size", len(text)),
+				zap.Int("truncated_size", i),
+				zap.Int("max_tokens", maxTokens))
+			return text[:i]
+		}
+	}
+
+	return text
+}
+
+// Tokenizer counts the tokens a model would use for text
+type Tokenizer interface {
+	CountTokens(text string) int
+}
+
+// HeuristicTokenizer counts tokens with EstimateTokens, for models whose
+// tokenizer is not available
+type HeuristicTokenizer struct{}
+
+// CountTokens returns the estimated number of tokens in text
+func (HeuristicTokenizer) CountTokens(text string) int {
+	return EstimateTokens(text)
+}
+
+// TruncateTokens truncates text to at most maxTokens as counted by the
+// tokenizer, cutting on a character boundary, and marks the truncation
+func (tp *TextProcessor) TruncateTokens(text string, maxTokens int, tokenizer Tokenizer) string {
+	if maxTokens <= 0 || tokenizer.CountTokens(text) <= maxTokens {
+		return text
+	}
+
+	// Find the longest prefix within the budget, cutting between runes
+	offsets := make([]int, 0, len(text))
+	for i := range text {
+		offsets = append(offsets, i)
+	}
+	cut := sort.Search(len(offsets), func(i int) bool {
+		return tokenizer.CountTokens(text[:offsets[i]]) > maxTokens
+	}) - 1
+	truncated := ""
+	if cut >= 0 {
+		truncated = text[:offsets[cut]]
+	}
+
+	tp.logger.Debug("Text truncated to token limit",
+		zap.Int("original_size", len(text)),
+		zap.Int("truncated_size", len(truncated)),
+		zap.Int("max_tokens", maxTokens))
+
+	return truncated + "\n[... Content truncated due to size limits ...]"
+}
@@ -3,21 +3,33 @@ package whitelist
 import (
 	"strings"
 
+	"github.com/mikey/llm-spam-filter/internal/utils"
 	"go.uber.org/zap"
 )
 
 // Checker provides functionality to check if email domains are whitelisted
 type Checker struct {
-	domains []string
-	logger  *zap.Logger
+	domains         []string
+	usePublicSuffix bool
+	normalizeIDN    bool
+	logger          *zap.Logger
 }
 
-// NewChecker creates a new whitelist checker
-func NewChecker(domains []string, logger *zap.Logger) *Checker {
+// NewChecker creates a new whitelist checker. With usePublicSuffix, domains
+// are compared by registrable domain, so whitelisting bbc.co.uk also covers
+// news.bbc.co.uk. With normalizeIDN, internationalized domains are compared
+// in their punycode form, so bücher.de and xn--bcher-kva.de match.
+func NewChecker(domains []string, usePublicSuffix bool, normalizeIDN bool, logger *zap.Logger) *Checker {
 	// Normalize domains (lowercase)
 	normalizedDomains := make([]string, len(domains))
 	for i, domain := range domains {
 		normalizedDomains[i] = strings.ToLower(strings.TrimSpace(domain))
+		if normalizeIDN {
+			normalizedDomains[i] = utils.NormalizeDomain(normalizedDomains[i])
+		}
+		if usePublicSuffix {
+			normalizedDomains[i] = utils.RegistrableDomain(normalizedDomains[i])
+		}
 	}
 
 	if len(normalizedDomains) > 0 && logger != nil {
@@ -25,8 +37,10 @@ func NewChecker(domains []string, logger *zap.Logger) *Checker {
 	}
 
 	return &Checker{
-		domains: normalizedDomains,
-		logger:  logger,
+		domains:         normalizedDomains,
+		usePublicSuffix: usePublicSuffix,
+		normalizeIDN:    normalizeIDN,
+		logger:          logger,
 	}
 }
 
@@ -42,6 +56,12 @@ func (c *Checker) IsWhitelisted(from string) bool {
 		return false
 	}
 	domain := strings.ToLower(parts[1])
+	if c.normalizeIDN {
+		domain = utils.NormalizeDomain(domain)
+	}
+	if c.usePublicSuffix {
+		domain = utils.RegistrableDomain(domain)
+	}
 
 	// Check if domain is in whitelist
 	for _, whitelisted := range c.domains {
@@ -0,0 +1,51 @@
+package whitelist
+
+import "testing"
+
+func TestIsWhitelisted(t *testing.T) {
+	checker := NewChecker([]string{" BBC.co.uk "}, false, false, nil)
+
+	if !checker.IsWhitelisted("editor@bbc.co.uk") {
+		t.Error("whitelisted domain was not matched")
+	}
+	if checker.IsWhitelisted("editor@foo.bbc.co.uk") {
+		t.Error("subdomain was matched without public suffix matching")
+	}
+	if checker.IsWhitelisted("not-an-address") {
+		t.Error("address without a domain was matched")
+	}
+}
+
+func TestIsWhitelistedByPublicSuffix(t *testing.T) {
+	checker := NewChecker([]string{"news.bbc.co.uk"}, true, false, nil)
+
+	for _, from := range []string{"editor@foo.bbc.co.uk", "editor@bbc.co.uk"} {
+		if !checker.IsWhitelisted(from) {
+			t.Errorf("IsWhitelisted(%q) = false, want a match on bbc.co.uk", from)
+		}
+	}
+	if checker.IsWhitelisted("editor@itv.co.uk") {
+		t.Error("another domain under the same public suffix was matched")
+	}
+}
+
+func TestIsWhitelistedNormalizesIDN(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry string
+		from  string
+	}{
+		{"unicode sender, punycode entry", "xn--bcher-kva.de", "info@bücher.de"},
+		{"punycode sender, unicode entry", "Bücher.de", "info@xn--bcher-kva.de"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !NewChecker([]string{tt.entry}, false, true, nil).IsWhitelisted(tt.from) {
+				t.Errorf("IsWhitelisted(%q) = false, want a match on %q", tt.from, tt.entry)
+			}
+			if NewChecker([]string{tt.entry}, false, false, nil).IsWhitelisted(tt.from) {
+				t.Errorf("IsWhitelisted(%q) = true without IDN normalization", tt.from)
+			}
+		})
+	}
+}